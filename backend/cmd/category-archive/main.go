@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/config"
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+const usage = `用法:
+  category-archive export -id <节点ID> [-o 输出文件] [-versions]
+  category-archive import -file <归档文件> [-parent <父节点ID>]`
+
+func main() {
+	// 加载环境变量
+	if err := godotenv.Load(".env"); err != nil {
+		_ = godotenv.Load("../../.env")
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+	ndr := ndrclient.NewClient(ndrclient.NDRConfig{
+		BaseURL: cfg.NDR.BaseURL,
+		APIKey:  cfg.NDR.APIKey,
+		Debug:   cfg.Debug.Traffic,
+	})
+	svc := service.NewService(cache.NewNoop(), ndr, nil)
+	meta := service.RequestMeta{
+		APIKey:   cfg.NDR.APIKey,
+		UserID:   cfg.Auth.DefaultUserID,
+		AdminKey: cfg.Auth.AdminKey,
+	}
+
+	ctx := context.Background()
+	switch os.Args[1] {
+	case "export":
+		runExport(ctx, svc, meta, os.Args[2:])
+	case "import":
+		runImport(ctx, svc, meta, os.Args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func runExport(ctx context.Context, svc *service.Service, meta service.RequestMeta, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	id := fs.Int64("id", 0, "要导出的分类节点 ID")
+	output := fs.String("o", "", "输出文件路径（默认 category-<id>.zip）")
+	versions := fs.Bool("versions", false, "是否包含完整版本历史")
+	_ = fs.Parse(args)
+
+	if *id <= 0 {
+		log.Fatal("-id is required")
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("category-%d.zip", *id)
+	}
+
+	var buf bytes.Buffer
+	manifest, err := svc.ExportCategory(ctx, meta, *id, service.CategoryExportOptions{IncludeVersions: *versions}, &buf)
+	if err != nil {
+		log.Fatalf("Failed to export category: %v", err)
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0o644); err != nil {
+		log.Fatalf("Failed to write archive: %v", err)
+	}
+	log.Printf("Exported %d nodes and %d documents to %s", len(manifest.Nodes), len(manifest.Documents), *output)
+}
+
+func runImport(ctx context.Context, svc *service.Service, meta service.RequestMeta, args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "", "要导入的归档文件")
+	parent := fs.Int64("parent", 0, "目标父节点 ID（默认导入到根层级）")
+	_ = fs.Parse(args)
+
+	if *file == "" {
+		log.Fatal("-file is required")
+	}
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		log.Fatalf("Failed to read archive: %v", err)
+	}
+
+	var parentID *int64
+	if *parent > 0 {
+		parentID = parent
+	}
+	result, err := svc.ImportCategoryArchive(ctx, meta, bytes.NewReader(data), int64(len(data)), parentID)
+	if err != nil {
+		log.Fatalf("Failed to import archive: %v", err)
+	}
+
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(out))
+}
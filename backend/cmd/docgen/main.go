@@ -52,6 +52,7 @@ type themeDefinition struct {
 	Label       string
 	Description string
 	CSSPath     string
+	CSS         string
 }
 
 type hookSpec struct {
@@ -191,7 +192,8 @@ func resolveThemeDefinitions(spec typeSpec, docTypesDir string) ([]themeDefiniti
 		if err != nil {
 			return nil, fmt.Errorf("resolve theme path for %s: %w", spec.ID, err)
 		}
-		if _, err := os.Stat(absPath); err != nil {
+		cssBytes, err := os.ReadFile(absPath)
+		if err != nil {
 			return nil, fmt.Errorf("theme file for %s (theme %s) not found: %w", spec.ID, theme.ID, err)
 		}
 
@@ -200,6 +202,7 @@ func resolveThemeDefinitions(spec typeSpec, docTypesDir string) ([]themeDefiniti
 			Label:       theme.Label,
 			Description: theme.Description,
 			CSSPath:     absPath,
+			CSS:         string(cssBytes),
 		})
 	}
 	return out, nil
@@ -232,6 +235,24 @@ func generateBackend(defs []documentTypeDefinition, dest string) error {
 		buf.WriteString(fmt.Sprintf("\t\t\tLabel: %s,\n", quoteGoString(def.Label)))
 		buf.WriteString(fmt.Sprintf("\t\t\tContentFormat: %s,\n", formatConst))
 		buf.WriteString(fmt.Sprintf("\t\t\tTemplatePath: %s,\n", quoteGoString(path)))
+		if len(def.Themes) > 0 {
+			buf.WriteString("\t\t\tThemes: []DocumentTypeTheme{\n")
+			for _, theme := range def.Themes {
+				label := theme.Label
+				if label == "" {
+					label = theme.ID
+				}
+				buf.WriteString("\t\t\t\t{\n")
+				buf.WriteString(fmt.Sprintf("\t\t\t\t\tID: %s,\n", quoteGoString(theme.ID)))
+				buf.WriteString(fmt.Sprintf("\t\t\t\t\tLabel: %s,\n", quoteGoString(label)))
+				if theme.Description != "" {
+					buf.WriteString(fmt.Sprintf("\t\t\t\t\tDescription: %s,\n", quoteGoString(theme.Description)))
+				}
+				buf.WriteString(fmt.Sprintf("\t\t\t\t\tCSS: %s,\n", quoteGoString(theme.CSS)))
+				buf.WriteString("\t\t\t\t},\n")
+			}
+			buf.WriteString("\t\t\t},\n")
+		}
 		buf.WriteString("\t\t},\n")
 	}
 	buf.WriteString("\t}\n")
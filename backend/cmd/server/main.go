@@ -20,6 +20,7 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/joho/godotenv"
 	"github.com/yjxt/ydms/backend/internal/api"
+	"github.com/yjxt/ydms/backend/internal/auth"
 	"github.com/yjxt/ydms/backend/internal/cache"
 	"github.com/yjxt/ydms/backend/internal/config"
 	"github.com/yjxt/ydms/backend/internal/database"
@@ -81,6 +82,37 @@ func runServer() error {
 		jwtExpiry = 24 * time.Hour
 	}
 
+	// 解析 API Key 轮换宽限期
+	rotationGrace, err := time.ParseDuration(cfg.APIKeys.RotationGrace)
+	if err != nil {
+		log.Printf("warning: invalid API key rotation grace '%s', using default 24h", cfg.APIKeys.RotationGrace)
+		rotationGrace = 24 * time.Hour
+	}
+
+	// 密码策略与登录锁定策略
+	passwordPolicy := service.DefaultPasswordPolicy()
+	passwordPolicy.MinLength = cfg.Password.MinLength
+	passwordPolicy.MinClasses = cfg.Password.MinClasses
+	passwordPolicy.HistorySize = cfg.Password.HistorySize
+	if cfg.Password.DenyListFile != "" {
+		if err := passwordPolicy.LoadPasswordDenyList(cfg.Password.DenyListFile); err != nil {
+			return fmt.Errorf("failed to load password deny-list: %w", err)
+		}
+	}
+	lockoutPolicy := service.DefaultLockoutPolicy()
+	lockoutPolicy.MaxUserFailures = cfg.Lockout.MaxUserFailures
+	lockoutPolicy.MaxIPFailures = cfg.Lockout.MaxIPFailures
+	if window, err := time.ParseDuration(cfg.Lockout.Window); err == nil && window > 0 {
+		lockoutPolicy.Window = window
+	} else {
+		log.Printf("warning: invalid login failure window '%s', using default %s", cfg.Lockout.Window, lockoutPolicy.Window)
+	}
+	if duration, err := time.ParseDuration(cfg.Lockout.Duration); err == nil && duration > 0 {
+		lockoutPolicy.Duration = duration
+	} else {
+		log.Printf("warning: invalid login lockout duration '%s', using default %s", cfg.Lockout.Duration, lockoutPolicy.Duration)
+	}
+
 	// 创建服务
 	cacheProvider := cache.NewNoop()
 	ndr := ndrclient.NewClient(ndrclient.NDRConfig{
@@ -90,13 +122,26 @@ func runServer() error {
 	})
 
 	// 创建认证相关服务
-	userService := service.NewUserService(db)
+	userService := service.NewUserServiceWithPolicies(db, passwordPolicy, lockoutPolicy)
+	twoFactorPolicy := service.TwoFactorPolicy{Issuer: "YDMS"}
+	if cfg.Auth.Require2FA {
+		twoFactorPolicy.RequiredRoles = []string{"super_admin", "course_admin"}
+	}
+	userService.SetTwoFactorPolicy(twoFactorPolicy)
 	svc := service.NewService(cacheProvider, ndr, userService)
 	courseService := service.NewCourseService(db, ndr, userService)
+	// 分类树快照：本进程的节点变更立即失效，其他来源的变更最多延迟 TTL
+	if ttl, err := time.ParseDuration(cfg.Category.TreeTTL); err == nil && ttl >= 0 {
+		svc.SetCategoryTreeTTL(ttl)
+	} else {
+		log.Printf("warning: invalid category tree ttl '%s', using default %s", cfg.Category.TreeTTL, service.DefaultCategoryTreeTTL)
+	}
+	courseService.SetTreeInvalidator(svc.InvalidateCategoryTree)
 	permissionService := service.NewPermissionService(db, userService, ndr)
 
 	// 创建服务层
-	apiKeyService := service.NewAPIKeyService(db)
+	apiKeyService := service.NewAPIKeyService(db, rotationGrace)
+	paperService := service.NewPaperService(db, svc)
 
 	// 创建 handlers
 	handler := api.NewHandler(svc, permissionService, api.HeaderDefaults{
@@ -106,18 +151,137 @@ func runServer() error {
 	})
 	authHandler := api.NewAuthHandler(userService, cfg.JWT.Secret, jwtExpiry)
 	userHandler := api.NewUserHandler(userService)
+	userHandler.SetCourseService(courseService)
 	courseHandler := api.NewCourseHandler(courseService)
 	apiKeyHandler := api.NewAPIKeyHandler(apiKeyService)
+	paperHandler := api.NewPaperHandler(handler, paperService)
+
+	// 后台任务：大批量操作异步执行，进程重启后继续未完成的任务
+	jobOptions := service.DefaultJobOptions()
+	jobOptions.Workers = cfg.Jobs.Workers
+	if lease, err := time.ParseDuration(cfg.Jobs.Lease); err == nil && lease > 0 {
+		jobOptions.Lease = lease
+	} else {
+		log.Printf("warning: invalid job lease '%s', using default %s", cfg.Jobs.Lease, jobOptions.Lease)
+	}
+	// 后台执行（任务、崩溃恢复）访问 NDR 使用的服务端凭据
+	backgroundMeta := service.RequestMeta{
+		APIKey:   cfg.NDR.APIKey,
+		UserID:   cfg.Auth.DefaultUserID,
+		AdminKey: cfg.Auth.AdminKey,
+	}
+	jobService := service.NewJobService(db, jobOptions)
+	jobService.SetCredentials(backgroundMeta)
+	svc.RegisterCategoryJobs(jobService)
+	handler.SetJobService(jobService, cfg.Jobs.AsyncThreshold)
+	jobHandler := api.NewJobHandler(jobService)
+
+	// 批量分类操作的补偿日志：崩溃后由恢复流程完成或回滚未结束的操作
+	svc.SetSagaJournal(service.NewSagaJournal(db, service.DefaultSagaStaleAfter))
+	sagaHandler := api.NewSagaHandler(handler)
+
+	// 文档编辑锁：锁定期间其他用户（超级管理员除外）的修改返回 423
+	svc.SetDocumentLocks(service.NewDocumentLocks(db))
+
+	// 文档审核流程：审核通过或已发布的文档只有课程管理员可以修改
+	svc.SetReviewWorkflow(service.NewReviewWorkflow(db))
+
+	// 文档评论：讨论串可锚定到 YAML 字段或 Markdown 文本范围，新评论以 document.commented 事件通知
+	svc.SetDocumentComments(service.NewDocumentComments(db))
+
+	// 课程标签词表：保存文档时标签按同义词归一化，改名与合并以后台任务同步到课程中的文档
+	svc.SetTagRegistry(service.NewTagRegistry(db))
+	svc.RegisterTagJobs(jobService)
+
+	// 变更事件推送：分类与文档变更通过 /api/v1/events 实时通知同一课程的其他编辑者
+	eventBroker := service.NewEventBroker(service.DefaultEventBufferSize)
+	svc.SetEventBroker(eventBroker)
+	eventHandler := api.NewEventHandler(handler)
+
+	// webhook：变更事件写入投递队列，由后台 worker 签名后推送给订阅方，失败按退避重试
+	webhookOptions := service.DefaultWebhookOptions()
+	webhookOptions.MaxAttempts = cfg.Webhooks.MaxAttempts
+	webhookOptions.AllowPrivateTargets = cfg.Webhooks.AllowPrivateTargets
+	if timeout, err := time.ParseDuration(cfg.Webhooks.Timeout); err == nil && timeout > 0 {
+		webhookOptions.Timeout = timeout
+	} else {
+		log.Printf("warning: invalid webhook timeout '%s', using default %s", cfg.Webhooks.Timeout, webhookOptions.Timeout)
+	}
+	webhookService := service.NewWebhookService(db, webhookOptions)
+	eventBroker.AddHook(webhookService.HandleEvent)
+	webhookHandler := api.NewWebhookHandler(webhookService)
+
+	// 认证请求限流（API Key 可单独配置限额）
+	rateLimiter := auth.NewRateLimiter(
+		auth.RateLimit{PerMinute: cfg.Limits.APIKeyPerMinute, Burst: cfg.Limits.APIKeyBurst},
+		auth.RateLimit{PerMinute: cfg.Limits.UserPerMinute, Burst: cfg.Limits.UserBurst},
+	)
+
+	// API Key 使用记录后台批量写入
+	usageFlush, err := time.ParseDuration(cfg.APIKeys.UsageFlush)
+	if err != nil || usageFlush <= 0 {
+		log.Printf("warning: invalid API key usage flush interval '%s', using default 5s", cfg.APIKeys.UsageFlush)
+		usageFlush = 5 * time.Second
+	}
+	usageRecorder := auth.NewUsageRecorder(db, usageFlush)
+	handler.SetUsageRecorder(usageRecorder)
+
+	// 可信反向代理（生产环境中的 nginx）
+	trustedProxies, err := auth.ParseCIDRs(cfg.Auth.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid YDMS_TRUSTED_PROXIES: %w", err)
+	}
+	authHandler.SetTrustedProxies(trustedProxies)
+
+	// 单点登录（OIDC）
+	if cfg.OIDC.Enabled() {
+		if cfg.OIDC.RedirectURL == "" {
+			return errors.New("YDMS_OIDC_REDIRECT_URL is required when single sign-on is enabled")
+		}
+		authHandler.SetOIDC(api.OIDCSettings{
+			Provider: auth.NewOIDCProvider(auth.OIDCConfig{
+				Issuer:       cfg.OIDC.Issuer,
+				ClientID:     cfg.OIDC.ClientID,
+				ClientSecret: cfg.OIDC.ClientSecret,
+				RedirectURL:  cfg.OIDC.RedirectURL,
+				Scopes:       cfg.OIDC.Scopes,
+			}, nil),
+			Provisioning: service.OIDCProvisioning{
+				UsernameClaim: cfg.OIDC.UsernameClaim,
+				LinkExisting:  cfg.OIDC.LinkExisting,
+				AutoProvision: cfg.OIDC.AutoProvision,
+				DefaultRole:   cfg.OIDC.DefaultRole,
+			},
+			PostLoginRedirect: cfg.OIDC.PostLoginRedirect,
+			SecureCookie:      strings.HasPrefix(cfg.OIDC.RedirectURL, "https://"),
+		})
+		log.Printf("single sign-on enabled: issuer=%s", cfg.OIDC.Issuer)
+	}
+	if !cfg.Auth.PasswordLogin {
+		if !cfg.OIDC.Enabled() {
+			log.Printf("warning: YDMS_PASSWORD_LOGIN_ENABLED=false without single sign-on, keeping password login enabled")
+		} else {
+			authHandler.SetPasswordLoginEnabled(false)
+		}
+	}
 
 	// 创建路由器（使用新的配置方式）
 	router := api.NewRouterWithConfig(api.RouterConfig{
-		Handler:       handler,
-		AuthHandler:   authHandler,
-		UserHandler:   userHandler,
-		CourseHandler: courseHandler,
-		APIKeyHandler: apiKeyHandler,
-		JWTSecret:     cfg.JWT.Secret,
-		DB:            db, // 传递 DB 用于 API Key 验证
+		Handler:        handler,
+		AuthHandler:    authHandler,
+		UserHandler:    userHandler,
+		CourseHandler:  courseHandler,
+		APIKeyHandler:  apiKeyHandler,
+		PaperHandler:   paperHandler,
+		JobHandler:     jobHandler,
+		SagaHandler:    sagaHandler,
+		EventHandler:   eventHandler,
+		WebhookHandler: webhookHandler,
+		JWTSecret:      cfg.JWT.Secret,
+		DB:             db, // 传递 DB 用于 API Key 验证
+		RateLimiter:    rateLimiter,
+		TrustedProxies: trustedProxies,
+		UsageRecorder:  usageRecorder,
 	})
 
 	server := &http.Server{
@@ -125,6 +289,14 @@ func runServer() error {
 		Handler:           router,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
+	// 优雅退出时先断开事件流长连接，否则 Shutdown 会一直等待到超时
+	server.RegisterOnShutdown(eventBroker.Close)
+
+	jobService.Start()
+	webhookService.Start()
+	recoveryCtx, stopRecovery := context.WithCancel(context.Background())
+	defer stopRecovery()
+	go svc.RunSagaRecovery(recoveryCtx, backgroundMeta, time.Minute)
 
 	go func() {
 		log.Printf("backend listening on %s", cfg.HTTPAddress())
@@ -133,7 +305,7 @@ func runServer() error {
 		}
 	}()
 
-	waitForShutdown(server)
+	waitForShutdown(server, usageRecorder, jobService, webhookService)
 	return nil
 }
 
@@ -143,7 +315,7 @@ func loadDotEnv() {
 	}
 }
 
-func waitForShutdown(server *http.Server) {
+func waitForShutdown(server *http.Server, usageRecorder *auth.UsageRecorder, jobService *service.JobService, webhookService *service.WebhookService) {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
@@ -159,6 +331,20 @@ func waitForShutdown(server *http.Server) {
 			log.Printf("forced close failed: %v", err)
 		}
 	}
+
+	// 等待执行中的任务步骤完成，未完成的任务在下次启动后继续
+	if err := jobService.Close(shutdownCtx); err != nil {
+		log.Printf("stopping background jobs failed: %v", err)
+	}
+	// 未投递的 webhook 保存在数据库中，下次启动后继续
+	if err := webhookService.Close(shutdownCtx); err != nil {
+		log.Printf("stopping webhook delivery failed: %v", err)
+	}
+
+	// 请求处理完毕后写入剩余的 API Key 使用记录
+	if err := usageRecorder.Close(shutdownCtx); err != nil {
+		log.Printf("flushing API key usage failed: %v", err)
+	}
 	log.Println("server stopped")
 }
 
@@ -3,9 +3,11 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/yjxt/ydms/backend/internal/auth"
 	"github.com/yjxt/ydms/backend/internal/database"
@@ -47,6 +49,10 @@ func (h *APIKeyHandler) APIKeyRoutes(w http.ResponseWriter, r *http.Request) {
 		h.getAPIKeyStats(w, r)
 		return
 	}
+	if relPath == "service-accounts" {
+		h.createServiceAccount(w, r)
+		return
+	}
 
 	// 解析 ID
 	parts := strings.Split(relPath, "/")
@@ -67,6 +73,10 @@ func (h *APIKeyHandler) APIKeyRoutes(w http.ResponseWriter, r *http.Request) {
 		switch action {
 		case "revoke":
 			h.revokeAPIKey(w, r, uint(id))
+		case "rotate":
+			h.rotateAPIKey(w, r, uint(id))
+		case "usage":
+			h.getAPIKeyUsage(w, r, uint(id))
 		default:
 			respondError(w, http.StatusNotFound, errors.New("unknown action"))
 		}
@@ -120,6 +130,41 @@ func (h *APIKeyHandler) createAPIKey(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusCreated, resp)
 }
 
+// createServiceAccount 创建服务账号并签发其首个 API Key
+func (h *APIKeyHandler) createServiceAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found in context"))
+		return
+	}
+
+	// 只有超级管理员可以创建服务账号
+	if currentUser.Role != "super_admin" {
+		respondError(w, http.StatusForbidden, errors.New("only super admin can create service accounts"))
+		return
+	}
+
+	var req service.CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	req.CreatedByID = currentUser.ID
+
+	resp, err := h.service.CreateServiceAccount(req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
 // listAPIKeys 列出 API Keys
 func (h *APIKeyHandler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
 	// 获取当前用户
@@ -213,18 +258,40 @@ func (h *APIKeyHandler) updateAPIKey(w http.ResponseWriter, r *http.Request, id
 
 	// 只允许更新特定字段
 	allowedFields := map[string]bool{
-		"name":       true,
-		"expires_at": true,
-		"scopes":     true,
-	}
-	for field := range updates {
+		"name":          true,
+		"expires_at":    true,
+		"scopes":        true,
+		"allowed_cidrs": true,
+	}
+	// 限额字段仅超级管理员可修改，并映射到数据库列名
+	limitColumns := map[string]string{
+		"rate_limit_per_minute": "rate_limit",
+		"rate_limit_burst":      "rate_burst",
+	}
+	columns := make(map[string]interface{}, len(updates))
+	for field, value := range updates {
+		column, isLimit := limitColumns[field]
+		if isLimit {
+			if currentUser.Role != "super_admin" {
+				respondError(w, http.StatusForbidden, errors.New("only super admin can change rate limits"))
+				return
+			}
+			limit, ok := value.(float64)
+			if !ok || limit < 0 || limit != float64(int(limit)) {
+				respondError(w, http.StatusBadRequest, errors.New("field '"+field+"' must be a non-negative integer"))
+				return
+			}
+			columns[column] = int(limit)
+			continue
+		}
 		if !allowedFields[field] {
 			respondError(w, http.StatusBadRequest, errors.New("field '"+field+"' cannot be updated"))
 			return
 		}
+		columns[field] = value
 	}
 
-	updatedKey, err := h.service.UpdateAPIKey(id, updates)
+	updatedKey, err := h.service.UpdateAPIKey(id, columns)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, err)
 		return
@@ -270,6 +337,113 @@ func (h *APIKeyHandler) revokeAPIKey(w http.ResponseWriter, r *http.Request, id
 	})
 }
 
+// rotateAPIKey 轮换 API Key：签发新密钥，旧密钥在宽限期内继续有效
+func (h *APIKeyHandler) rotateAPIKey(w http.ResponseWriter, r *http.Request, id uint) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	// 获取当前用户
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found in context"))
+		return
+	}
+
+	// 获取现有的 API Key
+	key, err := h.service.GetAPIKey(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+
+	// 权限检查
+	if currentUser.Role != "super_admin" && key.UserID != currentUser.ID {
+		respondError(w, http.StatusForbidden, errors.New("access denied"))
+		return
+	}
+
+	// 请求体可选：{"grace_period": "48h"}，"0s" 表示旧密钥立即失效
+	var req struct {
+		GracePeriod *string `json:"grace_period"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			respondError(w, http.StatusBadRequest, errors.New("invalid request body"))
+			return
+		}
+	}
+	var grace *time.Duration
+	if req.GracePeriod != nil {
+		parsed, err := time.ParseDuration(*req.GracePeriod)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid grace_period: "+err.Error()))
+			return
+		}
+		grace = &parsed
+	}
+
+	resp, err := h.service.RotateAPIKey(id, grace)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// getAPIKeyUsage 查看 API Key 最近的请求日志
+func (h *APIKeyHandler) getAPIKeyUsage(w http.ResponseWriter, r *http.Request, id uint) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	// 获取当前用户
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found in context"))
+		return
+	}
+
+	// 获取现有的 API Key
+	key, err := h.service.GetAPIKey(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+
+	// 权限检查
+	if currentUser.Role != "super_admin" && key.UserID != currentUser.ID {
+		respondError(w, http.StatusForbidden, errors.New("access denied"))
+		return
+	}
+
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	var beforeID uint
+	if raw := query.Get("before_id"); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid before_id"))
+			return
+		}
+		beforeID = uint(parsed)
+	}
+
+	logs, err := h.service.ListAPIKeyUsage(id, limit, beforeID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"usage": logs,
+		"total": len(logs),
+	})
+}
+
 // deleteAPIKey 永久删除 API Key
 func (h *APIKeyHandler) deleteAPIKey(w http.ResponseWriter, r *http.Request, id uint) {
 	// 获取当前用户
@@ -3,7 +3,10 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/yjxt/ydms/backend/internal/auth"
@@ -13,9 +16,12 @@ import (
 
 // AuthHandler 认证相关 handler
 type AuthHandler struct {
-	userService *service.UserService
-	jwtSecret   string
-	jwtExpiry   time.Duration
+	userService           *service.UserService
+	jwtSecret             string
+	jwtExpiry             time.Duration
+	trustedProxies        []*net.IPNet
+	passwordLoginDisabled bool          // 仅允许单点登录
+	oidc                  *OIDCSettings // 为空表示未启用单点登录
 }
 
 // NewAuthHandler 创建认证 handler
@@ -27,6 +33,38 @@ func NewAuthHandler(userService *service.UserService, jwtSecret string, jwtExpir
 	}
 }
 
+// SetTrustedProxies 设置受信任的反向代理，用于解析登录请求的客户端 IP
+func (h *AuthHandler) SetTrustedProxies(trustedProxies []*net.IPNet) {
+	h.trustedProxies = trustedProxies
+}
+
+// clientIP 返回请求的客户端 IP（无法解析时为空）
+func (h *AuthHandler) clientIP(r *http.Request) string {
+	if ip := auth.ClientIP(r, h.trustedProxies); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// respondLoginError 输出登录失败响应，锁定时返回 429 并设置 Retry-After
+func respondLoginError(w http.ResponseWriter, err error) {
+	var locked *service.LoginLockedError
+	if errors.As(err, &locked) {
+		seconds := int(math.Ceil(time.Until(locked.Until).Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		respondError(w, http.StatusTooManyRequests, err)
+		return
+	}
+	if errors.Is(err, service.ErrUserDisabled) {
+		respondError(w, http.StatusForbidden, err)
+		return
+	}
+	respondError(w, http.StatusUnauthorized, err)
+}
+
 // Login 用户登录
 // POST /api/v1/auth/login
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -52,28 +90,138 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 认证用户
-	user, err := h.userService.Authenticate(req.Username, req.Password)
+	if h.passwordLoginDisabled {
+		respondError(w, http.StatusForbidden, errors.New("password login is disabled, please use single sign-on"))
+		return
+	}
+
+	// 认证用户（失败次数过多时临时锁定）
+	user, err := h.userService.Login(req.Username, req.Password, h.clientIP(r))
 	if err != nil {
-		respondError(w, http.StatusUnauthorized, err)
+		respondLoginError(w, err)
 		return
 	}
 
-	// 生成 token
-	token, err := h.userService.GenerateToken(user, h.jwtSecret, h.jwtExpiry)
+	// 使用管理员重置的临时密码登录：必须先设置新密码
+	if user.MustChangePassword {
+		resp, err := h.preAuthResult(user, auth.PurposePasswordChange)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	resp, err := h.loginResult(user)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
+// LoginChangePassword 使用临时密码登录后设置新密码，之后继续正常的登录流程
+// POST /api/v1/auth/login/change-password
+func (h *AuthHandler) LoginChangePassword(w http.ResponseWriter, r *http.Request) {
+	req, claims, ok := h.decodePreAuth(w, r, auth.PurposePasswordChange)
+	if !ok {
+		return
+	}
+	if req.NewPassword == "" {
+		respondError(w, http.StatusBadRequest, errors.New("new_password is required"))
+		return
+	}
+
+	if err := h.userService.UpdatePassword(claims.UserID, req.NewPassword); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+	if user.Disabled {
+		respondError(w, http.StatusForbidden, service.ErrUserDisabled)
+		return
+	}
+
+	resp, err := h.loginResult(user)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// loginResult 完成第一步认证后的登录结果：
+// 已启用两步验证或角色要求两步验证时返回预认证 token，否则直接签发访问 token
+func (h *AuthHandler) loginResult(user *database.User) (map[string]interface{}, error) {
+	// 已启用两步验证：先签发预认证 token，再由 /auth/login/2fa 校验验证码
+	if user.TOTPEnabled {
+		return h.preAuthResult(user, auth.PurposeMFA)
+	}
+	// 角色要求两步验证但尚未绑定：只允许完成绑定流程
+	if h.userService.TwoFactorRequired(user) {
+		return h.preAuthResult(user, auth.PurposeMFAEnroll)
+	}
+	return h.accessTokenResult(user, nil)
+}
+
+// preAuthResult 登录第二步所需的预认证 token
+func (h *AuthHandler) preAuthResult(user *database.User, purpose string) (map[string]interface{}, error) {
+	token, err := auth.GeneratePreAuthToken(user.ID, user.Username, purpose, h.jwtSecret, preAuthTokenExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := map[string]interface{}{
+		"pre_auth_token": token,
+		"expires_in":     int(preAuthTokenExpiry.Seconds()),
+	}
+	switch purpose {
+	case auth.PurposeMFAEnroll:
+		resp["mfa_enrollment_required"] = true
+	case auth.PurposePasswordChange:
+		resp["password_change_required"] = true
+	default:
+		resp["mfa_required"] = true
+	}
+	return resp, nil
+}
+
+// accessTokenResult 签发访问 token；绑定两步验证时一并返回恢复码
+func (h *AuthHandler) accessTokenResult(user *database.User, recoveryCodes []string) (map[string]interface{}, error) {
+	// 生成 token
+	token, err := h.userService.GenerateToken(user, h.jwtSecret, h.jwtExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := map[string]interface{}{
 		"token": token,
 		"user": map[string]interface{}{
 			"id":       user.ID,
 			"username": user.Username,
 			"role":     user.Role,
 		},
-	})
+	}
+	if recoveryCodes != nil {
+		resp["recovery_codes"] = recoveryCodes
+	}
+	return resp, nil
+}
+
+// respondLoginSuccess 输出访问 token
+func (h *AuthHandler) respondLoginSuccess(w http.ResponseWriter, user *database.User, recoveryCodes []string) {
+	resp, err := h.accessTokenResult(user, recoveryCodes)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 // Logout 用户登出
@@ -91,10 +239,11 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// Me 获取当前用户信息
-// GET /api/v1/auth/me
+// Me 获取或修改当前用户信息
+// GET   /api/v1/auth/me
+// PATCH /api/v1/auth/me  修改显示名称
 func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodGet && r.Method != http.MethodPatch {
 		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
 		return
 	}
@@ -106,11 +255,32 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 从数据库获取完整用户信息
-	fullUser, err := h.userService.GetUserByID(user.ID)
-	if err != nil {
-		respondError(w, http.StatusNotFound, err)
-		return
+	var fullUser *database.User
+	var err error
+	if r.Method == http.MethodPatch {
+		var req struct {
+			DisplayName *string `json:"display_name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.DisplayName == nil {
+			respondError(w, http.StatusBadRequest, errors.New("display_name is required"))
+			return
+		}
+		fullUser, err = h.userService.UpdateProfile(user.ID, *req.DisplayName)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		// 从数据库获取完整用户信息
+		fullUser, err = h.userService.GetUserByID(user.ID)
+		if err != nil {
+			respondError(w, http.StatusNotFound, err)
+			return
+		}
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
@@ -118,6 +288,7 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 		"username":     fullUser.Username,
 		"role":         fullUser.Role,
 		"display_name": fullUser.DisplayName,
+		"totp_enabled": fullUser.TOTPEnabled,
 		"created_at":   fullUser.CreatedAt,
 	})
 }
@@ -154,10 +325,13 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 验证旧密码
-	_, err := h.userService.Authenticate(user.Username, req.OldPassword)
+	// 验证旧密码（与登录共用失败计数）
+	_, err := h.userService.Login(user.Username, req.OldPassword, h.clientIP(r))
 	if err != nil {
-		respondError(w, http.StatusUnauthorized, errors.New("invalid old password"))
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			err = errors.New("invalid old password")
+		}
+		respondLoginError(w, err)
 		return
 	}
 
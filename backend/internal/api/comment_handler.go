@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+// documentCommentRoutes 处理文档评论端点
+// GET    /api/v1/documents/{id}/comments?resolved=            按讨论串列出评论，resolved=true/false 可选
+// POST   /api/v1/documents/{id}/comments                      创建评论或回复（parent_id）
+// PATCH  /api/v1/documents/{id}/comments/{cid}                修改评论正文（仅作者）
+// DELETE /api/v1/documents/{id}/comments/{cid}                删除评论（作者、课程管理员、超级管理员）
+// POST   /api/v1/documents/{id}/comments/{cid}/resolve        标记讨论串已解决
+// POST   /api/v1/documents/{id}/comments/{cid}/unresolve      重新打开讨论串
+func (h *Handler) documentCommentRoutes(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, id int64, rest []string) {
+	if len(rest) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			var resolved *bool
+			if raw := r.URL.Query().Get("resolved"); raw != "" {
+				value, err := strconv.ParseBool(raw)
+				if err != nil {
+					respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "resolved 参数无效", err.Error()))
+					return
+				}
+				resolved = &value
+			}
+			comments, err := h.service.ListDocumentComments(r.Context(), meta, id, resolved)
+			if err != nil {
+				respondCommentError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": comments})
+		case http.MethodPost:
+			var input service.DocumentCommentInput
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
+				return
+			}
+			comment, err := h.service.CreateDocumentComment(r.Context(), meta, id, input)
+			if err != nil {
+				respondCommentError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusCreated, comment)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+		return
+	}
+
+	commentID, err := strconv.ParseUint(rest[0], 10, 64)
+	if err != nil || commentID == 0 {
+		respondError(w, http.StatusBadRequest, errors.New("invalid comment id"))
+		return
+	}
+	cid := uint(commentID)
+
+	switch {
+	case len(rest) == 1 && r.Method == http.MethodPatch:
+		var req struct {
+			Body string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
+			return
+		}
+		comment, err := h.service.UpdateDocumentComment(r.Context(), meta, id, cid, req.Body)
+		if err != nil {
+			respondCommentError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, comment)
+	case len(rest) == 1 && r.Method == http.MethodDelete:
+		if err := h.service.DeleteDocumentComment(r.Context(), meta, id, cid); err != nil {
+			respondCommentError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(rest) == 2 && (rest[1] == "resolve" || rest[1] == "unresolve") && r.Method == http.MethodPost:
+		comment, err := h.service.ResolveDocumentComment(r.Context(), meta, id, cid, rest[1] == "resolve")
+		if err != nil {
+			respondCommentError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, comment)
+	case len(rest) == 1, len(rest) == 2 && (rest[1] == "resolve" || rest[1] == "unresolve"):
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func respondCommentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrDocumentCommentsDisabled):
+		respondAPIError(w, NewAPIError(ErrCodeNotFound, http.StatusNotFound, "未启用文档评论", err.Error()))
+	case errors.Is(err, service.ErrCommentNotFound):
+		respondAPIError(w, NewAPIError(ErrCodeNotFound, http.StatusNotFound, "评论不存在", err.Error()))
+	case errors.Is(err, service.ErrInvalidComment):
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "评论参数无效", err.Error()))
+	case errors.Is(err, service.ErrCommentForbidden):
+		respondAPIError(w, NewAPIError(ErrCodeForbidden, http.StatusForbidden, "无权执行该评论操作", err.Error()))
+	default:
+		respondAPIError(w, WrapUpstreamError(err))
+	}
+}
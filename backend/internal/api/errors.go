@@ -25,6 +25,9 @@ const (
 	// 资源冲突
 	ErrCodeConflict ErrorCode = "CONFLICT"
 
+	// 资源被其他用户锁定
+	ErrCodeLocked ErrorCode = "LOCKED"
+
 	// 上游服务错误
 	ErrCodeUpstream ErrorCode = "UPSTREAM_ERROR"
 
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+// defaultEventHeartbeat 心跳间隔，需小于反向代理的读超时（nginx 默认 60s）
+const defaultEventHeartbeat = 25 * time.Second
+
+// EventHandler 分类与文档变更事件推送（Server-Sent Events）
+type EventHandler struct {
+	base      *Handler
+	heartbeat time.Duration
+}
+
+// NewEventHandler 创建事件推送 handler，服务与请求元数据复用 base
+func NewEventHandler(base *Handler) *EventHandler {
+	return &EventHandler{base: base, heartbeat: defaultEventHeartbeat}
+}
+
+// Stream 处理 GET /api/v1/events
+// 断线重连时通过 Last-Event-ID 请求头（或 last_event_id 查询参数）补发缓冲区中的事件；
+// 缓冲区已无法补齐时先发送 reset 事件，客户端应重新加载目录树与文档
+func (h *EventHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	broker := h.base.service.Events()
+	if broker == nil {
+		respondError(w, http.StatusNotFound, errors.New("event stream is disabled"))
+		return
+	}
+
+	var lastEventID *uint64
+	if raw := strings.TrimSpace(headerFallback(r.Header.Get("Last-Event-ID"), r.URL.Query().Get("last_event_id"))); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid Last-Event-ID"))
+			return
+		}
+		lastEventID = &id
+	}
+
+	meta := h.base.metaFromRequest(r)
+	visible, err := h.base.service.EventFilter(meta)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	sub, replay, complete := broker.Subscribe(lastEventID)
+	defer broker.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !complete {
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", sub.LastID)
+	} else {
+		for _, event := range replay {
+			if visible(event) {
+				writeSSEEvent(w, event)
+			}
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.Printf("[events] flush failed: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// 订阅者过慢或服务关闭：断开连接，客户端重连后按 Last-Event-ID 补齐
+				return
+			}
+			if !visible(event) {
+				continue
+			}
+			writeSSEEvent(w, event)
+		case <-ticker.C:
+			// 心跳时刷新课程权限，授权变更在一个心跳周期内生效
+			if refreshed, err := h.base.service.EventFilter(meta); err == nil {
+				visible = refreshed
+			}
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeSSEEvent(w io.Writer, event service.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[events] encode event %d failed: %v", event.ID, err)
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
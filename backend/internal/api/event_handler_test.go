@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+type sseMessage struct {
+	id, event, data string
+}
+
+// readSSE 读取下一条事件，跳过 retry 与注释行
+func readSSE(t *testing.T, r *bufio.Reader) sseMessage {
+	t.Helper()
+	var msg sseMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && msg.event != "":
+			return msg
+		case strings.HasPrefix(line, "id: "):
+			msg.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			msg.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			msg.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestEventStreamReplaysAndStreams(t *testing.T) {
+	svc := service.NewService(cache.NewNoop(), newInMemoryNDR(), nil)
+	svc.SetEventBroker(service.NewEventBroker(16))
+	handler := NewHandler(svc, nil, HeaderDefaults{})
+	router := NewRouter(handler)
+	events := NewEventHandler(handler)
+	server := httptest.NewServer(loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events.Stream(w, withTestUser(r, nil))
+	})))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	connect := func(lastEventID string) *bufio.Reader {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("unexpected response %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		return bufio.NewReader(resp.Body)
+	}
+
+	root := createCategory(t, router, `{"name":"Root"}`)
+
+	// 从 0 之后重放已发生的事件，随后继续推送新事件
+	stream := connect("0")
+	msg := readSSE(t, stream)
+	var event service.Event
+	if err := json.Unmarshal([]byte(msg.data), &event); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if msg.id != "1" || msg.event != service.EventCategoryCreated || len(event.Courses) != 1 || event.Courses[0] != root.ID {
+		t.Fatalf("unexpected replayed event %+v %+v", msg, event)
+	}
+	createCategory(t, router, `{"name":"Second"}`)
+	if msg := readSSE(t, stream); msg.id != "2" || msg.event != service.EventCategoryCreated {
+		t.Fatalf("unexpected live event %+v", msg)
+	}
+
+	// 未知的事件 ID（如服务重启前）要求客户端重新加载
+	if msg := readSSE(t, connect("99")); msg.event != "reset" || msg.id != "2" {
+		t.Fatalf("expected reset event, got %+v", msg)
+	}
+}
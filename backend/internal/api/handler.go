@@ -1,13 +1,17 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/yjxt/ydms/backend/internal/auth"
 	"github.com/yjxt/ydms/backend/internal/database"
@@ -15,11 +19,17 @@ import (
 	"github.com/yjxt/ydms/backend/internal/service"
 )
 
+// maxCategoryArchiveSize limits the size of uploaded category archives.
+const maxCategoryArchiveSize = 256 << 20
+
 // Handler exposes HTTP handlers that delegate to the service layer.
 type Handler struct {
 	service           *service.Service
 	permissionService *service.PermissionService
 	defaults          HeaderDefaults
+	usageRecorder     *auth.UsageRecorder
+	jobs              *service.JobService
+	asyncThreshold    int
 }
 
 type HeaderDefaults struct {
@@ -37,9 +47,18 @@ func NewHandler(svc *service.Service, permSvc *service.PermissionService, defaul
 	}
 }
 
+// SetUsageRecorder attaches the API key usage recorder so its backlog shows up in health output.
+func (h *Handler) SetUsageRecorder(recorder *auth.UsageRecorder) {
+	h.usageRecorder = recorder
+}
+
 // Health reports basic liveness.
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	body := map[string]any{"status": "ok"}
+	if h.usageRecorder != nil {
+		body["api_key_usage_queue"] = h.usageRecorder.QueueDepth()
+	}
+	writeJSON(w, http.StatusOK, body)
 }
 
 // Ping returns a hello world message.
@@ -118,6 +137,11 @@ func (h *Handler) CategoryRoutes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if relPath == "import" {
+		h.importCategoryArchive(w, r, meta)
+		return
+	}
+
 	parts := strings.Split(relPath, "/")
 	id, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
@@ -139,6 +163,10 @@ func (h *Handler) CategoryRoutes(w http.ResponseWriter, r *http.Request) {
 		h.purgeCategory(w, r, meta, id)
 	case "reposition":
 		h.repositionCategory(w, r, meta, id)
+	case "export":
+		h.exportCategory(w, r, meta, id)
+	case "children":
+		h.listCategoryChildren(w, r, meta, id)
 	default:
 		respondError(w, http.StatusNotFound, errors.New("not found"))
 	}
@@ -174,7 +202,7 @@ func (h *Handler) Documents(w http.ResponseWriter, r *http.Request) {
 		}
 		doc, err := h.service.CreateDocument(r.Context(), meta, payload)
 		if err != nil {
-			respondAPIError(w, WrapUpstreamError(err))
+			respondAPIError(w, documentWriteError(err))
 			return
 		}
 		writeJSON(w, http.StatusCreated, doc)
@@ -196,6 +224,11 @@ func (h *Handler) DocumentRoutes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if relPath == "bulk-tag" || relPath == "bulk-untag" {
+		h.bulkTagDocuments(w, r, h.metaFromRequest(r), relPath == "bulk-untag")
+		return
+	}
+
 	if relPath == "trash" {
 		h.listDeletedDocuments(w, r, h.metaFromRequest(r))
 		return
@@ -230,6 +263,31 @@ func (h *Handler) DocumentRoutes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if parts[1] == "render" {
+		h.renderDocument(w, r, meta, id)
+		return
+	}
+
+	if parts[1] == "merge" {
+		h.mergeDocument(w, r, meta, id)
+		return
+	}
+
+	if parts[1] == "lock" {
+		h.documentLockRoutes(w, r, meta, id, parts[2:])
+		return
+	}
+
+	if parts[1] == "review" {
+		h.documentReviewRoutes(w, r, meta, id, parts[2:])
+		return
+	}
+
+	if parts[1] == "comments" {
+		h.documentCommentRoutes(w, r, meta, id, parts[2:])
+		return
+	}
+
 	// Handle reference-related routes
 	if parts[1] == "references" {
 		if len(parts) == 2 {
@@ -312,21 +370,244 @@ func (h *Handler) updateDocument(w http.ResponseWriter, r *http.Request, meta se
 		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
 		return
 	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		version, err := parseVersionETag(ifMatch)
+		if err != nil {
+			respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "If-Match 格式错误", err.Error()))
+			return
+		}
+		if version != nil {
+			payload.ExpectedVersion = version
+		}
+	}
 	doc, err := h.service.UpdateDocument(r.Context(), meta, id, payload)
 	if err != nil {
-		respondAPIError(w, WrapUpstreamError(err))
+		if respondDocumentEditRejected(w, err) {
+			return
+		}
+		var conflict *service.DocumentVersionConflictError
+		if errors.As(err, &conflict) {
+			respondVersionConflict(w, conflict, payload)
+			return
+		}
+		respondAPIError(w, documentWriteError(err))
 		return
 	}
+	setVersionETag(w, doc)
 	writeJSON(w, http.StatusOK, doc)
 }
 
+// parseVersionETag reads a version_number from an If-Match value such as `"12"`, `W/"12"` or `12`.
+// "*" matches any version and yields nil.
+func parseVersionETag(value string) (*int, error) {
+	value = strings.TrimSpace(value)
+	if value == "*" {
+		return nil, nil
+	}
+	value = strings.TrimPrefix(value, "W/")
+	value = strings.Trim(value, `"`)
+	version, err := strconv.Atoi(value)
+	if err != nil || version <= 0 {
+		return nil, fmt.Errorf("invalid version %q", value)
+	}
+	return &version, nil
+}
+
+func setVersionETag(w http.ResponseWriter, doc ndrclient.Document) {
+	if doc.Version != nil {
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, *doc.Version))
+	}
+}
+
+// respondVersionConflict returns 409 with the server copy and the rejected submission side by side.
+func respondVersionConflict(w http.ResponseWriter, conflict *service.DocumentVersionConflictError, submitted service.DocumentUpdateRequest) {
+	setVersionETag(w, conflict.Current)
+	writeJSON(w, http.StatusConflict, map[string]any{
+		"code":             ErrCodeConflict,
+		"message":          "文档已被其他人修改",
+		"details":          conflict.Error(),
+		"expected_version": conflict.Expected,
+		"current":          conflict.Current,
+		"submitted":        submitted,
+	})
+}
+
+// mergeDocument three-way merges the submitted edits with the latest version.
+func (h *Handler) mergeDocument(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, id int64) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	var payload service.DocumentMergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
+		return
+	}
+	if payload.BaseVersion <= 0 {
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "base_version 不能为空"))
+		return
+	}
+
+	result, err := h.service.MergeDocument(r.Context(), meta, id, payload)
+	switch {
+	case errors.Is(err, service.ErrMergeConflict):
+		writeJSON(w, http.StatusConflict, result)
+	case errors.Is(err, service.ErrDocumentVersionConflict):
+		// 合并期间文档又被修改，客户端需重新合并
+		respondAPIError(w, NewAPIError(ErrCodeConflict, http.StatusConflict, "合并期间文档已被修改，请重试", err.Error()))
+	case respondDocumentEditRejected(w, err):
+	case err != nil:
+		respondAPIError(w, documentWriteError(err))
+	default:
+		if result.Document != nil {
+			setVersionETag(w, *result.Document)
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// documentWriteError reports unsafe HTML as a validation error instead of an upstream failure.
+func documentWriteError(err error) *APIError {
+	if errors.Is(err, service.ErrUnsafeHTML) {
+		return ErrInvalidDocumentContent(err.Error())
+	}
+	return WrapUpstreamError(err)
+}
+
+// renderDocument returns sanitized HTML for a document; format=json returns the fragment and theme CSS separately.
+func (h *Handler) renderDocument(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, id int64) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	rendered, err := h.service.RenderDocument(r.Context(), meta, id, r.URL.Query().Get("theme"))
+	if errors.Is(err, service.ErrUnknownDocumentTheme) {
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "无效的主题", err.Error()))
+		return
+	}
+	if err != nil {
+		respondAPIError(w, WrapUpstreamError(err))
+		return
+	}
+	if r.URL.Query().Get("format") == "json" {
+		writeJSON(w, http.StatusOK, rendered)
+		return
+	}
+	page, err := rendered.StandalonePage()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, page)
+}
+
 func (h *Handler) getDocument(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, id int64) {
 	doc, err := h.service.GetDocument(r.Context(), meta, id)
 	if err != nil {
 		respondAPIError(w, WrapUpstreamError(err))
 		return
 	}
-	writeJSON(w, http.StatusOK, doc)
+	// 附带当前编辑锁的持有者，查询失败时不影响读取文档
+	lock, err := h.service.DocumentLockHolder(r.Context(), id)
+	if err != nil {
+		log.Printf("[document-locks] load lock of document %d failed: %v", id, err)
+	}
+	setVersionETag(w, doc)
+	writeJSON(w, http.StatusOK, documentWithLock{Document: doc, Lock: lock})
+}
+
+// documentWithLock 文档详情，lock 为当前有效的编辑锁（未锁定时为 null）
+type documentWithLock struct {
+	ndrclient.Document
+	Lock *database.DocumentLock `json:"lock"`
+}
+
+// documentLockRoutes 处理文档编辑锁端点
+// POST   /api/v1/documents/{id}/lock        加锁或续期（心跳）：{"ttl_seconds": 300}
+// DELETE /api/v1/documents/{id}/lock        释放自己持有的锁
+// POST   /api/v1/documents/{id}/lock/break  超级管理员强制解锁
+func (h *Handler) documentLockRoutes(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, id int64, rest []string) {
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodPost:
+		var payload struct {
+			TTLSeconds int `json:"ttl_seconds"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
+				return
+			}
+		}
+		if payload.TTLSeconds < 0 {
+			respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "ttl_seconds 不能为负数"))
+			return
+		}
+		lock, err := h.service.LockDocument(r.Context(), meta, id, time.Duration(payload.TTLSeconds)*time.Second)
+		if err != nil {
+			respondDocumentLockError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, lock)
+	case len(rest) == 0 && r.Method == http.MethodDelete:
+		if err := h.service.UnlockDocument(r.Context(), meta, id); err != nil {
+			respondDocumentLockError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(rest) == 1 && rest[0] == "break" && r.Method == http.MethodPost:
+		lock, err := h.service.BreakDocumentLock(r.Context(), meta, id)
+		if err != nil {
+			respondDocumentLockError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, lock)
+	case len(rest) == 0 || (len(rest) == 1 && rest[0] == "break"):
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func respondDocumentLockError(w http.ResponseWriter, err error) {
+	switch {
+	case respondDocumentLocked(w, err):
+	case errors.Is(err, service.ErrDocumentLockForbidden):
+		respondAPIError(w, NewAPIError(ErrCodeForbidden, http.StatusForbidden, "只有超级管理员可以强制解锁", err.Error()))
+	case errors.Is(err, service.ErrDocumentLockAnonymous):
+		respondAPIError(w, NewAPIError(ErrCodeUnauthorized, http.StatusUnauthorized, "需要登录后才能锁定文档", err.Error()))
+	case errors.Is(err, service.ErrDocumentLockNoPermission):
+		respondAPIError(w, NewAPIError(ErrCodeForbidden, http.StatusForbidden, "没有该文档所属课程的权限", err.Error()))
+	case errors.Is(err, service.ErrDocumentNotLocked), errors.Is(err, service.ErrDocumentLocksDisabled):
+		respondAPIError(w, NewAPIError(ErrCodeNotFound, http.StatusNotFound, "文档未锁定", err.Error()))
+	default:
+		respondAPIError(w, WrapUpstreamError(err))
+	}
+}
+
+// respondDocumentEditRejected 处理文档写入前的编辑限制：审核通过的文档返回 403，被他人锁定返回 423
+func respondDocumentEditRejected(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, service.ErrReviewedDocumentReadOnly) {
+		respondAPIError(w, NewAPIError(ErrCodeForbidden, http.StatusForbidden, "文档已审核通过，只有课程管理员可以修改", err.Error()))
+		return true
+	}
+	return respondDocumentLocked(w, err)
+}
+
+// respondDocumentLocked 文档被其他用户锁定时返回 423 及锁的持有者
+func respondDocumentLocked(w http.ResponseWriter, err error) bool {
+	var locked *service.DocumentLockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	writeJSON(w, http.StatusLocked, map[string]any{
+		"code":    ErrCodeLocked,
+		"message": "文档正被其他用户编辑",
+		"details": locked.Error(),
+		"lock":    locked.Lock,
+	})
+	return true
 }
 
 func (h *Handler) deleteDocument(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, id int64) {
@@ -338,6 +619,9 @@ func (h *Handler) deleteDocument(w http.ResponseWriter, r *http.Request, meta se
 	}
 
 	if err := h.service.DeleteDocument(r.Context(), meta, id); err != nil {
+		if respondDocumentEditRejected(w, err) {
+			return
+		}
 		respondAPIError(w, WrapUpstreamError(err))
 		return
 	}
@@ -351,6 +635,9 @@ func (h *Handler) restoreDocument(w http.ResponseWriter, r *http.Request, meta s
 	}
 	doc, err := h.service.RestoreDocument(r.Context(), meta, id)
 	if err != nil {
+		if respondDocumentEditRejected(w, err) {
+			return
+		}
 		respondError(w, http.StatusBadGateway, err)
 		return
 	}
@@ -363,6 +650,9 @@ func (h *Handler) purgeDocument(w http.ResponseWriter, r *http.Request, meta ser
 		return
 	}
 	if err := h.service.PurgeDocument(r.Context(), meta, id); err != nil {
+		if respondDocumentEditRejected(w, err) {
+			return
+		}
 		respondError(w, http.StatusBadGateway, err)
 		return
 	}
@@ -504,6 +794,9 @@ func (h *Handler) restoreDocumentVersion(w http.ResponseWriter, r *http.Request,
 
 	doc, err := h.service.RestoreDocumentVersion(r.Context(), meta, docID, versionNum)
 	if err != nil {
+		if respondDocumentEditRejected(w, err) {
+			return
+		}
 		respondError(w, http.StatusBadGateway, err)
 		return
 	}
@@ -539,6 +832,9 @@ func (h *Handler) addDocumentReference(w http.ResponseWriter, r *http.Request, m
 
 	doc, err := h.service.AddDocumentReference(r.Context(), meta, docID, payload.DocumentID)
 	if err != nil {
+		if respondDocumentEditRejected(w, err) {
+			return
+		}
 		respondAPIError(w, WrapUpstreamError(err))
 		return
 	}
@@ -562,6 +858,9 @@ func (h *Handler) removeDocumentReference(w http.ResponseWriter, r *http.Request
 
 	doc, err := h.service.RemoveDocumentReference(r.Context(), meta, docID, refDocID)
 	if err != nil {
+		if respondDocumentEditRejected(w, err) {
+			return
+		}
 		respondAPIError(w, WrapUpstreamError(err))
 		return
 	}
@@ -588,6 +887,48 @@ func (h *Handler) getReferencingDocuments(w http.ResponseWriter, r *http.Request
 	})
 }
 
+// PaperRoutes handles exam paper operations.
+func (h *Handler) PaperRoutes(w http.ResponseWriter, r *http.Request) {
+	relPath := strings.TrimPrefix(r.URL.Path, "/api/v1/papers/")
+	switch relPath {
+	case "render":
+		h.renderPaper(w, r, h.metaFromRequest(r))
+	default:
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// renderPaper composes an ad-hoc paper from categories or explicit documents.
+func (h *Handler) renderPaper(w http.ResponseWriter, r *http.Request, meta service.RequestMeta) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	var payload service.PaperRenderRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
+		return
+	}
+	if variant := r.URL.Query().Get("variant"); variant != "" {
+		payload.Variant = service.PaperVariant(variant)
+	}
+	if len(payload.CategoryIDs) == 0 && len(payload.DocumentIDs) == 0 {
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "category_ids 或 document_ids 不能为空"))
+		return
+	}
+	if payload.Variant != "" && payload.Variant != service.PaperVariantStudent && payload.Variant != service.PaperVariantTeacher {
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "variant 必须是 student 或 teacher"))
+		return
+	}
+
+	result, err := h.service.RenderPaper(r.Context(), meta, payload)
+	if err != nil {
+		respondAPIError(w, WrapUpstreamError(err))
+		return
+	}
+	writeRenderedPaper(w, r, result)
+}
+
 // NodeRoutes handles node-related sub-resources.
 func (h *Handler) NodeRoutes(w http.ResponseWriter, r *http.Request) {
 	relPath := strings.TrimPrefix(r.URL.Path, "/api/v1/nodes/")
@@ -637,6 +978,9 @@ func (h *Handler) NodeRoutes(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if err := h.service.BindDocument(r.Context(), meta, id, docID); err != nil {
+			if respondDocumentEditRejected(w, err) {
+				return
+			}
 			respondError(w, http.StatusBadGateway, err)
 			return
 		}
@@ -782,12 +1126,58 @@ func (h *Handler) listCategoryTree(w http.ResponseWriter, r *http.Request, meta
 		return
 	}
 	includeDeleted := r.URL.Query().Get("include_deleted") == "true"
-	tree, err := h.service.GetCategoryTree(r.Context(), meta, includeDeleted)
+	tree, err := h.service.LoadCategoryTree(r.Context(), meta, includeDeleted)
 	if err != nil {
 		respondError(w, http.StatusBadGateway, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, tree)
+	if tree.ETag != "" {
+		w.Header().Set("ETag", tree.ETag)
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), tree.ETag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, tree.Roots)
+}
+
+// etagMatches reports whether an If-None-Match list (weak comparison, "*" included) matches etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// listCategoryChildren returns the subtree below a node for lazy loading: ?depth=N (default 1).
+func (h *Handler) listCategoryChildren(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, id int64) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	depth := 1
+	if raw := r.URL.Query().Get("depth"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 || value > service.MaxCategoryChildrenDepth {
+			respondError(w, http.StatusBadRequest, fmt.Errorf("depth must be between 1 and %d", service.MaxCategoryChildrenDepth))
+			return
+		}
+		depth = value
+	}
+	children, err := h.service.GetCategoryChildren(r.Context(), meta, id, depth)
+	if err != nil {
+		if errors.Is(err, service.ErrCategoryForbidden) {
+			respondError(w, http.StatusForbidden, err)
+			return
+		}
+		respondError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, children)
 }
 
 func (h *Handler) reorderCategories(w http.ResponseWriter, r *http.Request, meta service.RequestMeta) {
@@ -897,6 +1287,15 @@ func (h *Handler) bulkPurgeCategories(w http.ResponseWriter, r *http.Request, me
 		respondError(w, http.StatusBadRequest, err)
 		return
 	}
+	if h.runAsync(r, len(payload.IDs)) {
+		job, err := h.jobs.EnqueueBulkPurgeCategories(meta, payload.IDs)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJobAccepted(w, job)
+		return
+	}
 	ids, err := h.service.BulkPurgeCategories(r.Context(), meta, payload.IDs)
 	if err != nil {
 		respondError(w, http.StatusBadGateway, err)
@@ -947,6 +1346,15 @@ func (h *Handler) bulkCopyCategories(w http.ResponseWriter, r *http.Request, met
 		respondError(w, http.StatusBadRequest, err)
 		return
 	}
+	if h.runAsync(r, len(payload.SourceIDs)) {
+		job, err := h.jobs.EnqueueBulkCopyCategories(meta, payload)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJobAccepted(w, job)
+		return
+	}
 	items, err := h.service.BulkCopyCategories(r.Context(), meta, payload)
 	if err != nil {
 		respondError(w, http.StatusBadGateway, err)
@@ -965,6 +1373,15 @@ func (h *Handler) bulkMoveCategories(w http.ResponseWriter, r *http.Request, met
 		respondError(w, http.StatusBadRequest, err)
 		return
 	}
+	if h.runAsync(r, len(payload.SourceIDs)) {
+		job, err := h.jobs.EnqueueBulkMoveCategories(meta, payload)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJobAccepted(w, job)
+		return
+	}
 	items, err := h.service.BulkMoveCategories(r.Context(), meta, payload)
 	if err != nil {
 		respondError(w, http.StatusBadGateway, err)
@@ -973,6 +1390,62 @@ func (h *Handler) bulkMoveCategories(w http.ResponseWriter, r *http.Request, met
 	writeJSON(w, http.StatusOK, map[string]any{"items": items})
 }
 
+func (h *Handler) exportCategory(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, id int64) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	opts := service.CategoryExportOptions{
+		IncludeVersions: r.URL.Query().Get("include_versions") == "true",
+	}
+	// 先写入内存，避免导出中途失败时客户端收到半个 zip
+	var buf bytes.Buffer
+	if _, err := h.service.ExportCategory(r.Context(), meta, id, opts, &buf); err != nil {
+		respondAPIError(w, WrapUpstreamError(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="category-%d.zip"`, id))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (h *Handler) importCategoryArchive(w http.ResponseWriter, r *http.Request, meta service.RequestMeta) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	// 权限检查：校对员不能导入分类
+	_, httpErr := h.requireNotProofreader(r, "import categories")
+	if httpErr != nil {
+		respondError(w, httpErr.code, httpErr.message)
+		return
+	}
+
+	var parentID *int64
+	if raw := r.URL.Query().Get("parent_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid parent_id"))
+			return
+		}
+		parentID = &id
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCategoryArchiveSize))
+	if err != nil {
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "读取导入文件失败", err.Error()))
+		return
+	}
+	result, err := h.service.ImportCategoryArchive(r.Context(), meta, bytes.NewReader(data), int64(len(data)), parentID)
+	if err != nil {
+		respondAPIError(w, WrapUpstreamError(err))
+		return
+	}
+	writeJSON(w, http.StatusCreated, result)
+}
+
 func cloneQuery(values url.Values) url.Values {
 	if values == nil {
 		return nil
@@ -1006,6 +1479,7 @@ func (h *Handler) metaFromRequest(r *http.Request) service.RequestMeta {
 	if user, ok := r.Context().Value(auth.UserContextKey).(*database.User); ok {
 		meta.UserRole = user.Role
 		meta.UserIDNumeric = user.ID
+		meta.Username = user.Username
 	}
 
 	return meta
@@ -13,6 +13,9 @@ import (
 	"testing"
 	"time"
 
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
 	"github.com/yjxt/ydms/backend/internal/auth"
 	"github.com/yjxt/ydms/backend/internal/cache"
 	"github.com/yjxt/ydms/backend/internal/database"
@@ -364,6 +367,58 @@ func TestCategoriesEndpoints_InvalidCategoryID(t *testing.T) {
 	}
 }
 
+func TestCategoryTreeConditionalGet(t *testing.T) {
+	ndr := newInMemoryNDR()
+	svc := service.NewService(cache.NewNoop(), ndr, nil)
+	handler := NewHandler(svc, nil, HeaderDefaults{})
+	router := NewRouter(handler)
+	root := createCategory(t, router, `{"name":"Root"}`)
+
+	getTree := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/categories/tree", nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := getTree("")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected tree with etag, got %d %q", first.Code, etag)
+	}
+	if rec := getTree(`"stale", W/` + etag); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("expected 304 for matching etag, got %d", rec.Code)
+	}
+
+	// 新建节点使快照失效，旧 ETag 不再匹配
+	createCategory(t, router, fmt.Sprintf(`{"name":"Child","parent_id":%d}`, root.ID))
+	rec := getTree(etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+		t.Fatalf("expected fresh tree after mutation, got %d", rec.Code)
+	}
+
+	childrenReq := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/categories/%d/children?depth=1", root.ID), nil)
+	childrenRec := httptest.NewRecorder()
+	router.ServeHTTP(childrenRec, childrenReq)
+	var children []service.Category
+	if err := json.NewDecoder(childrenRec.Body).Decode(&children); err != nil || childrenRec.Code != http.StatusOK {
+		t.Fatalf("unexpected children response %d: %v", childrenRec.Code, err)
+	}
+	if len(children) != 1 || children[0].Name != "Child" || children[0].HasChildren == nil {
+		t.Fatalf("unexpected children %+v", children)
+	}
+
+	badReq := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/categories/%d/children?depth=0", root.ID), nil)
+	badRec := httptest.NewRecorder()
+	router.ServeHTTP(badRec, badReq)
+	if badRec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid depth, got %d", badRec.Code)
+	}
+}
+
 func TestCategoriesEndpoints_MethodNotAllowed(t *testing.T) {
 	ndr := newInMemoryNDR()
 	svc := service.NewService(cache.NewNoop(), ndr, nil)
@@ -1644,6 +1699,89 @@ func TestDocumentCreationWithTypeAndPosition(t *testing.T) {
 	}
 }
 
+func TestDocumentLockEndpoints(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&database.User{}, &database.PasswordHistory{}, &database.CoursePermission{}, &database.DocumentLock{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	ndr := newInMemoryNDR()
+	userService := service.NewUserService(db)
+	svc := service.NewService(cache.NewNoop(), ndr, userService)
+	svc.SetDocumentLocks(service.NewDocumentLocks(db))
+	router := NewRouter(NewHandler(svc, nil, HeaderDefaults{}))
+
+	slug := "course"
+	course, err := ndr.CreateNode(context.Background(), ndrclient.RequestMeta{}, ndrclient.NodeCreate{Name: "Course", Slug: &slug})
+	if err != nil {
+		t.Fatalf("create node error: %v", err)
+	}
+	doc, err := ndr.CreateDocument(context.Background(), ndrclient.RequestMeta{}, ndrclient.DocumentCreate{Title: "Doc"})
+	if err != nil {
+		t.Fatalf("create document error: %v", err)
+	}
+	if err := ndr.BindDocument(context.Background(), ndrclient.RequestMeta{}, course.ID, doc.ID); err != nil {
+		t.Fatalf("bind document error: %v", err)
+	}
+	alice, _ := userService.CreateUser("alice", "Secret-pass-9", "course_admin", nil)
+	bob, _ := userService.CreateUser("bob", "Secret-pass-9", "course_admin", nil)
+	outsider, _ := userService.CreateUser("otto", "Secret-pass-9", "course_admin", nil)
+	userService.GrantCoursePermission(alice.ID, course.ID)
+	userService.GrantCoursePermission(bob.ID, course.ID)
+	do := func(method, path, body string, user *database.User) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, fmt.Sprintf("/api/v1/documents/%d%s", doc.ID, path), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, withTestUser(req, user))
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/lock", `{"ttl_seconds":60}`, outsider); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected lock without course permission to be forbidden, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/lock", `{"ttl_seconds":60}`, alice); rec.Code != http.StatusOK {
+		t.Fatalf("expected lock to succeed, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	rec := do(http.MethodPut, "", `{"title":"Bob"}`, bob)
+	var locked struct {
+		Code string                `json:"code"`
+		Lock database.DocumentLock `json:"lock"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&locked); err != nil || rec.Code != http.StatusLocked || locked.Code != string(ErrCodeLocked) || locked.Lock.HolderName != "alice" {
+		t.Fatalf("expected 423 with lock holder, got %d %+v", rec.Code, locked)
+	}
+	if rec := do(http.MethodDelete, "/purge", "", bob); rec.Code != http.StatusLocked {
+		t.Fatalf("expected purge by other user to be locked, got %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	rec = do(http.MethodGet, "", "", bob)
+	var fetched struct {
+		ID   int64                  `json:"id"`
+		Lock *database.DocumentLock `json:"lock"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&fetched); err != nil || fetched.ID != doc.ID || fetched.Lock == nil || fetched.Lock.HolderID != alice.ID {
+		t.Fatalf("expected document with lock holder, got %d %+v", rec.Code, fetched)
+	}
+
+	if rec := do(http.MethodPost, "/lock/break", "", bob); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected break lock to be forbidden, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "", `{"title":"Admin"}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected super admin to bypass the lock, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/lock/break", "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected super admin to break the lock, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPut, "", `{"title":"Bob"}`, bob); rec.Code != http.StatusOK {
+		t.Fatalf("expected update after break to succeed, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, "/lock", "", alice); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected unlock of released lock to succeed, got %d", rec.Code)
+	}
+}
+
 func TestDocumentUpdateWithTypeAndPosition(t *testing.T) {
 	ndr := newInMemoryNDR()
 	svc := service.NewService(cache.NewNoop(), ndr, nil)
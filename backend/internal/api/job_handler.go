@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+// JobHandler 后台任务查询与取消的 HTTP handler
+type JobHandler struct {
+	jobs *service.JobService
+}
+
+// NewJobHandler 创建后台任务 handler
+func NewJobHandler(jobs *service.JobService) *JobHandler {
+	return &JobHandler{jobs: jobs}
+}
+
+// JobRoutes 处理后台任务端点
+// GET  /api/v1/jobs/:id         查询状态、进度与结果
+// POST /api/v1/jobs/:id/cancel  取消任务
+// DELETE /api/v1/jobs/:id       同 cancel
+func (h *JobHandler) JobRoutes(w http.ResponseWriter, r *http.Request) {
+	relPath := strings.TrimPrefix(r.URL.Path, "/api/v1/jobs/")
+	parts := strings.Split(relPath, "/")
+	id, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("invalid job id"))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		h.getJob(w, r, uint(id))
+	case len(parts) == 1 && r.Method == http.MethodDelete,
+		len(parts) == 2 && parts[1] == "cancel" && r.Method == http.MethodPost:
+		h.cancelJob(w, r, uint(id))
+	case len(parts) <= 2:
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *JobHandler) getJob(w http.ResponseWriter, r *http.Request, id uint) {
+	job, ok := h.loadOwnJob(w, r, id)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (h *JobHandler) cancelJob(w http.ResponseWriter, r *http.Request, id uint) {
+	if _, ok := h.loadOwnJob(w, r, id); !ok {
+		return
+	}
+	job, err := h.jobs.Cancel(id)
+	if err != nil {
+		if errors.Is(err, service.ErrJobFinished) {
+			respondError(w, http.StatusConflict, err)
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// loadOwnJob 加载任务，只有发起者与超级管理员可以查看或取消
+func (h *JobHandler) loadOwnJob(w http.ResponseWriter, r *http.Request, id uint) (*service.JobDetail, bool) {
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found"))
+		return nil, false
+	}
+	job, err := h.jobs.Get(id)
+	if err != nil {
+		if errors.Is(err, service.ErrJobNotFound) {
+			respondError(w, http.StatusNotFound, err)
+			return nil, false
+		}
+		respondError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if currentUser.Role != "super_admin" && job.CreatedByID != currentUser.ID {
+		// 不暴露其他用户的任务是否存在
+		respondError(w, http.StatusNotFound, service.ErrJobNotFound)
+		return nil, false
+	}
+	return job, true
+}
+
+// SetJobService 启用后台任务：条目数超过 threshold 或带 ?async=true 的批量请求转为后台执行
+func (h *Handler) SetJobService(jobs *service.JobService, threshold int) {
+	h.jobs = jobs
+	h.asyncThreshold = threshold
+}
+
+// runAsync 判断批量请求是否转为后台任务
+func (h *Handler) runAsync(r *http.Request, items int) bool {
+	if h.jobs == nil {
+		return false
+	}
+	if async, err := strconv.ParseBool(r.URL.Query().Get("async")); err == nil && async {
+		return true
+	}
+	return h.asyncThreshold > 0 && items > h.asyncThreshold
+}
+
+// writeJobAccepted 返回 202 与任务查询地址
+func writeJobAccepted(w http.ResponseWriter, job *database.Job) {
+	statusURL := fmt.Sprintf("/api/v1/jobs/%d", job.ID)
+	w.Header().Set("Location", statusURL)
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"job_id":     job.ID,
+		"status":     job.Status,
+		"status_url": statusURL,
+	})
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+func TestBulkMoveCategoriesRunsAsJob(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&database.Job{}, &database.JobStep{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	svc := service.NewService(cache.NewNoop(), newInMemoryNDR(), nil)
+	jobs := service.NewJobService(db, service.JobOptions{})
+	svc.RegisterCategoryJobs(jobs)
+	handler := NewHandler(svc, nil, HeaderDefaults{})
+	handler.SetJobService(jobs, 1)
+	router := NewRouter(handler)
+	jobHandler := NewJobHandler(jobs)
+
+	target := createCategory(t, router, `{"name":"Target"}`)
+	first := createCategory(t, router, `{"name":"First"}`)
+	second := createCategory(t, router, `{"name":"Second"}`)
+
+	// 条目数超过阈值时返回 202 与任务地址
+	owner := &database.User{ID: 1, Username: "owner", Role: "course_admin"}
+	payload := fmt.Sprintf(`{"source_ids":[%d,%d],"target_parent_id":%d}`, first.ID, second.ID, target.ID)
+	req := withTestUser(httptest.NewRequest(http.MethodPost, "/api/v1/categories/bulk/move", strings.NewReader(payload)), owner)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var accepted struct {
+		JobID     uint   `json:"job_id"`
+		StatusURL string `json:"status_url"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&accepted); err != nil {
+		t.Fatalf("decode response error: %v", err)
+	}
+	if rec.Header().Get("Location") != accepted.StatusURL || accepted.StatusURL != fmt.Sprintf("/api/v1/jobs/%d", accepted.JobID) {
+		t.Fatalf("unexpected job location %q / %q", rec.Header().Get("Location"), accepted.StatusURL)
+	}
+
+	if ran, err := jobs.RunNext(context.Background()); err != nil || !ran {
+		t.Fatalf("expected job to run: %v", err)
+	}
+
+	getJob := func(user *database.User) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		jobHandler.JobRoutes(rec, withTestUser(httptest.NewRequest(http.MethodGet, accepted.StatusURL, nil), user))
+		return rec
+	}
+	rec = getJob(owner)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var detail struct {
+		Status   string  `json:"status"`
+		Progress float64 `json:"progress"`
+		Result   struct {
+			Items []service.Category `json:"items"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&detail); err != nil {
+		t.Fatalf("decode job error: %v", err)
+	}
+	if detail.Status != database.JobSucceeded || detail.Progress != 1 || len(detail.Result.Items) != 2 {
+		t.Fatalf("unexpected job detail: %+v", detail)
+	}
+	for _, item := range detail.Result.Items {
+		if item.ParentID == nil || *item.ParentID != target.ID {
+			t.Fatalf("expected %d to be moved under %d", item.ID, target.ID)
+		}
+	}
+
+	// 其他用户看不到该任务，已结束的任务不能取消
+	if rec = getJob(&database.User{ID: 2, Username: "other", Role: "proofreader"}); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for other user, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	jobHandler.JobRoutes(rec, withTestUser(httptest.NewRequest(http.MethodPost, accepted.StatusURL+"/cancel", nil), owner))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 when canceling a finished job, got %d", rec.Code)
+	}
+}
+
+func TestTagMergeRunsAsJob(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&database.Job{}, &database.JobStep{}, &database.Tag{}, &database.TagSynonym{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	svc := service.NewService(cache.NewNoop(), newInMemoryNDR(), nil)
+	svc.SetTagRegistry(service.NewTagRegistry(db))
+	jobs := service.NewJobService(db, service.JobOptions{})
+	svc.RegisterTagJobs(jobs)
+	handler := NewHandler(svc, nil, HeaderDefaults{})
+	handler.SetJobService(jobs, 0)
+	router := NewRouter(handler)
+
+	course := createCategory(t, router, `{"name":"Course"}`)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, withTestUser(httptest.NewRequest(method, path, strings.NewReader(body)), testSuperAdmin))
+		return rec
+	}
+	createTag := func(name string) database.Tag {
+		rec := do(http.MethodPost, "/api/v1/tags", fmt.Sprintf(`{"course_id":%d,"name":%q}`, course.ID, name))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var tag database.Tag
+		if err := json.NewDecoder(rec.Body).Decode(&tag); err != nil {
+			t.Fatalf("decode tag error: %v", err)
+		}
+		return tag
+	}
+	source := createTag("OS")
+	target := createTag("操作系统")
+
+	// 只调整上级不需要同步文档，直接返回
+	if rec := do(http.MethodPatch, fmt.Sprintf("/api/v1/tags/%d", source.ID), `{"parent_id":0}`); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for parent-only update, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 合并修改词表后返回 202，文档由任务同步
+	rec := do(http.MethodPost, fmt.Sprintf("/api/v1/tags/%d/merge", source.ID), fmt.Sprintf(`{"target_id":%d}`, target.ID))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var accepted struct {
+		JobID     uint   `json:"job_id"`
+		StatusURL string `json:"status_url"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&accepted); err != nil {
+		t.Fatalf("decode response error: %v", err)
+	}
+	if rec.Header().Get("Location") != fmt.Sprintf("/api/v1/jobs/%d", accepted.JobID) {
+		t.Fatalf("unexpected job location %q", rec.Header().Get("Location"))
+	}
+
+	if ran, err := jobs.RunNext(context.Background()); err != nil || !ran {
+		t.Fatalf("expected job to run: %v", err)
+	}
+	detail, err := jobs.Get(accepted.JobID)
+	if err != nil || detail.Kind != service.JobKindTagSync || detail.Status != database.JobSucceeded {
+		t.Fatalf("unexpected job detail %+v err=%v", detail, err)
+	}
+	var result service.TagChangeResult
+	if err := json.Unmarshal(detail.Result, &result); err != nil || result.Tag == nil || result.Tag.ID != target.ID || len(result.Tag.Synonyms) != 1 {
+		t.Fatalf("unexpected job result %s err=%v", detail.Result, err)
+	}
+}
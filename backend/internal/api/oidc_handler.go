@@ -0,0 +1,192 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+const (
+	// oidcStateCookie 保存 state/nonce/PKCE verifier 的 cookie
+	oidcStateCookie = "ydms_oidc_state"
+	// oidcStateExpiry 从跳转到 IdP 到回调之间允许的最长时间
+	oidcStateExpiry = 10 * time.Minute
+)
+
+// OIDCSettings 单点登录设置
+type OIDCSettings struct {
+	Provider          *auth.OIDCProvider
+	Provisioning      service.OIDCProvisioning
+	PostLoginRedirect string // 登录完成后跳转的前端地址，结果放在 URL fragment 中；为空时回调直接返回 JSON
+	SecureCookie      bool   // 回调地址为 https 时设置 Secure cookie
+}
+
+// SetOIDC 启用 OIDC 单点登录
+func (h *AuthHandler) SetOIDC(settings OIDCSettings) {
+	h.oidc = &settings
+}
+
+// SetPasswordLoginEnabled 设置是否允许用户名密码登录（仅使用单点登录时关闭）
+func (h *AuthHandler) SetPasswordLoginEnabled(enabled bool) {
+	h.passwordLoginDisabled = !enabled
+}
+
+// AuthOptions 返回可用的登录方式，供前端决定显示哪些登录入口
+// GET /api/v1/auth/options
+func (h *AuthHandler) AuthOptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	resp := map[string]interface{}{
+		"password_login": !h.passwordLoginDisabled,
+		"oidc":           h.oidc != nil,
+	}
+	if h.oidc != nil {
+		resp["oidc_login_url"] = "/api/v1/auth/oidc/login"
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// OIDCLogin 跳转到 IdP 开始授权码流程
+// GET /api/v1/auth/oidc/login
+func (h *AuthHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if h.oidc == nil {
+		respondError(w, http.StatusNotFound, errors.New("single sign-on is not configured"))
+		return
+	}
+
+	state, err := auth.NewOIDCState()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	target, err := h.oidc.Provider.AuthCodeURL(r.Context(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		respondError(w, http.StatusBadGateway, errors.New("identity provider is unavailable"))
+		return
+	}
+	signed, err := auth.SignOIDCState(state, h.jwtSecret, oidcStateExpiry)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    signed,
+		Path:     "/api/v1/auth/oidc",
+		MaxAge:   int(oidcStateExpiry.Seconds()),
+		HttpOnly: true,
+		Secure:   h.oidc.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCCallback IdP 回调：校验 state，兑换授权码，映射本地用户并签发 YDMS token
+// GET /api/v1/auth/oidc/callback
+func (h *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if h.oidc == nil {
+		respondError(w, http.StatusNotFound, errors.New("single sign-on is not configured"))
+		return
+	}
+
+	// state cookie 只能使用一次
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Path:     "/api/v1/auth/oidc",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.oidc.SecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := r.URL.Query()
+	if idpErr := query.Get("error"); idpErr != "" {
+		h.respondOIDCError(w, r, http.StatusUnauthorized, fmt.Errorf("identity provider returned %s", idpErr))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		h.respondOIDCError(w, r, http.StatusBadRequest, errors.New("missing login state, please start again"))
+		return
+	}
+	state, err := auth.ParseOIDCState(cookie.Value, h.jwtSecret)
+	if err != nil || query.Get("state") == "" || query.Get("state") != state.State {
+		h.respondOIDCError(w, r, http.StatusBadRequest, errors.New("invalid login state, please start again"))
+		return
+	}
+
+	identity, err := h.oidc.Provider.Exchange(r.Context(), query.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		log.Printf("oidc: %v", err)
+		h.respondOIDCError(w, r, http.StatusUnauthorized, errors.New("single sign-on failed"))
+		return
+	}
+
+	user, err := h.userService.ResolveOIDCUser(identity, h.oidc.Provisioning)
+	if err != nil {
+		log.Printf("oidc: cannot map %s/%s: %v", identity.Issuer, identity.Subject, err)
+		h.respondOIDCError(w, r, http.StatusForbidden, err)
+		return
+	}
+
+	resp, err := h.loginResult(user)
+	if err != nil {
+		h.respondOIDCError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if h.oidc.PostLoginRedirect == "" {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	h.redirectWithFragment(w, r, resp)
+}
+
+// respondOIDCError 输出单点登录错误：配置了前端地址时跳转并在 fragment 中带上错误信息
+func (h *AuthHandler) respondOIDCError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if h.oidc.PostLoginRedirect == "" {
+		respondError(w, status, err)
+		return
+	}
+	h.redirectWithFragment(w, r, map[string]interface{}{"error": err.Error()})
+}
+
+// redirectWithFragment 跳转到前端，结果放在 fragment 中（不会发送到服务器或写入访问日志）
+func (h *AuthHandler) redirectWithFragment(w http.ResponseWriter, r *http.Request, values map[string]interface{}) {
+	fragment := url.Values{}
+	for key, value := range values {
+		switch v := value.(type) {
+		case string:
+			fragment.Set(key, v)
+		case bool, int:
+			fragment.Set(key, fmt.Sprint(v))
+		}
+	}
+	target, err := url.Parse(h.oidc.PostLoginRedirect)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	target.Fragment = ""
+	target.RawFragment = ""
+	http.Redirect(w, r, target.String()+"#"+fragment.Encode(), http.StatusFound)
+}
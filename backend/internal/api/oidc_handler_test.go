@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/auth/oidctest"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+func TestOIDCLoginFlow(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&database.User{}, &database.PasswordHistory{}, &database.LoginThrottle{},
+		&database.RecoveryCode{}, &database.UserIdentity{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	idp := oidctest.NewServer("ydms", "s3cret")
+	defer idp.Close()
+	idp.SetClaims(map[string]interface{}{"sub": "u-1", "preferred_username": "alice", "name": "Alice"})
+
+	const redirectURL = "http://ydms.test/api/v1/auth/oidc/callback"
+	handler := NewAuthHandler(service.NewUserService(db), "jwt-secret", time.Hour)
+	handler.SetOIDC(OIDCSettings{
+		Provider: auth.NewOIDCProvider(auth.OIDCConfig{
+			Issuer:       idp.Issuer(),
+			ClientID:     "ydms",
+			ClientSecret: "s3cret",
+			RedirectURL:  redirectURL,
+		}, nil),
+		Provisioning: service.OIDCProvisioning{LinkExisting: true, AutoProvision: true},
+	})
+	handler.SetPasswordLoginEnabled(false)
+
+	// 关闭密码登录后拒绝用户名密码登录
+	rec := httptest.NewRecorder()
+	handler.Login(rec, httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"username":"alice","password":"x"}`)))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected password login to be rejected, got %d", rec.Code)
+	}
+
+	login := func() *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.OIDCLogin(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("expected redirect to IdP, got %d: %s", rec.Code, rec.Body.String())
+		}
+		cookies := rec.Result().Cookies()
+
+		// 模拟浏览器访问 IdP 授权端点
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(rec.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("authorize: %v", err)
+		}
+		resp.Body.Close()
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil || !strings.HasPrefix(callback.String(), redirectURL) {
+			t.Fatalf("unexpected IdP redirect %q", resp.Header.Get("Location"))
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?"+callback.RawQuery, nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec = httptest.NewRecorder()
+		handler.OIDCCallback(rec, req)
+		return rec
+	}
+
+	// 首次登录自动创建账号并签发 token
+	rec = login()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected callback to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Token string `json:"token"`
+		User  struct {
+			ID       uint   `json:"id"`
+			Username string `json:"username"`
+			Role     string `json:"role"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Token == "" || resp.User.Username != "alice" || resp.User.Role != "proofreader" {
+		t.Fatalf("unexpected login response: %s", rec.Body.String())
+	}
+	if claims, err := auth.ValidateToken(resp.Token, "jwt-secret"); err != nil || claims.UserID != resp.User.ID {
+		t.Fatalf("issued token is invalid: %v", err)
+	}
+
+	// 再次登录按 issuer + subject 找到同一账号，即使用户名声明已变更
+	idp.SetClaims(map[string]interface{}{"sub": "u-1", "preferred_username": "alice.renamed"})
+	rec = login()
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"username":"alice"`) {
+		t.Fatalf("expected linked identity to log in as alice, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// state 不匹配（缺少 cookie）时拒绝回调
+	rec = httptest.NewRecorder()
+	handler.OIDCCallback(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?code=x&state=y", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected missing state to be rejected, got %d", rec.Code)
+	}
+
+	// 未开启自动创建时，没有对应账号的身份无法登录
+	handler.oidc.Provisioning.AutoProvision = false
+	idp.SetClaims(map[string]interface{}{"sub": "u-2", "preferred_username": "bob"})
+	if rec = login(); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected unprovisioned identity to be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
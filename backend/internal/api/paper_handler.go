@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+// PaperHandler 组卷相关 handler
+type PaperHandler struct {
+	base   *Handler
+	papers *service.PaperService
+}
+
+// NewPaperHandler 创建组卷 handler，渲染与请求元数据复用 base
+func NewPaperHandler(base *Handler, papers *service.PaperService) *PaperHandler {
+	return &PaperHandler{base: base, papers: papers}
+}
+
+// Papers 处理试卷集合端点
+// GET /api/v1/papers, POST /api/v1/papers
+func (h *PaperHandler) Papers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listPapers(w, r)
+	case http.MethodPost:
+		h.buildPaper(w, r)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// PaperRoutes 处理试卷子路由
+func (h *PaperHandler) PaperRoutes(w http.ResponseWriter, r *http.Request) {
+	relPath := strings.TrimPrefix(r.URL.Path, "/api/v1/papers/")
+	if relPath == "" {
+		h.Papers(w, r)
+		return
+	}
+	if relPath == "render" {
+		h.base.renderPaper(w, r, h.base.metaFromRequest(r))
+		return
+	}
+
+	parts := strings.Split(relPath, "/")
+	id, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("invalid paper id"))
+		return
+	}
+
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			h.getPaper(w, r, uint(id))
+		case http.MethodDelete:
+			h.deletePaper(w, r, uint(id))
+		default:
+			respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "render" {
+		h.renderSavedPaper(w, r, uint(id))
+		return
+	}
+
+	respondError(w, http.StatusNotFound, errors.New("not found"))
+}
+
+func (h *PaperHandler) buildPaper(w http.ResponseWriter, r *http.Request) {
+	// 权限检查：校对员不能组卷
+	user, httpErr := h.base.requireNotProofreader(r, "build papers")
+	if httpErr != nil {
+		respondError(w, httpErr.code, httpErr.message)
+		return
+	}
+
+	var req service.PaperBuildRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
+		return
+	}
+	req.CreatedByID = user.ID
+
+	paper, err := h.papers.BuildPaper(r.Context(), h.base.metaFromRequest(r), req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	status := http.StatusCreated
+	if req.DryRun {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, paper)
+}
+
+func (h *PaperHandler) listPapers(w http.ResponseWriter, r *http.Request) {
+	user, err := h.base.getCurrentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// 超级管理员可查看全部试卷，其他用户仅查看自己创建的
+	var createdBy uint
+	if user.Role != "super_admin" {
+		createdBy = user.ID
+	}
+	papers, err := h.papers.ListPapers(createdBy)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"papers": papers})
+}
+
+// loadOwnedPaper 读取试卷，仅创建者与超级管理员可访问；失败时已写入响应
+func (h *PaperHandler) loadOwnedPaper(w http.ResponseWriter, r *http.Request, id uint) (*service.PaperDefinition, bool) {
+	user, err := h.base.getCurrentUser(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, err)
+		return nil, false
+	}
+	paper, err := h.papers.GetPaper(id)
+	if err != nil {
+		respondPaperError(w, err)
+		return nil, false
+	}
+	if user.Role != "super_admin" && paper.CreatedByID != user.ID {
+		respondError(w, http.StatusForbidden, errors.New("only the creator or super admin can access this paper"))
+		return nil, false
+	}
+	return paper, true
+}
+
+func (h *PaperHandler) getPaper(w http.ResponseWriter, r *http.Request, id uint) {
+	paper, ok := h.loadOwnedPaper(w, r, id)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, paper)
+}
+
+func (h *PaperHandler) deletePaper(w http.ResponseWriter, r *http.Request, id uint) {
+	if _, ok := h.loadOwnedPaper(w, r, id); !ok {
+		return
+	}
+	if err := h.papers.DeletePaper(id); err != nil {
+		respondPaperError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *PaperHandler) renderSavedPaper(w http.ResponseWriter, r *http.Request, id uint) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if _, ok := h.loadOwnedPaper(w, r, id); !ok {
+		return
+	}
+	variant := service.PaperVariant(r.URL.Query().Get("variant"))
+	result, err := h.papers.RenderPaper(r.Context(), h.base.metaFromRequest(r), id, variant)
+	if err != nil {
+		respondPaperError(w, err)
+		return
+	}
+	writeRenderedPaper(w, r, result)
+}
+
+// writeRenderedPaper returns the composed paper as HTML, or as JSON when format=json.
+func writeRenderedPaper(w http.ResponseWriter, r *http.Request, result service.PaperRenderResult) {
+	if r.URL.Query().Get("format") == "json" {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, result.HTML)
+}
+
+func respondPaperError(w http.ResponseWriter, err error) {
+	if errors.Is(err, service.ErrPaperNotFound) {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+	respondError(w, http.StatusBadGateway, err)
+}
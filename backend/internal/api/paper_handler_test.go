@@ -0,0 +1,56 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+func TestPaperRoutesRestrictToCreator(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&database.Paper{}, &database.PaperQuestion{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	paper := database.Paper{Title: "期中", Rules: "[]", CreatedByID: testCourseAdmin.ID}
+	if err := db.Create(&paper).Error; err != nil {
+		t.Fatalf("create paper: %v", err)
+	}
+
+	svc := service.NewService(cache.NewNoop(), newInMemoryNDR(), nil)
+	handler := NewPaperHandler(NewHandler(svc, nil, HeaderDefaults{}), service.NewPaperService(db, svc))
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		user   *database.User
+		want   int
+	}{
+		{"创建者可以查看", http.MethodGet, "", testCourseAdmin, http.StatusOK},
+		{"超级管理员可以查看", http.MethodGet, "", testSuperAdmin, http.StatusOK},
+		{"其他用户不能查看", http.MethodGet, "", testProofreader, http.StatusForbidden},
+		{"其他用户不能渲染", http.MethodGet, "/render", testProofreader, http.StatusForbidden},
+		{"其他用户不能删除", http.MethodDelete, "", testProofreader, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, fmt.Sprintf("/api/v1/papers/%d%s", paper.ID, tc.path), nil)
+			rec := httptest.NewRecorder()
+			handler.PaperRoutes(rec, withTestUser(req, tc.user))
+			if rec.Code != tc.want {
+				t.Fatalf("expected %d, got %d: %s", tc.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+// Reviews 处理审核列表端点
+// GET /api/v1/reviews?course_id=&state=  课程中处于某审核状态的文档（默认 in_review，即待审核）
+// GET /api/v1/reviews/queue              指定给当前用户的待审核文档
+func (h *Handler) Reviews(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	meta := h.metaFromRequest(r)
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/reviews"), "/") {
+	case "":
+		courseID, err := strconv.ParseInt(r.URL.Query().Get("course_id"), 10, 64)
+		if err != nil || courseID <= 0 {
+			respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "course_id 不能为空"))
+			return
+		}
+		reviews, err := h.service.ListCourseReviews(meta, courseID, r.URL.Query().Get("state"))
+		if err != nil {
+			respondReviewError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": reviews})
+	case "queue":
+		reviews, err := h.service.ListReviewQueue(meta)
+		if err != nil {
+			respondReviewError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": reviews})
+	default:
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// documentReviewRoutes 处理文档审核端点
+// GET  /api/v1/documents/{id}/review          审核状态与变更记录
+// POST /api/v1/documents/{id}/review/{action} 审核操作：submit、assign、approve、reject、publish、reopen
+func (h *Handler) documentReviewRoutes(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, id int64, rest []string) {
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		review, err := h.service.GetDocumentReview(r.Context(), meta, id)
+		if err != nil {
+			respondReviewError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, review)
+	case len(rest) == 1 && r.Method == http.MethodPost:
+		var req service.ReviewActionRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
+				return
+			}
+		}
+		review, err := h.service.TransitionDocumentReview(r.Context(), meta, id, rest[0], req)
+		if err != nil {
+			respondReviewError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, review)
+	case len(rest) <= 1:
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func respondReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrReviewWorkflowDisabled):
+		respondAPIError(w, NewAPIError(ErrCodeNotFound, http.StatusNotFound, "未启用审核流程", err.Error()))
+	case errors.Is(err, service.ErrInvalidReviewRequest):
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "审核请求无效", err.Error()))
+	case errors.Is(err, service.ErrReviewForbidden):
+		respondAPIError(w, NewAPIError(ErrCodeForbidden, http.StatusForbidden, "无权执行该审核操作", err.Error()))
+	case errors.Is(err, service.ErrReviewTransition):
+		respondAPIError(w, NewAPIError(ErrCodeConflict, http.StatusConflict, "当前审核状态不允许该操作", err.Error()))
+	default:
+		respondAPIError(w, WrapUpstreamError(err))
+	}
+}
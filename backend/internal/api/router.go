@@ -3,6 +3,7 @@ package api
 import (
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -20,8 +21,16 @@ type RouterConfig struct {
 	UserHandler    *UserHandler
 	CourseHandler  *CourseHandler
 	APIKeyHandler  *APIKeyHandler
+	PaperHandler   *PaperHandler
+	JobHandler     *JobHandler         // 为 nil 时不提供后台任务端点
+	SagaHandler    *SagaHandler        // 为 nil 时不提供 saga 管理端点
+	EventHandler   *EventHandler       // 为 nil 时不提供变更事件推送
+	WebhookHandler *WebhookHandler     // 为 nil 时不提供 webhook 管理端点
 	JWTSecret      string
-	DB             *gorm.DB // 用于 API Key 验证
+	DB             *gorm.DB            // 用于 API Key 验证
+	RateLimiter    *auth.RateLimiter   // 为 nil 时不限流
+	TrustedProxies []*net.IPNet        // 可信反向代理网段（用于解析 X-Forwarded-For）
+	UsageRecorder  *auth.UsageRecorder // API Key 使用记录批量写入器
 }
 
 // NewRouter creates the HTTP router and wires handler endpoints.
@@ -40,6 +49,11 @@ func NewRouter(h *Handler) http.Handler {
 	mux.Handle("/api/v1/documents", wrap(http.HandlerFunc(h.Documents)))
 	mux.Handle("/api/v1/documents/", wrap(http.HandlerFunc(h.DocumentRoutes)))
 	mux.Handle("/api/v1/nodes/", wrap(http.HandlerFunc(h.NodeRoutes)))
+	mux.Handle("/api/v1/reviews", wrap(http.HandlerFunc(h.Reviews)))
+	mux.Handle("/api/v1/reviews/", wrap(http.HandlerFunc(h.Reviews)))
+	mux.Handle("/api/v1/tags", wrap(http.HandlerFunc(h.Tags)))
+	mux.Handle("/api/v1/tags/", wrap(http.HandlerFunc(h.Tags)))
+	mux.Handle("/api/v1/papers/", wrap(http.HandlerFunc(h.PaperRoutes)))
 
 	return mux
 }
@@ -49,7 +63,11 @@ func NewRouterWithConfig(cfg RouterConfig) http.Handler {
 	mux := http.NewServeMux()
 
 	wrap := cfg.Handler.applyMiddleware
-	authWrap := cfg.Handler.applyAuthMiddleware(cfg.JWTSecret, cfg.DB)
+	authWrap := cfg.Handler.applyAuthMiddleware(cfg.JWTSecret, cfg.DB, auth.FlexibleAuthOptions{
+		RateLimiter:    cfg.RateLimiter,
+		TrustedProxies: cfg.TrustedProxies,
+		Usage:          cfg.UsageRecorder,
+	})
 
 	// 健康检查端点（公开）
 	mux.Handle("/health", wrap(http.HandlerFunc(cfg.Handler.Health)))
@@ -59,9 +77,18 @@ func NewRouterWithConfig(cfg RouterConfig) http.Handler {
 
 	// 认证端点
 	mux.Handle("/api/v1/auth/login", wrap(http.HandlerFunc(cfg.AuthHandler.Login)))
+	mux.Handle("/api/v1/auth/login/2fa", wrap(http.HandlerFunc(cfg.AuthHandler.LoginSecondFactor)))
+	mux.Handle("/api/v1/auth/login/2fa/setup", wrap(http.HandlerFunc(cfg.AuthHandler.LoginEnrollSetup)))
+	mux.Handle("/api/v1/auth/login/2fa/enable", wrap(http.HandlerFunc(cfg.AuthHandler.LoginEnrollConfirm)))
+	mux.Handle("/api/v1/auth/login/change-password", wrap(http.HandlerFunc(cfg.AuthHandler.LoginChangePassword)))
+	mux.Handle("/api/v1/auth/options", wrap(http.HandlerFunc(cfg.AuthHandler.AuthOptions)))
+	mux.Handle("/api/v1/auth/oidc/login", wrap(http.HandlerFunc(cfg.AuthHandler.OIDCLogin)))
+	mux.Handle("/api/v1/auth/oidc/callback", wrap(http.HandlerFunc(cfg.AuthHandler.OIDCCallback)))
 	mux.Handle("/api/v1/auth/logout", authWrap(http.HandlerFunc(cfg.AuthHandler.Logout)))
 	mux.Handle("/api/v1/auth/me", authWrap(http.HandlerFunc(cfg.AuthHandler.Me)))
 	mux.Handle("/api/v1/auth/change-password", authWrap(http.HandlerFunc(cfg.AuthHandler.ChangePassword)))
+	mux.Handle("/api/v1/auth/2fa", authWrap(http.HandlerFunc(cfg.AuthHandler.TwoFactor)))
+	mux.Handle("/api/v1/auth/2fa/", authWrap(http.HandlerFunc(cfg.AuthHandler.TwoFactor)))
 
 	// 用户管理端点（需要认证）
 	if cfg.UserHandler != nil {
@@ -88,6 +115,44 @@ func NewRouterWithConfig(cfg RouterConfig) http.Handler {
 	mux.Handle("/api/v1/documents/", authWrap(http.HandlerFunc(cfg.Handler.DocumentRoutes)))
 	mux.Handle("/api/v1/nodes/", authWrap(http.HandlerFunc(cfg.Handler.NodeRoutes)))
 
+	// 文档审核列表（需要认证）
+	mux.Handle("/api/v1/reviews", authWrap(http.HandlerFunc(cfg.Handler.Reviews)))
+	mux.Handle("/api/v1/reviews/", authWrap(http.HandlerFunc(cfg.Handler.Reviews)))
+
+	// 课程标签词表（需要认证）
+	mux.Handle("/api/v1/tags", authWrap(http.HandlerFunc(cfg.Handler.Tags)))
+	mux.Handle("/api/v1/tags/", authWrap(http.HandlerFunc(cfg.Handler.Tags)))
+
+	// 后台任务端点（需要认证）
+	if cfg.JobHandler != nil {
+		mux.Handle("/api/v1/jobs/", authWrap(http.HandlerFunc(cfg.JobHandler.JobRoutes)))
+	}
+
+	// 批量操作补偿日志管理（仅超级管理员）
+	if cfg.SagaHandler != nil {
+		mux.Handle("/api/v1/admin/sagas", authWrap(http.HandlerFunc(cfg.SagaHandler.SagaRoutes)))
+		mux.Handle("/api/v1/admin/sagas/", authWrap(http.HandlerFunc(cfg.SagaHandler.SagaRoutes)))
+	}
+
+	// webhook 订阅与投递记录管理（仅超级管理员）
+	if cfg.WebhookHandler != nil {
+		mux.Handle("/api/v1/admin/webhooks", authWrap(http.HandlerFunc(cfg.WebhookHandler.WebhookRoutes)))
+		mux.Handle("/api/v1/admin/webhooks/", authWrap(http.HandlerFunc(cfg.WebhookHandler.WebhookRoutes)))
+	}
+
+	// 变更事件推送（SSE，需要认证）
+	if cfg.EventHandler != nil {
+		mux.Handle("/api/v1/events", authWrap(http.HandlerFunc(cfg.EventHandler.Stream)))
+	}
+
+	// 组卷端点（可选，需要数据库保存试卷定义）
+	if cfg.PaperHandler != nil {
+		mux.Handle("/api/v1/papers", authWrap(http.HandlerFunc(cfg.PaperHandler.Papers)))
+		mux.Handle("/api/v1/papers/", authWrap(http.HandlerFunc(cfg.PaperHandler.PaperRoutes)))
+	} else {
+		mux.Handle("/api/v1/papers/", authWrap(http.HandlerFunc(cfg.Handler.PaperRoutes)))
+	}
+
 	return mux
 }
 
@@ -110,7 +175,18 @@ func handleUserRoutes(h *UserHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 
+		// 批量导入与导出
+		switch path {
+		case "/api/v1/users/import":
+			h.ImportUsers(w, r)
+			return
+		case "/api/v1/users/export":
+			h.ExportUsers(w, r)
+			return
+		}
+
 		// GET /api/v1/users/:id
+		// PATCH /api/v1/users/:id
 		// DELETE /api/v1/users/:id
 		if len(path) > len("/api/v1/users/") {
 			// 检查是否是课程权限相关路由
@@ -127,11 +203,25 @@ func handleUserRoutes(h *UserHandler) http.HandlerFunc {
 					h.RevokeCoursePermission(w, r)
 					return
 				}
+			} else if strings.HasSuffix(path, "/unlock") {
+				// POST /api/v1/users/:id/unlock
+				h.UnlockUser(w, r)
+				return
+			} else if strings.HasSuffix(path, "/2fa") {
+				// DELETE /api/v1/users/:id/2fa
+				h.ResetTwoFactor(w, r)
+				return
+			} else if strings.HasSuffix(path, "/reset-password") {
+				// POST /api/v1/users/:id/reset-password
+				h.ResetPassword(w, r)
+				return
 			} else {
 				// 用户基本操作
 				switch r.Method {
 				case http.MethodGet:
 					h.GetUser(w, r)
+				case http.MethodPatch:
+					h.UpdateUser(w, r)
 				case http.MethodDelete:
 					h.DeleteUser(w, r)
 				default:
@@ -174,11 +264,11 @@ func (h *Handler) applyMiddleware(next http.Handler) http.Handler {
 	return handler
 }
 
-func (h *Handler) applyAuthMiddleware(jwtSecret string, db *gorm.DB) func(http.Handler) http.Handler {
+func (h *Handler) applyAuthMiddleware(jwtSecret string, db *gorm.DB, opts auth.FlexibleAuthOptions) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		handler := next
 		// 先应用认证中间件（支持 JWT 和 API Key）
-		handler = authMiddlewareWrapper(jwtSecret, db)(handler)
+		handler = authMiddlewareWrapper(jwtSecret, db, opts)(handler)
 		// 再应用其他中间件
 		handler = corsMiddleware(handler)
 		handler = loggingMiddleware(handler)
@@ -187,10 +277,10 @@ func (h *Handler) applyAuthMiddleware(jwtSecret string, db *gorm.DB) func(http.H
 }
 
 // authMiddlewareWrapper 认证中间件包装器（支持 JWT 和 API Key）
-func authMiddlewareWrapper(jwtSecret string, db *gorm.DB) func(http.Handler) http.Handler {
+func authMiddlewareWrapper(jwtSecret string, db *gorm.DB, opts auth.FlexibleAuthOptions) func(http.Handler) http.Handler {
 	if db != nil {
-		// 使用灵活的认证中间件（支持 JWT 和 API Key）
-		return auth.FlexibleAuthMiddleware(db, jwtSecret)
+		// 使用灵活的认证中间件（支持 JWT 和 API Key，并按 Key / 用户限流）
+		return auth.FlexibleAuthMiddleware(db, jwtSecret, opts)
 	}
 	// 降级为仅支持 JWT
 	return auth.AuthMiddleware(jwtSecret)
@@ -218,11 +308,16 @@ func (lrw *loggingResponseWriter) WriteHeader(status int) {
 	lrw.ResponseWriter.WriteHeader(status)
 }
 
+// Unwrap 使 http.ResponseController 能够访问底层 writer（SSE 需要 Flush）
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// For development we allow all origins; adjust as needed for production.
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-api-key, x-user-id, x-request-id, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-api-key, x-user-id, x-request-id, Authorization, Last-Event-ID")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 
 		if r.Method == http.MethodOptions {
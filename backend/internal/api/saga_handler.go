@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+// SagaHandler 批量分类操作补偿日志的管理端点（仅超级管理员）
+type SagaHandler struct {
+	base *Handler
+}
+
+// NewSagaHandler 创建 saga 管理 handler，服务与请求元数据复用 base
+func NewSagaHandler(base *Handler) *SagaHandler {
+	return &SagaHandler{base: base}
+}
+
+// SagaRoutes 处理 saga 管理端点
+// GET  /api/v1/admin/sagas?status=      列出 saga（默认列出执行中与需要处理的）
+// GET  /api/v1/admin/sagas/:id          查看 saga 及其步骤
+// POST /api/v1/admin/sagas/:id/resolve  处理卡住的 saga：{"action": "rollback" | "mark_resolved"}
+func (h *SagaHandler) SagaRoutes(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found"))
+		return
+	}
+	if currentUser.Role != "super_admin" {
+		respondError(w, http.StatusForbidden, errors.New("only super admin can manage sagas"))
+		return
+	}
+
+	relPath := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/sagas"), "/")
+	if relPath == "" {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		h.listSagas(w, r)
+		return
+	}
+
+	parts := strings.Split(relPath, "/")
+	id, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("invalid saga id"))
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		h.getSaga(w, uint(id))
+	case len(parts) == 2 && parts[1] == "resolve" && r.Method == http.MethodPost:
+		h.resolveSaga(w, r, uint(id), currentUser)
+	case len(parts) <= 2:
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *SagaHandler) listSagas(w http.ResponseWriter, r *http.Request) {
+	sagas, err := h.base.service.ListSagas(r.URL.Query().Get("status"))
+	if err != nil {
+		respondSagaError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": sagas})
+}
+
+func (h *SagaHandler) getSaga(w http.ResponseWriter, id uint) {
+	saga, err := h.base.service.GetSaga(id)
+	if err != nil {
+		respondSagaError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, saga)
+}
+
+func (h *SagaHandler) resolveSaga(w http.ResponseWriter, r *http.Request, id uint, currentUser *database.User) {
+	var req struct {
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	if req.Action != service.SagaResolveRollback && req.Action != service.SagaResolveMarkResolved {
+		respondError(w, http.StatusBadRequest, errors.New("action must be rollback or mark_resolved"))
+		return
+	}
+	saga, err := h.base.service.ResolveSaga(r.Context(), h.base.metaFromRequest(r), id, req.Action, currentUser.Username)
+	if err != nil {
+		respondSagaError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, saga)
+}
+
+func respondSagaError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrSagaNotFound), errors.Is(err, service.ErrSagaJournalDisabled):
+		respondError(w, http.StatusNotFound, err)
+	case errors.Is(err, service.ErrSagaActive), errors.Is(err, service.ErrSagaFinished):
+		respondError(w, http.StatusConflict, err)
+	default:
+		respondError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+// Tags 处理课程标签词表端点
+// GET    /api/v1/tags?course_id=          课程的标签词表（含同义词与上级）
+// POST   /api/v1/tags                     新建标签（课程管理员）
+// GET    /api/v1/tags/cloud?category_id=  分类子树的标签统计
+// PATCH  /api/v1/tags/{id}                改名、调整上级或替换同义词
+// DELETE /api/v1/tags/{id}                从词表删除标签（文档中的标签保持不变）
+// POST   /api/v1/tags/{id}/merge          合并到另一个标签：{"target_id": 3}
+//
+// 改名、替换同义词与合并修改词表后，以后台任务将变化同步到课程中的文档，返回 202 与任务地址
+func (h *Handler) Tags(w http.ResponseWriter, r *http.Request) {
+	meta := h.metaFromRequest(r)
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/tags"), "/"), "/")
+
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		courseID, err := strconv.ParseInt(r.URL.Query().Get("course_id"), 10, 64)
+		if err != nil || courseID <= 0 {
+			respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "course_id 不能为空"))
+			return
+		}
+		tags, err := h.service.ListTags(meta, courseID)
+		if err != nil {
+			respondTagError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": tags})
+	case parts[0] == "" && r.Method == http.MethodPost:
+		var input service.TagInput
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
+			return
+		}
+		tag, err := h.service.CreateTag(meta, input)
+		if err != nil {
+			respondTagError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, tag)
+	case parts[0] == "cloud" && len(parts) == 1 && r.Method == http.MethodGet:
+		categoryID, err := strconv.ParseInt(r.URL.Query().Get("category_id"), 10, 64)
+		if err != nil || categoryID <= 0 {
+			respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "category_id 不能为空"))
+			return
+		}
+		cloud, err := h.service.TagCloud(r.Context(), meta, categoryID)
+		if err != nil {
+			respondTagError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, cloud)
+	case parts[0] == "" || parts[0] == "cloud":
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		id, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil || id == 0 {
+			respondError(w, http.StatusBadRequest, errors.New("invalid tag id"))
+			return
+		}
+		h.tagRoutes(w, r, meta, uint(id), parts[1:])
+	}
+}
+
+func (h *Handler) tagRoutes(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, id uint, rest []string) {
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodPatch:
+		var update service.TagUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
+			return
+		}
+		tag, err := h.service.UpdateTag(meta, id, update)
+		if err != nil {
+			respondTagError(w, err)
+			return
+		}
+		if update.Name == nil && update.Synonyms == nil {
+			// 只调整上级不影响文档中的标签
+			writeJSON(w, http.StatusOK, service.TagChangeResult{Tag: tag, UpdatedDocuments: []int64{}})
+			return
+		}
+		h.syncTagDocuments(w, r, meta, tag.ID)
+	case len(rest) == 0 && r.Method == http.MethodDelete:
+		if err := h.service.DeleteTag(meta, id); err != nil {
+			respondTagError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(rest) == 1 && rest[0] == "merge" && r.Method == http.MethodPost:
+		var req struct {
+			TargetID uint `json:"target_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
+			return
+		}
+		if req.TargetID == 0 {
+			respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "target_id 不能为空"))
+			return
+		}
+		tag, err := h.service.MergeTag(meta, id, req.TargetID)
+		if err != nil {
+			respondTagError(w, err)
+			return
+		}
+		h.syncTagDocuments(w, r, meta, tag.ID)
+	case len(rest) == 0, len(rest) == 1 && rest[0] == "merge":
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// syncTagDocuments 启用后台任务时将文档同步写入任务队列并返回 202，否则同步执行
+func (h *Handler) syncTagDocuments(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, tagID uint) {
+	if h.jobs != nil {
+		job, err := h.jobs.EnqueueTagSync(meta, tagID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJobAccepted(w, job)
+		return
+	}
+	result, err := h.service.SyncTagDocuments(r.Context(), meta, tagID)
+	if err != nil {
+		respondTagError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// bulkTagDocuments 批量打标签或移除标签
+// POST /api/v1/documents/bulk-tag    {"document_ids": [1, 2], "tags": ["操作系统"]}
+// POST /api/v1/documents/bulk-untag  同上，移除标签（同义词同样匹配）
+func (h *Handler) bulkTagDocuments(w http.ResponseWriter, r *http.Request, meta service.RequestMeta, remove bool) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	var req service.BulkTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "请求格式错误", err.Error()))
+		return
+	}
+	results, err := h.service.BulkTagDocuments(r.Context(), meta, req, remove)
+	if err != nil {
+		respondTagError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": results})
+}
+
+func respondTagError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrTagRegistryDisabled):
+		respondAPIError(w, NewAPIError(ErrCodeNotFound, http.StatusNotFound, "未启用标签词表", err.Error()))
+	case errors.Is(err, service.ErrTagNotFound):
+		respondAPIError(w, NewAPIError(ErrCodeNotFound, http.StatusNotFound, "标签不存在", err.Error()))
+	case errors.Is(err, service.ErrInvalidTag):
+		respondAPIError(w, NewAPIError(ErrCodeValidation, http.StatusBadRequest, "标签参数无效", err.Error()))
+	case errors.Is(err, service.ErrTagConflict):
+		respondAPIError(w, NewAPIError(ErrCodeConflict, http.StatusConflict, "标签名称或同义词已被使用", err.Error()))
+	case errors.Is(err, service.ErrTagForbidden):
+		respondAPIError(w, NewAPIError(ErrCodeForbidden, http.StatusForbidden, "无权执行该标签操作", err.Error()))
+	default:
+		respondAPIError(w, WrapUpstreamError(err))
+	}
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+// preAuthTokenExpiry 预认证 token 有效期
+const preAuthTokenExpiry = 5 * time.Minute
+
+// preAuthRequest 登录后续步骤（两步验证、强制改密）的请求体
+type preAuthRequest struct {
+	PreAuthToken string `json:"pre_auth_token"`
+	Code         string `json:"code"`         // TOTP 验证码或恢复码
+	NewPassword  string `json:"new_password"` // 强制改密时设置的新密码
+}
+
+// decodePreAuth 解析请求体并验证预认证 token 的用途
+func (h *AuthHandler) decodePreAuth(w http.ResponseWriter, r *http.Request, purpose string) (*preAuthRequest, *auth.Claims, bool) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return nil, nil, false
+	}
+
+	var req preAuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+	if req.PreAuthToken == "" {
+		respondError(w, http.StatusBadRequest, errors.New("pre_auth_token is required"))
+		return nil, nil, false
+	}
+
+	claims, err := auth.ValidatePreAuthToken(req.PreAuthToken, h.jwtSecret, purpose)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, errors.New("invalid or expired pre-auth token"))
+		return nil, nil, false
+	}
+	return &req, claims, true
+}
+
+// LoginSecondFactor 登录第二步：校验 TOTP 验证码或恢复码
+// POST /api/v1/auth/login/2fa
+func (h *AuthHandler) LoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	req, claims, ok := h.decodePreAuth(w, r, auth.PurposeMFA)
+	if !ok {
+		return
+	}
+	if req.Code == "" {
+		respondError(w, http.StatusBadRequest, errors.New("code is required"))
+		return
+	}
+
+	user, err := h.userService.VerifySecondFactor(claims.UserID, req.Code, h.clientIP(r))
+	if err != nil {
+		respondTwoFactorError(w, err)
+		return
+	}
+
+	h.respondLoginSuccess(w, user, nil)
+}
+
+// LoginEnrollSetup 强制两步验证的用户在登录过程中生成 TOTP 密钥
+// POST /api/v1/auth/login/2fa/setup
+func (h *AuthHandler) LoginEnrollSetup(w http.ResponseWriter, r *http.Request) {
+	_, claims, ok := h.decodePreAuth(w, r, auth.PurposeMFAEnroll)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.userService.BeginTOTPEnrollment(claims.UserID)
+	if err != nil {
+		respondTwoFactorError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, enrollment)
+}
+
+// LoginEnrollConfirm 强制两步验证的用户在登录过程中完成绑定，成功后直接登录
+// POST /api/v1/auth/login/2fa/enable
+func (h *AuthHandler) LoginEnrollConfirm(w http.ResponseWriter, r *http.Request) {
+	req, claims, ok := h.decodePreAuth(w, r, auth.PurposeMFAEnroll)
+	if !ok {
+		return
+	}
+	if req.Code == "" {
+		respondError(w, http.StatusBadRequest, errors.New("code is required"))
+		return
+	}
+
+	codes, err := h.userService.ConfirmTOTPEnrollment(claims.UserID, req.Code, h.clientIP(r))
+	if err != nil {
+		respondTwoFactorError(w, err)
+		return
+	}
+
+	user, err := h.userService.GetUserByID(claims.UserID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+
+	h.respondLoginSuccess(w, user, codes)
+}
+
+// TwoFactor 当前用户的两步验证管理
+// GET  /api/v1/auth/2fa                 查看状态
+// POST /api/v1/auth/2fa/setup           生成 TOTP 密钥与 otpauth URI
+// POST /api/v1/auth/2fa/enable          校验验证码并启用，返回恢复码
+// POST /api/v1/auth/2fa/disable         使用验证码或恢复码关闭
+// POST /api/v1/auth/2fa/recovery-codes  重新生成恢复码
+func (h *AuthHandler) TwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found"))
+		return
+	}
+
+	action := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/auth/2fa"), "/")
+	if action == "" {
+		if r.Method != http.MethodGet {
+			respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		status, err := h.userService.GetTwoFactorStatus(user.ID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if action != "setup" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Code == "" {
+			respondError(w, http.StatusBadRequest, errors.New("code is required"))
+			return
+		}
+	}
+
+	switch action {
+	case "setup":
+		enrollment, err := h.userService.BeginTOTPEnrollment(user.ID)
+		if err != nil {
+			respondTwoFactorError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, enrollment)
+	case "enable":
+		codes, err := h.userService.ConfirmTOTPEnrollment(user.ID, req.Code, h.clientIP(r))
+		if err != nil {
+			respondTwoFactorError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+	case "disable":
+		if err := h.userService.DisableTOTP(user.ID, req.Code, h.clientIP(r)); err != nil {
+			respondTwoFactorError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"message": "two-factor authentication disabled"})
+	case "recovery-codes":
+		codes, err := h.userService.RegenerateRecoveryCodes(user.ID, req.Code, h.clientIP(r))
+		if err != nil {
+			respondTwoFactorError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+	default:
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// respondTwoFactorError 将两步验证相关错误映射为 HTTP 状态码
+func respondTwoFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidSecondFactor):
+		respondError(w, http.StatusUnauthorized, err)
+	case errors.Is(err, service.ErrTOTPRequired):
+		respondError(w, http.StatusForbidden, err)
+	case errors.Is(err, service.ErrTOTPNotEnabled), errors.Is(err, service.ErrTOTPAlreadyEnabled):
+		respondError(w, http.StatusConflict, err)
+	default:
+		var locked *service.LoginLockedError
+		if errors.As(err, &locked) {
+			respondLoginError(w, err)
+			return
+		}
+		respondError(w, http.StatusBadRequest, err)
+	}
+}
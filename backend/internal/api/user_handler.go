@@ -10,11 +10,13 @@ import (
 	"github.com/yjxt/ydms/backend/internal/auth"
 	"github.com/yjxt/ydms/backend/internal/database"
 	"github.com/yjxt/ydms/backend/internal/service"
+	"gorm.io/gorm"
 )
 
 // UserHandler 用户管理 handler
 type UserHandler struct {
-	userService *service.UserService
+	userService   *service.UserService
+	courseService *service.CourseService // 可选，用于导入时按 slug 解析课程
 }
 
 // NewUserHandler 创建用户管理 handler
@@ -133,11 +135,230 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 登录锁定状态
+	lockedUntil, err := h.userService.GetUserLockout(user.Username)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"user":         user,
+		"locked_until": lockedUntil,
+	})
+}
+
+// UnlockUser 解除用户的登录锁定
+// POST /api/v1/users/:id/unlock
+func (h *UserHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	// 获取当前用户
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found"))
+		return
+	}
+
+	// 只有超级管理员可以解除锁定
+	if currentUser.Role != "super_admin" {
+		respondError(w, http.StatusForbidden, errors.New("only super administrators can unlock users"))
+		return
+	}
+
+	// 从 URL 解析用户 ID
+	userIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/users/")
+	userIDStr = strings.Split(userIDStr, "/")[0]
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("invalid user id"))
+		return
+	}
+
+	// 解除锁定
+	if err := h.userService.UnlockUser(uint(userID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"message": "user unlocked successfully",
+	})
+}
+
+// UpdateUser 修改用户的角色、显示名称或停用状态
+// PATCH /api/v1/users/:id
+func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	// 获取当前用户
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found"))
+		return
+	}
+
+	// 只有超级管理员可以修改用户
+	if currentUser.Role != "super_admin" {
+		respondError(w, http.StatusForbidden, errors.New("only super administrators can update users"))
+		return
+	}
+
+	// 从 URL 解析用户 ID
+	userIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/users/")
+	userIDStr = strings.Split(userIDStr, "/")[0]
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("invalid user id"))
+		return
+	}
+
+	// 解析请求
+	var req service.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// 不能修改自己的角色或停用自己
+	if currentUser.ID == uint(userID) && ((req.Role != nil && *req.Role != currentUser.Role) || (req.Disabled != nil && *req.Disabled)) {
+		respondError(w, http.StatusBadRequest, errors.New("cannot change your own role or disable yourself"))
+		return
+	}
+
+	user, err := h.userService.UpdateUser(uint(userID), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			respondError(w, http.StatusNotFound, errors.New("user not found"))
+		case errors.Is(err, service.ErrLastSuperAdmin):
+			respondError(w, http.StatusConflict, err)
+		default:
+			respondError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+
 	writeJSON(w, http.StatusOK, map[string]interface{}{
 		"user": user,
 	})
 }
 
+// ResetPassword 重置用户密码，返回一次性临时密码（用户登录后必须修改）
+// POST /api/v1/users/:id/reset-password
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	// 获取当前用户
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found"))
+		return
+	}
+
+	// 只有超级管理员可以重置密码
+	if currentUser.Role != "super_admin" {
+		respondError(w, http.StatusForbidden, errors.New("only super administrators can reset passwords"))
+		return
+	}
+
+	// 从 URL 解析用户 ID
+	userIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/users/")
+	userIDStr = strings.Split(userIDStr, "/")[0]
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("invalid user id"))
+		return
+	}
+
+	// 修改自己的密码需使用 change-password
+	if currentUser.ID == uint(userID) {
+		respondError(w, http.StatusBadRequest, errors.New("cannot reset your own password, use change-password instead"))
+		return
+	}
+
+	password, err := h.userService.ResetPassword(uint(userID))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			respondError(w, http.StatusNotFound, errors.New("user not found"))
+		case errors.Is(err, service.ErrServiceAccountPassword):
+			respondError(w, http.StatusBadRequest, err)
+		default:
+			respondError(w, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"temporary_password":   password,
+		"must_change_password": true,
+	})
+}
+
+// ResetTwoFactor 清除用户的两步验证（用于丢失认证器且恢复码用尽的情况）
+// DELETE /api/v1/users/:id/2fa
+func (h *UserHandler) ResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	// 获取当前用户
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found"))
+		return
+	}
+
+	// 只有超级管理员可以重置两步验证
+	if currentUser.Role != "super_admin" {
+		respondError(w, http.StatusForbidden, errors.New("only super administrators can reset two-factor authentication"))
+		return
+	}
+
+	// 从 URL 解析用户 ID
+	userIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/users/")
+	userIDStr = strings.Split(userIDStr, "/")[0]
+	userID, err := strconv.ParseUint(userIDStr, 10, 32)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("invalid user id"))
+		return
+	}
+
+	// 不能重置自己的两步验证（需使用验证码或恢复码关闭）
+	if currentUser.ID == uint(userID) {
+		respondError(w, http.StatusBadRequest, errors.New("cannot reset your own two-factor authentication"))
+		return
+	}
+
+	if err := h.userService.ResetTOTP(uint(userID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(w, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"message": "two-factor authentication reset successfully",
+	})
+}
+
 // DeleteUser 删除用户
 // DELETE /api/v1/users/:id
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+// maxUserImportSize 导入 CSV 的最大字节数
+const maxUserImportSize = 2 << 20
+
+// SetCourseService 设置课程服务，用于在导入时按 slug 解析课程
+func (h *UserHandler) SetCourseService(courseService *service.CourseService) {
+	h.courseService = courseService
+}
+
+// ImportUsers 通过 CSV 批量创建用户并授予课程权限
+// POST /api/v1/users/import?dry_run=true
+// 请求体为 CSV 文本，列：username, display_name, role, courses（课程 ID 或 slug，分号分隔）
+func (h *UserHandler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	// 获取当前用户
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found"))
+		return
+	}
+
+	// 只有超级管理员可以导入用户
+	if currentUser.Role != "super_admin" {
+		respondError(w, http.StatusForbidden, errors.New("only super administrators can import users"))
+		return
+	}
+
+	dryRun := false
+	if raw := r.URL.Query().Get("dry_run"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid dry_run"))
+			return
+		}
+		dryRun = value
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUserImportSize))
+	if err != nil {
+		respondError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("failed to read csv: %w", err))
+		return
+	}
+	rows, err := service.ParseUserImportCSV(bytes.NewReader(data))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts := service.UserImportOptions{DryRun: dryRun, CreatedByID: currentUser.ID}
+	if h.courseService != nil {
+		meta := service.RequestMeta{
+			APIKey:    r.Header.Get("x-api-key"),
+			UserID:    currentUser.Username,
+			RequestID: r.Header.Get("x-request-id"),
+		}
+		resolver, err := h.courseService.CourseResolver(r.Context(), meta)
+		if err != nil {
+			respondError(w, http.StatusBadGateway, err)
+			return
+		}
+		opts.ResolveCourse = resolver
+	}
+
+	result, err := h.userService.ImportUsers(rows, opts)
+	if err != nil {
+		if errors.Is(err, service.ErrUserImportInvalid) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"error":  err.Error(),
+				"result": result,
+			})
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if dryRun {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+	log.Printf("user import: %s created %d users", currentUser.Username, result.Created)
+	// 响应中包含初始密码，禁止缓存
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// ExportUsers 导出用户及其课程权限为 CSV
+// GET /api/v1/users/export
+func (h *UserHandler) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	// 获取当前用户
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found"))
+		return
+	}
+
+	// 只有超级管理员可以导出用户
+	if currentUser.Role != "super_admin" {
+		respondError(w, http.StatusForbidden, errors.New("only super administrators can export users"))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.userService.ExportUsersCSV(&buf); err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	filename := fmt.Sprintf("ydms-users-%s.csv", time.Now().Format("20060102"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
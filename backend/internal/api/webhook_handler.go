@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/service"
+)
+
+// WebhookHandler webhook 订阅与投递记录的管理端点（仅超级管理员）
+type WebhookHandler struct {
+	webhooks *service.WebhookService
+}
+
+// NewWebhookHandler 创建 webhook 管理 handler
+func NewWebhookHandler(webhooks *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks}
+}
+
+// WebhookRoutes 处理 webhook 管理端点
+// GET    /api/v1/admin/webhooks                              列出订阅
+// POST   /api/v1/admin/webhooks                              创建订阅（响应中返回一次签名密钥）
+// GET    /api/v1/admin/webhooks/:id                          查看订阅
+// PATCH  /api/v1/admin/webhooks/:id                          更新订阅，rotate_secret 为 true 时轮换密钥
+// DELETE /api/v1/admin/webhooks/:id                          删除订阅及其投递记录
+// GET    /api/v1/admin/webhooks/:id/deliveries?status=        投递历史
+// GET    /api/v1/admin/webhooks/dead-letters                 全部订阅的死信列表
+// POST   /api/v1/admin/webhooks/deliveries/:id/redeliver     重新投递
+func (h *WebhookHandler) WebhookRoutes(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(auth.UserContextKey).(*database.User)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, errors.New("user not found"))
+		return
+	}
+	if currentUser.Role != "super_admin" {
+		respondError(w, http.StatusForbidden, errors.New("only super admin can manage webhooks"))
+		return
+	}
+
+	relPath := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/webhooks"), "/")
+	parts := strings.Split(relPath, "/")
+	switch {
+	case relPath == "" && r.Method == http.MethodGet:
+		h.listWebhooks(w)
+	case relPath == "" && r.Method == http.MethodPost:
+		h.createWebhook(w, r, currentUser)
+	case relPath == "dead-letters" && r.Method == http.MethodGet:
+		h.listDeliveries(w, r, 0, database.WebhookDeliveryDead)
+	case len(parts) == 3 && parts[0] == "deliveries" && parts[2] == "redeliver":
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		id, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid delivery id"))
+			return
+		}
+		h.redeliver(w, uint(id))
+	case relPath == "" || relPath == "dead-letters":
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		id, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, errors.New("invalid webhook id"))
+			return
+		}
+		h.webhookRoutes(w, r, uint(id), parts[1:])
+	}
+}
+
+func (h *WebhookHandler) webhookRoutes(w http.ResponseWriter, r *http.Request, id uint, rest []string) {
+	switch {
+	case len(rest) == 0 && r.Method == http.MethodGet:
+		webhook, err := h.webhooks.GetWebhook(id)
+		if err != nil {
+			respondWebhookError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, webhook)
+	case len(rest) == 0 && r.Method == http.MethodPatch:
+		h.updateWebhook(w, r, id)
+	case len(rest) == 0 && r.Method == http.MethodDelete:
+		if err := h.webhooks.DeleteWebhook(id); err != nil {
+			respondWebhookError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(rest) == 1 && rest[0] == "deliveries" && r.Method == http.MethodGet:
+		h.listDeliveries(w, r, id, r.URL.Query().Get("status"))
+	case len(rest) <= 1:
+		respondError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	default:
+		respondError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *WebhookHandler) listWebhooks(w http.ResponseWriter) {
+	webhooks, err := h.webhooks.ListWebhooks()
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": webhooks})
+}
+
+func (h *WebhookHandler) createWebhook(w http.ResponseWriter, r *http.Request, currentUser *database.User) {
+	var input service.WebhookInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	webhook, err := h.webhooks.CreateWebhook(input, currentUser.ID)
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+func (h *WebhookHandler) updateWebhook(w http.ResponseWriter, r *http.Request, id uint) {
+	var update service.WebhookUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		respondError(w, http.StatusBadRequest, errors.New("invalid request body"))
+		return
+	}
+	webhook, err := h.webhooks.UpdateWebhook(id, update)
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+func (h *WebhookHandler) listDeliveries(w http.ResponseWriter, r *http.Request, id uint, status string) {
+	switch status {
+	case "", database.WebhookDeliveryPending, database.WebhookDeliveryDelivered, database.WebhookDeliveryDead:
+	default:
+		respondError(w, http.StatusBadRequest, errors.New("status must be pending, delivered or dead"))
+		return
+	}
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			respondError(w, http.StatusBadRequest, errors.New("invalid limit"))
+			return
+		}
+		limit = parsed
+	}
+	deliveries, err := h.webhooks.ListDeliveries(id, status, limit)
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": deliveries})
+}
+
+func (h *WebhookHandler) redeliver(w http.ResponseWriter, id uint) {
+	delivery, err := h.webhooks.Redeliver(id)
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, delivery)
+}
+
+func respondWebhookError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrWebhookNotFound), errors.Is(err, service.ErrWebhookDeliveryNotFound):
+		respondError(w, http.StatusNotFound, err)
+	case errors.Is(err, service.ErrInvalidWebhook):
+		respondError(w, http.StatusBadRequest, err)
+	default:
+		respondError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -39,40 +40,40 @@ func APIKeyAuthMiddleware(db *gorm.DB) func(http.Handler) http.Handler {
 			}
 
 			// 验证 API Key 并获取关联用户
-			user, err := ValidateAPIKey(db, apiKey)
+			match, err := lookupAPIKey(db, apiKey)
 			if err != nil {
 				respondError(w, http.StatusUnauthorized, errors.New("invalid API key: "+err.Error()))
 				return
 			}
 
-			// 更新最后使用时间（异步，不阻塞请求）
-			go updateAPIKeyLastUsed(db, apiKey)
-
-			// 将用户信息存入 context
-			ctx := context.WithValue(r.Context(), UserContextKey, user)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			serveAPIKeyRequest(w, r, next, db, match, FlexibleAuthOptions{})
 		})
 	}
 }
 
+// FlexibleAuthOptions 认证中间件的可选配置
+type FlexibleAuthOptions struct {
+	RateLimiter    *RateLimiter   // 为 nil 时不限流
+	TrustedProxies []*net.IPNet   // 可信反向代理网段，仅来自这些地址的 X-Forwarded-For 会被采信
+	Usage          *UsageRecorder // 为 nil 时同步写入使用记录
+}
+
 // FlexibleAuthMiddleware 灵活的认证中间件
-// 同时支持 JWT Token 和 API Key 认证
-func FlexibleAuthMiddleware(db *gorm.DB, jwtSecret string) func(http.Handler) http.Handler {
+// 同时支持 JWT Token 和 API Key 认证，并按 API Key / 用户限流
+func FlexibleAuthMiddleware(db *gorm.DB, jwtSecret string, opts FlexibleAuthOptions) func(http.Handler) http.Handler {
+	limiter := opts.RateLimiter
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// 优先尝试 API Key 认证
 			apiKey := extractAPIKey(r)
 			if apiKey != "" {
-				user, err := ValidateAPIKey(db, apiKey)
-				if err == nil {
-					// API Key 认证成功
-					go updateAPIKeyLastUsed(db, apiKey)
-					ctx := context.WithValue(r.Context(), UserContextKey, user)
-					next.ServeHTTP(w, r.WithContext(ctx))
+				match, err := lookupAPIKey(db, apiKey)
+				if err != nil {
+					// API Key 无效，返回错误
+					respondError(w, http.StatusUnauthorized, errors.New("invalid API key"))
 					return
 				}
-				// API Key 无效，返回错误
-				respondError(w, http.StatusUnauthorized, errors.New("invalid API key"))
+				serveAPIKeyRequest(w, r, next, db, match, opts)
 				return
 			}
 
@@ -96,6 +97,13 @@ func FlexibleAuthMiddleware(db *gorm.DB, jwtSecret string) func(http.Handler) ht
 				return
 			}
 
+			if limiter != nil {
+				if allowed, wait := limiter.AllowUser(claims.UserID); !allowed {
+					respondRateLimited(w, wait)
+					return
+				}
+			}
+
 			// JWT 认证成功
 			ctx := context.WithValue(r.Context(), ClaimsContextKey, claims)
 			user := &database.User{
@@ -103,12 +111,62 @@ func FlexibleAuthMiddleware(db *gorm.DB, jwtSecret string) func(http.Handler) ht
 				Username: claims.Username,
 				Role:     claims.Role,
 			}
+			if db != nil {
+				// 已签发的 token 在有效期内同样受停用、删除与角色变更影响
+				user, err = loadTokenUser(db, claims.UserID)
+				if err != nil {
+					respondError(w, http.StatusUnauthorized, err)
+					return
+				}
+			}
 			ctx = context.WithValue(ctx, UserContextKey, user)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// serveAPIKeyRequest 对已通过校验的 API Key 做来源 IP 与限流检查，然后调用后续 handler，
+// 请求结束后记录最后使用时间、每日计数与请求日志
+func serveAPIKeyRequest(w http.ResponseWriter, r *http.Request, next http.Handler, db *gorm.DB, match apiKeyMatch, opts FlexibleAuthOptions) {
+	req := apiKeyRequest{
+		match:  match,
+		method: r.Method,
+		route:  r.URL.Path,
+		at:     time.Now(),
+	}
+	clientIP := ClientIP(r, opts.TrustedProxies)
+	if clientIP != nil {
+		req.ip = clientIP.String()
+	}
+
+	// 来源 IP 检查
+	if err := checkAPIKeySource(match.key, clientIP); err != nil {
+		req.outcome, req.status = apiKeyBlocked, http.StatusForbidden
+		recordAPIKeyRequest(db, opts.Usage, req)
+		respondError(w, http.StatusForbidden, err)
+		return
+	}
+
+	// 限流检查（被拒绝的请求同样计入每日统计）
+	if opts.RateLimiter != nil {
+		if allowed, wait := opts.RateLimiter.AllowAPIKey(match.key); !allowed {
+			req.outcome, req.status = apiKeyThrottled, http.StatusTooManyRequests
+			recordAPIKeyRequest(db, opts.Usage, req)
+			respondRateLimited(w, wait)
+			return
+		}
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		req.outcome, req.status = apiKeyServed, recorder.status
+		recordAPIKeyRequest(db, opts.Usage, req)
+	}()
+
+	ctx := context.WithValue(r.Context(), UserContextKey, &match.key.User)
+	next.ServeHTTP(recorder, r.WithContext(ctx))
+}
+
 // extractAPIKey 从请求中提取 API Key
 func extractAPIKey(r *http.Request) string {
 	// 1. 尝试从 X-API-Key header 获取
@@ -133,6 +191,22 @@ func extractAPIKey(r *http.Request) string {
 
 // ValidateAPIKey 验证 API Key 并返回关联的用户
 func ValidateAPIKey(db *gorm.DB, apiKey string) (*database.User, error) {
+	match, err := lookupAPIKey(db, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &match.key.User, nil
+}
+
+// apiKeyMatch API Key 校验结果
+type apiKeyMatch struct {
+	key      *database.APIKey
+	previous bool // 是否通过轮换前的旧密钥匹配
+}
+
+// lookupAPIKey 查询并校验 API Key，返回包含关联用户的记录
+// 轮换后的旧密钥在宽限期内同样有效
+func lookupAPIKey(db *gorm.DB, apiKey string) (apiKeyMatch, error) {
 	// 计算 API Key 的哈希值
 	keyHash := HashAPIKey(apiKey)
 
@@ -140,37 +214,57 @@ func ValidateAPIKey(db *gorm.DB, apiKey string) (*database.User, error) {
 	var dbKey database.APIKey
 	err := db.Preload("User", func(db *gorm.DB) *gorm.DB {
 		return db.Unscoped() // 允许加载已删除的用户，以便进行检查
-	}).Where("key_hash = ?", keyHash).First(&dbKey).Error
+	}).Where("key_hash = ? OR prev_key_hash = ?", keyHash, keyHash).First(&dbKey).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("API key not found")
+			return apiKeyMatch{}, errors.New("API key not found")
 		}
-		return nil, fmt.Errorf("database error: %w", err)
+		return apiKeyMatch{}, fmt.Errorf("database error: %w", err)
 	}
 
 	// 检查是否已删除
 	if dbKey.DeletedAt.Valid {
-		return nil, errors.New("API key has been revoked")
+		return apiKeyMatch{}, errors.New("API key has been revoked")
+	}
+
+	// 旧密钥仅在宽限期内有效
+	previous := dbKey.KeyHash != keyHash
+	if previous && (dbKey.GraceUntil == nil || !dbKey.GraceUntil.After(time.Now())) {
+		return apiKeyMatch{}, errors.New("API key has been rotated")
 	}
 
 	// 检查是否过期
 	if dbKey.ExpiresAt != nil && dbKey.ExpiresAt.Before(time.Now()) {
-		return nil, errors.New("API key has expired")
+		return apiKeyMatch{}, errors.New("API key has expired")
 	}
 
 	// 检查关联用户是否存在且未删除
 	if dbKey.User.DeletedAt.Valid {
-		return nil, errors.New("associated user has been deleted")
+		return apiKeyMatch{}, errors.New("associated user has been deleted")
+	}
+
+	// 检查关联用户是否已停用
+	if dbKey.User.Disabled {
+		return apiKeyMatch{}, errors.New("associated user has been disabled")
 	}
 
-	return &dbKey.User, nil
+	return apiKeyMatch{key: &dbKey, previous: previous}, nil
 }
 
-// updateAPIKeyLastUsed 更新 API Key 的最后使用时间
-func updateAPIKeyLastUsed(db *gorm.DB, apiKey string) {
-	keyHash := HashAPIKey(apiKey)
-	now := time.Now()
-	db.Model(&database.APIKey{}).Where("key_hash = ?", keyHash).Update("last_used_at", now)
+// loadTokenUser 查询 JWT 对应的用户，用户已删除或停用时返回错误
+func loadTokenUser(db *gorm.DB, userID uint) (*database.User, error) {
+	var user database.User
+	err := db.Select("id", "username", "role", "kind", "disabled").First(&user, userID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user no longer exists")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if user.Disabled {
+		return nil, errors.New("account is disabled")
+	}
+	return &user, nil
 }
 
 // GenerateAPIKey 生成一个新的 API Key
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"net/http"
 	"testing"
 	"time"
 
@@ -16,8 +17,15 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("failed to open test database: %v", err)
 	}
 
+	// 内存数据库每个连接相互独立，限制为单连接以便异步写入使用同一个库
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
 	// 自动迁移
-	if err := db.AutoMigrate(&database.User{}, &database.APIKey{}); err != nil {
+	if err := db.AutoMigrate(&database.User{}, &database.APIKey{}, &database.APIKeyDailyUsage{}, &database.APIKeyUsageLog{}); err != nil {
 		t.Fatalf("failed to migrate test database: %v", err)
 	}
 
@@ -241,8 +249,87 @@ func TestValidateAPIKey_DeletedUser(t *testing.T) {
 	}
 }
 
+func TestValidateAPIKey_DisabledUser(t *testing.T) {
+	db := setupTestDB(t)
+
+	// 创建测试用户
+	user := database.User{
+		Username:     "testuser",
+		PasswordHash: "hash",
+		Role:         "course_admin",
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+
+	apiKey, _ := GenerateAPIKey("test")
+	dbKey := database.APIKey{
+		Name:        "Test Key",
+		KeyHash:     HashAPIKey(apiKey),
+		KeyPrefix:   "ydms_test_...",
+		UserID:      user.ID,
+		CreatedByID: user.ID,
+	}
+	if err := db.Create(&dbKey).Error; err != nil {
+		t.Fatalf("failed to create API key: %v", err)
+	}
+
+	// 停用用户（不删除）
+	if err := db.Model(&user).Update("disabled", true).Error; err != nil {
+		t.Fatalf("failed to disable user: %v", err)
+	}
+
+	if _, err := ValidateAPIKey(db, apiKey); err == nil {
+		t.Errorf("ValidateAPIKey() should fail for disabled user")
+	}
+}
+
 func TestExtractAPIKey(t *testing.T) {
 	// 注意：extractAPIKey 是包私有函数，这里仅作为示例
 	// 实际使用时应该通过公共 API 测试
 	t.Skip("extractAPIKey is a private function, test through public APIs instead")
 }
+
+func TestLookupAPIKey_PreviousKeyGrace(t *testing.T) {
+	db := setupTestDB(t)
+
+	user := database.User{Username: "testuser", PasswordHash: "hash", Role: "course_admin"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+
+	graceUntil := time.Now().Add(time.Hour)
+	dbKey := database.APIKey{
+		Name:        "rotated",
+		KeyHash:     HashAPIKey("ydms_test_new"),
+		KeyPrefix:   "ydms_test_new",
+		UserID:      user.ID,
+		PrevKeyHash: HashAPIKey("ydms_test_old"),
+		GraceUntil:  &graceUntil,
+	}
+	if err := db.Create(&dbKey).Error; err != nil {
+		t.Fatalf("failed to create API key: %v", err)
+	}
+
+	match, err := lookupAPIKey(db, "ydms_test_old")
+	if err != nil || !match.previous {
+		t.Fatalf("old key should match as previous within grace, got %+v %v", match, err)
+	}
+	trackAPIKeyRequest(db, apiKeyRequest{match: match, outcome: apiKeyServed, status: http.StatusOK, at: time.Now()})
+
+	var reloaded database.APIKey
+	db.First(&reloaded, dbKey.ID)
+	if reloaded.PrevUsedAt == nil || reloaded.LastUsedAt != nil {
+		t.Fatalf("usage of the old key should only touch prev_used_at: %+v", reloaded)
+	}
+
+	// 宽限期结束后旧密钥失效
+	expired := time.Now().Add(-time.Minute)
+	db.Model(&dbKey).Update("grace_until", expired)
+	if _, err := lookupAPIKey(db, "ydms_test_old"); err == nil {
+		t.Fatalf("old key should be rejected after the grace window")
+	}
+	if match, err := lookupAPIKey(db, "ydms_test_new"); err != nil || match.previous {
+		t.Fatalf("new key should still be valid, got %+v %v", match, err)
+	}
+}
@@ -0,0 +1,341 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+// APIKeyUsageLogRetention 请求日志保留时长
+const APIKeyUsageLogRetention = 7 * 24 * time.Hour
+
+// usageLogPruneEvery 两次清理过期请求日志之间的最小间隔
+const usageLogPruneEvery = time.Hour
+
+// maxPendingUsageLogs 内存中最多暂存的请求日志条数，超出后丢弃并计数
+const maxPendingUsageLogs = 10000
+
+// lastUsageLogPrune 上次清理请求日志的时间（UnixNano）
+var lastUsageLogPrune atomic.Int64
+
+// apiKeyOutcome API Key 请求的处理结果
+type apiKeyOutcome int
+
+const (
+	apiKeyServed    apiKeyOutcome = iota // 已交给业务 handler 处理
+	apiKeyThrottled                      // 因限流被拒绝
+	apiKeyBlocked                        // 来源 IP 不在允许列表内
+)
+
+// apiKeyRequest 一次 API Key 请求的记录信息
+type apiKeyRequest struct {
+	match   apiKeyMatch
+	outcome apiKeyOutcome
+	ip      string
+	method  string
+	route   string
+	status  int
+	at      time.Time
+}
+
+// usageDayKey 每日计数的聚合键
+type usageDayKey struct {
+	keyID uint
+	day   string
+}
+
+// usageCounts 每日计数增量
+type usageCounts struct {
+	requests  int64
+	throttled int64
+	updatedAt time.Time
+}
+
+// usageBatch 一批待写入的使用记录，同一 Key 的最后使用时间与每日计数会被合并
+type usageBatch struct {
+	lastUsed map[uint]time.Time // 新密钥最后使用时间
+	prevUsed map[uint]time.Time // 轮换前旧密钥最后使用时间
+	daily    map[usageDayKey]*usageCounts
+	logs     []database.APIKeyUsageLog
+}
+
+func newUsageBatch() *usageBatch {
+	return &usageBatch{
+		lastUsed: make(map[uint]time.Time),
+		prevUsed: make(map[uint]time.Time),
+		daily:    make(map[usageDayKey]*usageCounts),
+	}
+}
+
+// add 合并一次请求，返回请求日志是否被接收（暂存已满时丢弃）
+func (b *usageBatch) add(req apiKeyRequest) bool {
+	keyID := req.match.key.ID
+	if req.outcome == apiKeyServed {
+		target := b.lastUsed
+		if req.match.previous {
+			target = b.prevUsed
+		}
+		if req.at.After(target[keyID]) {
+			target[keyID] = req.at
+		}
+	}
+	if req.outcome != apiKeyBlocked {
+		dayKey := usageDayKey{keyID: keyID, day: req.at.UTC().Format(database.APIKeyUsageDayLayout)}
+		counts, ok := b.daily[dayKey]
+		if !ok {
+			counts = &usageCounts{}
+			b.daily[dayKey] = counts
+		}
+		if req.outcome == apiKeyThrottled {
+			counts.throttled++
+		} else {
+			counts.requests++
+		}
+		if req.at.After(counts.updatedAt) {
+			counts.updatedAt = req.at
+		}
+	}
+
+	if len(b.logs) >= maxPendingUsageLogs {
+		return false
+	}
+	b.logs = append(b.logs, database.APIKeyUsageLog{
+		APIKeyID:    keyID,
+		CreatedAt:   req.at,
+		IP:          req.ip,
+		Method:      req.method,
+		Route:       truncate(req.route, 512),
+		Status:      req.status,
+		PreviousKey: req.match.previous,
+	})
+	return true
+}
+
+// size 待写入的记录数
+func (b *usageBatch) size() int {
+	return len(b.lastUsed) + len(b.prevUsed) + len(b.daily) + len(b.logs)
+}
+
+// write 将批次写入数据库，单项失败不影响其余记录，返回遇到的第一个错误
+func (b *usageBatch) write(db *gorm.DB) error {
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for column, values := range map[string]map[uint]time.Time{"last_used_at": b.lastUsed, "prev_used_at": b.prevUsed} {
+		for keyID, at := range values {
+			// 只前进不后退，避免较早的批次覆盖较新的时间
+			keep(db.Model(&database.APIKey{}).
+				Where("id = ? AND ("+column+" IS NULL OR "+column+" < ?)", keyID, at).
+				Update(column, at).Error)
+		}
+	}
+	for dayKey, counts := range b.daily {
+		keep(addAPIKeyUsage(db, dayKey, *counts))
+	}
+	if len(b.logs) > 0 {
+		keep(db.CreateInBatches(b.logs, 200).Error)
+	}
+
+	now := time.Now()
+	last := lastUsageLogPrune.Load()
+	if now.Sub(time.Unix(0, last)) >= usageLogPruneEvery && lastUsageLogPrune.CompareAndSwap(last, now.UnixNano()) {
+		PruneAPIKeyUsageLogs(db, now)
+	}
+	return firstErr
+}
+
+// trackAPIKeyRequest 同步记录一次 API Key 请求（未配置 UsageRecorder 时使用）
+// 通过旧密钥访问时更新 prev_used_at，便于确认客户端是否已切换到新密钥
+func trackAPIKeyRequest(db *gorm.DB, req apiKeyRequest) {
+	batch := newUsageBatch()
+	batch.add(req)
+	if err := batch.write(db); err != nil {
+		log.Printf("failed to record API key usage: %v", err)
+	}
+}
+
+// UsageRecorder 在后台按固定间隔批量写入 API Key 使用记录
+// 请求路径上只做内存合并，不再为每个请求启动 goroutine 或执行 UPDATE
+type UsageRecorder struct {
+	db       *gorm.DB
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending *usageBatch
+	dropped int64
+
+	flushMu   sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewUsageRecorder 创建并启动后台刷新协程
+func NewUsageRecorder(db *gorm.DB, interval time.Duration) *UsageRecorder {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	u := &UsageRecorder{
+		db:       db,
+		interval: interval,
+		pending:  newUsageBatch(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go u.loop()
+	return u
+}
+
+func (u *UsageRecorder) loop() {
+	defer close(u.done)
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			u.flushAndLog()
+		case <-u.stop:
+			u.flushAndLog()
+			return
+		}
+	}
+}
+
+func (u *UsageRecorder) flushAndLog() {
+	if err := u.Flush(); err != nil {
+		log.Printf("failed to flush API key usage: %v", err)
+	}
+}
+
+// record 合并一次请求到待写入批次
+func (u *UsageRecorder) record(req apiKeyRequest) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.pending.add(req) {
+		u.dropped++
+	}
+}
+
+// QueueDepth 当前等待写入的记录数
+func (u *UsageRecorder) QueueDepth() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.pending.size()
+}
+
+// Flush 立即写入当前暂存的记录
+func (u *UsageRecorder) Flush() error {
+	u.flushMu.Lock()
+	defer u.flushMu.Unlock()
+
+	u.mu.Lock()
+	batch := u.pending
+	dropped := u.dropped
+	u.pending = newUsageBatch()
+	u.dropped = 0
+	u.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("warning: dropped %d API key usage log entries (queue full)", dropped)
+	}
+	if batch.size() == 0 {
+		return nil
+	}
+	return batch.write(u.db)
+}
+
+// Close 停止后台协程并写入剩余记录，ctx 到期时放弃等待
+func (u *UsageRecorder) Close(ctx context.Context) error {
+	u.closeOnce.Do(func() { close(u.stop) })
+	select {
+	case <-u.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recordAPIKeyRequest 记录一次 API Key 请求：有 UsageRecorder 时批量写入，否则同步写入
+func recordAPIKeyRequest(db *gorm.DB, recorder *UsageRecorder, req apiKeyRequest) {
+	if recorder != nil {
+		recorder.record(req)
+		return
+	}
+	trackAPIKeyRequest(db, req)
+}
+
+// PruneAPIKeyUsageLogs 删除超出保留时长的请求日志
+func PruneAPIKeyUsageLogs(db *gorm.DB, now time.Time) {
+	cutoff := now.Add(-APIKeyUsageLogRetention)
+	if err := db.Where("created_at < ?", cutoff).Delete(&database.APIKeyUsageLog{}).Error; err != nil {
+		log.Printf("failed to prune API key usage logs: %v", err)
+	}
+}
+
+// RecordAPIKeyUsage 累加 API Key 在指定日期（UTC）的请求计数
+// throttled 为 true 时计入被限流拒绝的次数
+func RecordAPIKeyUsage(db *gorm.DB, keyID uint, at time.Time, throttled bool) error {
+	counts := usageCounts{requests: 1, updatedAt: at}
+	if throttled {
+		counts = usageCounts{throttled: 1, updatedAt: at}
+	}
+	return addAPIKeyUsage(db, usageDayKey{keyID: keyID, day: at.UTC().Format(database.APIKeyUsageDayLayout)}, counts)
+}
+
+// addAPIKeyUsage 以 upsert 方式累加每日计数
+func addAPIKeyUsage(db *gorm.DB, dayKey usageDayKey, counts usageCounts) error {
+	row := database.APIKeyDailyUsage{
+		APIKeyID:       dayKey.keyID,
+		Day:            dayKey.day,
+		RequestCount:   counts.requests,
+		ThrottledCount: counts.throttled,
+		UpdatedAt:      counts.updatedAt,
+	}
+	table := row.TableName()
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "api_key_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"request_count":   gorm.Expr(table+".request_count + ?", counts.requests),
+			"throttled_count": gorm.Expr(table+".throttled_count + ?", counts.throttled),
+			"updated_at":      counts.updatedAt,
+		}),
+	}).Create(&row).Error
+}
+
+// statusRecorder 记录下游 handler 写出的状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush 透传 http.Flusher，避免影响流式响应
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// truncate 按字节截断字符串
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max]
+}
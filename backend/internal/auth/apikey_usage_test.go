@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+func TestUsageRecorderCoalescesAndFlushesOnClose(t *testing.T) {
+	db := setupTestDB(t)
+
+	user := database.User{Username: "sync", PasswordHash: "hash", Role: "course_admin"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	dbKey := database.APIKey{Name: "sync", KeyHash: "h", KeyPrefix: "p", UserID: user.ID}
+	if err := db.Create(&dbKey).Error; err != nil {
+		t.Fatalf("failed to create API key: %v", err)
+	}
+
+	// 间隔足够长，确保只有 Close 会触发写入
+	recorder := NewUsageRecorder(db, time.Hour)
+	match := apiKeyMatch{key: &dbKey}
+	start := time.Now().Truncate(time.Second)
+	for i := 0; i < 5; i++ {
+		recorder.record(apiKeyRequest{match: match, outcome: apiKeyServed, status: http.StatusOK, route: "/api/v1/documents", at: start.Add(time.Duration(i) * time.Second)})
+	}
+	recorder.record(apiKeyRequest{match: match, outcome: apiKeyThrottled, status: http.StatusTooManyRequests, at: start})
+
+	// 1 个最后使用时间 + 1 个每日计数 + 6 条请求日志
+	if depth := recorder.QueueDepth(); depth != 8 {
+		t.Fatalf("expected queue depth 8, got %d", depth)
+	}
+	var reloaded database.APIKey
+	db.First(&reloaded, dbKey.ID)
+	if reloaded.LastUsedAt != nil {
+		t.Fatalf("nothing should be written before flush")
+	}
+
+	if err := recorder.Close(context.Background()); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if depth := recorder.QueueDepth(); depth != 0 {
+		t.Fatalf("expected empty queue after close, got %d", depth)
+	}
+
+	db.First(&reloaded, dbKey.ID)
+	if reloaded.LastUsedAt == nil || !reloaded.LastUsedAt.Equal(start.Add(4*time.Second)) {
+		t.Fatalf("expected last_used_at to be the latest request, got %v", reloaded.LastUsedAt)
+	}
+	var usage database.APIKeyDailyUsage
+	if err := db.Where("api_key_id = ?", dbKey.ID).First(&usage).Error; err != nil {
+		t.Fatalf("daily usage missing: %v", err)
+	}
+	if usage.RequestCount != 5 || usage.ThrottledCount != 1 {
+		t.Fatalf("unexpected daily usage: %+v", usage)
+	}
+	var logs int64
+	db.Model(&database.APIKeyUsageLog{}).Where("api_key_id = ?", dbKey.ID).Count(&logs)
+	if logs != 6 {
+		t.Fatalf("expected 6 usage log rows, got %d", logs)
+	}
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+// ParseCIDRs 解析 CIDR 列表，单个 IP 视为 /32（IPv6 为 /128）
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, raw := range values {
+		value := strings.TrimSpace(raw)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", value)
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+// containsIP 判断 IP 是否落在任一网段内
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, network := range nets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP 解析请求的真实客户端 IP
+// 仅当 RemoteAddr 属于受信任代理（如生产环境的 nginx）时才采信 X-Forwarded-For，
+// 并从右向左跳过受信任代理，取第一个不受信任的地址，防止客户端伪造该请求头。
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+	if remote == nil || !containsIP(trustedProxies, remote) {
+		return remote
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client := remote
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			// 无法解析的条目之前的内容都不可信
+			break
+		}
+		client = ip
+		if !containsIP(trustedProxies, ip) {
+			break
+		}
+	}
+	return client
+}
+
+// checkAPIKeySource 校验请求来源 IP 是否在 API Key 的允许列表内（列表为空表示不限制）
+func checkAPIKeySource(key *database.APIKey, ip net.IP) error {
+	if key.AllowCIDRs == "" {
+		return nil
+	}
+	var values []string
+	if err := json.Unmarshal([]byte(key.AllowCIDRs), &values); err != nil {
+		return fmt.Errorf("invalid allow-list on API key %d", key.ID)
+	}
+	nets, err := ParseCIDRs(values)
+	if err != nil {
+		return fmt.Errorf("invalid allow-list on API key %d: %w", key.ID, err)
+	}
+	if len(nets) == 0 {
+		return nil
+	}
+	if ip == nil || !containsIP(nets, ip) {
+		return fmt.Errorf("API key is not allowed from %s", ip)
+	}
+	return nil
+}
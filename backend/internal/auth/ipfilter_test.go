@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+func TestClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	trusted, err := ParseCIDRs([]string{"172.20.0.10"})
+	if err != nil {
+		t.Fatalf("parse trusted proxies: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct request ignores header", "203.0.113.7:5000", "10.0.0.1", "203.0.113.7"},
+		{"trusted proxy forwards client", "172.20.0.10:40000", "198.51.100.4", "198.51.100.4"},
+		{"spoofed leftmost entry is skipped", "172.20.0.10:40000", "10.0.0.1, 198.51.100.4", "198.51.100.4"},
+		{"trusted proxy without header", "172.20.0.10:40000", "", "172.20.0.10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := ClientIP(req, trusted); got.String() != tt.want {
+				t.Fatalf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAllowListAndUsageLog(t *testing.T) {
+	db := setupTestDB(t)
+
+	user := database.User{Username: "partner", PasswordHash: "hash", Role: "course_admin"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	apiKey, _ := GenerateAPIKey("test")
+	dbKey := database.APIKey{
+		Name:       "office only",
+		KeyHash:    HashAPIKey(apiKey),
+		KeyPrefix:  apiKey[:16],
+		UserID:     user.ID,
+		AllowCIDRs: `["198.51.100.0/24"]`,
+	}
+	if err := db.Create(&dbKey).Error; err != nil {
+		t.Fatalf("failed to create API key: %v", err)
+	}
+
+	trusted := []*net.IPNet{{IP: net.IPv4(172, 20, 0, 10).To4(), Mask: net.CIDRMask(32, 32)}}
+	handler := FlexibleAuthMiddleware(db, "secret", FlexibleAuthOptions{TrustedProxies: trusted})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func(remote, forwarded string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/documents", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-API-Key", apiKey)
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send("172.20.0.10:1234", "198.51.100.9"); code != http.StatusNoContent {
+		t.Fatalf("allowed client behind nginx should pass, got %d", code)
+	}
+	if code := send("203.0.113.5:1234", "198.51.100.9"); code != http.StatusForbidden {
+		t.Fatalf("spoofed header from untrusted peer should be rejected, got %d", code)
+	}
+
+	match, err := lookupAPIKey(db, apiKey)
+	if err != nil {
+		t.Fatalf("lookup failed: %v", err)
+	}
+	trackAPIKeyRequest(db, apiKeyRequest{match: match, outcome: apiKeyBlocked, ip: "203.0.113.5", method: "GET", route: "/api/v1/documents", status: http.StatusForbidden, at: time.Now()})
+
+	var logs []database.APIKeyUsageLog
+	if err := db.Where("api_key_id = ? AND status = ?", dbKey.ID, http.StatusForbidden).Find(&logs).Error; err != nil {
+		t.Fatalf("query usage logs: %v", err)
+	}
+	if len(logs) == 0 || logs[0].IP != "203.0.113.5" || logs[0].Route != "/api/v1/documents" {
+		t.Fatalf("expected blocked request in usage log, got %+v", logs)
+	}
+
+	// 超出保留期的日志会被清理
+	later := time.Now().Add(APIKeyUsageLogRetention + time.Hour)
+	PruneAPIKeyUsageLogs(db, later)
+	var remaining int64
+	db.Model(&database.APIKeyUsageLog{}).Where("created_at < ?", later.Add(-APIKeyUsageLogRetention)).Count(&remaining)
+	if remaining != 0 {
+		t.Fatalf("expected expired logs to be pruned, %d left", remaining)
+	}
+}
@@ -12,9 +12,17 @@ type Claims struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
 	Role     string `json:"role"`
+	Purpose  string `json:"purpose,omitempty"` // 非空表示受限用途的 token（如两步验证的预认证 token），不能用于访问 API
 	jwt.RegisteredClaims
 }
 
+// 受限 token 的用途
+const (
+	PurposeMFA            = "mfa"             // 已通过密码验证，等待输入 TOTP 验证码或恢复码
+	PurposeMFAEnroll      = "mfa_enroll"      // 已通过密码验证，但角色要求两步验证且尚未绑定
+	PurposePasswordChange = "password_change" // 已使用管理员重置的临时密码登录，必须先设置新密码
+)
+
 // GenerateToken 生成 JWT token
 func GenerateToken(userID uint, username, role string, secret string, expiry time.Duration) (string, error) {
 	now := time.Now()
@@ -48,8 +56,54 @@ func ValidateToken(tokenString, secret string) (*Claims, error) {
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		// 预认证 token 不能当作访问 token 使用
+		if claims.Purpose != "" {
+			return nil, errors.New("invalid token")
+		}
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid token")
 }
+
+// GeneratePreAuthToken 生成两步验证过程中使用的短期预认证 token
+func GeneratePreAuthToken(userID uint, username, purpose, secret string, expiry time.Duration) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		UserID:   userID,
+		Username: username,
+		Purpose:  purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// ValidatePreAuthToken 验证预认证 token，并检查用途是否匹配
+func ValidatePreAuthToken(tokenString, secret string, purposes ...string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	for _, purpose := range purposes {
+		if claims.Purpose == purpose {
+			return claims, nil
+		}
+	}
+	return nil, errors.New("invalid pre-auth token")
+}
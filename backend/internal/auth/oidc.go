@@ -0,0 +1,343 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PurposeOIDCState OIDC 登录过程中保存 state/nonce 的 cookie token 用途
+const PurposeOIDCState = "oidc_state"
+
+// jwksRefreshInterval 遇到未知 kid 时重新拉取 JWKS 的最小间隔
+const jwksRefreshInterval = time.Minute
+
+// OIDCConfig OIDC 客户端配置
+type OIDCConfig struct {
+	Issuer       string // IdP 的 issuer，用于拼接 /.well-known/openid-configuration
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // 回调地址，需与 IdP 中登记的一致
+	Scopes       []string // 默认 openid profile email
+}
+
+// OIDCIdentity 从已验证的 ID Token 中提取的身份信息
+type OIDCIdentity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	Claims            map[string]interface{}
+}
+
+// Claim 返回字符串类型的声明值（不存在或非字符串时为空）
+func (i *OIDCIdentity) Claim(name string) string {
+	value, _ := i.Claims[name].(string)
+	return value
+}
+
+// oidcMetadata discovery 文档中用到的字段
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider OIDC 授权码流程客户端（含 PKCE）
+// discovery 文档与 JWKS 在首次使用时拉取并缓存，IdP 暂时不可用不会影响服务启动
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	meta        *oidcMetadata
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// NewOIDCProvider 创建 OIDC 客户端，client 为空时使用带超时的默认客户端
+func NewOIDCProvider(cfg OIDCConfig, client *http.Client) *OIDCProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	return &OIDCProvider{cfg: cfg, client: client, now: time.Now}
+}
+
+// metadata 获取（并缓存）discovery 文档
+func (p *OIDCProvider) metadata(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	var meta oidcMetadata
+	if err := p.getJSON(ctx, p.cfg.Issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery returned issuer %q, expected %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is missing required endpoints")
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// AuthCodeURL 生成跳转到 IdP 的授权地址
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+// Exchange 用授权码换取 ID Token 并验证签名、issuer、audience、有效期与 nonce
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCIdentity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("oidc token request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token endpoint returned %d: %s", resp.StatusCode, truncate(string(body), 200))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.IDToken == "" {
+		return nil, errors.New("oidc token response does not contain an id_token")
+	}
+	return p.verifyIDToken(ctx, meta, token.IDToken, nonce)
+}
+
+// verifyIDToken 验证 ID Token 并提取身份信息
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, meta *oidcMetadata, raw, nonce string) (*OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.signingKey(ctx, meta, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+		jwt.WithTimeFunc(p.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if got, _ := claims["nonce"].(string); nonce == "" || got != nonce {
+		return nil, errors.New("invalid id_token: nonce mismatch")
+	}
+	// 多个 audience 时要求 azp 为本客户端
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.cfg.ClientID {
+			return nil, errors.New("invalid id_token: azp mismatch")
+		}
+	}
+
+	identity := &OIDCIdentity{Issuer: meta.Issuer, Claims: claims}
+	identity.Subject = identity.Claim("sub")
+	identity.Email = identity.Claim("email")
+	identity.Name = identity.Claim("name")
+	identity.PreferredUsername = identity.Claim("preferred_username")
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	if identity.Subject == "" {
+		return nil, errors.New("invalid id_token: missing sub")
+	}
+	return identity, nil
+}
+
+// signingKey 按 kid 查找签名公钥，未知 kid 时刷新 JWKS（IdP 轮换密钥）
+func (p *OIDCProvider) signingKey(ctx context.Context, meta *oidcMetadata, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.lookupKeyLocked(kid); key != nil {
+		return key, nil
+	}
+	if p.keys != nil && p.now().Sub(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+	p.keysFetched = p.now()
+
+	if key := p.lookupKeyLocked(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKeyLocked 查找公钥；未指定 kid 且只有一个公钥时直接使用
+func (p *OIDCProvider) lookupKeyLocked(kid string) *rsa.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, target string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// OIDCState 登录跳转期间保存在 cookie 中的状态
+type OIDCState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Purpose  string `json:"purpose"` // 固定为 PurposeOIDCState，防止被当作访问 token
+	jwt.RegisteredClaims
+}
+
+// NewOIDCState 生成随机的 state、nonce 与 PKCE verifier
+func NewOIDCState() (*OIDCState, error) {
+	values := make([]string, 3)
+	for i := range values {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	return &OIDCState{State: values[0], Nonce: values[1], Verifier: values[2], Purpose: PurposeOIDCState}, nil
+}
+
+// SignOIDCState 签名状态，用于写入 cookie
+func SignOIDCState(state *OIDCState, secret string, expiry time.Duration) (string, error) {
+	now := time.Now()
+	claims := *state
+	claims.Purpose = PurposeOIDCState
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
+
+// ParseOIDCState 验证并解析 cookie 中的状态
+func ParseOIDCState(tokenString, secret string) (*OIDCState, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &OIDCState{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	state, ok := token.Claims.(*OIDCState)
+	if !ok || !token.Valid || state.Purpose != PurposeOIDCState {
+		return nil, errors.New("invalid oidc state")
+	}
+	return state, nil
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/auth/oidctest"
+)
+
+// authorizeCode 访问模拟 IdP 的授权端点，返回回调中携带的授权码
+func authorizeCode(t *testing.T, provider *OIDCProvider, state *OIDCState) string {
+	t.Helper()
+	target, err := provider.AuthCodeURL(context.Background(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("unexpected authorize response %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if location.Query().Get("state") != state.State {
+		t.Fatalf("state was not echoed back")
+	}
+	return location.Query().Get("code")
+}
+
+func TestOIDCExchangeVerifiesIDToken(t *testing.T) {
+	idp := oidctest.NewServer("ydms", "s3cret")
+	defer idp.Close()
+	idp.SetClaims(map[string]interface{}{
+		"sub":                "u-42",
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+	})
+
+	provider := NewOIDCProvider(OIDCConfig{
+		Issuer:       idp.Issuer(),
+		ClientID:     "ydms",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://ydms.example.com/api/v1/auth/oidc/callback",
+	}, nil)
+
+	state, err := NewOIDCState()
+	if err != nil {
+		t.Fatalf("NewOIDCState: %v", err)
+	}
+	identity, err := provider.Exchange(context.Background(), authorizeCode(t, provider, state), state.Verifier, state.Nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Issuer != idp.Issuer() || identity.Subject != "u-42" || identity.Claim("preferred_username") != "alice" || !identity.EmailVerified {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+
+	// nonce 不匹配时拒绝
+	state, _ = NewOIDCState()
+	if _, err := provider.Exchange(context.Background(), authorizeCode(t, provider, state), state.Verifier, "other-nonce"); err == nil {
+		t.Fatalf("expected nonce mismatch to be rejected")
+	}
+
+	// PKCE verifier 不匹配时 IdP 拒绝兑换
+	state, _ = NewOIDCState()
+	if _, err := provider.Exchange(context.Background(), authorizeCode(t, provider, state), "wrong-verifier", state.Nonce); err == nil {
+		t.Fatalf("expected PKCE mismatch to be rejected")
+	}
+
+	// audience 不匹配时拒绝（IdP 为其他 client 签发的 token）
+	idp.SetClaims(map[string]interface{}{"sub": "u-42", "aud": "someone-else"})
+	state, _ = NewOIDCState()
+	if _, err := provider.Exchange(context.Background(), authorizeCode(t, provider, state), state.Verifier, state.Nonce); err == nil {
+		t.Fatalf("expected audience mismatch to be rejected")
+	}
+}
+
+func TestOIDCStateRoundTrip(t *testing.T) {
+	state, err := NewOIDCState()
+	if err != nil {
+		t.Fatalf("NewOIDCState: %v", err)
+	}
+	signed, err := SignOIDCState(state, "secret", time.Minute)
+	if err != nil {
+		t.Fatalf("SignOIDCState: %v", err)
+	}
+	parsed, err := ParseOIDCState(signed, "secret")
+	if err != nil || parsed.State != state.State || parsed.Nonce != state.Nonce || parsed.Verifier != state.Verifier {
+		t.Fatalf("state did not round-trip: %+v, %v", parsed, err)
+	}
+	if _, err := ParseOIDCState(signed, "other"); err == nil {
+		t.Fatalf("expected wrong secret to be rejected")
+	}
+	// 状态 cookie 不能当作访问 token 使用
+	if _, err := ValidateToken(signed, "secret"); err == nil {
+		t.Fatalf("expected oidc state to be rejected as access token")
+	}
+}
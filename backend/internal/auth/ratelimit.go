@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+// RateLimit 令牌桶限流参数
+type RateLimit struct {
+	PerMinute int // 每分钟补充的令牌数（<=0 表示不限流）
+	Burst     int // 桶容量（<=0 时与 PerMinute 相同）
+}
+
+// capacity 返回桶容量
+func (l RateLimit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.PerMinute)
+}
+
+// unlimited 是否不限流
+func (l RateLimit) unlimited() bool {
+	return l.PerMinute <= 0
+}
+
+// tokenBucket 单个限流对象的令牌桶状态
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	limit  RateLimit
+}
+
+// RateLimiter 基于令牌桶的内存限流器
+// 按 API Key ID 与 JWT 用户 ID 分别计数，单实例部署下有效
+type RateLimiter struct {
+	mu           sync.Mutex
+	buckets      map[string]*tokenBucket
+	apiKeyLimit  RateLimit
+	userLimit    RateLimit
+	now          func() time.Time
+	callsToPrune int
+}
+
+// bucketPruneInterval 每处理多少次请求清理一次空闲的令牌桶
+const bucketPruneInterval = 1024
+
+// NewRateLimiter 创建限流器
+// apiKeyLimit 为 API Key 的默认限额（可被 APIKey.RateLimit 覆盖），userLimit 为 JWT 用户的限额
+func NewRateLimiter(apiKeyLimit, userLimit RateLimit) *RateLimiter {
+	return &RateLimiter{
+		buckets:     make(map[string]*tokenBucket),
+		apiKeyLimit: apiKeyLimit,
+		userLimit:   userLimit,
+		now:         time.Now,
+	}
+}
+
+// AllowAPIKey 检查 API Key 是否还有剩余额度，返回是否放行以及需要等待的时间
+func (l *RateLimiter) AllowAPIKey(key *database.APIKey) (bool, time.Duration) {
+	limit := l.apiKeyLimit
+	if key.RateLimit > 0 {
+		limit = RateLimit{PerMinute: key.RateLimit, Burst: key.RateBurst}
+	}
+	return l.allow(fmt.Sprintf("apikey:%d", key.ID), limit)
+}
+
+// AllowUser 检查 JWT 用户是否还有剩余额度
+func (l *RateLimiter) AllowUser(userID uint) (bool, time.Duration) {
+	return l.allow(fmt.Sprintf("user:%d", userID), l.userLimit)
+}
+
+// allow 从指定桶中取出一个令牌
+func (l *RateLimiter) allow(bucketKey string, limit RateLimit) (bool, time.Duration) {
+	if limit.unlimited() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.pruneLocked(now)
+
+	capacity := limit.capacity()
+	rate := float64(limit.PerMinute) / float64(time.Minute)
+
+	bucket, ok := l.buckets[bucketKey]
+	if !ok || bucket.limit != limit {
+		// 首次访问或限额被修改时重新装满
+		bucket = &tokenBucket{tokens: capacity, last: now, limit: limit}
+		l.buckets[bucketKey] = bucket
+	} else {
+		elapsed := now.Sub(bucket.last)
+		if elapsed > 0 {
+			bucket.tokens = math.Min(capacity, bucket.tokens+float64(elapsed)*rate)
+			bucket.last = now
+		}
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration(math.Ceil((1 - bucket.tokens) / rate))
+	return false, wait
+}
+
+// pruneLocked 定期清理已经补满的令牌桶，避免内存无限增长
+func (l *RateLimiter) pruneLocked(now time.Time) {
+	l.callsToPrune++
+	if l.callsToPrune < bucketPruneInterval {
+		return
+	}
+	l.callsToPrune = 0
+
+	for key, bucket := range l.buckets {
+		rate := float64(bucket.limit.PerMinute) / float64(time.Minute)
+		refilled := bucket.tokens + float64(now.Sub(bucket.last))*rate
+		if refilled >= bucket.limit.capacity() {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// respondRateLimited 返回 429 并设置 Retry-After（秒，向上取整）
+func respondRateLimited(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondError(w, http.StatusTooManyRequests, errors.New("rate limit exceeded"))
+}
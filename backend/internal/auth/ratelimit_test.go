@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+func TestRateLimiterRefillsTokens(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(RateLimit{PerMinute: 60, Burst: 2}, RateLimit{})
+	limiter.now = func() time.Time { return now }
+
+	key := &database.APIKey{ID: 1}
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.AllowAPIKey(key); !ok {
+			t.Fatalf("request %d should pass within burst", i+1)
+		}
+	}
+
+	ok, wait := limiter.AllowAPIKey(key)
+	if ok || wait != time.Second {
+		t.Fatalf("expected rejection with 1s wait, got ok=%v wait=%v", ok, wait)
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := limiter.AllowAPIKey(key); !ok {
+		t.Fatalf("expected one token to be refilled after 1s")
+	}
+
+	// 每个 Key 的独立限额覆盖默认值
+	custom := &database.APIKey{ID: 2, RateLimit: 1}
+	if ok, _ := limiter.AllowAPIKey(custom); !ok {
+		t.Fatalf("first request with custom limit should pass")
+	}
+	if ok, wait := limiter.AllowAPIKey(custom); ok || wait != time.Minute {
+		t.Fatalf("expected custom limit to reject with 1m wait, got ok=%v wait=%v", ok, wait)
+	}
+
+	// 用户限额为 0 表示不限流
+	for i := 0; i < 100; i++ {
+		if ok, _ := limiter.AllowUser(7); !ok {
+			t.Fatalf("unlimited user should never be throttled")
+		}
+	}
+}
+
+func TestFlexibleAuthMiddlewareRateLimitsAPIKey(t *testing.T) {
+	db := setupTestDB(t)
+
+	user := database.User{Username: "sync", PasswordHash: "hash", Role: "course_admin"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to create test user: %v", err)
+	}
+	apiKey, _ := GenerateAPIKey("test")
+	dbKey := database.APIKey{
+		Name:      "partner sync",
+		KeyHash:   HashAPIKey(apiKey),
+		KeyPrefix: apiKey[:16],
+		UserID:    user.ID,
+		RateLimit: 1,
+	}
+	if err := db.Create(&dbKey).Error; err != nil {
+		t.Fatalf("failed to create API key: %v", err)
+	}
+
+	limiter := NewRateLimiter(RateLimit{PerMinute: 100}, RateLimit{})
+	handler := FlexibleAuthMiddleware(db, "secret", FlexibleAuthOptions{RateLimiter: limiter})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/documents", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(); rec.Code != http.StatusNoContent {
+		t.Fatalf("first request should pass, got %d", rec.Code)
+	}
+	rec := send()
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rec.Code)
+	}
+	if retry := rec.Header().Get("Retry-After"); retry != "60" {
+		t.Fatalf("expected Retry-After 60, got %q", retry)
+	}
+}
+
+func TestRecordAPIKeyUsageAccumulatesPerDay(t *testing.T) {
+	db := setupTestDB(t)
+
+	day := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	for _, throttled := range []bool{false, false, true} {
+		if err := RecordAPIKeyUsage(db, 3, day, throttled); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	if err := RecordAPIKeyUsage(db, 3, day.Add(2*time.Hour), false); err != nil {
+		t.Fatalf("record usage: %v", err)
+	}
+
+	var rows []database.APIKeyDailyUsage
+	if err := db.Order("day").Find(&rows).Error; err != nil {
+		t.Fatalf("query usage: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected two daily rows, got %+v", rows)
+	}
+	if rows[0].Day != "2024-05-01" || rows[0].RequestCount != 2 || rows[0].ThrottledCount != 1 {
+		t.Fatalf("unexpected first day: %+v", rows[0])
+	}
+	if rows[1].Day != "2024-05-02" || rows[1].RequestCount != 1 {
+		t.Fatalf("unexpected second day: %+v", rows[1])
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// RFC 6238 附录 B 的 SHA1 测试向量（取后 6 位）
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil || got != want {
+			t.Fatalf("TOTPCode at %d = %q, %v; want %q", unix, got, err, want)
+		}
+	}
+}
+
+func TestValidateTOTPAllowsOneStepOfSkew(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("generate secret: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	previous, _ := TOTPCode(secret, TOTPStep(now)-1)
+	if step, ok := ValidateTOTP(secret, previous, now); !ok || step != TOTPStep(now)-1 {
+		t.Fatalf("expected previous step to be accepted")
+	}
+	stale, _ := TOTPCode(secret, TOTPStep(now)-3)
+	if _, ok := ValidateTOTP(secret, stale, now); ok {
+		t.Fatalf("expected stale code to be rejected")
+	}
+
+	uri := TOTPURI("YDMS", "alice", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/YDMS:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("unexpected otpauth URI: %s", uri)
+	}
+}
+
+func TestPreAuthTokenCannotBeUsedAsAccessToken(t *testing.T) {
+	token, err := GeneratePreAuthToken(7, "alice", PurposeMFA, "secret", time.Minute)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if _, err := ValidateToken(token, "secret"); err == nil {
+		t.Fatalf("pre-auth token must not validate as an access token")
+	}
+	if _, err := ValidatePreAuthToken(token, "secret", PurposeMFAEnroll); err == nil {
+		t.Fatalf("pre-auth token must not validate for a different purpose")
+	}
+	claims, err := ValidatePreAuthToken(token, "secret", PurposeMFA)
+	if err != nil || claims.UserID != 7 {
+		t.Fatalf("expected pre-auth token to validate: %v", err)
+	}
+
+	access, _ := GenerateToken(7, "alice", "super_admin", "secret", time.Minute)
+	if _, err := ValidatePreAuthToken(access, "secret", PurposeMFA); err == nil {
+		t.Fatalf("access token must not validate as a pre-auth token")
+	}
+}
+
+func TestRecoveryCodeFormat(t *testing.T) {
+	code, err := GenerateRecoveryCode()
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(code) != 11 || code[5] != '-' {
+		t.Fatalf("unexpected recovery code %q", code)
+	}
+	if NormalizeRecoveryCode(strings.ToLower(strings.Replace(code, "-", " ", 1))) != code {
+		t.Fatalf("normalization should accept lowercase input without the dash")
+	}
+}
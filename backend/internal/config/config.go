@@ -15,6 +15,14 @@ type Config struct {
 	DB       DBConfig
 	JWT      JWTConfig
 	Admin    AdminBootstrapConfig
+	Limits   RateLimitConfig
+	APIKeys  APIKeyConfig
+	Password PasswordConfig
+	Lockout  LockoutConfig
+	OIDC     OIDCConfig
+	Jobs     JobConfig
+	Category CategoryConfig
+	Webhooks WebhookConfig
 }
 
 // NDRConfig stores settings for the upstream NDR service.
@@ -30,8 +38,11 @@ type DebugConfig struct {
 
 // AuthConfig contains defaults for user/request metadata.
 type AuthConfig struct {
-	DefaultUserID string
-	AdminKey      string
+	DefaultUserID  string
+	AdminKey       string
+	TrustedProxies []string // CIDRs of reverse proxies whose X-Forwarded-For is trusted
+	Require2FA     bool     // require TOTP two-factor authentication for super_admin and course_admin
+	PasswordLogin  bool     // allow username/password login; disable to force single sign-on
 }
 
 // DBConfig stores database connection settings.
@@ -57,6 +68,78 @@ type JWTConfig struct {
 	Expiry string // e.g., "24h", "7d"
 }
 
+// RateLimitConfig stores default token-bucket limits for authenticated requests.
+// A per-minute value of 0 disables limiting for that kind of caller.
+type RateLimitConfig struct {
+	APIKeyPerMinute int
+	APIKeyBurst     int
+	UserPerMinute   int
+	UserBurst       int
+}
+
+// APIKeyConfig stores API key lifecycle settings.
+type APIKeyConfig struct {
+	RotationGrace string // how long a rotated-out key stays valid, e.g. "24h"
+	UsageFlush    string // how often buffered last-used/usage records are written, e.g. "5s"
+}
+
+// PasswordConfig stores the password policy applied when passwords are set.
+type PasswordConfig struct {
+	MinLength    int
+	MinClasses   int    // required character classes among lowercase, uppercase, digits and symbols
+	HistorySize  int    // number of previous passwords that cannot be reused
+	DenyListFile string // optional file with extra banned passwords, one per line
+}
+
+// LockoutConfig stores failed-login thresholds and lockout timing.
+// A failure limit of 0 disables lockout for that dimension.
+type LockoutConfig struct {
+	MaxUserFailures int
+	MaxIPFailures   int
+	Window          string // e.g. "15m"
+	Duration        string // e.g. "15m"
+}
+
+// OIDCConfig stores OpenID Connect single sign-on settings.
+// Single sign-on is enabled when Issuer and ClientID are both set.
+type OIDCConfig struct {
+	Issuer            string
+	ClientID          string
+	ClientSecret      string
+	RedirectURL       string // public URL of /api/v1/auth/oidc/callback
+	Scopes            []string
+	UsernameClaim     string // ID token claim used as the YDMS username
+	LinkExisting      bool   // link the identity to an existing non-admin user whose username equals the verified email
+	AutoProvision     bool   // create a user on first login when none matches
+	DefaultRole       string // role given to auto-provisioned users
+	PostLoginRedirect string // frontend URL that receives the login result in its fragment
+}
+
+// Enabled reports whether single sign-on is configured.
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != ""
+}
+
+// JobConfig stores settings for the background job workers.
+type JobConfig struct {
+	Workers        int
+	AsyncThreshold int    // bulk requests with more items than this run as background jobs; 0 means only on ?async=true
+	Lease          string // how long a worker owns a job between heartbeats before another worker may take over, e.g. "1m"
+}
+
+// CategoryConfig stores settings for the category tree.
+type CategoryConfig struct {
+	TreeTTL string // how long the server-held tree snapshot is reused without asking NDR, e.g. "30s"; "0" disables it
+}
+
+// WebhookConfig stores settings for outbound webhook delivery.
+type WebhookConfig struct {
+	MaxAttempts int    // deliveries that still fail after this many attempts move to the dead-letter list
+	Timeout     string // per-request timeout when calling a subscriber, e.g. "10s"
+	// AllowPrivateTargets permits subscriber URLs on loopback, link-local and private networks.
+	AllowPrivateTargets bool
+}
+
 // Load builds a Config object from environment variables, providing sane defaults.
 func Load() Config {
 	return Config{
@@ -66,8 +149,11 @@ func Load() Config {
 			APIKey:  firstNonEmpty(os.Getenv("YDMS_NDR_API_KEY"), "not_set"),
 		},
 		Auth: AuthConfig{
-			DefaultUserID: firstNonEmpty(os.Getenv("YDMS_DEFAULT_USER_ID"), "dms"),
-			AdminKey:      firstNonEmpty(os.Getenv("YDMS_ADMIN_KEY"), "not_set"),
+			DefaultUserID:  firstNonEmpty(os.Getenv("YDMS_DEFAULT_USER_ID"), "dms"),
+			AdminKey:       firstNonEmpty(os.Getenv("YDMS_ADMIN_KEY"), "not_set"),
+			TrustedProxies: parseEnvList("YDMS_TRUSTED_PROXIES"),
+			Require2FA:     parseEnvBool("YDMS_REQUIRE_2FA", false),
+			PasswordLogin:  parseEnvBool("YDMS_PASSWORD_LOGIN_ENABLED", true),
 		},
 		Debug: DebugConfig{
 			Traffic: parseEnvBool("YDMS_DEBUG_TRAFFIC", false),
@@ -89,6 +175,53 @@ func Load() Config {
 			Password:    firstNonEmpty(os.Getenv("YDMS_DEFAULT_ADMIN_PASSWORD"), "admin123456"),
 			DisplayName: firstNonEmpty(os.Getenv("YDMS_DEFAULT_ADMIN_DISPLAY_NAME"), "超级管理员"),
 		},
+		Limits: RateLimitConfig{
+			APIKeyPerMinute: parseEnvInt("YDMS_RATE_LIMIT_API_KEY_PER_MINUTE", 300),
+			APIKeyBurst:     parseEnvInt("YDMS_RATE_LIMIT_API_KEY_BURST", 60),
+			UserPerMinute:   parseEnvInt("YDMS_RATE_LIMIT_USER_PER_MINUTE", 600),
+			UserBurst:       parseEnvInt("YDMS_RATE_LIMIT_USER_BURST", 120),
+		},
+		APIKeys: APIKeyConfig{
+			RotationGrace: firstNonEmpty(os.Getenv("YDMS_API_KEY_ROTATION_GRACE"), "24h"),
+			UsageFlush:    firstNonEmpty(os.Getenv("YDMS_API_KEY_USAGE_FLUSH_INTERVAL"), "5s"),
+		},
+		Password: PasswordConfig{
+			MinLength:    parseEnvInt("YDMS_PASSWORD_MIN_LENGTH", 8),
+			MinClasses:   parseEnvInt("YDMS_PASSWORD_MIN_CLASSES", 2),
+			HistorySize:  parseEnvInt("YDMS_PASSWORD_HISTORY", 5),
+			DenyListFile: os.Getenv("YDMS_PASSWORD_DENYLIST_FILE"),
+		},
+		Lockout: LockoutConfig{
+			MaxUserFailures: parseEnvInt("YDMS_LOGIN_MAX_USER_FAILURES", 5),
+			MaxIPFailures:   parseEnvInt("YDMS_LOGIN_MAX_IP_FAILURES", 20),
+			Window:          firstNonEmpty(os.Getenv("YDMS_LOGIN_FAILURE_WINDOW"), "15m"),
+			Duration:        firstNonEmpty(os.Getenv("YDMS_LOGIN_LOCKOUT_DURATION"), "15m"),
+		},
+		OIDC: OIDCConfig{
+			Issuer:            os.Getenv("YDMS_OIDC_ISSUER"),
+			ClientID:          os.Getenv("YDMS_OIDC_CLIENT_ID"),
+			ClientSecret:      os.Getenv("YDMS_OIDC_CLIENT_SECRET"),
+			RedirectURL:       os.Getenv("YDMS_OIDC_REDIRECT_URL"),
+			Scopes:            parseEnvList("YDMS_OIDC_SCOPES"),
+			UsernameClaim:     firstNonEmpty(os.Getenv("YDMS_OIDC_USERNAME_CLAIM"), "preferred_username"),
+			LinkExisting:      parseEnvBool("YDMS_OIDC_LINK_EXISTING", false),
+			AutoProvision:     parseEnvBool("YDMS_OIDC_AUTO_PROVISION", false),
+			DefaultRole:       firstNonEmpty(os.Getenv("YDMS_OIDC_DEFAULT_ROLE"), "proofreader"),
+			PostLoginRedirect: os.Getenv("YDMS_OIDC_POST_LOGIN_REDIRECT"),
+		},
+		Jobs: JobConfig{
+			Workers:        parseEnvInt("YDMS_JOB_WORKERS", 2),
+			AsyncThreshold: parseEnvInt("YDMS_JOB_ASYNC_THRESHOLD", 20),
+			Lease:          firstNonEmpty(os.Getenv("YDMS_JOB_LEASE"), "1m"),
+		},
+		Category: CategoryConfig{
+			TreeTTL: firstNonEmpty(os.Getenv("YDMS_CATEGORY_TREE_TTL"), "30s"),
+		},
+		Webhooks: WebhookConfig{
+			MaxAttempts:         parseEnvInt("YDMS_WEBHOOK_MAX_ATTEMPTS", 8),
+			Timeout:             firstNonEmpty(os.Getenv("YDMS_WEBHOOK_TIMEOUT"), "10s"),
+			AllowPrivateTargets: parseEnvBool("YDMS_WEBHOOK_ALLOW_PRIVATE_TARGETS", false),
+		},
 	}
 }
 
@@ -125,6 +258,16 @@ func parseEnvBool(key string, defaultValue bool) bool {
 	}
 }
 
+func parseEnvList(key string) []string {
+	var values []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if strings.TrimSpace(v) != "" {
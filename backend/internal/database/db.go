@@ -49,9 +49,16 @@ func AutoMigrate(db *gorm.DB) error {
 func AutoMigrateWithDefaults(db *gorm.DB, defaults AdminDefaults) error {
 	log.Println("Running database migrations...")
 
+	// api_keys.allow_cidrs 早期按默认命名规则建成了 allow_c_id_rs，先改名以保留已有数据
+	if m := db.Migrator(); m.HasColumn(&APIKey{}, "allow_c_id_rs") && !m.HasColumn(&APIKey{}, "allow_cidrs") {
+		if err := m.RenameColumn(&APIKey{}, "allow_c_id_rs", "allow_cidrs"); err != nil {
+			return fmt.Errorf("failed to rename api_keys.allow_c_id_rs: %w", err)
+		}
+	}
+
 	// 使用原始的 db（已在 Connect 时配置）迁移所有表
 	// 注意：我们在手动创建外键约束，所以不依赖 GORM 自动创建
-	err := db.AutoMigrate(&User{}, &CoursePermission{}, &APIKey{})
+	err := db.AutoMigrate(&User{}, &CoursePermission{}, &PasswordHistory{}, &LoginThrottle{}, &RecoveryCode{}, &UserIdentity{}, &APIKey{}, &APIKeyDailyUsage{}, &APIKeyUsageLog{}, &Paper{}, &PaperQuestion{}, &Job{}, &JobStep{}, &Saga{}, &SagaStep{}, &WebhookSubscription{}, &WebhookDelivery{}, &DocumentLock{}, &DocumentReview{}, &DocumentReviewEvent{}, &DocumentComment{}, &Tag{}, &TagSynonym{})
 	if err != nil {
 		return fmt.Errorf("failed to migrate tables: %w", err)
 	}
@@ -74,6 +81,57 @@ func AutoMigrateWithDefaults(db *gorm.DB, defaults AdminDefaults) error {
 		log.Printf("Warning: failed to create user self-reference FK: %v", err)
 	}
 
+	// PasswordHistory.User -> User.ID
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_password_histories_user' AND table_name = 'password_histories'
+			) THEN
+				ALTER TABLE password_histories ADD CONSTRAINT fk_password_histories_user
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create password_histories.user FK: %v", err)
+	}
+
+	// RecoveryCode.User -> User.ID
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_user_recovery_codes_user' AND table_name = 'user_recovery_codes'
+			) THEN
+				ALTER TABLE user_recovery_codes ADD CONSTRAINT fk_user_recovery_codes_user
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create user_recovery_codes.user FK: %v", err)
+	}
+
+	// UserIdentity.User -> User.ID
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_user_identities_user' AND table_name = 'user_identities'
+			) THEN
+				ALTER TABLE user_identities ADD CONSTRAINT fk_user_identities_user
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create user_identities.user FK: %v", err)
+	}
+
 	// APIKey.User -> User.ID
 	err = db.Exec(`
 		DO $$
@@ -108,6 +166,210 @@ func AutoMigrateWithDefaults(db *gorm.DB, defaults AdminDefaults) error {
 		log.Printf("Warning: failed to create api_keys.created_by FK: %v", err)
 	}
 
+	// APIKeyDailyUsage.APIKey -> APIKey.ID
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_api_key_daily_usage_api_key' AND table_name = 'api_key_daily_usage'
+			) THEN
+				ALTER TABLE api_key_daily_usage ADD CONSTRAINT fk_api_key_daily_usage_api_key
+				FOREIGN KEY (api_key_id) REFERENCES api_keys(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create api_key_daily_usage.api_key FK: %v", err)
+	}
+
+	// APIKeyUsageLog.APIKey -> APIKey.ID
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_api_key_usage_logs_api_key' AND table_name = 'api_key_usage_logs'
+			) THEN
+				ALTER TABLE api_key_usage_logs ADD CONSTRAINT fk_api_key_usage_logs_api_key
+				FOREIGN KEY (api_key_id) REFERENCES api_keys(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create api_key_usage_logs.api_key FK: %v", err)
+	}
+
+	// PaperQuestion.Paper -> Paper.ID
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_paper_questions_paper' AND table_name = 'paper_questions'
+			) THEN
+				ALTER TABLE paper_questions ADD CONSTRAINT fk_paper_questions_paper
+				FOREIGN KEY (paper_id) REFERENCES papers(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create paper_questions.paper FK: %v", err)
+	}
+
+	// JobStep.Job -> Job.ID
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_job_steps_job' AND table_name = 'job_steps'
+			) THEN
+				ALTER TABLE job_steps ADD CONSTRAINT fk_job_steps_job
+				FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create job_steps.job FK: %v", err)
+	}
+
+	// SagaStep.Saga -> Saga.ID
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_saga_steps_saga' AND table_name = 'saga_steps'
+			) THEN
+				ALTER TABLE saga_steps ADD CONSTRAINT fk_saga_steps_saga
+				FOREIGN KEY (saga_id) REFERENCES sagas(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create saga_steps.saga FK: %v", err)
+	}
+
+	// WebhookDelivery.Subscription -> WebhookSubscription.ID
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_webhook_deliveries_subscription' AND table_name = 'webhook_deliveries'
+			) THEN
+				ALTER TABLE webhook_deliveries ADD CONSTRAINT fk_webhook_deliveries_subscription
+				FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create webhook_deliveries.subscription FK: %v", err)
+	}
+
+	// DocumentLock.Holder -> User.ID（删除用户时释放其持有的锁）
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_document_locks_holder' AND table_name = 'document_locks'
+			) THEN
+				ALTER TABLE document_locks ADD CONSTRAINT fk_document_locks_holder
+				FOREIGN KEY (holder_id) REFERENCES users(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create document_locks.holder FK: %v", err)
+	}
+
+	// DocumentReview.Reviewer -> User.ID（删除审核人后文档回到未分配状态）
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_document_reviews_reviewer' AND table_name = 'document_reviews'
+			) THEN
+				ALTER TABLE document_reviews ADD CONSTRAINT fk_document_reviews_reviewer
+				FOREIGN KEY (reviewer_id) REFERENCES users(id) ON DELETE SET NULL;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create document_reviews.reviewer FK: %v", err)
+	}
+
+	// DocumentComment.Author -> User.ID（删除用户时一并删除其评论）
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_document_comments_author' AND table_name = 'document_comments'
+			) THEN
+				ALTER TABLE document_comments ADD CONSTRAINT fk_document_comments_author
+				FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create document_comments.author FK: %v", err)
+	}
+
+	// DocumentComment.Parent -> DocumentComment.ID（删除首条评论时一并删除回复）
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_document_comments_parent' AND table_name = 'document_comments'
+			) THEN
+				ALTER TABLE document_comments ADD CONSTRAINT fk_document_comments_parent
+				FOREIGN KEY (parent_id) REFERENCES document_comments(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create document_comments.parent FK: %v", err)
+	}
+
+	// TagSynonym.Tag -> Tag.ID
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_tag_synonyms_tag' AND table_name = 'tag_synonyms'
+			) THEN
+				ALTER TABLE tag_synonyms ADD CONSTRAINT fk_tag_synonyms_tag
+				FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create tag_synonyms.tag FK: %v", err)
+	}
+
+	// Tag.Parent -> Tag.ID（服务层删除标签前先将子标签移到其上级）
+	err = db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.table_constraints
+				WHERE constraint_name = 'fk_tags_parent' AND table_name = 'tags'
+			) THEN
+				ALTER TABLE tags ADD CONSTRAINT fk_tags_parent
+				FOREIGN KEY (parent_id) REFERENCES tags(id) ON DELETE SET NULL;
+			END IF;
+		END$$;
+	`).Error
+	if err != nil {
+		log.Printf("Warning: failed to create tags.parent FK: %v", err)
+	}
+
 	log.Println("Database migrations completed successfully")
 
 	// 创建默认管理员账号（如果不存在）
@@ -15,9 +15,28 @@ type User struct {
 	Username     string         `gorm:"uniqueIndex;not null" json:"username"`
 	PasswordHash string         `gorm:"not null" json:"-"` // 不在 JSON 中返回密码
 	Role         string         `gorm:"not null;index" json:"role"` // super_admin, course_admin, proofreader
+	Kind         string         `gorm:"not null;default:'human';index" json:"kind"` // human, service_account
 	DisplayName  string         `json:"display_name"`
 	CreatedByID  *uint          `gorm:"index" json:"created_by_id,omitempty"` // 创建者 ID
 	CreatedBy    *User          `gorm:"foreignKey:CreatedByID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL" json:"created_by,omitempty"`
+	TOTPSecret   string         `gorm:"column:totp_secret" json:"-"` // TOTP 密钥（Base32），绑定确认前为待确认状态
+	TOTPEnabled  bool           `gorm:"column:totp_enabled;not null;default:false" json:"totp_enabled"` // 是否已启用两步验证
+	TOTPLastStep int64          `gorm:"column:totp_last_step;not null;default:0" json:"-"` // 最近一次使用的时间步，防止验证码重放
+	Disabled     bool           `gorm:"not null;default:false;index" json:"disabled"` // 已停用：禁止登录与 API Key 访问，数据保留（区别于软删除）
+	MustChangePassword bool     `gorm:"not null;default:false" json:"must_change_password"` // 管理员重置密码后，下次登录必须先修改密码
+}
+
+// 用户类型
+const (
+	// UserKindHuman 普通用户，可使用密码登录
+	UserKindHuman = "human"
+	// UserKindServiceAccount 服务账号，仅供 API Key 集成使用，不能密码登录
+	UserKindServiceAccount = "service_account"
+)
+
+// IsServiceAccount 是否为服务账号
+func (u *User) IsServiceAccount() bool {
+	return u.Kind == UserKindServiceAccount
 }
 
 // CoursePermission 课程权限模型（多对多关联）
@@ -39,6 +58,71 @@ func (CoursePermission) TableName() string {
 	return "course_permissions"
 }
 
+// UserIdentity 外部身份（OIDC issuer + subject）与本地用户的绑定
+type UserIdentity struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Issuer      string     `gorm:"size:255;not null;uniqueIndex:idx_user_identities_issuer_subject" json:"issuer"`
+	Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_user_identities_issuer_subject" json:"subject"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// TableName 指定表名
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// RecoveryCode 两步验证的一次性恢复码
+type RecoveryCode struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null" json:"-"` // bcrypt 哈希
+	UsedAt    *time.Time `json:"used_at,omitempty"` // 使用时间，非空表示已失效
+}
+
+// TableName 指定表名
+func (RecoveryCode) TableName() string {
+	return "user_recovery_codes"
+}
+
+// PasswordHistory 密码历史，用于禁止重复使用最近的密码
+type PasswordHistory struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `gorm:"index:idx_password_histories_user_time" json:"created_at"`
+	UserID       uint      `gorm:"not null;index:idx_password_histories_user_time" json:"user_id"`
+	PasswordHash string    `gorm:"not null" json:"-"`
+}
+
+// TableName 指定表名
+func (PasswordHistory) TableName() string {
+	return "password_histories"
+}
+
+// 登录失败计数的维度
+const (
+	LoginThrottleUser = "user" // 按用户名计数
+	LoginThrottleIP   = "ip"   // 按客户端 IP 计数
+)
+
+// LoginThrottle 登录失败计数与锁定状态，持久化以便重启后仍然生效
+type LoginThrottle struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	Scope       string     `gorm:"size:16;not null;uniqueIndex:idx_login_throttle_scope_key" json:"scope"` // user, ip
+	Key         string     `gorm:"size:255;not null;uniqueIndex:idx_login_throttle_scope_key" json:"key"`  // 用户名（小写）或 IP
+	Failures    int        `gorm:"not null;default:0" json:"failures"`                                     // 当前窗口内的失败次数
+	WindowStart time.Time  `json:"window_start"`                                                           // 计数窗口开始时间
+	LockedUntil *time.Time `gorm:"index" json:"locked_until,omitempty"`                                    // 锁定截止时间
+	LockCount   int        `gorm:"not null;default:0" json:"lock_count"`                                   // 累计被锁定次数
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (LoginThrottle) TableName() string {
+	return "login_throttles"
+}
+
 // APIKey API密钥模型
 type APIKey struct {
 	ID          uint           `gorm:"primarykey" json:"id"`
@@ -53,6 +137,14 @@ type APIKey struct {
 	Scopes      string         `json:"scopes"`                                                      // 权限范围（JSON数组字符串）
 	ExpiresAt   *time.Time     `json:"expires_at,omitempty"`                                        // 过期时间
 	LastUsedAt  *time.Time     `json:"last_used_at,omitempty"`                                      // 最后使用时间
+	RateLimit   int            `gorm:"not null;default:0" json:"rate_limit_per_minute"`             // 每分钟请求上限（0 表示使用全局默认值）
+	RateBurst   int            `gorm:"not null;default:0" json:"rate_limit_burst"`                  // 突发请求上限（0 表示与每分钟上限相同）
+	PrevKeyHash string         `gorm:"index" json:"-"`                                              // 轮换前的旧密钥哈希（宽限期内仍可用）
+	PrevPrefix  string         `json:"previous_key_prefix,omitempty"`                               // 旧密钥前缀
+	GraceUntil  *time.Time     `json:"previous_key_valid_until,omitempty"`                          // 旧密钥宽限期截止时间
+	PrevUsedAt  *time.Time     `json:"previous_key_last_used_at,omitempty"`                         // 旧密钥最后使用时间（LastUsedAt 仅记录新密钥）
+	RotatedAt   *time.Time     `json:"rotated_at,omitempty"`                                        // 最近一次轮换时间
+	AllowCIDRs  string         `gorm:"column:allow_cidrs;type:text" json:"allowed_cidrs"`           // 允许访问的来源网段（JSON数组字符串，空表示不限制）
 	CreatedByID uint           `gorm:"index" json:"created_by_id"`                                  // 创建者 ID
 	CreatedBy   *User          `gorm:"foreignKey:CreatedByID;constraint:OnDelete:SET NULL" json:"created_by,omitempty"`
 }
@@ -61,3 +153,353 @@ type APIKey struct {
 func (APIKey) TableName() string {
 	return "api_keys"
 }
+
+// APIKeyUsageDayLayout 每日用量统计使用的日期格式（UTC）
+const APIKeyUsageDayLayout = "2006-01-02"
+
+// APIKeyDailyUsage API Key 每日请求计数
+type APIKeyDailyUsage struct {
+	ID             uint      `gorm:"primarykey" json:"-"`
+	APIKeyID       uint      `gorm:"not null;uniqueIndex:idx_api_key_usage_day" json:"api_key_id"`
+	Day            string    `gorm:"size:10;not null;uniqueIndex:idx_api_key_usage_day" json:"day"` // UTC 日期，格式 YYYY-MM-DD
+	RequestCount   int64     `gorm:"not null;default:0" json:"request_count"`                        // 放行的请求数
+	ThrottledCount int64     `gorm:"not null;default:0" json:"throttled_count"`                      // 因限流被拒绝的请求数
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (APIKeyDailyUsage) TableName() string {
+	return "api_key_daily_usage"
+}
+
+// APIKeyUsageLog API Key 请求日志（滚动保留最近一段时间）
+type APIKeyUsageLog struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	APIKeyID    uint      `gorm:"not null;index:idx_api_key_usage_logs_key_time" json:"api_key_id"`
+	CreatedAt   time.Time `gorm:"index:idx_api_key_usage_logs_key_time" json:"created_at"`
+	IP          string    `gorm:"size:64" json:"ip"` // 客户端 IP（经受信任代理解析）
+	Method      string    `gorm:"size:16" json:"method"`
+	Route       string    `gorm:"size:512" json:"route"` // 请求路径（不含查询参数）
+	Status      int       `json:"status"`                // 响应状态码
+	PreviousKey bool      `json:"previous_key"`          // 是否使用轮换前的旧密钥
+}
+
+// TableName 指定表名
+func (APIKeyUsageLog) TableName() string {
+	return "api_key_usage_logs"
+}
+
+// Paper 试卷定义（组卷结果）
+type Paper struct {
+	ID          uint            `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt  `gorm:"index" json:"deleted_at,omitempty"`
+	Title       string          `gorm:"not null" json:"title"`
+	Seed        int64           `json:"seed"`                       // 随机种子，用于复现抽题结果
+	Rules       string          `gorm:"type:text" json:"-"`         // 组卷规则（JSON 字符串）
+	CreatedByID uint            `gorm:"index" json:"created_by_id"` // 创建者 ID
+	Questions   []PaperQuestion `gorm:"foreignKey:PaperID" json:"questions,omitempty"`
+}
+
+// TableName 指定表名
+func (Paper) TableName() string {
+	return "papers"
+}
+
+// PaperQuestion 试卷中的题目（按出题顺序）
+type PaperQuestion struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	PaperID    uint      `gorm:"not null;index" json:"paper_id"`
+	DocumentID int64     `gorm:"not null;index" json:"document_id"` // NDR 文档 ID
+	Position   int       `json:"position"`
+}
+
+// TableName 指定表名
+func (PaperQuestion) TableName() string {
+	return "paper_questions"
+}
+
+// 后台任务状态
+const (
+	JobQueued    = "queued"    // 等待执行
+	JobRunning   = "running"   // 执行中（持有租约）
+	JobSucceeded = "succeeded" // 全部步骤成功
+	JobFailed    = "failed"    // 执行失败，已完成的步骤已补偿
+	JobCanceled  = "canceled"  // 已取消，已完成的步骤已补偿
+)
+
+// Job 后台任务（长时间运行的批量操作），持久化以便进程重启后继续执行
+type Job struct {
+	ID              uint       `gorm:"primarykey" json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	Kind            string     `gorm:"size:64;not null;index" json:"kind"`                  // 任务类型，如 category.bulk_copy
+	Status          string     `gorm:"size:16;not null;index:idx_jobs_claim" json:"status"` // queued, running, succeeded, failed, canceled
+	Payload         string     `gorm:"type:text" json:"-"`                                  // 任务参数（JSON）
+	Meta            string     `gorm:"type:text" json:"-"`                                  // 发起者身份（JSON，不含密钥）
+	Result          string     `gorm:"type:text" json:"-"`                                  // 执行结果（JSON）
+	Error           string     `gorm:"type:text" json:"error,omitempty"`
+	StepsTotal      int        `gorm:"not null;default:0" json:"steps_total"`
+	StepsDone       int        `gorm:"not null;default:0" json:"steps_done"`
+	Attempts        int        `gorm:"not null;default:0" json:"attempts"` // 被 worker 领取的次数（重启后恢复会累加）
+	CancelRequested bool       `gorm:"not null;default:false" json:"cancel_requested"`
+	LockedBy        string     `gorm:"size:128" json:"-"`             // 持有租约的 worker
+	LockedUntil     *time.Time `gorm:"index:idx_jobs_claim" json:"-"` // 租约到期时间，过期后其他 worker 可接管
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	CreatedByID     uint       `gorm:"index" json:"created_by_id"`
+}
+
+// TableName 指定表名
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// 任务步骤状态
+const (
+	JobStepPending   = "pending"
+	JobStepRunning   = "running"
+	JobStepSucceeded = "succeeded"
+	JobStepFailed    = "failed"
+)
+
+// JobStep 任务中的单个步骤，完成的步骤在恢复执行时跳过
+type JobStep struct {
+	ID         uint       `gorm:"primarykey" json:"-"`
+	JobID      uint       `gorm:"not null;uniqueIndex:idx_job_steps_job_seq" json:"-"`
+	Seq        int        `gorm:"not null;uniqueIndex:idx_job_steps_job_seq" json:"seq"`
+	Key        string     `gorm:"size:255;not null" json:"key"`   // 步骤标识，如源节点 ID
+	Status     string     `gorm:"size:16;not null" json:"status"` // pending, running, succeeded, failed
+	Result     string     `gorm:"type:text" json:"-"`             // 步骤结果（JSON），同时作为失败时的补偿依据
+	Error      string     `gorm:"type:text" json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// TableName 指定表名
+func (JobStep) TableName() string {
+	return "job_steps"
+}
+
+// 事务日志（saga）状态
+const (
+	SagaRunning        = "running"         // 执行中
+	SagaCommitted      = "committed"       // 已全部完成
+	SagaCompensated    = "compensated"     // 已全部回滚
+	SagaNeedsAttention = "needs_attention" // 回滚未完成，需要管理员处理
+	SagaResolved       = "resolved"        // 管理员已人工处理
+)
+
+// Saga 跨 NDR 的多步操作日志；每个步骤在调用 NDR 之前写入，进程崩溃后据此完成或回滚
+type Saga struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"index" json:"updated_at"`
+	Kind        string     `gorm:"size:64;not null;index" json:"kind"`   // 操作类型，如 category.bulk_copy
+	Status      string     `gorm:"size:24;not null;index" json:"status"` // running, committed, compensated, needs_attention, resolved
+	Meta        string     `gorm:"type:text" json:"-"`                   // 发起者身份（JSON，不含密钥）
+	Owner       string     `gorm:"size:128;not null" json:"owner"`       // 执行该操作的进程
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	ResolvedBy  string     `gorm:"size:64" json:"resolved_by,omitempty"` // 人工处理的管理员
+	JobID       *uint      `gorm:"index" json:"job_id,omitempty"`        // 所属后台任务，由任务重试时负责恢复
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CreatedByID uint       `gorm:"index" json:"created_by_id"`
+}
+
+// TableName 指定表名
+func (Saga) TableName() string {
+	return "sagas"
+}
+
+// saga 步骤状态
+const (
+	SagaStepPlanned            = "planned"             // 已记录，NDR 调用结果未知
+	SagaStepDone               = "done"                // NDR 调用成功
+	SagaStepAborted            = "aborted"             // NDR 调用失败，无需补偿
+	SagaStepCompensated        = "compensated"         // 已补偿
+	SagaStepCompensationFailed = "compensation_failed" // 补偿失败
+)
+
+// SagaStep saga 中的单个 NDR 调用及其补偿所需的数据
+type SagaStep struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	UpdatedAt time.Time `json:"updated_at"`
+	SagaID    uint      `gorm:"not null;uniqueIndex:idx_saga_steps_saga_seq" json:"-"`
+	Seq       int       `gorm:"not null;uniqueIndex:idx_saga_steps_saga_seq" json:"seq"`
+	Action    string    `gorm:"size:32;not null" json:"action"` // create_node, clone_document, bind_document, move_node
+	Data      string    `gorm:"type:text" json:"-"`             // 步骤参数与结果（JSON）
+	Status    string    `gorm:"size:24;not null" json:"status"` // planned, done, aborted, compensated, compensation_failed
+	Error     string    `gorm:"type:text" json:"error,omitempty"`
+}
+
+// TableName 指定表名
+func (SagaStep) TableName() string {
+	return "saga_steps"
+}
+
+// webhook 投递状态
+const (
+	WebhookDeliveryPending   = "pending"   // 等待投递或等待重试
+	WebhookDeliveryDelivered = "delivered" // 接收方返回 2xx
+	WebhookDeliveryDead      = "dead"      // 重试次数用尽，进入死信列表
+)
+
+// WebhookSubscription 出站 webhook 订阅
+type WebhookSubscription struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Name        string    `gorm:"size:128" json:"name"`
+	URL         string    `gorm:"size:2048;not null" json:"url"`
+	Secret      string    `gorm:"size:128;not null" json:"-"` // HMAC-SHA256 签名密钥
+	EventTypes  string    `gorm:"type:text" json:"-"`         // 订阅的事件类型（JSON数组字符串，空表示全部）
+	CourseIDs   string    `gorm:"type:text" json:"-"`         // 课程过滤（JSON数组字符串，空表示全部）
+	Active      bool      `gorm:"not null" json:"active"`
+	CreatedByID uint      `gorm:"index" json:"created_by_id"`
+}
+
+// TableName 指定表名
+func (WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// WebhookDelivery 一次事件投递及其重试状态，同时作为投递历史与死信列表
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	SubscriptionID uint       `gorm:"not null;index" json:"subscription_id"`
+	EventType      string     `gorm:"size:64;not null" json:"event_type"`
+	Payload        string     `gorm:"type:text" json:"-"`                                              // 请求体（JSON）
+	Status         string     `gorm:"size:16;not null;index:idx_webhook_deliveries_due" json:"status"` // pending, delivered, dead
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  *time.Time `gorm:"index:idx_webhook_deliveries_due" json:"next_attempt_at,omitempty"` // 下次投递时间；投递中时为租约到期时间
+	ResponseStatus int        `json:"response_status,omitempty"`                                         // 最近一次投递的 HTTP 状态码
+	LastError      string     `gorm:"type:text" json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// TableName 指定表名
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// DocumentLock 文档编辑锁（软锁）：持有者通过心跳续期，过期后视为已释放
+type DocumentLock struct {
+	DocumentID int64     `gorm:"primaryKey;autoIncrement:false" json:"document_id"` // NDR 文档 ID，每个文档最多一把锁
+	HolderID   uint      `gorm:"not null;index" json:"holder_id"`
+	HolderName string    `gorm:"size:64" json:"holder_name"`
+	AcquiredAt time.Time `gorm:"not null" json:"acquired_at"`
+	ExpiresAt  time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// TableName 指定表名
+func (DocumentLock) TableName() string {
+	return "document_locks"
+}
+
+// 文档审核状态
+const (
+	ReviewStateDraft     = "draft"     // 草稿（没有审核记录的文档同样视为草稿）
+	ReviewStateInReview  = "in_review" // 已提交，等待课程管理员审核
+	ReviewStateApproved  = "approved"  // 审核通过
+	ReviewStatePublished = "published" // 已发布
+)
+
+// DocumentReview 文档的审核状态，每个文档一行
+type DocumentReview struct {
+	DocumentID       int64      `gorm:"primaryKey;autoIncrement:false" json:"document_id"` // NDR 文档 ID
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	CourseID         int64      `gorm:"not null;index:idx_document_reviews_course_state" json:"course_id"` // 提交审核时文档所属的课程
+	State            string     `gorm:"size:16;not null;index:idx_document_reviews_course_state" json:"state"`
+	Title            string     `gorm:"size:255" json:"title"` // 最近一次状态变更时的文档标题
+	ReviewerID       *uint      `gorm:"index" json:"reviewer_id,omitempty"`
+	SubmittedByID    *uint      `json:"submitted_by_id,omitempty"`
+	SubmittedAt      *time.Time `json:"submitted_at,omitempty"`
+	SubmittedVersion *int       `json:"submitted_version,omitempty"`        // 提交审核时的文档版本
+	Comment          string     `gorm:"type:text" json:"comment,omitempty"` // 最近一次审核意见
+}
+
+// TableName 指定表名
+func (DocumentReview) TableName() string {
+	return "document_reviews"
+}
+
+// DocumentReviewEvent 审核状态变更记录
+type DocumentReviewEvent struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	DocumentID int64     `gorm:"not null;index" json:"document_id"`
+	Action     string    `gorm:"size:16;not null" json:"action"` // submit, assign, approve, reject, publish, reopen
+	FromState  string    `gorm:"size:16;not null" json:"from_state"`
+	ToState    string    `gorm:"size:16;not null" json:"to_state"`
+	ActorID    uint      `gorm:"not null" json:"actor_id"`
+	ActorName  string    `gorm:"size:64" json:"actor_name"`
+	ReviewerID *uint     `json:"reviewer_id,omitempty"`
+	Comment    string    `gorm:"type:text" json:"comment,omitempty"`
+}
+
+// TableName 指定表名
+func (DocumentReviewEvent) TableName() string {
+	return "document_review_events"
+}
+
+// DocumentComment 文档评论；ParentID 为空的是讨论串的首条评论，回复只挂在首条评论下
+type DocumentComment struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DocumentID    int64      `gorm:"not null;index" json:"document_id"` // NDR 文档 ID
+	ParentID      *uint      `gorm:"index" json:"parent_id,omitempty"`
+	VersionNumber *int       `json:"version_number,omitempty"`              // 撰写评论时针对的文档版本
+	AnchorPath    string     `gorm:"size:255" json:"anchor_path,omitempty"` // YAML 路径，如 details[2].answer
+	AnchorStart   *int       `json:"anchor_start,omitempty"`                // Markdown 文本范围（按字符计，左闭右开）
+	AnchorEnd     *int       `json:"anchor_end,omitempty"`
+	AnchorQuote   string     `gorm:"type:text" json:"anchor_quote,omitempty"` // 撰写时锚定范围内的原文
+	Body          string     `gorm:"type:text;not null" json:"body"`
+	AuthorID      uint       `gorm:"not null;index" json:"author_id"`
+	AuthorName    string     `gorm:"size:64" json:"author_name"`
+	Mentions      string     `gorm:"type:text" json:"-"`                     // 被 @ 的用户名（JSON 数组）
+	Resolved      bool       `gorm:"not null;default:false" json:"resolved"` // 只对首条评论有意义
+	ResolvedByID  *uint      `json:"resolved_by_id,omitempty"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+}
+
+// TableName 指定表名
+func (DocumentComment) TableName() string {
+	return "document_comments"
+}
+
+// Tag 课程标签词表中的规范标签
+type Tag struct {
+	ID        uint         `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	CourseID  int64        `gorm:"not null;uniqueIndex:idx_tags_course_key" json:"course_id"` // 课程根节点 ID
+	Name      string       `gorm:"size:64;not null" json:"name"`                              // 规范名称，写入文档 metadata.tags
+	Key       string       `gorm:"size:64;not null;uniqueIndex:idx_tags_course_key" json:"-"` // 归一化后的匹配键
+	ParentID  *uint        `gorm:"index" json:"parent_id,omitempty"`                          // 上级标签（同一课程）
+	Synonyms  []TagSynonym `gorm:"foreignKey:TagID" json:"synonyms"`
+}
+
+// TableName 指定表名
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// TagSynonym 标签的同义词，文档保存时同义词替换为规范名称
+type TagSynonym struct {
+	ID       uint   `gorm:"primarykey" json:"id"`
+	TagID    uint   `gorm:"not null;index" json:"tag_id"`
+	CourseID int64  `gorm:"not null;uniqueIndex:idx_tag_synonyms_course_key" json:"-"`
+	Name     string `gorm:"size:64;not null" json:"name"`
+	Key      string `gorm:"size:64;not null;uniqueIndex:idx_tag_synonyms_course_key" json:"-"`
+}
+
+// TableName 指定表名
+func (TagSynonym) TableName() string {
+	return "tag_synonyms"
+}
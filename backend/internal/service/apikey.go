@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -14,14 +15,18 @@ import (
 
 // APIKeyService API Key 管理服务
 type APIKeyService struct {
-	db *gorm.DB
+	db            *gorm.DB
+	rotationGrace time.Duration // 轮换后旧密钥的默认宽限期
 }
 
 // NewAPIKeyService 创建 API Key 服务实例
-func NewAPIKeyService(db *gorm.DB) *APIKeyService {
-	return &APIKeyService{db: db}
+func NewAPIKeyService(db *gorm.DB, rotationGrace time.Duration) *APIKeyService {
+	return &APIKeyService{db: db, rotationGrace: rotationGrace}
 }
 
+// MaxAPIKeyRotationGrace 轮换宽限期上限
+const MaxAPIKeyRotationGrace = 30 * 24 * time.Hour
+
 // CreateAPIKeyRequest 创建 API Key 请求
 type CreateAPIKeyRequest struct {
 	Name        string     `json:"name"`                   // API Key 名称
@@ -29,6 +34,9 @@ type CreateAPIKeyRequest struct {
 	Scopes      []string   `json:"scopes,omitempty"`       // 权限范围
 	ExpiresAt   *time.Time `json:"expires_at,omitempty"`   // 过期时间
 	Environment string     `json:"environment,omitempty"`  // 环境标识（prod/dev/test）
+	RateLimit   int        `json:"rate_limit_per_minute"`  // 每分钟请求上限（0 使用全局默认值）
+	RateBurst   int        `json:"rate_limit_burst"`       // 突发请求上限（0 与每分钟上限相同）
+	AllowCIDRs  []string   `json:"allowed_cidrs,omitempty"` // 允许访问的来源网段（为空不限制）
 	CreatedByID uint       `json:"created_by_id"`          // 创建者 ID
 }
 
@@ -41,18 +49,32 @@ type CreateAPIKeyResponse struct {
 
 // CreateAPIKey 创建新的 API Key
 func (s *APIKeyService) CreateAPIKey(req CreateAPIKeyRequest) (*CreateAPIKeyResponse, error) {
+	return createAPIKey(s.db, req)
+}
+
+// createAPIKey 在给定的数据库会话（可为事务）中创建 API Key
+func createAPIKey(db *gorm.DB, req CreateAPIKeyRequest) (*CreateAPIKeyResponse, error) {
 	// 验证用户是否存在
 	var user database.User
-	if err := s.db.First(&user, req.UserID).Error; err != nil {
+	if err := db.First(&user, req.UserID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, errors.New("user not found")
 		}
 		return nil, fmt.Errorf("failed to query user: %w", err)
 	}
 
-	// 检查用户是否为管理员角色
-	if user.Role != "super_admin" && user.Role != "course_admin" {
-		return nil, errors.New("API keys can only be created for admin users")
+	// 检查用户是否为管理员角色（服务账号不受此限制）
+	if !user.IsServiceAccount() && user.Role != "super_admin" && user.Role != "course_admin" {
+		return nil, errors.New("API keys can only be created for admin users or service accounts")
+	}
+
+	if req.RateLimit < 0 || req.RateBurst < 0 {
+		return nil, errors.New("rate limits must not be negative")
+	}
+
+	allowCIDRs, err := encodeAllowedCIDRs(req.AllowCIDRs)
+	if err != nil {
+		return nil, err
 	}
 
 	// 设置默认环境
@@ -91,15 +113,18 @@ func (s *APIKeyService) CreateAPIKey(req CreateAPIKeyRequest) (*CreateAPIKeyResp
 		UserID:      req.UserID,
 		Scopes:      scopesJSON,
 		ExpiresAt:   req.ExpiresAt,
+		RateLimit:   req.RateLimit,
+		RateBurst:   req.RateBurst,
+		AllowCIDRs:  allowCIDRs,
 		CreatedByID: req.CreatedByID,
 	}
 
-	if err := s.db.Create(&dbKey).Error; err != nil {
+	if err := db.Create(&dbKey).Error; err != nil {
 		return nil, fmt.Errorf("failed to create API key: %w", err)
 	}
 
 	// 重新加载以获取关联数据
-	if err := s.db.Preload("User").Preload("CreatedBy").First(&dbKey, dbKey.ID).Error; err != nil {
+	if err := db.Preload("User").Preload("CreatedBy").First(&dbKey, dbKey.ID).Error; err != nil {
 		return nil, fmt.Errorf("failed to reload API key: %w", err)
 	}
 
@@ -110,6 +135,98 @@ func (s *APIKeyService) CreateAPIKey(req CreateAPIKeyRequest) (*CreateAPIKeyResp
 	}, nil
 }
 
+// CreateServiceAccountRequest 创建服务账号及其首个 API Key 的请求
+type CreateServiceAccountRequest struct {
+	Username    string              `json:"username"`
+	DisplayName string              `json:"display_name,omitempty"`
+	Role        string              `json:"role,omitempty"`       // 默认 course_admin
+	CourseIDs   []int64             `json:"course_ids,omitempty"` // 授权的课程根节点 ID
+	Key         CreateAPIKeyRequest `json:"api_key"`              // user_id 由服务端填充
+	CreatedByID uint                `json:"-"`
+}
+
+// CreateServiceAccountResponse 创建服务账号响应
+type CreateServiceAccountResponse struct {
+	User      *database.User        `json:"user"`
+	CourseIDs []int64               `json:"course_ids"`
+	APIKey    *CreateAPIKeyResponse `json:"api_key"`
+}
+
+// CreateServiceAccount 在一个事务中创建服务账号、授予课程权限并签发 API Key
+// 服务账号不属于任何个人，不能使用密码登录，删除员工账号不会影响集成。
+func (s *APIKeyService) CreateServiceAccount(req CreateServiceAccountRequest) (*CreateServiceAccountResponse, error) {
+	username := strings.TrimSpace(req.Username)
+	if username == "" {
+		return nil, errors.New("username is required")
+	}
+	role := req.Role
+	if role == "" {
+		role = "course_admin"
+	}
+	if role != "super_admin" && role != "course_admin" && role != "proofreader" {
+		return nil, errors.New("invalid role")
+	}
+
+	var resp *CreateServiceAccountResponse
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// 用户名在包括已删除用户在内的范围内唯一
+		var count int64
+		if err := tx.Unscoped().Model(&database.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check username: %w", err)
+		}
+		if count > 0 {
+			return errors.New("username already exists")
+		}
+
+		var createdBy *uint
+		if req.CreatedByID > 0 {
+			createdBy = &req.CreatedByID
+		}
+		user := &database.User{
+			Username:     username,
+			PasswordHash: serviceAccountPasswordHash,
+			Role:         role,
+			Kind:         database.UserKindServiceAccount,
+			DisplayName:  req.DisplayName,
+			CreatedByID:  createdBy,
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return fmt.Errorf("failed to create service account: %w", err)
+		}
+
+		courseIDs := make([]int64, 0, len(req.CourseIDs))
+		seen := make(map[int64]bool, len(req.CourseIDs))
+		for _, rootNodeID := range req.CourseIDs {
+			if seen[rootNodeID] {
+				continue
+			}
+			seen[rootNodeID] = true
+			if err := tx.Create(&database.CoursePermission{UserID: user.ID, RootNodeID: rootNodeID}).Error; err != nil {
+				return fmt.Errorf("failed to grant course %d: %w", rootNodeID, err)
+			}
+			courseIDs = append(courseIDs, rootNodeID)
+		}
+
+		keyReq := req.Key
+		keyReq.UserID = user.ID
+		keyReq.CreatedByID = req.CreatedByID
+		if keyReq.Name == "" {
+			keyReq.Name = username
+		}
+		key, err := createAPIKey(tx, keyReq)
+		if err != nil {
+			return err
+		}
+
+		resp = &CreateServiceAccountResponse{User: user, CourseIDs: courseIDs, APIKey: key}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 // ListAPIKeys 列出 API Keys
 func (s *APIKeyService) ListAPIKeys(userID uint, includeDeleted bool) ([]database.APIKey, error) {
 	var keys []database.APIKey
@@ -179,6 +296,20 @@ func (s *APIKeyService) UpdateAPIKey(id uint, updates map[string]interface{}) (*
 		return nil, fmt.Errorf("failed to get API key: %w", err)
 	}
 
+	// 来源网段需校验并序列化为 JSON 数组字符串
+	if raw, ok := updates["allowed_cidrs"]; ok {
+		delete(updates, "allowed_cidrs")
+		list, err := toStringSlice(raw)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := encodeAllowedCIDRs(list)
+		if err != nil {
+			return nil, err
+		}
+		updates["allow_cidrs"] = encoded
+	}
+
 	// 更新
 	if err := s.db.Model(&key).Updates(updates).Error; err != nil {
 		return nil, fmt.Errorf("failed to update API key: %w", err)
@@ -192,6 +323,149 @@ func (s *APIKeyService) UpdateAPIKey(id uint, updates map[string]interface{}) (*
 	return &key, nil
 }
 
+// ListAPIKeyUsage 查询 API Key 最近的请求日志（按时间倒序）
+// beforeID 大于 0 时返回 ID 小于该值的记录，用于向前翻页
+func (s *APIKeyService) ListAPIKeyUsage(id uint, limit int, beforeID uint) ([]database.APIKeyUsageLog, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query := s.db.Where("api_key_id = ?", id)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+	var logs []database.APIKeyUsageLog
+	if err := query.Order("id DESC").Limit(limit).Find(&logs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list API key usage: %w", err)
+	}
+	return logs, nil
+}
+
+// encodeAllowedCIDRs 校验来源网段并序列化，空列表表示不限制
+func encodeAllowedCIDRs(values []string) (string, error) {
+	nets, err := auth.ParseCIDRs(values)
+	if err != nil {
+		return "", err
+	}
+	if len(nets) == 0 {
+		return "", nil
+	}
+	normalized := make([]string, 0, len(nets))
+	for _, network := range nets {
+		normalized = append(normalized, network.String())
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize allowed CIDRs: %w", err)
+	}
+	return string(data), nil
+}
+
+// toStringSlice 将 JSON 解码得到的数组转换为字符串切片
+func toStringSlice(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return v, nil
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, errors.New("allowed_cidrs must be an array of strings")
+			}
+			result = append(result, str)
+		}
+		return result, nil
+	default:
+		return nil, errors.New("allowed_cidrs must be an array of strings")
+	}
+}
+
+// RotateAPIKeyResponse 轮换 API Key 响应
+type RotateAPIKeyResponse struct {
+	APIKey            string           `json:"api_key"`                            // 新的完整 API Key（仅此一次返回）
+	KeyPrefix         string           `json:"key_prefix"`                         // 新密钥前缀
+	PreviousKeyPrefix string           `json:"previous_key_prefix"`                // 旧密钥前缀
+	PreviousValidTo   *time.Time       `json:"previous_key_valid_until,omitempty"` // 旧密钥失效时间（为空表示立即失效）
+	KeyInfo           *database.APIKey `json:"key_info"`
+}
+
+// RotateAPIKey 为已有 API Key 签发新密钥
+// 旧密钥在 grace 时间内仍可使用；grace 为 nil 时使用服务默认宽限期，为 0 时旧密钥立即失效。
+// 同一记录上的上一轮旧密钥会被新的旧密钥覆盖。
+func (s *APIKeyService) RotateAPIKey(id uint, grace *time.Duration) (*RotateAPIKeyResponse, error) {
+	window := s.rotationGrace
+	if grace != nil {
+		window = *grace
+	}
+	if window < 0 || window > MaxAPIKeyRotationGrace {
+		return nil, fmt.Errorf("grace period must be between 0 and %s", MaxAPIKeyRotationGrace)
+	}
+
+	var key database.APIKey
+	if err := s.db.First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("API key not found")
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	apiKey, err := auth.GenerateAPIKey(keyEnvironment(key.KeyPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"key_hash":      auth.HashAPIKey(apiKey),
+		"key_prefix":    extractKeyPrefix(apiKey),
+		"prev_key_hash": "",
+		"prev_prefix":   key.KeyPrefix,
+		"grace_until":   nil,
+		"prev_used_at":  key.LastUsedAt,
+		"last_used_at":  nil,
+		"rotated_at":    now,
+	}
+	var validTo *time.Time
+	if window > 0 {
+		until := now.Add(window)
+		validTo = &until
+		updates["prev_key_hash"] = key.KeyHash
+		updates["grace_until"] = until
+	}
+
+	// 以旧哈希为条件更新，避免并发轮换互相覆盖
+	result := s.db.Model(&database.APIKey{}).Where("id = ? AND key_hash = ?", key.ID, key.KeyHash).Updates(updates)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to rotate API key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("API key was rotated concurrently, please retry")
+	}
+
+	if err := s.db.Preload("User").Preload("CreatedBy").First(&key, id).Error; err != nil {
+		return nil, fmt.Errorf("failed to reload API key: %w", err)
+	}
+
+	return &RotateAPIKeyResponse{
+		APIKey:            apiKey,
+		KeyPrefix:         key.KeyPrefix,
+		PreviousKeyPrefix: key.PrevPrefix,
+		PreviousValidTo:   validTo,
+		KeyInfo:           &key,
+	}, nil
+}
+
+// keyEnvironment 从前缀中解析环境标识，例如 ydms_prod_abc1... -> prod
+func keyEnvironment(prefix string) string {
+	parts := strings.SplitN(prefix, "_", 3)
+	if len(parts) == 3 && parts[0] == auth.APIKeyPrefix && parts[1] != "" {
+		return parts[1]
+	}
+	return "prod"
+}
+
 // GetAPIKeyStats 获取 API Key 使用统计
 func (s *APIKeyService) GetAPIKeyStats(userID uint) (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
@@ -242,9 +516,49 @@ func (s *APIKeyService) GetAPIKeyStats(userID uint) (map[string]interface{}, err
 	}
 	stats["revoked"] = revoked
 
+	// 请求量（来自每日计数，按 UTC 日期统计最近 7 天）
+	now := time.Now().UTC()
+	today := now.Format(database.APIKeyUsageDayLayout)
+	since := now.AddDate(0, 0, -(apiKeyUsageWindowDays - 1)).Format(database.APIKeyUsageDayLayout)
+
+	usageQuery := s.db.Model(&database.APIKeyDailyUsage{}).
+		Select("day, SUM(request_count) AS request_count, SUM(throttled_count) AS throttled_count").
+		Where("day >= ?", since)
+	if userID > 0 {
+		keyIDs := s.db.Unscoped().Model(&database.APIKey{}).Select("id").Where("user_id = ?", userID)
+		usageQuery = usageQuery.Where("api_key_id IN (?)", keyIDs)
+	}
+	var daily []APIKeyUsageDay
+	if err := usageQuery.Group("day").Order("day").Scan(&daily).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate usage: %w", err)
+	}
+
+	var requestsToday, throttledToday, requestsWindow int64
+	for _, day := range daily {
+		requestsWindow += day.RequestCount
+		if day.Day == today {
+			requestsToday = day.RequestCount
+			throttledToday = day.ThrottledCount
+		}
+	}
+	stats["requests_today"] = requestsToday
+	stats["throttled_today"] = throttledToday
+	stats["requests_last_7_days"] = requestsWindow
+	stats["daily_usage"] = daily
+
 	return stats, nil
 }
 
+// apiKeyUsageWindowDays 统计接口返回的每日用量天数
+const apiKeyUsageWindowDays = 7
+
+// APIKeyUsageDay 某一天的请求量汇总
+type APIKeyUsageDay struct {
+	Day            string `json:"day"`
+	RequestCount   int64  `json:"request_count"`
+	ThrottledCount int64  `json:"throttled_count"`
+}
+
 // extractKeyPrefix 提取 API Key 的显示前缀
 // 例如：ydms_prod_abc123... -> ydms_prod_abc1...
 func extractKeyPrefix(apiKey string) string {
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+func setupAPIKeyDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&database.User{}, &database.CoursePermission{}, &database.APIKey{}, &database.APIKeyDailyUsage{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+func TestRotateAPIKeyKeepsOldKeyDuringGrace(t *testing.T) {
+	db := setupAPIKeyDB(t)
+	admin := database.User{Username: "admin", PasswordHash: "hash", Role: "super_admin"}
+	db.Create(&admin)
+
+	svc := NewAPIKeyService(db, time.Hour)
+	created, err := svc.CreateAPIKey(CreateAPIKeyRequest{Name: "sync", UserID: admin.ID, Environment: "dev"})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	rotated, err := svc.RotateAPIKey(created.KeyInfo.ID, nil)
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	if rotated.APIKey == created.APIKey || !strings.HasPrefix(rotated.APIKey, "ydms_dev_") {
+		t.Fatalf("expected a new dev key, got %q", rotated.APIKey)
+	}
+	if rotated.PreviousKeyPrefix != created.KeyPrefix || rotated.PreviousValidTo == nil {
+		t.Fatalf("unexpected rotation response: %+v", rotated)
+	}
+	for _, key := range []string{created.APIKey, rotated.APIKey} {
+		if _, err := auth.ValidateAPIKey(db, key); err != nil {
+			t.Fatalf("key should be valid during grace window: %v", err)
+		}
+	}
+
+	// 再次轮换且不保留宽限期：此前的两个密钥都立即失效
+	zero := time.Duration(0)
+	again, err := svc.RotateAPIKey(created.KeyInfo.ID, &zero)
+	if err != nil {
+		t.Fatalf("second rotate failed: %v", err)
+	}
+	for _, key := range []string{created.APIKey, rotated.APIKey} {
+		if _, err := auth.ValidateAPIKey(db, key); err == nil {
+			t.Fatalf("rotated-out key should be rejected")
+		}
+	}
+	if _, err := auth.ValidateAPIKey(db, again.APIKey); err != nil {
+		t.Fatalf("latest key should be valid: %v", err)
+	}
+
+	tooLong := MaxAPIKeyRotationGrace + time.Hour
+	if _, err := svc.RotateAPIKey(created.KeyInfo.ID, &tooLong); err == nil {
+		t.Fatalf("expected grace period above the limit to be rejected")
+	}
+}
+
+func TestGetAPIKeyStatsReportsDailyUsage(t *testing.T) {
+	db := setupAPIKeyDB(t)
+
+	owner := database.User{Username: "owner", PasswordHash: "hash", Role: "course_admin"}
+	other := database.User{Username: "other", PasswordHash: "hash", Role: "course_admin"}
+	db.Create(&owner)
+	db.Create(&other)
+	ownKey := database.APIKey{Name: "own", KeyHash: "h1", KeyPrefix: "p1", UserID: owner.ID}
+	otherKey := database.APIKey{Name: "other", KeyHash: "h2", KeyPrefix: "p2", UserID: other.ID}
+	db.Create(&ownKey)
+	db.Create(&otherKey)
+
+	now := time.Now()
+	record := func(keyID uint, at time.Time, throttled bool, times int) {
+		for i := 0; i < times; i++ {
+			if err := auth.RecordAPIKeyUsage(db, keyID, at, throttled); err != nil {
+				t.Fatalf("record usage: %v", err)
+			}
+		}
+	}
+	record(ownKey.ID, now, false, 3)
+	record(ownKey.ID, now, true, 1)
+	record(ownKey.ID, now.AddDate(0, 0, -2), false, 2)
+	record(ownKey.ID, now.AddDate(0, 0, -30), false, 5) // 超出统计窗口
+	record(otherKey.ID, now, false, 4)
+
+	stats, err := NewAPIKeyService(db, 0).GetAPIKeyStats(owner.ID)
+	if err != nil {
+		t.Fatalf("stats failed: %v", err)
+	}
+	if stats["requests_today"] != int64(3) || stats["throttled_today"] != int64(1) {
+		t.Fatalf("unexpected today counts: %+v", stats)
+	}
+	if stats["requests_last_7_days"] != int64(5) {
+		t.Fatalf("unexpected 7 day total: %v", stats["requests_last_7_days"])
+	}
+	if daily := stats["daily_usage"].([]APIKeyUsageDay); len(daily) != 2 {
+		t.Fatalf("expected two days of usage, got %+v", daily)
+	}
+
+	all, err := NewAPIKeyService(db, 0).GetAPIKeyStats(0)
+	if err != nil {
+		t.Fatalf("stats failed: %v", err)
+	}
+	if all["requests_today"] != int64(7) {
+		t.Fatalf("expected usage across all keys, got %v", all["requests_today"])
+	}
+}
+
+func TestCreateServiceAccountWithKey(t *testing.T) {
+	db := setupAPIKeyDB(t)
+	admin := database.User{Username: "admin", PasswordHash: "hash", Role: "super_admin"}
+	db.Create(&admin)
+
+	svc := NewAPIKeyService(db, time.Hour)
+	resp, err := svc.CreateServiceAccount(CreateServiceAccountRequest{
+		Username:    "lms-sync",
+		CourseIDs:   []int64{11, 12, 11},
+		Key:         CreateAPIKeyRequest{Environment: "prod"},
+		CreatedByID: admin.ID,
+	})
+	if err != nil {
+		t.Fatalf("create service account failed: %v", err)
+	}
+	if resp.User.Kind != database.UserKindServiceAccount || resp.User.Role != "course_admin" {
+		t.Fatalf("unexpected user: %+v", resp.User)
+	}
+	if resp.APIKey.KeyInfo.Name != "lms-sync" || len(resp.CourseIDs) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	var grants int64
+	db.Model(&database.CoursePermission{}).Where("user_id = ?", resp.User.ID).Count(&grants)
+	if grants != 2 {
+		t.Fatalf("expected 2 course grants, got %d", grants)
+	}
+
+	owner, err := auth.ValidateAPIKey(db, resp.APIKey.APIKey)
+	if err != nil || owner.ID != resp.User.ID {
+		t.Fatalf("key should authenticate as the service account: %v", err)
+	}
+
+	// 服务账号不能密码登录，也不能设置密码
+	users := NewUserService(db)
+	if _, err := users.Authenticate("lms-sync", serviceAccountPasswordHash); err == nil {
+		t.Fatalf("service account must not log in with a password")
+	}
+	if err := users.UpdatePassword(resp.User.ID, "new-password-123"); err != ErrServiceAccountPassword {
+		t.Fatalf("expected ErrServiceAccountPassword, got %v", err)
+	}
+
+	// 用户名冲突时整个操作回滚
+	if _, err := svc.CreateServiceAccount(CreateServiceAccountRequest{Username: "lms-sync", CourseIDs: []int64{13}}); err == nil {
+		t.Fatalf("expected duplicate username to be rejected")
+	}
+	db.Model(&database.CoursePermission{}).Where("root_node_id = ?", 13).Count(&grants)
+	if grants != 0 {
+		t.Fatalf("failed create must not leave grants behind")
+	}
+}
+
+func TestUpdateAPIKeyAllowedCIDRs(t *testing.T) {
+	db := setupAPIKeyDB(t)
+	admin := database.User{Username: "admin", PasswordHash: "hash", Role: "super_admin"}
+	db.Create(&admin)
+
+	svc := NewAPIKeyService(db, time.Hour)
+	created, err := svc.CreateAPIKey(CreateAPIKeyRequest{Name: "sync", UserID: admin.ID, Environment: "dev", AllowCIDRs: []string{"198.51.100.0/24"}})
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	// 与 PATCH 请求体解码后的类型一致
+	updated, err := svc.UpdateAPIKey(created.KeyInfo.ID, map[string]interface{}{"allowed_cidrs": []interface{}{"10.0.0.0/8", "2001:db8::/32"}})
+	if err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	var stored database.APIKey
+	if err := db.First(&stored, created.KeyInfo.ID).Error; err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if updated.AllowCIDRs != `["10.0.0.0/8","2001:db8::/32"]` || stored.AllowCIDRs != updated.AllowCIDRs {
+		t.Fatalf("unexpected allow list: updated=%q stored=%q", updated.AllowCIDRs, stored.AllowCIDRs)
+	}
+
+	if _, err := svc.UpdateAPIKey(created.KeyInfo.ID, map[string]interface{}{"allowed_cidrs": []interface{}{"not-a-cidr"}}); err == nil {
+		t.Fatalf("expected invalid CIDR to be rejected")
+	}
+	if _, err := svc.UpdateAPIKey(created.KeyInfo.ID, map[string]interface{}{"allowed_cidrs": []interface{}{}}); err != nil {
+		t.Fatalf("clearing the allow list failed: %v", err)
+	}
+	db.First(&stored, created.KeyInfo.ID)
+	if stored.AllowCIDRs != "" {
+		t.Fatalf("expected allow list to be cleared, got %q", stored.AllowCIDRs)
+	}
+}
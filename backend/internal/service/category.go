@@ -11,21 +11,23 @@ import (
 	"strings"
 	"time"
 
+	"github.com/yjxt/ydms/backend/internal/database"
 	"github.com/yjxt/ydms/backend/internal/ndrclient"
 )
 
 // Category represents a catalog node exposed by the backend.
 type Category struct {
-	ID        int64       `json:"id"`
-	Name      string      `json:"name"`
-	Slug      string      `json:"slug"`
-	Path      string      `json:"path"`
-	ParentID  *int64      `json:"parent_id,omitempty"`
-	Position  int         `json:"position"`
-	CreatedAt string      `json:"created_at"`
-	UpdatedAt string      `json:"updated_at"`
-	DeletedAt *string     `json:"deleted_at,omitempty"`
-	Children  []*Category `json:"children,omitempty"`
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Slug        string      `json:"slug"`
+	Path        string      `json:"path"`
+	ParentID    *int64      `json:"parent_id,omitempty"`
+	Position    int         `json:"position"`
+	CreatedAt   string      `json:"created_at"`
+	UpdatedAt   string      `json:"updated_at"`
+	DeletedAt   *string     `json:"deleted_at,omitempty"`
+	Children    []*Category `json:"children,omitempty"`
+	HasChildren *bool       `json:"has_children,omitempty"` // set by the lazy-loading children endpoint only
 }
 
 // CategoryCreateRequest captures inputs from API layer.
@@ -88,8 +90,19 @@ type CategoryBulkCopyRequest struct {
 	TargetParentID *int64  `json:"target_parent_id"`
 	InsertBeforeID *int64  `json:"insert_before_id,omitempty"`
 	InsertAfterID  *int64  `json:"insert_after_id,omitempty"`
+	Mode           string  `json:"mode,omitempty"` // structure_only (default), link_documents or deep_copy
 }
 
+// Copy modes for CategoryBulkCopyRequest.
+const (
+	// CategoryCopyStructureOnly recreates the folder skeleton without documents.
+	CategoryCopyStructureOnly = "structure_only"
+	// CategoryCopyLinkDocuments binds the same documents to the copied folders.
+	CategoryCopyLinkDocuments = "link_documents"
+	// CategoryCopyDeepCopy clones every document and rewrites references inside the copied subtree.
+	CategoryCopyDeepCopy = "deep_copy"
+)
+
 // CategoryBulkMoveRequest describes moving multiple nodes to a new parent with optional anchor.
 type CategoryBulkMoveRequest struct {
 	SourceIDs      []int64 `json:"source_ids"`
@@ -188,6 +201,7 @@ func (s *Service) CreateCategory(ctx context.Context, meta RequestMeta, req Cate
 		ParentPath: parentPath,
 	}
 
+	defer s.InvalidateCategoryTree()
 	node, err := s.ndr.CreateNode(ctx, toNDRMeta(meta), body)
 	if err != nil {
 		log.Printf("[category] create node failed name=%q err=%v", req.Name, err)
@@ -196,6 +210,7 @@ func (s *Service) CreateCategory(ctx context.Context, meta RequestMeta, req Cate
 
 	category := mapNode(node, req.ParentID)
 	log.Printf("[category] created node id=%d path=%s position=%d", category.ID, category.Path, category.Position)
+	s.publish(meta, EventCategoryCreated, s.categoryCourses(ctx, meta, category), category)
 	return *category, nil
 }
 
@@ -212,6 +227,7 @@ func (s *Service) UpdateCategory(ctx context.Context, meta RequestMeta, id int64
 	if slug == "" {
 		slug = fmt.Sprintf("node-%d", time.Now().UnixNano())
 	}
+	defer s.InvalidateCategoryTree()
 	node, err := s.ndr.UpdateNode(ctx, toNDRMeta(meta), id, ndrclient.NodeUpdate{
 		Name: req.Name,
 		Slug: &slug,
@@ -223,6 +239,7 @@ func (s *Service) UpdateCategory(ctx context.Context, meta RequestMeta, id int64
 
 	category := mapNode(node, nil)
 	log.Printf("[category] updated node id=%d path=%s position=%d", category.ID, category.Path, category.Position)
+	s.publish(meta, EventCategoryUpdated, s.nodeCourses(ctx, meta, id), category)
 	return *category, nil
 }
 
@@ -237,16 +254,20 @@ func (s *Service) DeleteCategory(ctx context.Context, meta RequestMeta, id int64
 	if hasChildren {
 		return errors.New("cannot delete category with children")
 	}
+	courses := s.nodeCourses(ctx, meta, id)
+	defer s.InvalidateCategoryTree()
 	if err := s.ndr.DeleteNode(ctx, toNDRMeta(meta), id); err != nil {
 		log.Printf("[category] delete node failed id=%d err=%v", id, err)
 		return fmt.Errorf("delete node: %w", err)
 	}
+	s.publish(meta, EventCategoryDeleted, courses, map[string]any{"id": id, "purged": false})
 	return nil
 }
 
 // RestoreCategory reactivates a soft-deleted node.
 func (s *Service) RestoreCategory(ctx context.Context, meta RequestMeta, id int64) (Category, error) {
 	log.Printf("[category] restore id=%d", id)
+	defer s.InvalidateCategoryTree()
 	node, err := s.ndr.RestoreNode(ctx, toNDRMeta(meta), id)
 	if err != nil {
 		log.Printf("[category] restore node failed id=%d err=%v", id, err)
@@ -254,6 +275,7 @@ func (s *Service) RestoreCategory(ctx context.Context, meta RequestMeta, id int6
 	}
 	category := mapNode(node, nil)
 	log.Printf("[category] restored node id=%d path=%s", category.ID, category.Path)
+	s.publish(meta, EventCategoryRestored, s.nodeCourses(ctx, meta, id), category)
 	return *category, nil
 }
 
@@ -277,6 +299,9 @@ func (s *Service) MoveCategory(ctx context.Context, meta RequestMeta, id int64,
 		}
 	}
 
+	// 跨课程移动时两个课程的订阅者都需要收到事件
+	fromCourses := s.nodeCourses(ctx, meta, id)
+	defer s.InvalidateCategoryTree()
 	node, err := s.ndr.UpdateNode(ctx, toNDRMeta(meta), id, ndrclient.NodeUpdate{
 		ParentPath: parentPathOpt,
 	})
@@ -287,74 +312,23 @@ func (s *Service) MoveCategory(ctx context.Context, meta RequestMeta, id int64,
 
 	category := mapNode(node, req.NewParentID)
 	log.Printf("[category] moved node id=%d new_parent=%v position=%d", category.ID, category.ParentID, category.Position)
+	courses := s.categoryCourses(ctx, meta, category)
+	for _, course := range fromCourses {
+		if !containsInt(courses, course) {
+			courses = append(courses, course)
+		}
+	}
+	s.publish(meta, EventCategoryMoved, courses, category)
 	return *category, nil
 }
 
 // GetCategoryTree aggregates nodes into a hierarchy.
 func (s *Service) GetCategoryTree(ctx context.Context, meta RequestMeta, includeDeleted bool) ([]*Category, error) {
-	log.Printf("[category] tree include_deleted=%v", includeDeleted)
-	params := ndrclient.ListNodesParams{Page: 1, Size: 100}
-	if includeDeleted {
-		params.IncludeDeleted = ptr(true)
-	}
-
-	nodes := make([]ndrclient.Node, 0)
-	total := 0
-
-	for {
-		page, err := s.ndr.ListNodes(ctx, toNDRMeta(meta), params)
-		if err != nil {
-			log.Printf("[category] list nodes failed page=%d err=%v", params.Page, err)
-			return nil, fmt.Errorf("list nodes: %w", err)
-		}
-		if total == 0 {
-			total = page.Total
-		}
-		nodes = append(nodes, page.Items...)
-
-		pageSize := page.Size
-		if pageSize == 0 {
-			pageSize = params.Size
-		}
-
-		if (total != 0 && len(nodes) >= total) || len(page.Items) == 0 || len(page.Items) < pageSize {
-			break
-		}
-		params.Page++
-	}
-
-	tree := buildTree(nodes)
-
-	// 课程管理员和校对员权限过滤：只显示其被授权的课程（根节点）及其子节点
-	if (meta.UserRole == "course_admin" || meta.UserRole == "proofreader") && meta.UserIDNumeric > 0 {
-		authorizedRootNodes, err := s.userService.GetUserCourses(meta.UserIDNumeric)
-		if err != nil {
-			log.Printf("[category] failed to get user courses: %v", err)
-			// 如果获取权限失败，返回空树（安全策略）
-			return []*Category{}, nil
-		}
-
-		// 构建授权 root node ID 集合
-		authorizedSet := make(map[int64]bool)
-		for _, nodeID := range authorizedRootNodes {
-			authorizedSet[nodeID] = true
-		}
-
-		// 过滤树：只保留授权的根节点
-		filteredTree := make([]*Category, 0)
-		for _, root := range tree {
-			if authorizedSet[root.ID] {
-				filteredTree = append(filteredTree, root)
-			}
-		}
-
-		log.Printf("[category] tree filtered for %s user=%d: total_roots=%d authorized_roots=%d",
-			meta.UserRole, meta.UserIDNumeric, len(tree), len(filteredTree))
-		return filteredTree, nil
+	tree, err := s.LoadCategoryTree(ctx, meta, includeDeleted)
+	if err != nil {
+		return nil, err
 	}
-
-	log.Printf("[category] tree aggregated total=%d fetched=%d roots=%d", total, len(nodes), len(tree))
-	return tree, nil
+	return tree.Roots, nil
 }
 
 // GetDeletedCategories returns nodes that are soft deleted.
@@ -436,10 +410,13 @@ func (s *Service) GetDeletedCategories(ctx context.Context, meta RequestMeta) ([
 // PurgeCategory permanently deletes a node in NDR.
 func (s *Service) PurgeCategory(ctx context.Context, meta RequestMeta, id int64) error {
 	log.Printf("[category] purge id=%d", id)
+	courses := s.nodeCourses(ctx, meta, id)
+	defer s.InvalidateCategoryTree()
 	if err := s.ndr.PurgeNode(ctx, toNDRMeta(meta), id); err != nil {
 		log.Printf("[category] purge node failed id=%d err=%v", id, err)
 		return fmt.Errorf("purge node: %w", err)
 	}
+	s.publish(meta, EventCategoryDeleted, courses, map[string]any{"id": id, "purged": true})
 	return nil
 }
 
@@ -451,6 +428,7 @@ func (s *Service) ReorderCategories(ctx context.Context, meta RequestMeta, req C
 
 	log.Printf("[category] reorder parent=%v ids=%v", req.ParentID, req.OrderedIDs)
 
+	defer s.InvalidateCategoryTree()
 	nodes, err := s.ndr.ReorderNodes(ctx, toNDRMeta(meta), ndrclient.NodeReorderPayload{
 		ParentID:   req.ParentID,
 		OrderedIDs: req.OrderedIDs,
@@ -466,6 +444,11 @@ func (s *Service) ReorderCategories(ctx context.Context, meta RequestMeta, req C
 		categories = append(categories, *cat)
 	}
 	log.Printf("[category] reorder success parent=%v count=%d", req.ParentID, len(categories))
+	courses := req.OrderedIDs // 根节点排序：每个根节点即一门课程
+	if req.ParentID != nil {
+		courses = s.nodeCourses(ctx, meta, *req.ParentID)
+	}
+	s.publish(meta, EventCategoryReordered, courses, map[string]any{"parent_id": req.ParentID, "ordered_ids": req.OrderedIDs})
 	return categories, nil
 }
 
@@ -589,36 +572,57 @@ func (s *Service) BulkCopyCategories(ctx context.Context, meta RequestMeta, req
 	if req.InsertBeforeID != nil && req.InsertAfterID != nil {
 		return nil, errors.New("insert_before_id and insert_after_id cannot both be set")
 	}
+	mode := req.Mode
+	if mode == "" {
+		mode = CategoryCopyStructureOnly
+	}
+	if mode != CategoryCopyStructureOnly && mode != CategoryCopyLinkDocuments && mode != CategoryCopyDeepCopy {
+		return nil, fmt.Errorf("invalid copy mode %q", req.Mode)
+	}
 
-	cache := make(map[int64]map[string]struct{})
+	g, err := s.beginSaga(SagaKindCategoryCopy, meta, 0)
+	if err != nil {
+		return nil, err
+	}
+	job := &categoryCopy{
+		mode:      mode,
+		nameCache: make(map[int64]map[string]struct{}),
+		docIDMap:  make(map[int64]int64),
+		saga:      g,
+	}
 	created := make([]Category, 0, len(req.SourceIDs))
 	createdIDs := make([]int64, 0, len(req.SourceIDs))
 
-	// 复制节点，如果失败则回滚已创建的节点
+	// 复制节点（及文档），如果失败则回滚已创建的全部节点与文档
 	for _, id := range req.SourceIDs {
-		copied, err := s.copyCategoryRecursive(ctx, meta, id, req.TargetParentID, cache)
+		copied, err := s.copyCategoryRecursive(ctx, meta, id, req.TargetParentID, job)
 		if err != nil {
-			// 回滚：删除已创建的节点
-			s.rollbackCreatedCategories(ctx, meta, createdIDs)
-			return nil, fmt.Errorf("copy category %d failed, rolled back %d created nodes: %w", id, len(createdIDs), err)
+			nodes, docs := s.rollbackCategoryCopy(ctx, meta, job)
+			return nil, fmt.Errorf("copy category %d failed, rolled back %d nodes and %d documents: %w", id, nodes, docs, err)
 		}
 		created = append(created, *copied)
 		createdIDs = append(createdIDs, copied.ID)
 	}
 
+	// 深拷贝：所有文档复制完成后，把指向子树内文档的引用改写为新文档 ID
+	if err := s.remapCopiedReferences(ctx, meta, job); err != nil {
+		nodes, docs := s.rollbackCategoryCopy(ctx, meta, job)
+		return nil, fmt.Errorf("%w, rolled back %d nodes and %d documents", err, nodes, docs)
+	}
+
 	if req.InsertBeforeID != nil || req.InsertAfterID != nil {
 		if req.InsertBeforeID != nil && containsInt(req.SourceIDs, *req.InsertBeforeID) {
-			s.rollbackCreatedCategories(ctx, meta, createdIDs)
+			s.rollbackCategoryCopy(ctx, meta, job)
 			return nil, errors.New("anchor cannot be part of source_ids")
 		}
 		if req.InsertAfterID != nil && containsInt(req.SourceIDs, *req.InsertAfterID) {
-			s.rollbackCreatedCategories(ctx, meta, createdIDs)
+			s.rollbackCategoryCopy(ctx, meta, job)
 			return nil, errors.New("anchor cannot be part of source_ids")
 		}
 
 		siblings, err := s.fetchSiblingIDs(ctx, meta, req.TargetParentID)
 		if err != nil {
-			s.rollbackCreatedCategories(ctx, meta, createdIDs)
+			s.rollbackCategoryCopy(ctx, meta, job)
 			return nil, fmt.Errorf("fetch siblings failed, rolled back: %w", err)
 		}
 		siblings = removeIDs(siblings, createdIDs)
@@ -627,14 +631,14 @@ func (s *Service) BulkCopyCategories(ctx context.Context, meta RequestMeta, req
 		if req.InsertBeforeID != nil {
 			idx := indexOf(siblings, *req.InsertBeforeID)
 			if idx == -1 {
-				s.rollbackCreatedCategories(ctx, meta, createdIDs)
+				s.rollbackCategoryCopy(ctx, meta, job)
 				return nil, fmt.Errorf("anchor id %d not found", *req.InsertBeforeID)
 			}
 			ordered = append(siblings[:idx], append(createdIDs, siblings[idx:]...)...)
 		} else if req.InsertAfterID != nil {
 			idx := indexOf(siblings, *req.InsertAfterID)
 			if idx == -1 {
-				s.rollbackCreatedCategories(ctx, meta, createdIDs)
+				s.rollbackCategoryCopy(ctx, meta, job)
 				return nil, fmt.Errorf("anchor id %d not found", *req.InsertAfterID)
 			}
 			anchorIdx := idx + 1
@@ -645,6 +649,7 @@ func (s *Service) BulkCopyCategories(ctx context.Context, meta RequestMeta, req
 		if err != nil {
 			// 重排失败不回滚，节点已创建但顺序可能不符合预期
 			// 用户可以手动重新排序或删除
+			job.saga.commit()
 			return nil, fmt.Errorf("reorder failed, %d nodes created but not in expected order: %w", len(createdIDs), err)
 		}
 		updated := make(map[int64]Category)
@@ -664,18 +669,49 @@ func (s *Service) BulkCopyCategories(ctx context.Context, meta RequestMeta, req
 		}
 	}
 
+	job.saga.commit()
+	log.Printf("[category] bulk copy mode=%s nodes=%d cloned_documents=%d linked_documents=%d",
+		mode, len(job.nodes), len(job.documents), len(job.links))
 	return created, nil
 }
 
-// rollbackCreatedCategories 删除批量操作中创建的节点（尽力而为，忽略错误）
-func (s *Service) rollbackCreatedCategories(ctx context.Context, meta RequestMeta, createdIDs []int64) {
-	for _, id := range createdIDs {
-		// 使用软删除进行回滚，忽略错误继续
-		_ = s.DeleteCategory(ctx, meta, id)
+// categoryCopy 记录一次批量复制创建的全部资源，用于失败时回滚
+type categoryCopy struct {
+	mode      string
+	nameCache map[int64]map[string]struct{}
+	saga      *saga                // 每个 NDR 调用在执行前写入的补偿日志
+	nodes     []int64              // 新建节点，按创建顺序（父节点在前）
+	documents []int64              // deep_copy 新建的文档
+	links     [][2]int64           // link_documents 新增的 [节点, 文档] 绑定
+	docIDMap  map[int64]int64      // 源文档 ID -> 复制后的文档 ID
+	cloned    []ndrclient.Document // 已复制的源文档，用于改写引用
+}
+
+// rollbackCategoryCopy 按日志倒序撤销批量复制中的绑定、文档与节点，返回回滚的节点数与文档数。
+// 撤销失败的步骤保留在日志中，由管理员处理。
+func (s *Service) rollbackCategoryCopy(ctx context.Context, meta RequestMeta, job *categoryCopy) (int, int) {
+	return s.compensateSaga(ctx, meta, job.saga)
+}
+
+// restoreCopySaga 由已持久化的复制结果重建内存中的 saga，倒序补偿时先删文档、解绑，再由子到父删除节点
+func restoreCopySaga(nodes, documents []int64, links [][2]int64) *saga {
+	g := &saga{kind: SagaKindCategoryCopy}
+	add := func(action string, data sagaStepData) {
+		g.steps = append(g.steps, &sagaStep{action: action, data: data, status: database.SagaStepDone})
+	}
+	for _, id := range nodes {
+		add(sagaCreateNode, sagaStepData{NodeID: id})
+	}
+	for _, link := range links {
+		add(sagaBindDocument, sagaStepData{NodeID: link[0], DocumentID: link[1]})
 	}
+	for _, id := range documents {
+		add(sagaCloneDocument, sagaStepData{DocumentID: id})
+	}
+	return g
 }
 
-func (s *Service) copyCategoryRecursive(ctx context.Context, meta RequestMeta, sourceID int64, targetParentID *int64, cache map[int64]map[string]struct{}) (*Category, error) {
+func (s *Service) copyCategoryRecursive(ctx context.Context, meta RequestMeta, sourceID int64, targetParentID *int64, job *categoryCopy) (*Category, error) {
 	srcNode, err := s.ndr.GetNode(ctx, toNDRMeta(meta), sourceID, ndrclient.GetNodeOptions{})
 	if err != nil {
 		return nil, fmt.Errorf("fetch source node %d: %w", sourceID, err)
@@ -685,19 +721,31 @@ func (s *Service) copyCategoryRecursive(ctx context.Context, meta RequestMeta, s
 		return nil, fmt.Errorf("source node %d is deleted", sourceID)
 	}
 
-	name, err := s.ensureUniqueCategoryName(ctx, meta, targetParentID, srcNode.Name, cache)
+	name, err := s.ensureUniqueCategoryName(ctx, meta, targetParentID, srcNode.Name, job.nameCache)
 	if err != nil {
 		return nil, err
 	}
 
+	step, err := job.saga.plan(sagaCreateNode, sagaStepData{ParentID: targetParentID, Name: name})
+	if err != nil {
+		return nil, err
+	}
 	createdValue, err := s.CreateCategory(ctx, meta, CategoryCreateRequest{Name: name, ParentID: targetParentID})
 	if err != nil {
+		job.saga.fail(step, err)
 		return nil, err
 	}
+	step.data.NodeID = createdValue.ID
+	job.saga.done(step)
+	job.nodes = append(job.nodes, createdValue.ID)
 
 	created := createdValue
 	created.Children = nil
 
+	if err := s.copyNodeDocuments(ctx, meta, sourceID, created.ID, job); err != nil {
+		return nil, err
+	}
+
 	children, err := s.ndr.ListChildren(ctx, toNDRMeta(meta), sourceID, ndrclient.ListChildrenParams{})
 	if err != nil {
 		return nil, fmt.Errorf("list children for %d: %w", sourceID, err)
@@ -707,7 +755,7 @@ func (s *Service) copyCategoryRecursive(ctx context.Context, meta RequestMeta, s
 	})
 
 	for _, child := range children {
-		copiedChild, err := s.copyCategoryRecursive(ctx, meta, child.ID, ptr(created.ID), cache)
+		copiedChild, err := s.copyCategoryRecursive(ctx, meta, child.ID, ptr(created.ID), job)
 		if err != nil {
 			return nil, err
 		}
@@ -717,6 +765,82 @@ func (s *Service) copyCategoryRecursive(ctx context.Context, meta RequestMeta, s
 	return &created, nil
 }
 
+// copyNodeDocuments 按复制模式处理源节点直接绑定的文档
+func (s *Service) copyNodeDocuments(ctx context.Context, meta RequestMeta, sourceID, targetID int64, job *categoryCopy) error {
+	if job.mode == CategoryCopyStructureOnly {
+		return nil
+	}
+	docs, err := s.listDirectNodeDocuments(ctx, meta, sourceID)
+	if err != nil {
+		return fmt.Errorf("list documents for %d: %w", sourceID, err)
+	}
+
+	for _, doc := range docs {
+		docID := doc.ID
+		if job.mode == CategoryCopyDeepCopy {
+			// 同一文档绑定在子树内多个节点时只复制一次
+			cloneID, ok := job.docIDMap[doc.ID]
+			if !ok {
+				metadata := cloneMetadata(doc.Metadata)
+				delete(metadata, "references")
+				step, err := job.saga.plan(sagaCloneDocument, sagaStepData{SourceID: doc.ID})
+				if err != nil {
+					return err
+				}
+				clone, err := s.CreateDocument(ctx, meta, DocumentCreateRequest{
+					Title:    doc.Title,
+					Metadata: metadata,
+					Content:  doc.Content,
+					Type:     doc.Type,
+					Position: ptr(doc.Position),
+				})
+				if err != nil {
+					job.saga.fail(step, err)
+					return fmt.Errorf("copy document %d: %w", doc.ID, err)
+				}
+				step.data.DocumentID = clone.ID
+				job.saga.done(step)
+				cloneID = clone.ID
+				job.documents = append(job.documents, cloneID)
+				job.docIDMap[doc.ID] = cloneID
+				job.cloned = append(job.cloned, doc)
+			}
+			docID = cloneID
+		}
+
+		step, err := job.saga.plan(sagaBindDocument, sagaStepData{NodeID: targetID, DocumentID: docID})
+		if err != nil {
+			return err
+		}
+		if err := s.ndr.BindDocument(ctx, toNDRMeta(meta), targetID, docID); err != nil {
+			job.saga.fail(step, err)
+			return fmt.Errorf("bind document %d to node %d: %w", docID, targetID, err)
+		}
+		job.saga.done(step)
+		if job.mode == CategoryCopyLinkDocuments {
+			job.links = append(job.links, [2]int64{targetID, docID})
+		}
+	}
+	return nil
+}
+
+// remapCopiedReferences 将复制文档中指向子树内文档的引用改写为对应的新文档，子树外的引用保持不变
+func (s *Service) remapCopiedReferences(ctx context.Context, meta RequestMeta, job *categoryCopy) error {
+	for _, doc := range job.cloned {
+		refs, ok := doc.Metadata["references"].([]any)
+		if !ok || len(refs) == 0 {
+			continue
+		}
+		metadata := cloneMetadata(doc.Metadata)
+		metadata["references"] = remapReferences(refs, job.docIDMap)
+		newID := job.docIDMap[doc.ID]
+		if _, err := s.UpdateDocument(ctx, meta, newID, DocumentUpdateRequest{Metadata: metadata}); err != nil {
+			return fmt.Errorf("rewrite references for document %d: %w", newID, err)
+		}
+	}
+	return nil
+}
+
 func (s *Service) ensureUniqueCategoryName(ctx context.Context, meta RequestMeta, parentID *int64, base string, cache map[int64]map[string]struct{}) (string, error) {
 	parentKey := int64(-1)
 	if parentID != nil {
@@ -743,7 +867,20 @@ func (s *Service) ensureUniqueCategoryName(ctx context.Context, meta RequestMeta
 }
 
 func (s *Service) fetchSiblingNames(ctx context.Context, meta RequestMeta, parentID *int64) (map[string]struct{}, error) {
-	result := make(map[string]struct{})
+	nodes, err := s.listSiblingNodes(ctx, meta, parentID)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		result[node.Name] = struct{}{}
+	}
+	return result, nil
+}
+
+// listSiblingNodes 列出父节点下未删除的直接子节点，parentID 为 nil 时列出根节点
+func (s *Service) listSiblingNodes(ctx context.Context, meta RequestMeta, parentID *int64) ([]ndrclient.Node, error) {
+	nodes := make([]ndrclient.Node, 0)
 	if parentID == nil {
 		params := ndrclient.ListNodesParams{Page: 1, Size: 200}
 		for {
@@ -753,7 +890,7 @@ func (s *Service) fetchSiblingNames(ctx context.Context, meta RequestMeta, paren
 			}
 			for _, node := range page.Items {
 				if node.ParentID == nil && node.DeletedAt == nil {
-					result[node.Name] = struct{}{}
+					nodes = append(nodes, node)
 				}
 			}
 			if len(page.Items) < params.Size || (page.Total > 0 && params.Page*params.Size >= page.Total) {
@@ -761,7 +898,7 @@ func (s *Service) fetchSiblingNames(ctx context.Context, meta RequestMeta, paren
 			}
 			params.Page++
 		}
-		return result, nil
+		return nodes, nil
 	}
 	children, err := s.ndr.ListChildren(ctx, toNDRMeta(meta), *parentID, ndrclient.ListChildrenParams{})
 	if err != nil {
@@ -769,10 +906,10 @@ func (s *Service) fetchSiblingNames(ctx context.Context, meta RequestMeta, paren
 	}
 	for _, node := range children {
 		if node.DeletedAt == nil {
-			result[node.Name] = struct{}{}
+			nodes = append(nodes, node)
 		}
 	}
-	return result, nil
+	return nodes, nil
 }
 
 func generateCopyNameCandidates(base string) []string {
@@ -838,22 +975,39 @@ func (s *Service) BulkMoveCategories(ctx context.Context, meta RequestMeta, req
 		})
 	}
 
-	// 执行移动操作
+	// 执行前先把全部移动写入日志，恢复时据此判断操作是否已完整执行
 	targetParentID := req.TargetParentID
+	g, err := s.beginSaga(SagaKindCategoryMove, meta, 0)
+	if err != nil {
+		return nil, err
+	}
+	steps := make([]*sagaStep, 0, len(moveRecords))
+	for _, record := range moveRecords {
+		step, err := g.plan(sagaMoveNode, sagaStepData{NodeID: record.id, FromParentID: record.originalParent, ToParentID: targetParentID})
+		if err != nil {
+			s.compensateSaga(ctx, meta, g)
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+
+	// 执行移动操作
 	movedSet := make(map[int64]struct{}, len(req.SourceIDs))
 	for i, record := range moveRecords {
 		movedSet[record.id] = struct{}{}
 		_, err := s.MoveCategory(ctx, meta, record.id, MoveCategoryRequest{NewParentID: targetParentID, ParentSpecified: true})
 		if err != nil {
 			// 回滚：将已移动的节点移回原位置
-			s.rollbackMovedCategories(ctx, meta, moveRecords[:i])
-			return nil, fmt.Errorf("move category %d failed, rolled back %d moved nodes: %w", record.id, i, err)
+			g.fail(steps[i], err)
+			moved, _ := s.compensateSaga(ctx, meta, g)
+			return nil, fmt.Errorf("move category %d failed, rolled back %d moved nodes: %w", record.id, moved, err)
 		}
+		g.done(steps[i])
 	}
 
 	siblings, err := s.fetchSiblingIDs(ctx, meta, targetParentID)
 	if err != nil {
-		s.rollbackMovedCategories(ctx, meta, moveRecords)
+		s.compensateSaga(ctx, meta, g)
 		return nil, fmt.Errorf("fetch siblings failed, rolled back: %w", err)
 	}
 
@@ -868,24 +1022,24 @@ func (s *Service) BulkMoveCategories(ctx context.Context, meta RequestMeta, req
 	insert := req.SourceIDs
 	if req.InsertBeforeID != nil {
 		if _, ok := movedSet[*req.InsertBeforeID]; ok {
-			s.rollbackMovedCategories(ctx, meta, moveRecords)
+			s.compensateSaga(ctx, meta, g)
 			return nil, errors.New("anchor cannot be part of source_ids")
 		}
 		idx := indexOf(ordered, *req.InsertBeforeID)
 		if idx == -1 {
-			s.rollbackMovedCategories(ctx, meta, moveRecords)
+			s.compensateSaga(ctx, meta, g)
 			return nil, fmt.Errorf("anchor id %d not found among siblings", *req.InsertBeforeID)
 		}
 		anchorIndex = idx
 		ordered = append(ordered[:anchorIndex], append(insert, ordered[anchorIndex:]...)...)
 	} else if req.InsertAfterID != nil {
 		if _, ok := movedSet[*req.InsertAfterID]; ok {
-			s.rollbackMovedCategories(ctx, meta, moveRecords)
+			s.compensateSaga(ctx, meta, g)
 			return nil, errors.New("anchor cannot be part of source_ids")
 		}
 		idx := indexOf(ordered, *req.InsertAfterID)
 		if idx == -1 {
-			s.rollbackMovedCategories(ctx, meta, moveRecords)
+			s.compensateSaga(ctx, meta, g)
 			return nil, fmt.Errorf("anchor id %d not found among siblings", *req.InsertAfterID)
 		}
 		anchorIndex = idx + 1
@@ -894,6 +1048,8 @@ func (s *Service) BulkMoveCategories(ctx context.Context, meta RequestMeta, req
 		ordered = append(ordered, insert...)
 	}
 
+	// 节点已全部移动，之后的重排失败不再回滚
+	g.commit()
 	siblingsCats, err := s.ReorderCategories(ctx, meta, CategoryReorderRequest{ParentID: targetParentID, OrderedIDs: ordered})
 	if err != nil {
 		// 重排失败不回滚，节点已移动但顺序可能不符合预期
@@ -915,53 +1071,29 @@ func (s *Service) BulkMoveCategories(ctx context.Context, meta RequestMeta, req
 	return moved, nil
 }
 
-// rollbackMovedCategories 回滚批量移动操作（尽力而为，忽略错误）
-func (s *Service) rollbackMovedCategories(ctx context.Context, meta RequestMeta, records []moveRecord) {
+// rollbackMovedCategories 将已移动的节点倒序移回原父节点，返回移回的节点数
+func (s *Service) rollbackMovedCategories(ctx context.Context, meta RequestMeta, records []moveRecord) int {
+	g := &saga{kind: SagaKindCategoryMove}
 	for _, record := range records {
-		// 将节点移回原父节点，忽略错误继续
-		_, _ = s.MoveCategory(ctx, meta, record.id, MoveCategoryRequest{
-			NewParentID:     record.originalParent,
-			ParentSpecified: true,
+		g.steps = append(g.steps, &sagaStep{
+			action: sagaMoveNode,
+			data:   sagaStepData{NodeID: record.id, FromParentID: record.originalParent},
+			status: database.SagaStepDone,
 		})
 	}
+	moved, _ := s.compensateSaga(ctx, meta, g)
+	return moved
 }
 
 func (s *Service) fetchSiblingIDs(ctx context.Context, meta RequestMeta, parentID *int64) ([]int64, error) {
-	if parentID == nil {
-		params := ndrclient.ListNodesParams{Page: 1, Size: 200}
-		nodes := make([]ndrclient.Node, 0)
-		for {
-			page, err := s.ndr.ListNodes(ctx, toNDRMeta(meta), params)
-			if err != nil {
-				return nil, err
-			}
-			for _, node := range page.Items {
-				if node.DeletedAt == nil && node.ParentID == nil {
-					nodes = append(nodes, node)
-				}
-			}
-			if len(page.Items) < params.Size || (page.Total > 0 && params.Page*params.Size >= page.Total) {
-				break
-			}
-			params.Page++
-		}
-		sort.Slice(nodes, func(i, j int) bool { return nodes[i].Position < nodes[j].Position })
-		ids := make([]int64, 0, len(nodes))
-		for _, node := range nodes {
-			ids = append(ids, node.ID)
-		}
-		return ids, nil
-	}
-	children, err := s.ndr.ListChildren(ctx, toNDRMeta(meta), *parentID, ndrclient.ListChildrenParams{})
+	nodes, err := s.listSiblingNodes(ctx, meta, parentID)
 	if err != nil {
 		return nil, err
 	}
-	sort.Slice(children, func(i, j int) bool { return children[i].Position < children[j].Position })
-	ids := make([]int64, 0, len(children))
-	for _, node := range children {
-		if node.DeletedAt == nil {
-			ids = append(ids, node.ID)
-		}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Position < nodes[j].Position })
+	ids := make([]int64, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
 	}
 	return ids, nil
 }
@@ -0,0 +1,543 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+// CategoryArchiveFormatVersion identifies the layout of export archives.
+const CategoryArchiveFormatVersion = 1
+
+const (
+	archiveManifestName = "manifest.json"
+	archiveTreeDir      = "tree"
+	archiveVersionsDir  = "versions"
+	archivePageSize     = 100
+	// archiveMaxEntrySize caps the uncompressed size of a single archive entry so
+	// that a small, highly compressed upload cannot exhaust memory on import.
+	archiveMaxEntrySize = 64 << 20
+)
+
+// CategoryExportOptions controls what is written into an export archive.
+type CategoryExportOptions struct {
+	IncludeVersions bool
+}
+
+// CategoryArchiveManifest describes the content of an export archive.
+type CategoryArchiveManifest struct {
+	FormatVersion   int                       `json:"format_version"`
+	ExportedAt      string                    `json:"exported_at"`
+	RootID          int64                     `json:"root_id"`
+	IncludeVersions bool                      `json:"include_versions"`
+	Nodes           []CategoryArchiveNode     `json:"nodes"`
+	Documents       []CategoryArchiveDocument `json:"documents"`
+}
+
+// CategoryArchiveNode records a node of the exported subtree.
+type CategoryArchiveNode struct {
+	ID       int64  `json:"id"`
+	ParentID *int64 `json:"parent_id,omitempty"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	Path     string `json:"path"`
+	Position int    `json:"position"`
+	Dir      string `json:"dir"`
+}
+
+// CategoryArchiveDocument records a document of the exported subtree.
+type CategoryArchiveDocument struct {
+	ID            int64          `json:"id"`
+	Title         string         `json:"title"`
+	Type          *string        `json:"type,omitempty"`
+	Position      int            `json:"position"`
+	VersionNumber *int           `json:"version_number,omitempty"`
+	Format        string         `json:"format"`
+	File          string         `json:"file"`
+	Metadata      map[string]any `json:"metadata,omitempty"`
+	Bindings      []int64        `json:"bindings"`
+	References    []int64        `json:"references,omitempty"`
+	VersionsFile  string         `json:"versions_file,omitempty"`
+}
+
+// CategoryImportResult summarises an archive import.
+type CategoryImportResult struct {
+	RootID        int64           `json:"root_id"`
+	NodeIDMap     map[int64]int64 `json:"node_id_map"`
+	DocumentIDMap map[int64]int64 `json:"document_id_map"`
+	Warnings      []string        `json:"warnings,omitempty"`
+}
+
+// ExportCategory walks the subtree rooted at id and writes it as a zip archive to w.
+func (s *Service) ExportCategory(ctx context.Context, meta RequestMeta, id int64, opts CategoryExportOptions, w io.Writer) (CategoryArchiveManifest, error) {
+	log.Printf("[category] export id=%d include_versions=%v", id, opts.IncludeVersions)
+
+	root, err := s.ndr.GetNode(ctx, toNDRMeta(meta), id, ndrclient.GetNodeOptions{})
+	if err != nil {
+		return CategoryArchiveManifest{}, fmt.Errorf("get node: %w", err)
+	}
+	if root.DeletedAt != nil {
+		return CategoryArchiveManifest{}, fmt.Errorf("node %d is deleted", id)
+	}
+
+	manifest := CategoryArchiveManifest{
+		FormatVersion:   CategoryArchiveFormatVersion,
+		ExportedAt:      time.Now().UTC().Format(time.RFC3339),
+		RootID:          root.ID,
+		IncludeVersions: opts.IncludeVersions,
+	}
+
+	zw := zip.NewWriter(w)
+	docIndex := make(map[int64]int)
+
+	var walk func(node ndrclient.Node, parentID *int64, dir string) error
+	walk = func(node ndrclient.Node, parentID *int64, dir string) error {
+		manifest.Nodes = append(manifest.Nodes, CategoryArchiveNode{
+			ID:       node.ID,
+			ParentID: parentID,
+			Name:     node.Name,
+			Slug:     node.Slug,
+			Path:     node.Path,
+			Position: node.Position,
+			Dir:      dir,
+		})
+
+		docs, err := s.listDirectNodeDocuments(ctx, meta, node.ID)
+		if err != nil {
+			return fmt.Errorf("list documents for %d: %w", node.ID, err)
+		}
+		for _, doc := range docs {
+			if _, seen := docIndex[doc.ID]; seen {
+				continue
+			}
+			entry, err := s.exportDocument(ctx, meta, zw, doc, dir, opts)
+			if err != nil {
+				return err
+			}
+			docIndex[doc.ID] = len(manifest.Documents)
+			manifest.Documents = append(manifest.Documents, entry)
+		}
+
+		children, err := s.ndr.ListChildren(ctx, toNDRMeta(meta), node.ID, ndrclient.ListChildrenParams{})
+		if err != nil {
+			return fmt.Errorf("list children for %d: %w", node.ID, err)
+		}
+		sort.Slice(children, func(i, j int) bool {
+			return children[i].Position < children[j].Position
+		})
+		for _, child := range children {
+			if child.DeletedAt != nil {
+				continue
+			}
+			childDir := path.Join(dir, archiveEntryName(child.Position, child.ID, child.Name))
+			if err := walk(child, ptr(node.ID), childDir); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	rootDir := path.Join(archiveTreeDir, archiveEntryName(root.Position, root.ID, root.Name))
+	if err := walk(root, nil, rootDir); err != nil {
+		log.Printf("[category] export failed id=%d err=%v", id, err)
+		return CategoryArchiveManifest{}, err
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return CategoryArchiveManifest{}, fmt.Errorf("encode manifest: %w", err)
+	}
+	if err := writeArchiveFile(zw, archiveManifestName, manifestData); err != nil {
+		return CategoryArchiveManifest{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return CategoryArchiveManifest{}, fmt.Errorf("finalize archive: %w", err)
+	}
+
+	log.Printf("[category] exported id=%d nodes=%d documents=%d", id, len(manifest.Nodes), len(manifest.Documents))
+	return manifest, nil
+}
+
+func (s *Service) exportDocument(ctx context.Context, meta RequestMeta, zw *zip.Writer, doc ndrclient.Document, dir string, opts CategoryExportOptions) (CategoryArchiveDocument, error) {
+	format, data := documentContentParts(doc)
+	file := path.Join(dir, archiveEntryName(doc.Position, doc.ID, doc.Title)+contentFormatExtension(format))
+	if err := writeArchiveFile(zw, file, []byte(data)); err != nil {
+		return CategoryArchiveDocument{}, err
+	}
+
+	status, err := s.ndr.GetDocumentBindingStatus(ctx, toNDRMeta(meta), doc.ID)
+	if err != nil {
+		return CategoryArchiveDocument{}, fmt.Errorf("binding status for document %d: %w", doc.ID, err)
+	}
+	bindings := append([]int64{}, status.NodeIDs...)
+	sort.Slice(bindings, func(i, j int) bool { return bindings[i] < bindings[j] })
+
+	entry := CategoryArchiveDocument{
+		ID:            doc.ID,
+		Title:         doc.Title,
+		Type:          doc.Type,
+		Position:      doc.Position,
+		VersionNumber: doc.Version,
+		Format:        format,
+		File:          file,
+		Metadata:      doc.Metadata,
+		Bindings:      bindings,
+		References:    referencedDocumentIDs(doc.Metadata),
+	}
+
+	if opts.IncludeVersions {
+		versions, err := s.collectDocumentVersions(ctx, meta, doc.ID)
+		if err != nil {
+			return CategoryArchiveDocument{}, err
+		}
+		payload, err := json.MarshalIndent(versions, "", "  ")
+		if err != nil {
+			return CategoryArchiveDocument{}, fmt.Errorf("encode versions for document %d: %w", doc.ID, err)
+		}
+		entry.VersionsFile = path.Join(archiveVersionsDir, fmt.Sprintf("%d.json", doc.ID))
+		if err := writeArchiveFile(zw, entry.VersionsFile, payload); err != nil {
+			return CategoryArchiveDocument{}, err
+		}
+	}
+
+	return entry, nil
+}
+
+// listDirectNodeDocuments pages through the documents bound directly to a node.
+func (s *Service) listDirectNodeDocuments(ctx context.Context, meta RequestMeta, nodeID int64) ([]ndrclient.Document, error) {
+	docs := make([]ndrclient.Document, 0)
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set("include_descendants", "false")
+		query.Set("page", strconv.Itoa(page))
+		query.Set("size", strconv.Itoa(archivePageSize))
+
+		result, err := s.ndr.ListNodeDocuments(ctx, toNDRMeta(meta), nodeID, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range result.Items {
+			if doc.DeletedAt == nil {
+				docs = append(docs, doc)
+			}
+		}
+		if len(result.Items) < archivePageSize || (result.Total > 0 && page*archivePageSize >= result.Total) {
+			break
+		}
+	}
+	sort.SliceStable(docs, func(i, j int) bool { return docs[i].Position < docs[j].Position })
+	return docs, nil
+}
+
+func (s *Service) collectDocumentVersions(ctx context.Context, meta RequestMeta, docID int64) ([]DocumentVersion, error) {
+	versions := make([]DocumentVersion, 0)
+	for page := 1; ; page++ {
+		result, err := s.ListDocumentVersions(ctx, meta, docID, page, archivePageSize)
+		if err != nil {
+			return nil, fmt.Errorf("list versions for document %d: %w", docID, err)
+		}
+		versions = append(versions, result.Versions...)
+		if len(result.Versions) < archivePageSize || (result.Total > 0 && page*archivePageSize >= result.Total) {
+			break
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].VersionNumber < versions[j].VersionNumber })
+	return versions, nil
+}
+
+// ImportCategoryArchive recreates an exported subtree below targetParentID (nil for root level).
+// Everything created is rolled back if any step fails.
+func (s *Service) ImportCategoryArchive(ctx context.Context, meta RequestMeta, r io.ReaderAt, size int64, targetParentID *int64) (CategoryImportResult, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return CategoryImportResult{}, fmt.Errorf("open archive: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	manifestData, err := readArchiveFile(files, archiveManifestName)
+	if err != nil {
+		return CategoryImportResult{}, err
+	}
+	var manifest CategoryArchiveManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return CategoryImportResult{}, fmt.Errorf("decode manifest: %w", err)
+	}
+	if manifest.FormatVersion != CategoryArchiveFormatVersion {
+		return CategoryImportResult{}, fmt.Errorf("unsupported archive format version %d", manifest.FormatVersion)
+	}
+	if len(manifest.Nodes) == 0 || manifest.Nodes[0].ID != manifest.RootID {
+		return CategoryImportResult{}, errors.New("archive manifest must start with the root node")
+	}
+
+	log.Printf("[category] import root=%d nodes=%d documents=%d target_parent=%v",
+		manifest.RootID, len(manifest.Nodes), len(manifest.Documents), targetParentID)
+
+	result := CategoryImportResult{
+		NodeIDMap:     make(map[int64]int64, len(manifest.Nodes)),
+		DocumentIDMap: make(map[int64]int64, len(manifest.Documents)),
+	}
+	createdNodes := make([]int64, 0, len(manifest.Nodes))
+	createdDocs := make([]int64, 0, len(manifest.Documents))
+	rollback := func(cause error) (CategoryImportResult, error) {
+		for _, docID := range createdDocs {
+			_ = s.ndr.DeleteDocument(ctx, toNDRMeta(meta), docID)
+		}
+		// 子节点先删，父节点才能通过 DeleteCategory 的子节点检查
+		for i := len(createdNodes) - 1; i >= 0; i-- {
+			_ = s.DeleteCategory(ctx, meta, createdNodes[i])
+		}
+		log.Printf("[category] import failed root=%d err=%v", manifest.RootID, cause)
+		return CategoryImportResult{}, fmt.Errorf("import failed, rolled back %d nodes and %d documents: %w",
+			len(createdNodes), len(createdDocs), cause)
+	}
+
+	nameCache := make(map[int64]map[string]struct{})
+	for i, node := range manifest.Nodes {
+		var parentID *int64
+		name := node.Name
+		if i == 0 {
+			parentID = targetParentID
+			unique, err := s.ensureUniqueCategoryName(ctx, meta, parentID, node.Name, nameCache)
+			if err != nil {
+				return rollback(err)
+			}
+			name = unique
+		} else {
+			if node.ParentID == nil {
+				return rollback(fmt.Errorf("node %d has no parent in archive", node.ID))
+			}
+			mapped, ok := result.NodeIDMap[*node.ParentID]
+			if !ok {
+				return rollback(fmt.Errorf("parent %d of node %d not found in archive", *node.ParentID, node.ID))
+			}
+			parentID = ptr(mapped)
+		}
+		created, err := s.CreateCategory(ctx, meta, CategoryCreateRequest{Name: name, ParentID: parentID})
+		if err != nil {
+			return rollback(err)
+		}
+		createdNodes = append(createdNodes, created.ID)
+		result.NodeIDMap[node.ID] = created.ID
+	}
+	result.RootID = result.NodeIDMap[manifest.RootID]
+
+	for _, entry := range manifest.Documents {
+		data, err := readArchiveFile(files, entry.File)
+		if err != nil {
+			return rollback(err)
+		}
+		metadata := cloneMetadata(entry.Metadata)
+		delete(metadata, "references")
+
+		created, err := s.CreateDocument(ctx, meta, DocumentCreateRequest{
+			Title:    entry.Title,
+			Metadata: metadata,
+			Content:  map[string]any{"format": entry.Format, "data": string(data)},
+			Type:     entry.Type,
+			Position: ptr(entry.Position),
+		})
+		if err != nil {
+			return rollback(fmt.Errorf("create document %d: %w", entry.ID, err))
+		}
+		createdDocs = append(createdDocs, created.ID)
+		result.DocumentIDMap[entry.ID] = created.ID
+
+		bound := 0
+		for _, nodeID := range entry.Bindings {
+			mapped, ok := result.NodeIDMap[nodeID]
+			if !ok {
+				continue
+			}
+			if err := s.ndr.BindDocument(ctx, toNDRMeta(meta), mapped, created.ID); err != nil {
+				return rollback(fmt.Errorf("bind document %d to node %d: %w", created.ID, mapped, err))
+			}
+			bound++
+		}
+		if bound < len(entry.Bindings) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("document %d: %d bindings outside the archive were skipped", entry.ID, len(entry.Bindings)-bound))
+		}
+	}
+
+	// 引用需要在所有文档创建完成后再写回，才能映射到新 ID
+	for _, entry := range manifest.Documents {
+		refs, ok := entry.Metadata["references"].([]any)
+		if !ok || len(refs) == 0 {
+			continue
+		}
+		metadata := cloneMetadata(entry.Metadata)
+		metadata["references"] = remapReferences(refs, result.DocumentIDMap)
+		newID := result.DocumentIDMap[entry.ID]
+		if _, err := s.UpdateDocument(ctx, meta, newID, DocumentUpdateRequest{Metadata: metadata}); err != nil {
+			return rollback(fmt.Errorf("restore references for document %d: %w", newID, err))
+		}
+	}
+
+	if manifest.IncludeVersions {
+		result.Warnings = append(result.Warnings, "version history is kept in the archive only; imported documents start at a fresh version")
+	}
+
+	log.Printf("[category] imported root=%d new_root=%d nodes=%d documents=%d",
+		manifest.RootID, result.RootID, len(createdNodes), len(createdDocs))
+	return result, nil
+}
+
+// remapReferences rewrites references that point into the archive; external references are kept as-is.
+func remapReferences(refs []any, idMap map[int64]int64) []any {
+	out := make([]any, 0, len(refs))
+	for _, raw := range refs {
+		ref, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		copied := make(map[string]any, len(ref))
+		for k, v := range ref {
+			copied[k] = v
+		}
+		if id, ok := toInt64(ref["document_id"]); ok {
+			if mapped, exists := idMap[id]; exists {
+				copied["document_id"] = mapped
+			}
+		}
+		out = append(out, copied)
+	}
+	return out
+}
+
+func referencedDocumentIDs(metadata map[string]any) []int64 {
+	refs, ok := metadata["references"].([]any)
+	if !ok {
+		return nil
+	}
+	ids := make([]int64, 0, len(refs))
+	for _, raw := range refs {
+		ref, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		if id, ok := toInt64(ref["document_id"]); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func documentContentParts(doc ndrclient.Document) (string, string) {
+	format, _ := doc.Content["format"].(string)
+	data, _ := doc.Content["data"].(string)
+	if format == "" {
+		docType := ""
+		if doc.Type != nil {
+			docType = *doc.Type
+		}
+		format = string(GetContentFormat(DocumentType(docType)))
+	}
+	return format, data
+}
+
+func contentFormatExtension(format string) string {
+	switch ContentFormat(format) {
+	case ContentFormatMarkdown:
+		return ".md"
+	case ContentFormatHTML:
+		return ".html"
+	case ContentFormatYAML:
+		return ".yaml"
+	default:
+		return ".txt"
+	}
+}
+
+// archiveEntryName builds a stable, filesystem-safe name that keeps sibling order when sorted.
+func archiveEntryName(position int, id int64, name string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if runes := []rune(cleaned); len(runes) > 60 {
+		cleaned = string(runes[:60])
+	}
+	if cleaned == "" {
+		cleaned = "untitled"
+	}
+	return fmt.Sprintf("%04d_%d_%s", position, id, cleaned)
+}
+
+func writeArchiveFile(zw *zip.Writer, name string, data []byte) error {
+	fw, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("create archive entry %s: %w", name, err)
+	}
+	if _, err := fw.Write(data); err != nil {
+		return fmt.Errorf("write archive entry %s: %w", name, err)
+	}
+	return nil
+}
+
+func readArchiveFile(files map[string]*zip.File, name string) ([]byte, error) {
+	f, ok := files[name]
+	if !ok {
+		return nil, fmt.Errorf("archive entry %s not found", name)
+	}
+	if f.UncompressedSize64 > archiveMaxEntrySize {
+		return nil, fmt.Errorf("archive entry %s exceeds %d bytes", name, archiveMaxEntrySize)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open archive entry %s: %w", name, err)
+	}
+	defer rc.Close()
+	// The declared size comes from the archive itself, so the read is capped as well.
+	data, err := io.ReadAll(io.LimitReader(rc, archiveMaxEntrySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read archive entry %s: %w", name, err)
+	}
+	if len(data) > archiveMaxEntrySize {
+		return nil, fmt.Errorf("archive entry %s exceeds %d bytes", name, archiveMaxEntrySize)
+	}
+	return data, nil
+}
+
+func cloneMetadata(metadata map[string]any) map[string]any {
+	out := make(map[string]any, len(metadata))
+	for k, v := range metadata {
+		out[k] = v
+	}
+	return out
+}
+
+func toInt64(value any) (int64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+// archiveFakeNDR keeps a small node/document store so archives can round-trip.
+type archiveFakeNDR struct {
+	fakeNDR
+	nextID   int64
+	nodeDocs map[int64][]int64
+	docs     map[int64]ndrclient.Document
+}
+
+func newArchiveFakeNDR() *archiveFakeNDR {
+	return &archiveFakeNDR{
+		fakeNDR:  *newFakeNDR(),
+		nextID:   1000,
+		nodeDocs: make(map[int64][]int64),
+		docs:     make(map[int64]ndrclient.Document),
+	}
+}
+
+func (f *archiveFakeNDR) addNode(node ndrclient.Node) {
+	f.getNodes[node.ID] = node
+}
+
+func (f *archiveFakeNDR) addDocument(nodeID int64, doc ndrclient.Document) {
+	f.docs[doc.ID] = doc
+	_ = f.BindDocument(context.Background(), ndrclient.RequestMeta{}, nodeID, doc.ID)
+}
+
+func (f *archiveFakeNDR) CreateNode(_ context.Context, _ ndrclient.RequestMeta, body ndrclient.NodeCreate) (ndrclient.Node, error) {
+	f.createdNodes = append(f.createdNodes, body)
+	f.nextID++
+	node := ndrclient.Node{ID: f.nextID, Name: body.Name, Path: "/" + *body.Slug}
+	if body.ParentPath != nil {
+		// Imported roots may reuse the original path; prefer the newest node.
+		var parent *ndrclient.Node
+		for _, candidate := range f.getNodes {
+			if candidate.Path == *body.ParentPath && (parent == nil || candidate.ID > parent.ID) {
+				parent = &candidate
+			}
+		}
+		if parent != nil {
+			node.ParentID = ptr(parent.ID)
+			node.Path = parent.Path + node.Path
+		}
+	}
+	f.getNodes[node.ID] = node
+	return node, nil
+}
+
+func (f *archiveFakeNDR) ListChildren(_ context.Context, _ ndrclient.RequestMeta, id int64, params ndrclient.ListChildrenParams) ([]ndrclient.Node, error) {
+	children := make([]ndrclient.Node, 0)
+	level := []int64{id}
+	for depth := 0; len(level) > 0 && (depth == 0 || depth < params.Depth); depth++ {
+		var next []int64
+		for _, parentID := range level {
+			for _, node := range f.getNodes {
+				if node.ParentID != nil && *node.ParentID == parentID {
+					children = append(children, node)
+					next = append(next, node.ID)
+				}
+			}
+		}
+		level = next
+	}
+	return children, nil
+}
+
+func (f *archiveFakeNDR) ListNodeDocuments(_ context.Context, _ ndrclient.RequestMeta, id int64, _ url.Values) (ndrclient.DocumentsPage, error) {
+	items := make([]ndrclient.Document, 0)
+	for docID, nodes := range f.docBindings {
+		if _, ok := nodes[id]; ok {
+			items = append(items, f.docs[docID])
+		}
+	}
+	return ndrclient.DocumentsPage{Page: 1, Size: 100, Total: len(items), Items: items}, nil
+}
+
+func (f *archiveFakeNDR) CreateDocument(_ context.Context, _ ndrclient.RequestMeta, body ndrclient.DocumentCreate) (ndrclient.Document, error) {
+	f.createdDocs = append(f.createdDocs, body)
+	if f.createDocErr != nil {
+		return ndrclient.Document{}, f.createDocErr
+	}
+	f.nextID++
+	doc := ndrclient.Document{ID: f.nextID, Title: body.Title, Type: body.Type, Content: body.Content, Metadata: body.Metadata}
+	if body.Position != nil {
+		doc.Position = *body.Position
+	}
+	f.docs[doc.ID] = doc
+	return doc, nil
+}
+
+func (f *archiveFakeNDR) GetDocument(_ context.Context, _ ndrclient.RequestMeta, id int64) (ndrclient.Document, error) {
+	doc, ok := f.docs[id]
+	if !ok {
+		return ndrclient.Document{}, errors.New("document not found")
+	}
+	return doc, nil
+}
+
+func (f *archiveFakeNDR) UpdateDocument(_ context.Context, _ ndrclient.RequestMeta, id int64, body ndrclient.DocumentUpdate) (ndrclient.Document, error) {
+	doc := f.docs[id]
+	if body.Metadata != nil {
+		doc.Metadata = body.Metadata
+	}
+	f.docs[id] = doc
+	return doc, nil
+}
+
+func TestExportImportCategoryRoundTrip(t *testing.T) {
+	fake := newArchiveFakeNDR()
+	now := time.Now().UTC()
+	root := sampleNode(1, "Course", "/course", nil, 0, now, now)
+	chapter := sampleNode(2, "Chapter 1", "/course/chapter-1", ptr(int64(1)), 0, now, now)
+	fake.addNode(root)
+	fake.addNode(chapter)
+
+	overview := sampleDocument(10, "Overview", "markdown_v1", 0, now, now)
+	overview.Content = map[string]any{"format": "markdown", "data": "# Overview"}
+	question := sampleDocument(11, "Question", "comprehensive_choice_v1", 1, now, now)
+	question.Content = map[string]any{"format": "yaml", "data": "---\nid: 0\ndoc_type: yaml\n---\n\ntitle: q\n"}
+	question.Metadata = map[string]any{
+		"difficulty": float64(3),
+		"references": []any{
+			map[string]any{"document_id": float64(10), "title": "Overview", "added_at": "2024-01-01T00:00:00Z"},
+		},
+	}
+	fake.addDocument(1, overview)
+	fake.addDocument(2, question)
+
+	svc := NewService(cache.NewNoop(), fake, nil)
+
+	var buf bytes.Buffer
+	manifest, err := svc.ExportCategory(context.Background(), RequestMeta{}, 1, CategoryExportOptions{}, &buf)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if len(manifest.Nodes) != 2 || len(manifest.Documents) != 2 {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	joined := strings.Join(names, "\n")
+	if !strings.Contains(joined, "manifest.json") || !strings.Contains(joined, "Chapter 1/0001_11_Question.yaml") {
+		t.Fatalf("unexpected archive entries: %v", names)
+	}
+
+	result, err := svc.ImportCategoryArchive(context.Background(), RequestMeta{}, bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	newRoot := fake.getNodes[result.RootID]
+	if newRoot.ParentID != nil || !strings.HasPrefix(newRoot.Name, "Course") {
+		t.Fatalf("unexpected imported root: %+v", newRoot)
+	}
+	newChapter := fake.getNodes[result.NodeIDMap[2]]
+	if newChapter.ParentID == nil || *newChapter.ParentID != result.RootID {
+		t.Fatalf("chapter should be imported under the new root: %+v", newChapter)
+	}
+
+	newQuestionID := result.DocumentIDMap[11]
+	if _, ok := fake.docBindings[newQuestionID][newChapter.ID]; !ok {
+		t.Fatalf("question should be bound to imported chapter")
+	}
+	imported := fake.docs[newQuestionID]
+	if imported.Content["data"] != question.Content["data"] {
+		t.Fatalf("content not preserved: %v", imported.Content)
+	}
+	refs := imported.Metadata["references"].([]any)
+	ref := refs[0].(map[string]any)
+	if ref["document_id"] != result.DocumentIDMap[10] {
+		t.Fatalf("reference should point to imported overview, got %v", ref["document_id"])
+	}
+}
+
+func TestImportCategoryArchiveRollsBackOnFailure(t *testing.T) {
+	fake := newArchiveFakeNDR()
+	now := time.Now().UTC()
+	fake.addNode(sampleNode(1, "Course", "/course", nil, 0, now, now))
+	doc := sampleDocument(10, "Overview", "markdown_v1", 0, now, now)
+	doc.Content = map[string]any{"format": "markdown", "data": "# Overview"}
+	fake.addDocument(1, doc)
+
+	svc := NewService(cache.NewNoop(), fake, nil)
+	var buf bytes.Buffer
+	if _, err := svc.ExportCategory(context.Background(), RequestMeta{}, 1, CategoryExportOptions{}, &buf); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	fake.createDocErr = errors.New("upstream down")
+	if _, err := svc.ImportCategoryArchive(context.Background(), RequestMeta{}, bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil); err == nil {
+		t.Fatalf("expected import error")
+	}
+	if len(fake.deletedNodes) != 1 {
+		t.Fatalf("expected created root to be rolled back, deleted=%v", fake.deletedNodes)
+	}
+}
+
+func TestImportCategoryArchiveRejectsOversizedEntry(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fw, err := zw.Create(archiveManifestName)
+	if err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	// Zeros compress to a few dozen KB but expand past the per-entry cap.
+	if _, err := fw.Write(make([]byte, archiveMaxEntrySize+1)); err != nil {
+		t.Fatalf("write entry: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	svc := NewService(cache.NewNoop(), newArchiveFakeNDR(), nil)
+	_, err = svc.ImportCategoryArchive(context.Background(), RequestMeta{}, bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("expected oversized entry to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+// Job kinds for bulk category operations.
+const (
+	JobKindCategoryBulkCopy  = "category.bulk_copy"
+	JobKindCategoryBulkMove  = "category.bulk_move"
+	JobKindCategoryBulkPurge = "category.bulk_purge"
+)
+
+// RegisterCategoryJobs registers runners for asynchronous bulk category operations.
+func (s *Service) RegisterCategoryJobs(jobs *JobService) {
+	jobs.Register(JobKindCategoryBulkCopy, &categoryCopyRunner{svc: s})
+	jobs.Register(JobKindCategoryBulkMove, &categoryMoveRunner{svc: s})
+	jobs.Register(JobKindCategoryBulkPurge, &categoryPurgeRunner{svc: s})
+}
+
+// EnqueueBulkCopyCategories validates the request and queues it as a job with one step per source.
+func (s *JobService) EnqueueBulkCopyCategories(meta RequestMeta, req CategoryBulkCopyRequest) (*database.Job, error) {
+	if len(req.SourceIDs) == 0 {
+		return nil, errors.New("source_ids is required")
+	}
+	if err := validateAnchors(req.SourceIDs, req.InsertBeforeID, req.InsertAfterID); err != nil {
+		return nil, err
+	}
+	if req.Mode == "" {
+		req.Mode = CategoryCopyStructureOnly
+	}
+	if req.Mode != CategoryCopyStructureOnly && req.Mode != CategoryCopyLinkDocuments && req.Mode != CategoryCopyDeepCopy {
+		return nil, fmt.Errorf("invalid copy mode %q", req.Mode)
+	}
+	return s.Enqueue(JobKindCategoryBulkCopy, meta, req, idKeys(req.SourceIDs))
+}
+
+// EnqueueBulkMoveCategories validates the request and queues it as a job with one step per source.
+func (s *JobService) EnqueueBulkMoveCategories(meta RequestMeta, req CategoryBulkMoveRequest) (*database.Job, error) {
+	if len(req.SourceIDs) == 0 {
+		return nil, errors.New("source_ids is required")
+	}
+	if err := validateAnchors(req.SourceIDs, req.InsertBeforeID, req.InsertAfterID); err != nil {
+		return nil, err
+	}
+	return s.Enqueue(JobKindCategoryBulkMove, meta, req, idKeys(req.SourceIDs))
+}
+
+// EnqueueBulkPurgeCategories queues a bulk purge as a job with one step per node.
+func (s *JobService) EnqueueBulkPurgeCategories(meta RequestMeta, ids []int64) (*database.Job, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("ids is required")
+	}
+	return s.Enqueue(JobKindCategoryBulkPurge, meta, CategoryBulkIDsRequest{IDs: ids}, idKeys(ids))
+}
+
+func validateAnchors(sourceIDs []int64, beforeID, afterID *int64) error {
+	if beforeID != nil && afterID != nil {
+		return errors.New("insert_before_id and insert_after_id cannot both be set")
+	}
+	if (beforeID != nil && containsInt(sourceIDs, *beforeID)) || (afterID != nil && containsInt(sourceIDs, *afterID)) {
+		return errors.New("anchor cannot be part of source_ids")
+	}
+	return nil
+}
+
+func idKeys(ids []int64) []string {
+	keys := make([]string, 0, len(ids))
+	seen := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		keys = append(keys, strconv.FormatInt(id, 10))
+	}
+	return keys
+}
+
+// insertAtAnchor places ids before/after the anchor among siblings, or appends them when no anchor is given.
+func insertAtAnchor(siblings, ids []int64, beforeID, afterID *int64) ([]int64, error) {
+	ordered := removeIDs(siblings, ids)
+	idx := len(ordered)
+	if beforeID != nil || afterID != nil {
+		anchor := beforeID
+		if anchor == nil {
+			anchor = afterID
+		}
+		idx = indexOf(ordered, *anchor)
+		if idx == -1 {
+			return nil, fmt.Errorf("anchor id %d not found among siblings", *anchor)
+		}
+		if afterID != nil {
+			idx++
+		}
+	}
+	result := make([]int64, 0, len(ordered)+len(ids))
+	result = append(result, ordered[:idx]...)
+	result = append(result, ids...)
+	return append(result, ordered[idx:]...), nil
+}
+
+// categoryCopyStep is the persisted result of copying one source subtree.
+// It doubles as the undo journal when a later step fails or the job is canceled.
+type categoryCopyStep struct {
+	Category   Category        `json:"category"`
+	Nodes      []int64         `json:"nodes"`
+	Documents  []int64         `json:"documents,omitempty"`
+	Links      [][2]int64      `json:"links,omitempty"`
+	DocIDMap   map[int64]int64 `json:"doc_id_map,omitempty"`
+	RefSources []int64         `json:"ref_sources,omitempty"` // 含引用、需要在收尾时改写的源文档
+}
+
+type categoryCopyRunner struct {
+	svc *Service
+}
+
+func (r *categoryCopyRunner) RunStep(ctx context.Context, run *JobRun, step database.JobStep) (any, error) {
+	var req CategoryBulkCopyRequest
+	if err := run.Decode(&req); err != nil {
+		return nil, err
+	}
+	sourceID, err := strconv.ParseInt(step.Key, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid step key %q", step.Key)
+	}
+
+	// 上次执行在该步骤中途崩溃时，先回滚遗留的部分复制再重新执行
+	if err := r.svc.recoverJobSagas(ctx, run.Job.ID, run.Meta); err != nil {
+		return nil, err
+	}
+	g, err := r.svc.beginSaga(SagaKindCategoryCopy, run.Meta, run.Job.ID)
+	if err != nil {
+		return nil, err
+	}
+	job := &categoryCopy{
+		mode:      req.Mode,
+		nameCache: make(map[int64]map[string]struct{}),
+		docIDMap:  make(map[int64]int64),
+		saga:      g,
+	}
+	copied, err := r.svc.copyCategoryRecursive(ctx, run.Meta, sourceID, req.TargetParentID, job)
+	if err != nil {
+		nodes, docs := r.svc.rollbackCategoryCopy(ctx, run.Meta, job)
+		return nil, fmt.Errorf("copy category %d failed, rolled back %d nodes and %d documents: %w", sourceID, nodes, docs, err)
+	}
+	// 步骤结果由任务持久化，之后的补偿依据步骤结果执行
+	g.commit()
+
+	result := categoryCopyStep{
+		Category:  *copied,
+		Nodes:     job.nodes,
+		Documents: job.documents,
+		Links:     job.links,
+		DocIDMap:  job.docIDMap,
+	}
+	for _, doc := range job.cloned {
+		if len(referencedDocumentIDs(doc.Metadata)) > 0 {
+			result.RefSources = append(result.RefSources, doc.ID)
+		}
+	}
+	return result, nil
+}
+
+func (r *categoryCopyRunner) Finish(ctx context.Context, run *JobRun, steps []database.JobStep) (any, error) {
+	var req CategoryBulkCopyRequest
+	if err := run.Decode(&req); err != nil {
+		return nil, err
+	}
+
+	// 深拷贝：引用可能跨越多个源子树，全部复制完成后统一改写
+	job := &categoryCopy{docIDMap: make(map[int64]int64)}
+	created := make([]Category, 0, len(steps))
+	createdIDs := make([]int64, 0, len(steps))
+	var refSources []int64
+	for _, step := range steps {
+		var result categoryCopyStep
+		if err := DecodeStepResult(step, &result); err != nil {
+			return nil, fmt.Errorf("decode step %s: %w", step.Key, err)
+		}
+		for src, dst := range result.DocIDMap {
+			job.docIDMap[src] = dst
+		}
+		refSources = append(refSources, result.RefSources...)
+		created = append(created, result.Category)
+		createdIDs = append(createdIDs, result.Category.ID)
+	}
+	for _, docID := range refSources {
+		doc, err := r.svc.ndr.GetDocument(ctx, toNDRMeta(run.Meta), docID)
+		if err != nil {
+			return nil, fmt.Errorf("load document %d: %w", docID, err)
+		}
+		job.cloned = append(job.cloned, doc)
+	}
+	if err := r.svc.remapCopiedReferences(ctx, run.Meta, job); err != nil {
+		return nil, err
+	}
+
+	if req.InsertBeforeID != nil || req.InsertAfterID != nil {
+		siblings, err := r.svc.fetchSiblingIDs(ctx, run.Meta, req.TargetParentID)
+		if err != nil {
+			return nil, fmt.Errorf("fetch siblings: %w", err)
+		}
+		ordered, err := insertAtAnchor(siblings, createdIDs, req.InsertBeforeID, req.InsertAfterID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.svc.ReorderCategories(ctx, run.Meta, CategoryReorderRequest{ParentID: req.TargetParentID, OrderedIDs: ordered}); err != nil {
+			// 与同步接口一致：重排失败不回滚
+			log.Printf("[category] bulk copy job=%d reorder failed, %d nodes created but not in expected order: %v", run.Job.ID, len(createdIDs), err)
+		}
+	}
+	return map[string]any{"items": created}, nil
+}
+
+func (r *categoryCopyRunner) Compensate(ctx context.Context, run *JobRun, steps []database.JobStep) {
+	for i := len(steps) - 1; i >= 0; i-- {
+		var result categoryCopyStep
+		if err := DecodeStepResult(steps[i], &result); err != nil {
+			log.Printf("[category] bulk copy job=%d: cannot decode step %s for rollback: %v", run.Job.ID, steps[i].Key, err)
+			continue
+		}
+		nodes, docs := r.svc.rollbackCategoryCopy(ctx, run.Meta, &categoryCopy{
+			saga: restoreCopySaga(result.Nodes, result.Documents, result.Links),
+		})
+		log.Printf("[category] bulk copy job=%d rolled back source %s: %d nodes, %d documents", run.Job.ID, steps[i].Key, nodes, docs)
+	}
+}
+
+// categoryMoveStep records where a moved node came from so the move can be undone.
+type categoryMoveStep struct {
+	ID             int64  `json:"id"`
+	OriginalParent *int64 `json:"original_parent_id"`
+}
+
+type categoryMoveRunner struct {
+	svc *Service
+}
+
+func (r *categoryMoveRunner) RunStep(ctx context.Context, run *JobRun, step database.JobStep) (any, error) {
+	var req CategoryBulkMoveRequest
+	if err := run.Decode(&req); err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(step.Key, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid step key %q", step.Key)
+	}
+	// 上次执行在移动途中崩溃时，先把节点移回原位再重新读取原父节点
+	if err := r.svc.recoverJobSagas(ctx, run.Job.ID, run.Meta); err != nil {
+		return nil, err
+	}
+	node, err := r.svc.ndr.GetNode(ctx, toNDRMeta(run.Meta), id, ndrclient.GetNodeOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get node %d for move: %w", id, err)
+	}
+	g, err := r.svc.beginSaga(SagaKindCategoryMove, run.Meta, run.Job.ID)
+	if err != nil {
+		return nil, err
+	}
+	move, err := g.plan(sagaMoveNode, sagaStepData{NodeID: id, FromParentID: node.ParentID, ToParentID: req.TargetParentID})
+	if err != nil {
+		r.svc.compensateSaga(ctx, run.Meta, g)
+		return nil, err
+	}
+	if _, err := r.svc.MoveCategory(ctx, run.Meta, id, MoveCategoryRequest{NewParentID: req.TargetParentID, ParentSpecified: true}); err != nil {
+		g.fail(move, err)
+		r.svc.compensateSaga(ctx, run.Meta, g)
+		return nil, fmt.Errorf("move category %d: %w", id, err)
+	}
+	g.done(move)
+	g.commit()
+	return categoryMoveStep{ID: id, OriginalParent: node.ParentID}, nil
+}
+
+func (r *categoryMoveRunner) Finish(ctx context.Context, run *JobRun, steps []database.JobStep) (any, error) {
+	var req CategoryBulkMoveRequest
+	if err := run.Decode(&req); err != nil {
+		return nil, err
+	}
+	movedIDs := make([]int64, 0, len(steps))
+	for _, step := range steps {
+		var result categoryMoveStep
+		if err := DecodeStepResult(step, &result); err != nil {
+			return nil, fmt.Errorf("decode step %s: %w", step.Key, err)
+		}
+		movedIDs = append(movedIDs, result.ID)
+	}
+
+	siblings, err := r.svc.fetchSiblingIDs(ctx, run.Meta, req.TargetParentID)
+	if err != nil {
+		return nil, fmt.Errorf("fetch siblings: %w", err)
+	}
+	ordered, err := insertAtAnchor(siblings, movedIDs, req.InsertBeforeID, req.InsertAfterID)
+	if err != nil {
+		return nil, err
+	}
+	siblingsCats, err := r.svc.ReorderCategories(ctx, run.Meta, CategoryReorderRequest{ParentID: req.TargetParentID, OrderedIDs: ordered})
+	if err != nil {
+		return nil, fmt.Errorf("reorder failed, %d nodes moved but not in expected order: %w", len(movedIDs), err)
+	}
+
+	moved := make([]Category, 0, len(movedIDs))
+	for _, cat := range siblingsCats {
+		if containsInt(movedIDs, cat.ID) {
+			moved = append(moved, cat)
+		}
+	}
+	sort.SliceStable(moved, func(i, j int) bool {
+		return indexOf(ordered, moved[i].ID) < indexOf(ordered, moved[j].ID)
+	})
+	return map[string]any{"items": moved}, nil
+}
+
+func (r *categoryMoveRunner) Compensate(ctx context.Context, run *JobRun, steps []database.JobStep) {
+	records := make([]moveRecord, 0, len(steps))
+	for _, step := range steps {
+		var result categoryMoveStep
+		if err := DecodeStepResult(step, &result); err != nil {
+			log.Printf("[category] bulk move job=%d: cannot decode step %s for rollback: %v", run.Job.ID, step.Key, err)
+			continue
+		}
+		records = append(records, moveRecord{id: result.ID, originalParent: result.OriginalParent})
+	}
+	moved := r.svc.rollbackMovedCategories(ctx, run.Meta, records)
+	log.Printf("[category] bulk move job=%d rolled back %d of %d moved nodes", run.Job.ID, moved, len(records))
+}
+
+type categoryPurgeRunner struct {
+	svc *Service
+}
+
+func (r *categoryPurgeRunner) RunStep(ctx context.Context, run *JobRun, step database.JobStep) (any, error) {
+	id, err := strconv.ParseInt(step.Key, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid step key %q", step.Key)
+	}
+	if err := r.svc.PurgeCategory(ctx, run.Meta, id); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func (r *categoryPurgeRunner) Finish(ctx context.Context, run *JobRun, steps []database.JobStep) (any, error) {
+	ids := make([]int64, 0, len(steps))
+	for _, step := range steps {
+		var id int64
+		if err := DecodeStepResult(step, &id); err != nil {
+			return nil, fmt.Errorf("decode step %s: %w", step.Key, err)
+		}
+		ids = append(ids, id)
+	}
+	return map[string]any{"purged_ids": ids}, nil
+}
+
+// Compensate is a no-op: purged nodes cannot be restored.
+func (r *categoryPurgeRunner) Compensate(ctx context.Context, run *JobRun, steps []database.JobStep) {
+	log.Printf("[category] bulk purge job=%d stopped after purging %d nodes", run.Job.ID, len(steps))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -23,6 +24,7 @@ type fakeNDR struct {
 	purgedNodes   []int64
 	listResponse  ndrclient.NodesPage
 	listResponses map[int]ndrclient.NodesPage
+	listCalls     int
 	getNodes      map[int64]ndrclient.Node
 	createResp    ndrclient.Node
 	updateResp    ndrclient.Node
@@ -117,6 +119,7 @@ func (f *fakeNDR) RestoreNode(_ context.Context, _ ndrclient.RequestMeta, id int
 }
 
 func (f *fakeNDR) ListNodes(_ context.Context, _ ndrclient.RequestMeta, params ndrclient.ListNodesParams) (ndrclient.NodesPage, error) {
+	f.listCalls++
 	if f.listErr != nil {
 		return ndrclient.NodesPage{}, f.listErr
 	}
@@ -817,3 +820,132 @@ func sampleNode(id int64, name string, path string, parentID *int64, position in
 		UpdatedAt: updated,
 	}
 }
+
+// copyFailingNDR fails to bind documents to a given node and removes deleted nodes,
+// so rollback of a partially copied subtree can be observed.
+type copyFailingNDR struct {
+	*archiveFakeNDR
+	failBindNode string
+}
+
+func (f *copyFailingNDR) BindDocument(ctx context.Context, meta ndrclient.RequestMeta, nodeID, docID int64) error {
+	if f.getNodes[nodeID].Name == f.failBindNode {
+		return errors.New("bind failed")
+	}
+	return f.archiveFakeNDR.BindDocument(ctx, meta, nodeID, docID)
+}
+
+func (f *copyFailingNDR) DeleteNode(ctx context.Context, meta ndrclient.RequestMeta, id int64) error {
+	delete(f.getNodes, id)
+	return f.archiveFakeNDR.DeleteNode(ctx, meta, id)
+}
+
+func newCopySourceNDR() *archiveFakeNDR {
+	fake := newArchiveFakeNDR()
+	now := time.Now().UTC()
+	fake.addNode(sampleNode(1, "Course", "/course", nil, 0, now, now))
+	fake.addNode(sampleNode(2, "Chapter 1", "/course/chapter-1", ptr(int64(1)), 0, now, now))
+
+	overview := sampleDocument(10, "Overview", "markdown_v1", 3, now, now)
+	overview.Content = map[string]any{"format": "markdown", "data": "# Overview"}
+	question := sampleDocument(11, "Question", "markdown_v1", 7, now, now)
+	question.Content = map[string]any{"format": "markdown", "data": "Q"}
+	question.Metadata = map[string]any{
+		"references": []any{
+			map[string]any{"document_id": float64(10), "title": "Overview", "added_at": "2024-01-01T00:00:00Z"},
+			map[string]any{"document_id": float64(99), "title": "Elsewhere", "added_at": "2024-01-01T00:00:00Z"},
+		},
+	}
+	fake.addDocument(1, overview)
+	fake.addDocument(2, question)
+	return fake
+}
+
+func TestBulkCopyCategoriesModes(t *testing.T) {
+	childOf := func(fake *archiveFakeNDR, parentID int64) int64 {
+		for _, node := range fake.getNodes {
+			if node.ParentID != nil && *node.ParentID == parentID {
+				return node.ID
+			}
+		}
+		t.Fatalf("no child under %d", parentID)
+		return 0
+	}
+
+	// structure_only（默认）：只复制目录
+	fake := newCopySourceNDR()
+	svc := NewService(cache.NewNoop(), fake, nil)
+	items, err := svc.BulkCopyCategories(context.Background(), RequestMeta{}, CategoryBulkCopyRequest{SourceIDs: []int64{1}})
+	if err != nil || len(items) != 1 {
+		t.Fatalf("copy failed: %v", err)
+	}
+	if len(fake.createdDocs) != 0 || len(fake.docBindings[10]) != 1 {
+		t.Fatalf("structure_only must not touch documents: created=%d bindings=%v", len(fake.createdDocs), fake.docBindings)
+	}
+
+	// link_documents：新目录绑定同一批文档
+	fake = newCopySourceNDR()
+	svc = NewService(cache.NewNoop(), fake, nil)
+	items, err = svc.BulkCopyCategories(context.Background(), RequestMeta{}, CategoryBulkCopyRequest{SourceIDs: []int64{1}, Mode: CategoryCopyLinkDocuments})
+	if err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	newChapter := childOf(fake, items[0].ID)
+	if _, ok := fake.docBindings[10][items[0].ID]; !ok || len(fake.createdDocs) != 0 {
+		t.Fatalf("overview should be linked to the copied course")
+	}
+	if _, ok := fake.docBindings[11][newChapter]; !ok {
+		t.Fatalf("question should be linked to the copied chapter")
+	}
+
+	// deep_copy：复制文档、保留位置并改写子树内的引用
+	fake = newCopySourceNDR()
+	svc = NewService(cache.NewNoop(), fake, nil)
+	items, err = svc.BulkCopyCategories(context.Background(), RequestMeta{}, CategoryBulkCopyRequest{SourceIDs: []int64{1}, Mode: CategoryCopyDeepCopy})
+	if err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	newChapter = childOf(fake, items[0].ID)
+	if len(fake.createdDocs) != 2 {
+		t.Fatalf("expected 2 cloned documents, got %d", len(fake.createdDocs))
+	}
+	var overviewCopy, questionCopy ndrclient.Document
+	for id, doc := range fake.docs {
+		if id > 1000 && doc.Title == "Overview" {
+			overviewCopy = doc
+		}
+		if id > 1000 && doc.Title == "Question" {
+			questionCopy = doc
+		}
+	}
+	if overviewCopy.Position != 3 || questionCopy.Position != 7 || questionCopy.Content["data"] != "Q" {
+		t.Fatalf("clone should preserve content and position: %+v %+v", overviewCopy, questionCopy)
+	}
+	if _, ok := fake.docBindings[questionCopy.ID][newChapter]; !ok || len(fake.docBindings[11]) != 1 {
+		t.Fatalf("clone should be bound to the copied chapter only")
+	}
+	refs := questionCopy.Metadata["references"].([]any)
+	if refs[0].(map[string]any)["document_id"] != overviewCopy.ID || refs[1].(map[string]any)["document_id"] != float64(99) {
+		t.Fatalf("references should be remapped inside the subtree only: %v", refs)
+	}
+
+	if _, err := svc.BulkCopyCategories(context.Background(), RequestMeta{}, CategoryBulkCopyRequest{SourceIDs: []int64{1}, Mode: "everything"}); err == nil {
+		t.Fatalf("expected invalid mode to be rejected")
+	}
+}
+
+func TestBulkCopyCategoriesDeepCopyRollsBackDocuments(t *testing.T) {
+	fake := &copyFailingNDR{archiveFakeNDR: newCopySourceNDR(), failBindNode: "Chapter 1"}
+	svc := NewService(cache.NewNoop(), fake, nil)
+
+	_, err := svc.BulkCopyCategories(context.Background(), RequestMeta{}, CategoryBulkCopyRequest{SourceIDs: []int64{1}, Mode: CategoryCopyDeepCopy})
+	if err == nil || !strings.Contains(err.Error(), "rolled back 2 nodes and 2 documents") {
+		t.Fatalf("expected rollback error, got %v", err)
+	}
+	if len(fake.deletedDocIDs) != 2 || len(fake.deletedNodes) != 2 {
+		t.Fatalf("expected cloned documents and nodes to be removed, docs=%v nodes=%v", fake.deletedDocIDs, fake.deletedNodes)
+	}
+	if fake.deletedNodes[0] <= fake.deletedNodes[1] {
+		t.Fatalf("children must be deleted before parents: %v", fake.deletedNodes)
+	}
+}
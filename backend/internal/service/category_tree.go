@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+// DefaultCategoryTreeTTL bounds how long a tree snapshot is served without asking NDR.
+// Mutations made through this process invalidate the snapshot immediately; the TTL only
+// covers changes made elsewhere (other instances, direct NDR clients).
+const DefaultCategoryTreeTTL = 30 * time.Second
+
+// MaxCategoryChildrenDepth limits how many levels one lazy-loading request may expand.
+const MaxCategoryChildrenDepth = 5
+
+// ErrCategoryForbidden is returned when a restricted user asks for nodes outside their courses.
+var ErrCategoryForbidden = errors.New("no permission for this course")
+
+// CategoryTree is a category forest together with its validator for conditional requests.
+type CategoryTree struct {
+	Roots []*Category
+	ETag  string // 为空表示结果不可缓存（如权限查询失败时返回的空树）
+}
+
+// treeSnapshot 一次完整分页拉取的节点列表
+type treeSnapshot struct {
+	nodes   []ndrclient.Node
+	digest  string
+	expires time.Time
+}
+
+// categoryTreeCache 服务端持有的分类树快照，按是否包含已删除节点分别缓存
+type categoryTreeCache struct {
+	ttl      time.Duration
+	mu       sync.Mutex
+	revision uint64 // 每次失效加一，防止失效前发起的拉取覆盖新状态
+	entries  map[bool]*treeSnapshot
+	loading  sync.Mutex // 串行化拉取，缓存失效时并发请求只访问一次 NDR
+}
+
+func newCategoryTreeCache(ttl time.Duration) *categoryTreeCache {
+	return &categoryTreeCache{ttl: ttl, entries: make(map[bool]*treeSnapshot)}
+}
+
+func (c *categoryTreeCache) get(includeDeleted bool) (*treeSnapshot, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snapshot := c.entries[includeDeleted]
+	if snapshot != nil && time.Now().After(snapshot.expires) {
+		delete(c.entries, includeDeleted)
+		snapshot = nil
+	}
+	return snapshot, c.revision
+}
+
+func (c *categoryTreeCache) put(includeDeleted bool, revision uint64, snapshot *treeSnapshot) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.revision == revision {
+		c.entries[includeDeleted] = snapshot
+	}
+}
+
+func (c *categoryTreeCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.revision++
+	c.entries = make(map[bool]*treeSnapshot)
+}
+
+// SetCategoryTreeTTL changes how long tree snapshots are kept; ttl <= 0 disables the snapshot.
+func (s *Service) SetCategoryTreeTTL(ttl time.Duration) {
+	s.tree = newCategoryTreeCache(ttl)
+}
+
+// InvalidateCategoryTree drops the cached tree snapshot. Every node mutation calls it.
+func (s *Service) InvalidateCategoryTree() {
+	s.tree.invalidate()
+}
+
+// loadTreeSnapshot 返回未过期的快照，没有时分页拉取全部节点
+func (s *Service) loadTreeSnapshot(ctx context.Context, meta RequestMeta, includeDeleted bool) (*treeSnapshot, error) {
+	if snapshot, _ := s.tree.get(includeDeleted); snapshot != nil {
+		return snapshot, nil
+	}
+	s.tree.loading.Lock()
+	defer s.tree.loading.Unlock()
+	snapshot, revision := s.tree.get(includeDeleted)
+	if snapshot != nil {
+		return snapshot, nil
+	}
+
+	params := ndrclient.ListNodesParams{Page: 1, Size: 100}
+	if includeDeleted {
+		params.IncludeDeleted = ptr(true)
+	}
+	nodes := make([]ndrclient.Node, 0)
+	total := 0
+	for {
+		page, err := s.ndr.ListNodes(ctx, toNDRMeta(meta), params)
+		if err != nil {
+			log.Printf("[category] list nodes failed page=%d err=%v", params.Page, err)
+			return nil, fmt.Errorf("list nodes: %w", err)
+		}
+		if total == 0 {
+			total = page.Total
+		}
+		nodes = append(nodes, page.Items...)
+
+		pageSize := page.Size
+		if pageSize == 0 {
+			pageSize = params.Size
+		}
+
+		if (total != 0 && len(nodes) >= total) || len(page.Items) == 0 || len(page.Items) < pageSize {
+			break
+		}
+		params.Page++
+	}
+
+	snapshot = &treeSnapshot{
+		nodes:   nodes,
+		digest:  digestNodes(nodes, includeDeleted),
+		expires: time.Now().Add(s.tree.ttl),
+	}
+	s.tree.put(includeDeleted, revision, snapshot)
+	log.Printf("[category] tree snapshot loaded total=%d fetched=%d pages=%d", total, len(nodes), params.Page)
+	return snapshot, nil
+}
+
+// digestNodes 计算节点列表的摘要：节点数加上每个节点影响树形的字段，与 NDR 返回顺序无关
+func digestNodes(nodes []ndrclient.Node, includeDeleted bool) string {
+	sorted := make([]ndrclient.Node, len(nodes))
+	copy(sorted, nodes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	h := fnv.New64a()
+	var buf [8]byte
+	writeInt := func(v int64) {
+		binary.LittleEndian.PutUint64(buf[:], uint64(v))
+		h.Write(buf[:])
+	}
+	for _, node := range sorted {
+		writeInt(node.ID)
+		parentID := int64(-1)
+		if node.ParentID != nil {
+			parentID = *node.ParentID
+		}
+		writeInt(parentID)
+		writeInt(int64(node.Position))
+		writeInt(node.UpdatedAt.UnixNano())
+		deletedAt := int64(0)
+		if node.DeletedAt != nil {
+			deletedAt = node.DeletedAt.UnixNano()
+		}
+		writeInt(deletedAt)
+		h.Write([]byte(node.Name))
+		h.Write([]byte{0})
+		h.Write([]byte(node.Slug))
+		h.Write([]byte{0})
+	}
+	scope := "a"
+	if includeDeleted {
+		scope = "d"
+	}
+	return fmt.Sprintf("%s%d-%016x", scope, len(nodes), h.Sum64())
+}
+
+// LoadCategoryTree builds the category forest from the server-held snapshot and returns it
+// with an ETag. The ETag also covers the caller's course scope, so restricted users never
+// share a validator with users who see a different set of courses.
+func (s *Service) LoadCategoryTree(ctx context.Context, meta RequestMeta, includeDeleted bool) (*CategoryTree, error) {
+	log.Printf("[category] tree include_deleted=%v", includeDeleted)
+	snapshot, err := s.loadTreeSnapshot(ctx, meta, includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+	tree := buildTree(snapshot.nodes)
+
+	// 课程管理员和校对员权限过滤：只显示其被授权的课程（根节点）及其子节点
+	if (meta.UserRole == "course_admin" || meta.UserRole == "proofreader") && meta.UserIDNumeric > 0 {
+		authorizedRootNodes, err := s.userService.GetUserCourses(meta.UserIDNumeric)
+		if err != nil {
+			log.Printf("[category] failed to get user courses: %v", err)
+			// 如果获取权限失败，返回空树（安全策略）
+			return &CategoryTree{Roots: []*Category{}}, nil
+		}
+
+		// 构建授权 root node ID 集合
+		authorizedSet := make(map[int64]bool)
+		for _, nodeID := range authorizedRootNodes {
+			authorizedSet[nodeID] = true
+		}
+
+		// 过滤树：只保留授权的根节点
+		filteredTree := make([]*Category, 0)
+		for _, root := range tree {
+			if authorizedSet[root.ID] {
+				filteredTree = append(filteredTree, root)
+			}
+		}
+
+		sort.Slice(authorizedRootNodes, func(i, j int) bool { return authorizedRootNodes[i] < authorizedRootNodes[j] })
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%s:%v", meta.UserRole, authorizedRootNodes)
+		log.Printf("[category] tree filtered for %s user=%d: total_roots=%d authorized_roots=%d",
+			meta.UserRole, meta.UserIDNumeric, len(tree), len(filteredTree))
+		return &CategoryTree{
+			Roots: filteredTree,
+			ETag:  fmt.Sprintf(`"%s-%016x"`, snapshot.digest, h.Sum64()),
+		}, nil
+	}
+
+	log.Printf("[category] tree aggregated fetched=%d roots=%d", len(snapshot.nodes), len(tree))
+	return &CategoryTree{Roots: tree, ETag: fmt.Sprintf(`"%s"`, snapshot.digest)}, nil
+}
+
+// GetCategoryChildren returns the subtree below id, depth levels deep, for lazy loading.
+// Every returned node reports has_children so clients know whether it can be expanded;
+// NDR is asked for one extra level to answer that for the deepest nodes.
+func (s *Service) GetCategoryChildren(ctx context.Context, meta RequestMeta, id int64, depth int) ([]*Category, error) {
+	if depth < 1 || depth > MaxCategoryChildrenDepth {
+		return nil, fmt.Errorf("depth must be between 1 and %d", MaxCategoryChildrenDepth)
+	}
+	if err := s.checkCategoryAccess(ctx, meta, id); err != nil {
+		return nil, err
+	}
+
+	nodes, err := s.ndr.ListChildren(ctx, toNDRMeta(meta), id, ndrclient.ListChildrenParams{Depth: depth + 1})
+	if err != nil {
+		log.Printf("[category] list children failed id=%d depth=%d err=%v", id, depth, err)
+		return nil, fmt.Errorf("list children: %w", err)
+	}
+
+	// 计算每个节点相对 id 的层级，NDR 返回的顺序不保证父节点在前
+	parents := make(map[int64]int64, len(nodes))
+	for _, node := range nodes {
+		if node.ParentID != nil && node.DeletedAt == nil {
+			parents[node.ID] = *node.ParentID
+		}
+	}
+	levels := map[int64]int{id: 0}
+	var levelOf func(nodeID int64, seen int) int
+	levelOf = func(nodeID int64, seen int) int {
+		if level, ok := levels[nodeID]; ok {
+			return level
+		}
+		parentID, ok := parents[nodeID]
+		if !ok || seen > len(parents) {
+			return -1
+		}
+		level := levelOf(parentID, seen+1)
+		if level >= 0 {
+			level++
+		}
+		levels[nodeID] = level
+		return level
+	}
+
+	kept := make([]ndrclient.Node, 0, len(nodes))
+	expandable := make(map[int64]bool)
+	for _, node := range nodes {
+		level := levelOf(node.ID, 0)
+		if level < 1 {
+			continue
+		}
+		expandable[parents[node.ID]] = true
+		if level <= depth {
+			kept = append(kept, node)
+		}
+	}
+
+	roots := buildTree(kept)
+	var mark func(cats []*Category)
+	mark = func(cats []*Category) {
+		for _, cat := range cats {
+			cat.HasChildren = ptr(expandable[cat.ID])
+			mark(cat.Children)
+		}
+	}
+	mark(roots)
+	return roots, nil
+}
+
+// checkCategoryAccess 课程管理员与校对员只能访问被授权课程下的节点
+func (s *Service) checkCategoryAccess(ctx context.Context, meta RequestMeta, id int64) error {
+	if (meta.UserRole != "course_admin" && meta.UserRole != "proofreader") || meta.UserIDNumeric == 0 {
+		return nil
+	}
+	rootID, err := s.categoryRootID(ctx, meta, id)
+	if err != nil {
+		return err
+	}
+	courses, err := s.userService.GetUserCourses(meta.UserIDNumeric)
+	if err != nil {
+		return fmt.Errorf("get user courses: %w", err)
+	}
+	if !containsInt(courses, rootID) {
+		return ErrCategoryForbidden
+	}
+	return nil
+}
+
+// categoryRootID 查找节点所属的根节点，优先使用快照，避免逐级请求 NDR；已删除的节点同样可以解析
+func (s *Service) categoryRootID(ctx context.Context, meta RequestMeta, id int64) (int64, error) {
+	for _, includeDeleted := range []bool{false, true} {
+		snapshot, _ := s.tree.get(includeDeleted)
+		if snapshot == nil {
+			continue
+		}
+		parents := make(map[int64]*int64, len(snapshot.nodes))
+		for _, node := range snapshot.nodes {
+			parents[node.ID] = node.ParentID
+		}
+		if _, ok := parents[id]; ok {
+			current := id
+			for i := 0; i <= len(parents); i++ {
+				parentID, ok := parents[current]
+				if !ok {
+					break
+				}
+				if parentID == nil {
+					return current, nil
+				}
+				current = *parentID
+			}
+		}
+	}
+
+	current := id
+	for {
+		node, err := s.ndr.GetNode(ctx, toNDRMeta(meta), current, ndrclient.GetNodeOptions{IncludeDeleted: ptr(true)})
+		if err != nil {
+			return 0, fmt.Errorf("get node %d: %w", current, err)
+		}
+		if node.ParentID == nil {
+			return node.ID, nil
+		}
+		current = *node.ParentID
+	}
+}
+
+// documentBoundCourses 解析文档绑定的全部节点所属的课程，按绑定顺序去重
+func (s *Service) documentBoundCourses(ctx context.Context, meta RequestMeta, docID int64) ([]int64, error) {
+	status, err := s.ndr.GetDocumentBindingStatus(ctx, toNDRMeta(meta), docID)
+	if err != nil {
+		return nil, err
+	}
+	courses := make([]int64, 0, 1)
+	for _, nodeID := range status.NodeIDs {
+		rootID, err := s.categoryRootID(ctx, meta, nodeID)
+		if err != nil {
+			return nil, err
+		}
+		if !containsInt(courses, rootID) {
+			courses = append(courses, rootID)
+		}
+	}
+	return courses, nil
+}
+
+// hasAnyCoursePermission 超级管理员始终返回 true，其他用户须拥有其中至少一门课程的权限
+func (s *Service) hasAnyCoursePermission(meta RequestMeta, courses []int64) (bool, error) {
+	if meta.UserRole == "super_admin" {
+		return true, nil
+	}
+	if s.userService == nil || meta.UserIDNumeric == 0 {
+		return false, nil
+	}
+	for _, courseID := range courses {
+		ok, err := s.userService.HasCoursePermission(meta.UserIDNumeric, courseID)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
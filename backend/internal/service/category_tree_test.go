@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+func TestLoadCategoryTreeSnapshot(t *testing.T) {
+	fake := newFakeNDR()
+	now := time.Now().UTC()
+	fake.listResponse = ndrclient.NodesPage{
+		Items: []ndrclient.Node{
+			sampleNode(1, "Root", "/root", nil, 1, now, now),
+			sampleNode(2, "Child", "/root/child", ptr[int64](1), 1, now, now),
+		},
+	}
+	fake.updateResp = sampleNode(2, "Renamed", "/root/renamed", ptr[int64](1), 1, now, now)
+	svc := NewService(cache.NewNoop(), fake, nil)
+
+	first, err := svc.LoadCategoryTree(context.Background(), RequestMeta{}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, _ := svc.LoadCategoryTree(context.Background(), RequestMeta{}, false)
+	if fake.listCalls != 1 || first.ETag == "" || first.ETag != second.ETag {
+		t.Fatalf("expected snapshot to be reused, calls=%d etags=%q %q", fake.listCalls, first.ETag, second.ETag)
+	}
+	if _, err := svc.LoadCategoryTree(context.Background(), RequestMeta{}, true); err != nil || fake.listCalls != 2 {
+		t.Fatalf("expected include_deleted to use its own snapshot, calls=%d err=%v", fake.listCalls, err)
+	}
+
+	// 节点变更后快照失效，内容变化时 ETag 随之变化
+	fake.listResponse.Items[1] = fake.updateResp
+	if _, err := svc.UpdateCategory(context.Background(), RequestMeta{}, 2, CategoryUpdateRequest{Name: ptr("Renamed")}); err != nil {
+		t.Fatalf("UpdateCategory: %v", err)
+	}
+	third, _ := svc.LoadCategoryTree(context.Background(), RequestMeta{}, false)
+	if fake.listCalls != 3 || third.ETag == first.ETag || third.Roots[0].Children[0].Name != "Renamed" {
+		t.Fatalf("expected fresh tree after update, calls=%d etag=%q", fake.listCalls, third.ETag)
+	}
+
+	// TTL 为 0 时每次都访问 NDR
+	svc.SetCategoryTreeTTL(0)
+	svc.LoadCategoryTree(context.Background(), RequestMeta{}, false)
+	svc.LoadCategoryTree(context.Background(), RequestMeta{}, false)
+	if fake.listCalls != 5 {
+		t.Fatalf("expected snapshot to be disabled, calls=%d", fake.listCalls)
+	}
+}
+
+func TestLoadCategoryTreeETagCoversCourseScope(t *testing.T) {
+	userService := NewUserService(setupUserDB(t))
+	alice, _ := userService.CreateUser("alice", "Secret-pass-9", "course_admin", nil)
+	bob, _ := userService.CreateUser("bob", "Secret-pass-9", "course_admin", nil)
+	userService.GrantCoursePermission(alice.ID, 1)
+	userService.GrantCoursePermission(bob.ID, 3)
+
+	fake := newFakeNDR()
+	now := time.Now().UTC()
+	fake.listResponse = ndrclient.NodesPage{
+		Items: []ndrclient.Node{
+			sampleNode(1, "Root", "/root", nil, 1, now, now),
+			sampleNode(3, "Other", "/other", nil, 2, now, now),
+		},
+	}
+	svc := NewService(cache.NewNoop(), fake, userService)
+
+	admin, _ := svc.LoadCategoryTree(context.Background(), RequestMeta{UserRole: "super_admin"}, false)
+	forAlice, _ := svc.LoadCategoryTree(context.Background(), RequestMeta{UserRole: "course_admin", UserIDNumeric: alice.ID}, false)
+	forBob, _ := svc.LoadCategoryTree(context.Background(), RequestMeta{UserRole: "course_admin", UserIDNumeric: bob.ID}, false)
+	if len(admin.Roots) != 2 || len(forAlice.Roots) != 1 || forAlice.Roots[0].ID != 1 || len(forBob.Roots) != 1 {
+		t.Fatalf("unexpected filtered trees: %d %d %d", len(admin.Roots), len(forAlice.Roots), len(forBob.Roots))
+	}
+	if forAlice.ETag == admin.ETag || forAlice.ETag == forBob.ETag {
+		t.Fatalf("expected per-scope etags, got %q %q %q", admin.ETag, forAlice.ETag, forBob.ETag)
+	}
+	if fake.listCalls != 1 {
+		t.Fatalf("expected one snapshot shared by all users, calls=%d", fake.listCalls)
+	}
+}
+
+func TestGetCategoryChildren(t *testing.T) {
+	fake := newArchiveFakeNDR()
+	now := time.Now().UTC()
+	fake.addNode(sampleNode(1, "Course", "/course", nil, 0, now, now))
+	fake.addNode(sampleNode(2, "Chapter 1", "/course/chapter-1", ptr(int64(1)), 0, now, now))
+	fake.addNode(sampleNode(3, "Section", "/course/chapter-1/section", ptr(int64(2)), 0, now, now))
+	fake.addNode(sampleNode(4, "Chapter 2", "/course/chapter-2", ptr(int64(1)), 1, now, now))
+	svc := NewService(cache.NewNoop(), fake, nil)
+
+	children, err := svc.GetCategoryChildren(context.Background(), RequestMeta{}, 1, 1)
+	if err != nil {
+		t.Fatalf("GetCategoryChildren: %v", err)
+	}
+	if len(children) != 2 || children[0].ID != 2 || len(children[0].Children) != 0 {
+		t.Fatalf("expected direct children only, got %+v", children)
+	}
+	if !*children[0].HasChildren || *children[1].HasChildren {
+		t.Fatalf("unexpected has_children flags: %v %v", *children[0].HasChildren, *children[1].HasChildren)
+	}
+
+	children, _ = svc.GetCategoryChildren(context.Background(), RequestMeta{}, 1, 2)
+	if len(children[0].Children) != 1 || children[0].Children[0].ID != 3 || *children[0].Children[0].HasChildren {
+		t.Fatalf("expected two levels, got %+v", children[0])
+	}
+
+	if _, err := svc.GetCategoryChildren(context.Background(), RequestMeta{}, 1, MaxCategoryChildrenDepth+1); err == nil {
+		t.Fatalf("expected depth to be limited")
+	}
+}
+
+func TestGetCategoryChildrenChecksCourse(t *testing.T) {
+	userService := NewUserService(setupUserDB(t))
+	user, _ := userService.CreateUser("carol", "Secret-pass-9", "proofreader", nil)
+	userService.GrantCoursePermission(user.ID, 1)
+
+	fake := newArchiveFakeNDR()
+	now := time.Now().UTC()
+	fake.addNode(sampleNode(1, "Course", "/course", nil, 0, now, now))
+	fake.addNode(sampleNode(2, "Chapter 1", "/course/chapter-1", ptr(int64(1)), 0, now, now))
+	fake.addNode(sampleNode(5, "Other", "/other", nil, 1, now, now))
+	fake.addNode(sampleNode(6, "Chapter", "/other/chapter", ptr(int64(5)), 0, now, now))
+	svc := NewService(cache.NewNoop(), fake, userService)
+
+	meta := RequestMeta{UserRole: "proofreader", UserIDNumeric: user.ID}
+	if _, err := svc.GetCategoryChildren(context.Background(), meta, 2, 1); err != nil {
+		t.Fatalf("expected access inside granted course, got %v", err)
+	}
+	if _, err := svc.GetCategoryChildren(context.Background(), meta, 6, 1); !errors.Is(err, ErrCategoryForbidden) {
+		t.Fatalf("expected ErrCategoryForbidden, got %v", err)
+	}
+}
@@ -0,0 +1,463 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+const (
+	// MaxCommentBodyLength 单条评论正文的最大字符数
+	MaxCommentBodyLength = 10000
+	// maxCommentMentions 单条评论最多提及的用户数，超出部分忽略
+	maxCommentMentions = 20
+)
+
+var (
+	// ErrDocumentCommentsDisabled 未启用文档评论
+	ErrDocumentCommentsDisabled = errors.New("document comments are disabled")
+	// ErrCommentNotFound 评论不存在或不属于该文档
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrInvalidComment 评论参数不合法
+	ErrInvalidComment = errors.New("invalid comment")
+	// ErrCommentForbidden 没有文档所属课程的权限，或不是评论作者
+	ErrCommentForbidden = errors.New("comment action forbidden")
+)
+
+var (
+	// commentPathPattern YAML 锚点路径：字段名以 . 分隔，数组下标写作 [n]，如 details[2].answer
+	commentPathPattern = regexp.MustCompile(`^(?:[^.\[\]\s]+|\[\d+\])(?:\.[^.\[\]\s]+|\[\d+\])*$`)
+	commentPathSegment = regexp.MustCompile(`[^.\[\]\s]+|\[\d+\]`)
+	// commentMentionPattern @用户名；要求 @ 前不是用户名字符，避免把邮箱地址当作提及
+	commentMentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.@-])@([A-Za-z0-9_.-]*[A-Za-z0-9_])`)
+)
+
+// DocumentCommentInput 创建评论的参数；锚点只能在首条评论上设置，YAML 路径与文本范围二选一
+type DocumentCommentInput struct {
+	Body          string `json:"body"`
+	ParentID      *uint  `json:"parent_id"`      // 回复的首条评论
+	VersionNumber *int   `json:"version_number"` // 撰写评论时的文档版本，为空时使用当前版本
+	AnchorPath    string `json:"anchor_path"`    // YAML 文档的字段路径
+	AnchorStart   *int   `json:"anchor_start"`   // Markdown 文档的文本范围（按字符计，左闭右开）
+	AnchorEnd     *int   `json:"anchor_end"`
+}
+
+// DocumentCommentView 返回给客户端的评论
+type DocumentCommentView struct {
+	database.DocumentComment
+	MentionedUsers []string              `json:"mentions"`
+	Outdated       bool                  `json:"outdated"`              // 评论撰写后文档已有新版本
+	AnchorLost     bool                  `json:"anchor_lost,omitempty"` // 锚定的字段或原文在当前版本中已不存在
+	Replies        []DocumentCommentView `json:"replies,omitempty"`
+}
+
+// documentCommentEvent document.commented 事件携带的数据
+type documentCommentEvent struct {
+	ID       int64                     `json:"id"`
+	Comment  *database.DocumentComment `json:"comment"`
+	Mentions []string                  `json:"mentions"`
+}
+
+// DocumentComments 文档评论存储
+type DocumentComments struct {
+	db *gorm.DB
+}
+
+// NewDocumentComments 创建文档评论存储
+func NewDocumentComments(db *gorm.DB) *DocumentComments {
+	return &DocumentComments{db: db}
+}
+
+// SetDocumentComments 启用文档评论
+func (s *Service) SetDocumentComments(comments *DocumentComments) {
+	s.comments = comments
+}
+
+// ListDocumentComments 按讨论串返回文档评论，回复按时间排列在首条评论下；
+// resolved 不为空时只返回对应状态的讨论串
+func (s *Service) ListDocumentComments(ctx context.Context, meta RequestMeta, docID int64, resolved *bool) ([]DocumentCommentView, error) {
+	if s.comments == nil {
+		return nil, ErrDocumentCommentsDisabled
+	}
+	if _, err := s.commentCourses(ctx, meta, docID); err != nil {
+		return nil, err
+	}
+	doc, err := s.ndr.GetDocument(ctx, toNDRMeta(meta), docID)
+	if err != nil {
+		return nil, err
+	}
+
+	var comments []database.DocumentComment
+	if err := s.comments.db.Where("document_id = ?", docID).Order("created_at, id").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	format, data := contentParts(doc.Content)
+	var root *yaml.Node
+	if format == "yaml" {
+		// 解析失败时不判断锚点是否失效
+		root, _ = parseYAMLRoot(data)
+	}
+
+	threads := []DocumentCommentView{}
+	index := make(map[uint]int)
+	for _, comment := range comments {
+		if comment.ParentID != nil {
+			continue
+		}
+		if resolved != nil && comment.Resolved != *resolved {
+			continue
+		}
+		view := newDocumentCommentView(comment)
+		view.Outdated = comment.VersionNumber != nil && doc.Version != nil && *doc.Version > *comment.VersionNumber
+		view.AnchorLost = commentAnchorLost(comment, format, data, root)
+		index[comment.ID] = len(threads)
+		threads = append(threads, view)
+	}
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			continue
+		}
+		if i, ok := index[*comment.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, newDocumentCommentView(comment))
+		}
+	}
+	return threads, nil
+}
+
+// CreateDocumentComment 创建评论或回复，并通过 document.commented 事件通知课程成员与被提及的用户
+func (s *Service) CreateDocumentComment(ctx context.Context, meta RequestMeta, docID int64, input DocumentCommentInput) (*DocumentCommentView, error) {
+	if s.comments == nil {
+		return nil, ErrDocumentCommentsDisabled
+	}
+	if meta.UserIDNumeric == 0 {
+		return nil, fmt.Errorf("%w: comments require an authenticated user", ErrCommentForbidden)
+	}
+	body, err := normalizeCommentBody(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	courses, err := s.commentCourses(ctx, meta, docID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.ndr.GetDocument(ctx, toNDRMeta(meta), docID)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := database.DocumentComment{
+		DocumentID:    docID,
+		ParentID:      input.ParentID,
+		VersionNumber: doc.Version,
+		Body:          body,
+		AuthorID:      meta.UserIDNumeric,
+		AuthorName:    meta.Username,
+	}
+	if input.ParentID != nil {
+		parent, err := s.comments.load(docID, *input.ParentID)
+		if errors.Is(err, ErrCommentNotFound) {
+			return nil, fmt.Errorf("%w: parent comment %d not found", ErrInvalidComment, *input.ParentID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if parent.ParentID != nil {
+			return nil, fmt.Errorf("%w: replies can only be added to the first comment of a thread", ErrInvalidComment)
+		}
+		if input.AnchorPath != "" || input.AnchorStart != nil || input.AnchorEnd != nil {
+			return nil, fmt.Errorf("%w: replies cannot carry an anchor", ErrInvalidComment)
+		}
+	} else {
+		if input.VersionNumber != nil {
+			if *input.VersionNumber <= 0 || (doc.Version != nil && *input.VersionNumber > *doc.Version) {
+				return nil, fmt.Errorf("%w: version %d does not exist", ErrInvalidComment, *input.VersionNumber)
+			}
+			comment.VersionNumber = input.VersionNumber
+		}
+		content := doc.Content
+		if comment.VersionNumber != nil && doc.Version != nil && *comment.VersionNumber != *doc.Version {
+			version, err := s.ndr.GetDocumentVersion(ctx, toNDRMeta(meta), docID, *comment.VersionNumber)
+			if err != nil {
+				return nil, err
+			}
+			content = version.Content
+		}
+		if err := applyCommentAnchor(&comment, input, content); err != nil {
+			return nil, err
+		}
+	}
+
+	mentions := s.resolveCommentMentions(body, courses)
+	encoded, _ := json.Marshal(mentions)
+	comment.Mentions = string(encoded)
+	if err := s.comments.db.Create(&comment).Error; err != nil {
+		return nil, err
+	}
+
+	s.publish(meta, EventDocumentCommented, courses, documentCommentEvent{ID: docID, Comment: &comment, Mentions: mentions})
+	view := newDocumentCommentView(comment)
+	return &view, nil
+}
+
+// UpdateDocumentComment 修改评论正文，只有作者可以修改；提及的用户按新正文重新解析
+func (s *Service) UpdateDocumentComment(ctx context.Context, meta RequestMeta, docID int64, commentID uint, body string) (*DocumentCommentView, error) {
+	if s.comments == nil {
+		return nil, ErrDocumentCommentsDisabled
+	}
+	body, err := normalizeCommentBody(body)
+	if err != nil {
+		return nil, err
+	}
+	courses, err := s.commentCourses(ctx, meta, docID)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := s.comments.load(docID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if meta.UserIDNumeric == 0 || comment.AuthorID != meta.UserIDNumeric {
+		return nil, fmt.Errorf("%w: only the author can edit a comment", ErrCommentForbidden)
+	}
+
+	encoded, _ := json.Marshal(s.resolveCommentMentions(body, courses))
+	comment.Body = body
+	comment.Mentions = string(encoded)
+	if err := s.comments.db.Model(comment).Select("body", "mentions", "updated_at").Updates(comment).Error; err != nil {
+		return nil, err
+	}
+	view := newDocumentCommentView(*comment)
+	return &view, nil
+}
+
+// DeleteDocumentComment 删除评论，作者、课程管理员与超级管理员可以删除；删除首条评论时一并删除其回复
+func (s *Service) DeleteDocumentComment(ctx context.Context, meta RequestMeta, docID int64, commentID uint) error {
+	if s.comments == nil {
+		return ErrDocumentCommentsDisabled
+	}
+	if _, err := s.commentCourses(ctx, meta, docID); err != nil {
+		return err
+	}
+	comment, err := s.comments.load(docID, commentID)
+	if err != nil {
+		return err
+	}
+	isAuthor := meta.UserIDNumeric != 0 && comment.AuthorID == meta.UserIDNumeric
+	if !isAuthor && meta.UserRole != "super_admin" && meta.UserRole != "course_admin" {
+		return fmt.Errorf("%w: only the author or a course admin can delete a comment", ErrCommentForbidden)
+	}
+	return s.comments.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("parent_id = ?", comment.ID).Delete(&database.DocumentComment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&database.DocumentComment{}, comment.ID).Error
+	})
+}
+
+// ResolveDocumentComment 将讨论串标记为已解决或重新打开，拥有课程权限的用户均可操作
+func (s *Service) ResolveDocumentComment(ctx context.Context, meta RequestMeta, docID int64, commentID uint, resolved bool) (*DocumentCommentView, error) {
+	if s.comments == nil {
+		return nil, ErrDocumentCommentsDisabled
+	}
+	if _, err := s.commentCourses(ctx, meta, docID); err != nil {
+		return nil, err
+	}
+	comment, err := s.comments.load(docID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment.ParentID != nil {
+		return nil, fmt.Errorf("%w: only the first comment of a thread can be resolved", ErrInvalidComment)
+	}
+
+	comment.Resolved = resolved
+	comment.ResolvedByID = nil
+	comment.ResolvedAt = nil
+	if resolved {
+		now := time.Now()
+		if meta.UserIDNumeric != 0 {
+			comment.ResolvedByID = &meta.UserIDNumeric
+		}
+		comment.ResolvedAt = &now
+	}
+	if err := s.comments.db.Model(comment).Select("resolved", "resolved_by_id", "resolved_at", "updated_at").Updates(comment).Error; err != nil {
+		return nil, err
+	}
+	view := newDocumentCommentView(*comment)
+	return &view, nil
+}
+
+// commentCourses 解析文档绑定节点所属的课程；非超级管理员须拥有其中至少一门课程的权限
+func (s *Service) commentCourses(ctx context.Context, meta RequestMeta, docID int64) ([]int64, error) {
+	courses, err := s.documentBoundCourses(ctx, meta, docID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.hasAnyCoursePermission(meta, courses)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: no permission for document %d", ErrCommentForbidden, docID)
+	}
+	return courses, nil
+}
+
+// resolveCommentMentions 解析正文中的 @用户名，只保留存在且能访问该文档所属课程的用户
+func (s *Service) resolveCommentMentions(body string, courses []int64) []string {
+	mentions := []string{}
+	if s.userService == nil {
+		return mentions
+	}
+	for _, match := range commentMentionPattern.FindAllStringSubmatch(body, -1) {
+		username := match[1]
+		if len(mentions) >= maxCommentMentions {
+			break
+		}
+		if slices.Contains(mentions, username) {
+			continue
+		}
+		user, err := s.userService.GetUserByUsername(username)
+		if err != nil {
+			continue
+		}
+		if user.Role == "super_admin" {
+			mentions = append(mentions, user.Username)
+			continue
+		}
+		for _, courseID := range courses {
+			if ok, err := s.userService.HasCoursePermission(user.ID, courseID); err == nil && ok {
+				mentions = append(mentions, user.Username)
+				break
+			}
+		}
+	}
+	return mentions
+}
+
+func normalizeCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", fmt.Errorf("%w: body is required", ErrInvalidComment)
+	}
+	if utf8.RuneCountInString(body) > MaxCommentBodyLength {
+		return "", fmt.Errorf("%w: body exceeds %d characters", ErrInvalidComment, MaxCommentBodyLength)
+	}
+	return body, nil
+}
+
+// applyCommentAnchor 校验锚点并写入评论：YAML 路径须存在于该版本的内容中，文本范围记录对应原文
+func applyCommentAnchor(comment *database.DocumentComment, input DocumentCommentInput, content map[string]any) error {
+	hasRange := input.AnchorStart != nil || input.AnchorEnd != nil
+	if input.AnchorPath == "" && !hasRange {
+		return nil
+	}
+	if input.AnchorPath != "" && hasRange {
+		return fmt.Errorf("%w: anchor_path and anchor_start/anchor_end are mutually exclusive", ErrInvalidComment)
+	}
+	format, data := contentParts(content)
+
+	if input.AnchorPath != "" {
+		if !commentPathPattern.MatchString(input.AnchorPath) {
+			return fmt.Errorf("%w: malformed anchor_path %q", ErrInvalidComment, input.AnchorPath)
+		}
+		if format != "yaml" {
+			return fmt.Errorf("%w: anchor_path requires a YAML document", ErrInvalidComment)
+		}
+		root, err := parseYAMLRoot(data)
+		if err != nil {
+			return fmt.Errorf("%w: document content is not valid YAML: %v", ErrInvalidComment, err)
+		}
+		if lookupYAMLPath(root, input.AnchorPath) == nil {
+			return fmt.Errorf("%w: anchor_path %q not found in the document", ErrInvalidComment, input.AnchorPath)
+		}
+		comment.AnchorPath = input.AnchorPath
+		return nil
+	}
+
+	if input.AnchorStart == nil || input.AnchorEnd == nil {
+		return fmt.Errorf("%w: anchor_start and anchor_end must be given together", ErrInvalidComment)
+	}
+	if format != "markdown" {
+		return fmt.Errorf("%w: text ranges require a Markdown document", ErrInvalidComment)
+	}
+	runes := []rune(data)
+	start, end := *input.AnchorStart, *input.AnchorEnd
+	if start < 0 || start >= end || end > len(runes) {
+		return fmt.Errorf("%w: text range [%d, %d) is outside the document (length %d)", ErrInvalidComment, start, end, len(runes))
+	}
+	comment.AnchorStart = &start
+	comment.AnchorEnd = &end
+	comment.AnchorQuote = string(runes[start:end])
+	return nil
+}
+
+// commentAnchorLost 锚定的 YAML 字段在当前内容中已不存在，或文本范围内的原文已改变
+func commentAnchorLost(comment database.DocumentComment, format, data string, root *yaml.Node) bool {
+	switch {
+	case comment.AnchorPath != "":
+		return format == "yaml" && root != nil && lookupYAMLPath(root, comment.AnchorPath) == nil
+	case comment.AnchorStart != nil && comment.AnchorEnd != nil:
+		runes := []rune(data)
+		start, end := *comment.AnchorStart, *comment.AnchorEnd
+		return end > len(runes) || string(runes[start:end]) != comment.AnchorQuote
+	}
+	return false
+}
+
+// lookupYAMLPath 按 details[2].answer 形式的路径查找节点，不存在时返回 nil
+func lookupYAMLPath(root *yaml.Node, path string) *yaml.Node {
+	node := root
+	for _, segment := range commentPathSegment.FindAllString(path, -1) {
+		if strings.HasPrefix(segment, "[") {
+			i, err := strconv.Atoi(segment[1 : len(segment)-1])
+			if err != nil || !isYAMLKind(node, yaml.SequenceNode) || i >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[i]
+		} else {
+			node = yamlMappingValue(node, segment)
+		}
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+func newDocumentCommentView(comment database.DocumentComment) DocumentCommentView {
+	view := DocumentCommentView{DocumentComment: comment, MentionedUsers: []string{}}
+	if comment.Mentions != "" {
+		_ = json.Unmarshal([]byte(comment.Mentions), &view.MentionedUsers)
+	}
+	return view
+}
+
+// purge 删除文档的全部评论（文档被彻底删除时调用）
+func (c *DocumentComments) purge(docID int64) error {
+	return c.db.Where("document_id = ?", docID).Delete(&database.DocumentComment{}).Error
+}
+
+func (c *DocumentComments) load(docID int64, commentID uint) (*database.DocumentComment, error) {
+	var comment database.DocumentComment
+	err := c.db.Where("document_id = ?", docID).First(&comment, commentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
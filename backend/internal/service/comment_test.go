@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+func TestDocumentCommentThreads(t *testing.T) {
+	f := newCourseFixture(t, &database.DocumentComment{})
+	question := f.ndr.docs[11]
+	question.Version = ptr(2)
+	question.Content = map[string]any{"format": "yaml", "data": "stem: Q\ndetails:\n  - answer: A\n  - answer: B\n"}
+	f.ndr.docs[11] = question
+
+	svc := f.svc
+	svc.SetDocumentComments(NewDocumentComments(f.db))
+	ctx := context.Background()
+
+	t.Run("拒绝无效评论", func(t *testing.T) {
+		cases := []struct {
+			name    string
+			meta    RequestMeta
+			input   DocumentCommentInput
+			wantErr error
+		}{
+			{"没有课程权限", f.outsiderMeta, DocumentCommentInput{Body: "hi"}, ErrCommentForbidden},
+			{"锚定字段不存在", f.proofMeta, DocumentCommentInput{Body: "x", AnchorPath: "details[5].answer"}, ErrInvalidComment},
+			{"YAML 文档不能锚定文本范围", f.proofMeta, DocumentCommentInput{Body: "x", AnchorStart: ptr(0), AnchorEnd: ptr(1)}, ErrInvalidComment},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				if _, err := svc.CreateDocumentComment(ctx, tc.meta, 11, tc.input); !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected %v, got %v", tc.wantErr, err)
+				}
+			})
+		}
+	})
+
+	// 以下步骤依次操作同一讨论串
+	var thread *DocumentCommentView
+	t.Run("创建与回复", func(t *testing.T) {
+		// 提及课程外的用户与邮箱地址均被忽略
+		var err error
+		thread, err = svc.CreateDocumentComment(ctx, f.proofMeta, 11, DocumentCommentInput{
+			Body:       "@rita 答案应为 C，抄送 @otto 与 pat@example.com",
+			AnchorPath: "details[1].answer",
+		})
+		if err != nil {
+			t.Fatalf("create comment: %v", err)
+		}
+		if thread.VersionNumber == nil || *thread.VersionNumber != 2 || len(thread.MentionedUsers) != 1 || thread.MentionedUsers[0] != "rita" {
+			t.Fatalf("unexpected comment %+v", thread)
+		}
+		if _, err := svc.CreateDocumentComment(ctx, f.adminMeta, 11, DocumentCommentInput{Body: "已修改", ParentID: &thread.ID}); err != nil {
+			t.Fatalf("reply: %v", err)
+		}
+		if _, err := svc.UpdateDocumentComment(ctx, f.adminMeta, 11, thread.ID, "改写"); !errors.Is(err, ErrCommentForbidden) {
+			t.Fatalf("expected only the author to edit, got %v", err)
+		}
+	})
+	if thread == nil {
+		t.FailNow()
+	}
+
+	// 文档更新后评论标记为过期，锚定字段被删除后标记锚点失效
+	var replyID uint
+	t.Run("文档更新后过期", func(t *testing.T) {
+		question.Version = ptr(3)
+		question.Content = map[string]any{"format": "yaml", "data": "stem: Q\ndetails:\n  - answer: A\n"}
+		f.ndr.docs[11] = question
+		threads, err := svc.ListDocumentComments(ctx, f.proofMeta, 11, nil)
+		if err != nil || len(threads) != 1 || len(threads[0].Replies) != 1 {
+			t.Fatalf("unexpected threads %+v err=%v", threads, err)
+		}
+		if !threads[0].Outdated || !threads[0].AnchorLost {
+			t.Fatalf("expected thread to be outdated with a lost anchor: %+v", threads[0])
+		}
+		replyID = threads[0].Replies[0].ID
+	})
+
+	t.Run("解决与重新打开", func(t *testing.T) {
+		if _, err := svc.ResolveDocumentComment(ctx, f.proofMeta, 11, replyID, true); !errors.Is(err, ErrInvalidComment) {
+			t.Fatalf("expected resolving a reply to be rejected, got %v", err)
+		}
+		resolved, err := svc.ResolveDocumentComment(ctx, f.adminMeta, 11, thread.ID, true)
+		if err != nil || !resolved.Resolved || resolved.ResolvedByID == nil || *resolved.ResolvedByID != f.admin.ID {
+			t.Fatalf("unexpected resolved comment %+v err=%v", resolved, err)
+		}
+		open := false
+		if threads, err := svc.ListDocumentComments(ctx, f.proofMeta, 11, &open); err != nil || len(threads) != 0 {
+			t.Fatalf("expected no open threads, got %+v err=%v", threads, err)
+		}
+		if reopened, err := svc.ResolveDocumentComment(ctx, f.proofMeta, 11, thread.ID, false); err != nil || reopened.Resolved || reopened.ResolvedAt != nil {
+			t.Fatalf("unexpected reopened comment %+v err=%v", reopened, err)
+		}
+	})
+
+	// 删除首条评论时一并删除回复
+	t.Run("删除讨论串", func(t *testing.T) {
+		if err := svc.DeleteDocumentComment(ctx, f.adminMeta, 11, thread.ID); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		var count int64
+		f.db.Model(&database.DocumentComment{}).Count(&count)
+		if count != 0 {
+			t.Fatalf("expected replies to be deleted with the thread, %d comments left", count)
+		}
+	})
+}
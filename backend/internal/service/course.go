@@ -3,6 +3,9 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/yjxt/ydms/backend/internal/database"
 	"github.com/yjxt/ydms/backend/internal/ndrclient"
@@ -11,9 +14,10 @@ import (
 
 // CourseService 课程服务
 type CourseService struct {
-	db          *gorm.DB
-	ndr         ndrclient.Client
-	userService *UserService
+	db           *gorm.DB
+	ndr          ndrclient.Client
+	userService  *UserService
+	onTreeChange func() // 课程根节点增删后通知分类树快照失效
 }
 
 // NewCourseService 创建课程服务
@@ -25,6 +29,17 @@ func NewCourseService(db *gorm.DB, ndr ndrclient.Client, userService *UserServic
 	}
 }
 
+// SetTreeInvalidator 设置课程增删后调用的分类树失效回调
+func (s *CourseService) SetTreeInvalidator(fn func()) {
+	s.onTreeChange = fn
+}
+
+func (s *CourseService) invalidateTree() {
+	if s.onTreeChange != nil {
+		s.onTreeChange()
+	}
+}
+
 // CourseCreateRequest 创建课程请求
 type CourseCreateRequest struct {
 	Name string `json:"name"`
@@ -46,6 +61,7 @@ func (s *CourseService) CreateCourse(ctx context.Context, meta RequestMeta, req
 	slugPtr := &slug
 
 	// 在 NDR 中创建根节点
+	defer s.invalidateTree()
 	node, err := s.ndr.CreateNode(ctx, toNDRMeta(meta), ndrclient.NodeCreate{
 		Name:       req.Name,
 		Slug:       slugPtr,
@@ -91,6 +107,7 @@ func (s *CourseService) ListCourses(ctx context.Context, meta RequestMeta, userI
 // DeleteCourse 删除课程
 func (s *CourseService) DeleteCourse(ctx context.Context, meta RequestMeta, courseID int64) error {
 	// 删除 NDR 中的根节点
+	defer s.invalidateTree()
 	err := s.ndr.DeleteNode(ctx, toNDRMeta(meta), courseID)
 	if err != nil {
 		return err
@@ -102,3 +119,41 @@ func (s *CourseService) DeleteCourse(ctx context.Context, meta RequestMeta, cour
 
 	return nil
 }
+
+// CourseResolver 返回按根节点 ID 或 slug 查找课程的解析器（一次性加载全部根节点）
+func (s *CourseService) CourseResolver(ctx context.Context, meta RequestMeta) (CourseResolver, error) {
+	bySlug := make(map[string]int64)
+	byID := make(map[int64]bool)
+	params := ndrclient.ListNodesParams{Page: 1, Size: 100}
+	seen := 0
+	for {
+		page, err := s.ndr.ListNodes(ctx, toNDRMeta(meta), params)
+		if err != nil {
+			return nil, fmt.Errorf("list courses: %w", err)
+		}
+		for _, node := range page.Items {
+			if node.ParentID == nil && node.DeletedAt == nil {
+				byID[node.ID] = true
+				bySlug[strings.ToLower(node.Slug)] = node.ID
+			}
+		}
+		seen += len(page.Items)
+		if len(page.Items) == 0 || len(page.Items) < params.Size || (page.Total > 0 && seen >= page.Total) {
+			break
+		}
+		params.Page++
+	}
+
+	return func(ref string) (int64, error) {
+		if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+			if !byID[id] {
+				return 0, errors.New("course not found")
+			}
+			return id, nil
+		}
+		if id, ok := bySlug[strings.ToLower(ref)]; ok {
+			return id, nil
+		}
+		return 0, errors.New("course not found")
+	}, nil
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+const (
+	// DefaultDocumentLockTTL 未指定时长时编辑锁的有效期，客户端应在到期前发送心跳续期
+	DefaultDocumentLockTTL = 5 * time.Minute
+	// MaxDocumentLockTTL 单次加锁或续期允许的最长有效期
+	MaxDocumentLockTTL = time.Hour
+)
+
+var (
+	// ErrDocumentLocksDisabled 未启用文档编辑锁
+	ErrDocumentLocksDisabled = errors.New("document locks are disabled")
+	// ErrDocumentNotLocked 文档当前没有有效的编辑锁
+	ErrDocumentNotLocked = errors.New("document is not locked")
+	// ErrDocumentLockForbidden 只有超级管理员可以强制解锁
+	ErrDocumentLockForbidden = errors.New("only super admin can break document locks")
+	// ErrDocumentLockAnonymous 加锁需要已认证的用户
+	ErrDocumentLockAnonymous = errors.New("document locks require an authenticated user")
+	// ErrDocumentLockNoPermission 没有文档所属课程的权限
+	ErrDocumentLockNoPermission = errors.New("no permission for the document's course")
+)
+
+// DocumentLockedError 文档正被其他用户锁定
+type DocumentLockedError struct {
+	Lock database.DocumentLock
+}
+
+func (e *DocumentLockedError) Error() string {
+	return fmt.Sprintf("document %d is locked by %s until %s", e.Lock.DocumentID, e.Lock.HolderName, e.Lock.ExpiresAt.Format(time.RFC3339))
+}
+
+// DocumentLocks 文档编辑锁，保存在数据库中以便多个实例共享
+type DocumentLocks struct {
+	db *gorm.DB
+}
+
+// NewDocumentLocks 创建文档编辑锁存储
+func NewDocumentLocks(db *gorm.DB) *DocumentLocks {
+	return &DocumentLocks{db: db}
+}
+
+// SetDocumentLocks 启用文档编辑锁；未设置时文档更新保持最后写入者生效
+func (s *Service) SetDocumentLocks(locks *DocumentLocks) {
+	s.editLocks = locks
+}
+
+// LockDocument 为当前用户加锁或续期（心跳），要求拥有文档所属课程的权限。ttl <= 0 时使用
+// DefaultDocumentLockTTL；文档被其他用户锁定时返回 *DocumentLockedError
+func (s *Service) LockDocument(ctx context.Context, meta RequestMeta, docID int64, ttl time.Duration) (*database.DocumentLock, error) {
+	if s.editLocks == nil {
+		return nil, ErrDocumentLocksDisabled
+	}
+	if meta.UserIDNumeric == 0 {
+		return nil, ErrDocumentLockAnonymous
+	}
+	if ttl <= 0 {
+		ttl = DefaultDocumentLockTTL
+	}
+	if ttl > MaxDocumentLockTTL {
+		ttl = MaxDocumentLockTTL
+	}
+	// 确认文档存在，避免为不存在的文档留下锁
+	if _, err := s.ndr.GetDocument(ctx, toNDRMeta(meta), docID); err != nil {
+		return nil, err
+	}
+	// 每次续期都重新校验，课程权限被收回后无法继续持有锁
+	courses, err := s.documentBoundCourses(ctx, meta, docID)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := s.hasAnyCoursePermission(meta, courses); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("%w: document %d", ErrDocumentLockNoPermission, docID)
+	}
+	return s.editLocks.acquire(docID, meta.UserIDNumeric, meta.Username, ttl)
+}
+
+// UnlockDocument 释放当前用户持有的锁；文档未锁定或锁已过期时视为成功
+func (s *Service) UnlockDocument(ctx context.Context, meta RequestMeta, docID int64) error {
+	if s.editLocks == nil {
+		return nil
+	}
+	return s.editLocks.release(docID, meta.UserIDNumeric)
+}
+
+// BreakDocumentLock 超级管理员强制解除其他用户的锁，返回被解除的锁
+func (s *Service) BreakDocumentLock(ctx context.Context, meta RequestMeta, docID int64) (*database.DocumentLock, error) {
+	if meta.UserRole != "super_admin" {
+		return nil, ErrDocumentLockForbidden
+	}
+	if s.editLocks == nil {
+		return nil, ErrDocumentLocksDisabled
+	}
+	lock, err := s.editLocks.remove(docID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[document-locks] document=%d lock of %s (id=%d) broken by %s", docID, lock.HolderName, lock.HolderID, meta.Username)
+	return lock, nil
+}
+
+// DocumentLockHolder 返回文档当前有效的锁，未锁定时返回 nil
+func (s *Service) DocumentLockHolder(ctx context.Context, docID int64) (*database.DocumentLock, error) {
+	if s.editLocks == nil {
+		return nil, nil
+	}
+	return s.editLocks.current(docID)
+}
+
+// checkDocumentLock 文档被其他用户锁定时拒绝修改；超级管理员不受限制
+func (s *Service) checkDocumentLock(meta RequestMeta, docID int64) error {
+	if s.editLocks == nil || meta.UserRole == "super_admin" {
+		return nil
+	}
+	lock, err := s.editLocks.current(docID)
+	if err != nil {
+		return fmt.Errorf("check document lock: %w", err)
+	}
+	if lock != nil && (meta.UserIDNumeric == 0 || lock.HolderID != meta.UserIDNumeric) {
+		return &DocumentLockedError{Lock: *lock}
+	}
+	return nil
+}
+
+func (l *DocumentLocks) current(docID int64) (*database.DocumentLock, error) {
+	var lock database.DocumentLock
+	err := l.db.Where("document_id = ? AND expires_at > ?", docID, time.Now()).First(&lock).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// acquire 以条件更新接管自己持有或已过期的锁；不存在时插入，并发插入失败后按当前持有者返回
+func (l *DocumentLocks) acquire(docID int64, holderID uint, holderName string, ttl time.Duration) (*database.DocumentLock, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	var lock database.DocumentLock
+	err := l.db.Where("document_id = ?", docID).First(&lock).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		lock = database.DocumentLock{DocumentID: docID, HolderID: holderID, HolderName: holderName, AcquiredAt: now, ExpiresAt: expiresAt}
+		if err := l.db.Create(&lock).Error; err != nil {
+			if held, _ := l.current(docID); held != nil && held.HolderID != holderID {
+				return nil, &DocumentLockedError{Lock: *held}
+			}
+			return nil, fmt.Errorf("acquire document lock: %w", err)
+		}
+		return &lock, nil
+	case err != nil:
+		return nil, err
+	}
+
+	updates := map[string]interface{}{"expires_at": expiresAt, "holder_name": holderName}
+	if lock.HolderID != holderID || !lock.ExpiresAt.After(now) {
+		// 接管过期的锁（包括自己已过期的锁）时重新计算加锁时间
+		updates["holder_id"] = holderID
+		updates["acquired_at"] = now
+	}
+	res := l.db.Model(&database.DocumentLock{}).
+		Where("document_id = ? AND (holder_id = ? OR expires_at <= ?)", docID, holderID, now).
+		Updates(updates)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		if held, _ := l.current(docID); held != nil {
+			return nil, &DocumentLockedError{Lock: *held}
+		}
+		return nil, errors.New("acquire document lock: lock changed concurrently, retry")
+	}
+	if err := l.db.Where("document_id = ?", docID).First(&lock).Error; err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+func (l *DocumentLocks) release(docID int64, holderID uint) error {
+	res := l.db.Where("document_id = ? AND holder_id = ?", docID, holderID).Delete(&database.DocumentLock{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+	held, err := l.current(docID)
+	if err != nil {
+		return err
+	}
+	if held != nil {
+		return &DocumentLockedError{Lock: *held}
+	}
+	return nil
+}
+
+// purge 删除文档的锁，无论是否过期（文档被彻底删除时调用）
+func (l *DocumentLocks) purge(docID int64) error {
+	return l.db.Where("document_id = ?", docID).Delete(&database.DocumentLock{}).Error
+}
+
+func (l *DocumentLocks) remove(docID int64) (*database.DocumentLock, error) {
+	lock, err := l.current(docID)
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		return nil, ErrDocumentNotLocked
+	}
+	if err := l.db.Where("document_id = ?", docID).Delete(&database.DocumentLock{}).Error; err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+func TestDocumentLocks(t *testing.T) {
+	db := setupUserDB(t)
+	if err := db.AutoMigrate(&database.DocumentLock{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	userService := NewUserService(db)
+	var metas []RequestMeta
+	for _, name := range []string{"alice", "bob", "carol"} {
+		user, err := userService.CreateUser(name, "Secret-pass-9", "course_admin", nil)
+		if err != nil {
+			t.Fatalf("create user %s: %v", name, err)
+		}
+		metas = append(metas, RequestMeta{UserRole: "course_admin", UserIDNumeric: user.ID, Username: name})
+	}
+	alice, bob, outsider := metas[0], metas[1], metas[2]
+	userService.GrantCoursePermission(alice.UserIDNumeric, 1)
+	userService.GrantCoursePermission(bob.UserIDNumeric, 1)
+
+	svc := NewService(cache.NewNoop(), newCopySourceNDR(), userService)
+	svc.SetDocumentLocks(NewDocumentLocks(db))
+	ctx := context.Background()
+	admin := RequestMeta{UserRole: "super_admin", UserIDNumeric: 99, Username: "admin"}
+	title := "edited"
+
+	// 没有课程权限的用户不能加锁
+	if _, err := svc.LockDocument(ctx, outsider, 10, time.Minute); !errors.Is(err, ErrDocumentLockNoPermission) {
+		t.Fatalf("expected lock without course permission to be rejected, got %v", err)
+	}
+	lock, err := svc.LockDocument(ctx, alice, 10, time.Minute)
+	if err != nil || lock.HolderID != alice.UserIDNumeric || lock.HolderName != "alice" {
+		t.Fatalf("LockDocument: lock=%+v err=%v", lock, err)
+	}
+	// 心跳续期保留原加锁时间
+	renewed, err := svc.LockDocument(ctx, alice, 10, 10*time.Minute)
+	if err != nil || !renewed.ExpiresAt.After(lock.ExpiresAt) || !renewed.AcquiredAt.Equal(lock.AcquiredAt) {
+		t.Fatalf("heartbeat: lock=%+v err=%v", renewed, err)
+	}
+
+	var locked *DocumentLockedError
+	if _, err := svc.UpdateDocument(ctx, bob, 10, DocumentUpdateRequest{Title: &title}); !errors.As(err, &locked) || locked.Lock.HolderName != "alice" {
+		t.Fatalf("expected update by other user to be locked, got %v", err)
+	}
+	if _, err := svc.LockDocument(ctx, bob, 10, 0); !errors.As(err, &locked) {
+		t.Fatalf("expected lock by other user to fail, got %v", err)
+	}
+	if err := svc.UnlockDocument(ctx, bob, 10); !errors.As(err, &locked) {
+		t.Fatalf("expected unlock by other user to fail, got %v", err)
+	}
+	if err := svc.DeleteDocument(ctx, bob, 10); !errors.As(err, &locked) {
+		t.Fatalf("expected delete by other user to be locked, got %v", err)
+	}
+	if _, err := svc.UpdateDocument(ctx, alice, 10, DocumentUpdateRequest{Title: &title}); err != nil {
+		t.Fatalf("holder update: %v", err)
+	}
+	if _, err := svc.UpdateDocument(ctx, admin, 10, DocumentUpdateRequest{Title: &title}); err != nil {
+		t.Fatalf("super admin update: %v", err)
+	}
+
+	if _, err := svc.BreakDocumentLock(ctx, bob, 10); !errors.Is(err, ErrDocumentLockForbidden) {
+		t.Fatalf("expected break lock to require super admin, got %v", err)
+	}
+	broken, err := svc.BreakDocumentLock(ctx, admin, 10)
+	if err != nil || broken.HolderID != alice.UserIDNumeric {
+		t.Fatalf("BreakDocumentLock: lock=%+v err=%v", broken, err)
+	}
+	if holder, _ := svc.DocumentLockHolder(ctx, 10); holder != nil {
+		t.Fatalf("expected lock to be released, got %+v", holder)
+	}
+
+	// 过期的锁可被其他用户接管
+	if _, err := svc.LockDocument(ctx, bob, 11, time.Nanosecond); err != nil {
+		t.Fatalf("LockDocument: %v", err)
+	}
+	if _, err := svc.UpdateDocument(ctx, alice, 11, DocumentUpdateRequest{Title: &title}); err != nil {
+		t.Fatalf("expired lock must not block updates: %v", err)
+	}
+	if lock, err := svc.LockDocument(ctx, alice, 11, 0); err != nil || lock.HolderID != alice.UserIDNumeric || lock.ExpiresAt.Sub(lock.AcquiredAt) != DefaultDocumentLockTTL {
+		t.Fatalf("expected expired lock to be taken over, lock=%+v err=%v", lock, err)
+	}
+	if err := svc.UnlockDocument(ctx, alice, 11); err != nil {
+		t.Fatalf("UnlockDocument: %v", err)
+	}
+	if err := svc.UnlockDocument(ctx, alice, 11); err != nil {
+		t.Fatalf("unlocking twice must succeed: %v", err)
+	}
+}
+
+func TestDocumentLockGuardsRestoreAndPurge(t *testing.T) {
+	db := setupUserDB(t)
+	if err := db.AutoMigrate(&database.DocumentLock{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	userService := NewUserService(db)
+	holder, _ := userService.CreateUser("alice", "Secret-pass-9", "course_admin", nil)
+	other, _ := userService.CreateUser("bob", "Secret-pass-9", "course_admin", nil)
+	userService.GrantCoursePermission(holder.ID, 1)
+	userService.GrantCoursePermission(other.ID, 1)
+
+	fake := newCopySourceNDR()
+	svc := NewService(cache.NewNoop(), fake, userService)
+	svc.SetDocumentLocks(NewDocumentLocks(db))
+	ctx := context.Background()
+	alice := RequestMeta{UserRole: "course_admin", UserIDNumeric: holder.ID, Username: "alice"}
+	bob := RequestMeta{UserRole: "course_admin", UserIDNumeric: other.ID, Username: "bob"}
+	admin := RequestMeta{UserRole: "super_admin", UserIDNumeric: 99, Username: "admin"}
+	if _, err := svc.LockDocument(ctx, alice, 10, time.Minute); err != nil {
+		t.Fatalf("LockDocument: %v", err)
+	}
+
+	cases := []struct {
+		name       string
+		meta       RequestMeta
+		wantLocked bool
+	}{
+		{"其他用户被拒绝", bob, true},
+		{"持有者可以操作", alice, false},
+		{"超级管理员可以绕过", admin, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var locked *DocumentLockedError
+			_, restoreErr := svc.RestoreDocument(ctx, tc.meta, 10)
+			purgeErr := svc.PurgeDocument(ctx, tc.meta, 10)
+			for _, err := range []error{restoreErr, purgeErr} {
+				if errors.As(err, &locked) != tc.wantLocked || (!tc.wantLocked && err != nil) {
+					t.Fatalf("expected locked=%v, got %v", tc.wantLocked, err)
+				}
+			}
+		})
+	}
+	if len(fake.restoredDocIDs) != 2 || len(fake.purgedDocIDs) != 2 {
+		t.Fatalf("expected only the holder and super admin to reach NDR, restored=%v purged=%v", fake.restoredDocIDs, fake.purgedDocIDs)
+	}
+}
@@ -0,0 +1,572 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+// ErrDocumentVersionConflict indicates the caller edited a stale version of the document.
+var ErrDocumentVersionConflict = errors.New("document version conflict")
+
+// ErrMergeConflict indicates a merge could not be applied because fields conflict.
+var ErrMergeConflict = errors.New("merge has unresolved conflicts")
+
+// DocumentVersionConflictError carries the server-side document so the caller can show both versions.
+type DocumentVersionConflictError struct {
+	Expected int
+	Current  ndrclient.Document
+}
+
+func (e *DocumentVersionConflictError) Error() string {
+	current := 0
+	if e.Current.Version != nil {
+		current = *e.Current.Version
+	}
+	return fmt.Sprintf("document %d is at version %d, expected %d", e.Current.ID, current, e.Expected)
+}
+
+// Is lets errors.Is match ErrDocumentVersionConflict.
+func (e *DocumentVersionConflictError) Is(target error) bool {
+	return target == ErrDocumentVersionConflict
+}
+
+// DocumentMergeRequest describes local edits made on top of BaseVersion.
+// Fields left nil are treated as unchanged from the base.
+type DocumentMergeRequest struct {
+	BaseVersion int            `json:"base_version"`
+	Title       *string        `json:"title,omitempty"`
+	Content     map[string]any `json:"content,omitempty"`
+	Metadata    map[string]any `json:"metadata,omitempty"`
+	Apply       bool           `json:"apply,omitempty"`
+}
+
+// MergeConflict reports one field that both sides changed differently.
+type MergeConflict struct {
+	Field  string `json:"field"`
+	Base   any    `json:"base"`
+	Ours   any    `json:"ours"`
+	Theirs any    `json:"theirs"`
+}
+
+// DocumentMergeResult is the outcome of a three-way merge.
+type DocumentMergeResult struct {
+	BaseVersion    int                 `json:"base_version"`
+	CurrentVersion int                 `json:"current_version"`
+	Title          string              `json:"title"`
+	Content        map[string]any      `json:"content,omitempty"`
+	Metadata       map[string]any      `json:"metadata,omitempty"`
+	Conflicts      []MergeConflict     `json:"conflicts"`
+	Applied        bool                `json:"applied"`
+	Document       *ndrclient.Document `json:"document,omitempty"`
+}
+
+// MergeDocument three-way merges the caller's edits with the current document, using the
+// version the caller started from as the common base. With Apply set and no conflicts the
+// merged result is written back, guarded by the current version number.
+func (s *Service) MergeDocument(ctx context.Context, meta RequestMeta, docID int64, req DocumentMergeRequest) (DocumentMergeResult, error) {
+	if req.BaseVersion <= 0 {
+		return DocumentMergeResult{}, errors.New("base_version is required")
+	}
+
+	current, err := s.ndr.GetDocument(ctx, toNDRMeta(meta), docID)
+	if err != nil {
+		return DocumentMergeResult{}, err
+	}
+	base, err := s.GetDocumentVersion(ctx, meta, docID, req.BaseVersion)
+	if err != nil {
+		return DocumentMergeResult{}, fmt.Errorf("get base version %d: %w", req.BaseVersion, err)
+	}
+
+	result := DocumentMergeResult{BaseVersion: req.BaseVersion, Conflicts: []MergeConflict{}}
+	if current.Version != nil {
+		result.CurrentVersion = *current.Version
+	}
+
+	// 标题
+	oursTitle := base.Title
+	if req.Title != nil {
+		oursTitle = *req.Title
+	}
+	title, conflict := mergeScalar("title", base.Title, oursTitle, current.Title)
+	result.Title = title.(string)
+	if conflict != nil {
+		result.Conflicts = append(result.Conflicts, *conflict)
+	}
+
+	// 内容
+	format, currentData := documentContentParts(current)
+	baseFormat, baseData := contentParts(base.Content)
+	oursFormat, oursData := baseFormat, baseData
+	if req.Content != nil {
+		oursFormat, oursData = contentParts(req.Content)
+	}
+	if (baseFormat != "" && baseFormat != format) || (oursFormat != "" && oursFormat != format) {
+		return DocumentMergeResult{}, fmt.Errorf("content format changed from %s to %s, cannot merge", baseFormat, format)
+	}
+
+	var merged string
+	var contentConflicts []MergeConflict
+	switch ContentFormat(format) {
+	case ContentFormatYAML:
+		merged, contentConflicts, err = mergeYAMLText(baseData, oursData, currentData)
+		if err != nil {
+			return DocumentMergeResult{}, err
+		}
+	case ContentFormatMarkdown, ContentFormatHTML:
+		merged, contentConflicts = mergeTextLines(baseData, oursData, currentData)
+	default:
+		return DocumentMergeResult{}, fmt.Errorf("unsupported content format %q", format)
+	}
+	result.Content = map[string]any{"format": format, "data": merged}
+	result.Conflicts = append(result.Conflicts, contentConflicts...)
+
+	// 元数据
+	oursMeta := base.Metadata
+	if req.Metadata != nil {
+		oursMeta = req.Metadata
+	}
+	mergedMeta, metaConflicts := mergeMetadata(base.Metadata, oursMeta, current.Metadata)
+	result.Metadata = mergedMeta
+	result.Conflicts = append(result.Conflicts, metaConflicts...)
+
+	if !req.Apply {
+		return result, nil
+	}
+	if len(result.Conflicts) > 0 {
+		return result, ErrMergeConflict
+	}
+
+	expected := result.CurrentVersion
+	doc, err := s.UpdateDocument(ctx, meta, docID, DocumentUpdateRequest{
+		Title:           &result.Title,
+		Content:         result.Content,
+		Metadata:        metadataPatch(current.Metadata, mergedMeta),
+		ExpectedVersion: &expected,
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Applied = true
+	result.Document = &doc
+	return result, nil
+}
+
+func contentParts(content map[string]any) (string, string) {
+	format, _ := content["format"].(string)
+	data, _ := content["data"].(string)
+	return format, data
+}
+
+// missingValue marks a key that does not exist on one side of a merge.
+type missingValue struct{}
+
+func mergeValueOrNil(v any) any {
+	if _, ok := v.(missingValue); ok {
+		return nil
+	}
+	return v
+}
+
+// mergeScalar applies the standard three-way rule to an atomic value; on conflict ours wins
+// in the merged output and the conflict is reported.
+func mergeScalar(field string, base, ours, theirs any) (any, *MergeConflict) {
+	switch {
+	case reflect.DeepEqual(ours, theirs), reflect.DeepEqual(theirs, base):
+		return ours, nil
+	case reflect.DeepEqual(ours, base):
+		return theirs, nil
+	}
+	return ours, &MergeConflict{Field: field, Base: mergeValueOrNil(base), Ours: mergeValueOrNil(ours), Theirs: mergeValueOrNil(theirs)}
+}
+
+func mergeMetadata(base, ours, theirs map[string]any) (map[string]any, []MergeConflict) {
+	keys := make(map[string]struct{})
+	for _, m := range []map[string]any{base, ours, theirs} {
+		for k := range m {
+			keys[k] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	lookup := func(m map[string]any, k string) any {
+		if v, ok := m[k]; ok {
+			return v
+		}
+		return missingValue{}
+	}
+
+	merged := make(map[string]any)
+	var conflicts []MergeConflict
+	for _, k := range sorted {
+		value, conflict := mergeScalar("metadata."+k, lookup(base, k), lookup(ours, k), lookup(theirs, k))
+		if conflict != nil {
+			conflicts = append(conflicts, *conflict)
+		}
+		if _, missing := value.(missingValue); !missing {
+			merged[k] = value
+		}
+	}
+	return merged, conflicts
+}
+
+// metadataPatch turns the merged metadata into an RFC 7396 patch against current,
+// explicitly nulling keys the merge removed.
+func metadataPatch(current, merged map[string]any) map[string]any {
+	patch := make(map[string]any, len(merged))
+	for k, v := range merged {
+		patch[k] = v
+	}
+	for k := range current {
+		if _, ok := merged[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	return patch
+}
+
+// mergeYAMLText merges YAML documents field by field, keeping the key order and scalar
+// styles of our side. Front matter is merged the same way under "front_matter".
+func mergeYAMLText(base, ours, theirs string) (string, []MergeConflict, error) {
+	switch {
+	case ours == theirs, theirs == base:
+		return ours, nil, nil
+	case ours == base:
+		return theirs, nil, nil
+	}
+
+	var conflicts []MergeConflict
+	parts := make([]string, 2)
+	hasFrontMatter := false
+	for i, prefix := range []string{"content.front_matter", "content"} {
+		sides := make([]*yaml.Node, 3)
+		for j, data := range []string{base, ours, theirs} {
+			header, body := splitFrontMatter(data)
+			text := body
+			if i == 0 {
+				text = header
+				if strings.TrimSpace(header) != "" {
+					hasFrontMatter = true
+				}
+			}
+			node, err := parseYAMLRoot(text)
+			if err != nil {
+				return "", nil, fmt.Errorf("parse %s: %w", []string{"base", "ours", "theirs"}[j], err)
+			}
+			sides[j] = node
+		}
+		merged, found := mergeYAMLNodes(prefix, sides[0], sides[1], sides[2])
+		conflicts = append(conflicts, found...)
+		out, err := encodeYAMLNode(merged)
+		if err != nil {
+			return "", nil, err
+		}
+		parts[i] = out
+	}
+
+	if !hasFrontMatter {
+		return parts[1], conflicts, nil
+	}
+	return frontMatterDelimiter + "\n" + parts[0] + frontMatterDelimiter + "\n\n" + parts[1], conflicts, nil
+}
+
+func parseYAMLRoot(text string) (*yaml.Node, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return doc.Content[0], nil
+}
+
+func encodeYAMLNode(node *yaml.Node) (string, error) {
+	if node == nil {
+		return "", nil
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return "", fmt.Errorf("encode yaml: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("encode yaml: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func yamlNodeValue(node *yaml.Node) any {
+	if node == nil {
+		return missingValue{}
+	}
+	var v any
+	if err := node.Decode(&v); err != nil {
+		return node.Value
+	}
+	return v
+}
+
+func mergeYAMLNodes(path string, base, ours, theirs *yaml.Node) (*yaml.Node, []MergeConflict) {
+	bv, ov, tv := yamlNodeValue(base), yamlNodeValue(ours), yamlNodeValue(theirs)
+	switch {
+	case reflect.DeepEqual(ov, tv), reflect.DeepEqual(tv, bv):
+		return ours, nil
+	case reflect.DeepEqual(ov, bv):
+		return theirs, nil
+	}
+
+	if isYAMLKind(ours, yaml.MappingNode) && isYAMLKind(theirs, yaml.MappingNode) && (base == nil || base.Kind == yaml.MappingNode) {
+		merged := &yaml.Node{Kind: yaml.MappingNode, Tag: ours.Tag, Style: ours.Style}
+		var conflicts []MergeConflict
+		for _, key := range yamlMappingKeys(ours, theirs) {
+			child, found := mergeYAMLNodes(path+"."+key.Value, yamlMappingValue(base, key.Value), yamlMappingValue(ours, key.Value), yamlMappingValue(theirs, key.Value))
+			conflicts = append(conflicts, found...)
+			if child != nil {
+				merged.Content = append(merged.Content, key, child)
+			}
+		}
+		return merged, conflicts
+	}
+
+	// 长度一致的列表逐项合并，否则整体视为一个值
+	if isYAMLKind(ours, yaml.SequenceNode) && isYAMLKind(theirs, yaml.SequenceNode) &&
+		len(ours.Content) == len(theirs.Content) && (base == nil || (base.Kind == yaml.SequenceNode && len(base.Content) == len(ours.Content))) {
+		merged := &yaml.Node{Kind: yaml.SequenceNode, Tag: ours.Tag, Style: ours.Style}
+		var conflicts []MergeConflict
+		for i := range ours.Content {
+			var b *yaml.Node
+			if base != nil {
+				b = base.Content[i]
+			}
+			child, found := mergeYAMLNodes(fmt.Sprintf("%s[%d]", path, i), b, ours.Content[i], theirs.Content[i])
+			conflicts = append(conflicts, found...)
+			if child != nil {
+				merged.Content = append(merged.Content, child)
+			}
+		}
+		return merged, conflicts
+	}
+
+	conflict := MergeConflict{Field: path, Base: mergeValueOrNil(bv), Ours: mergeValueOrNil(ov), Theirs: mergeValueOrNil(tv)}
+	// 一方删除一方修改时保留修改，避免丢数据
+	if ours == nil {
+		return theirs, []MergeConflict{conflict}
+	}
+	return ours, []MergeConflict{conflict}
+}
+
+func isYAMLKind(node *yaml.Node, kind yaml.Kind) bool {
+	return node != nil && node.Kind == kind
+}
+
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if !isYAMLKind(node, yaml.MappingNode) {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// yamlMappingKeys lists our keys in order, followed by keys only present on their side.
+func yamlMappingKeys(ours, theirs *yaml.Node) []*yaml.Node {
+	seen := make(map[string]struct{})
+	keys := make([]*yaml.Node, 0, len(ours.Content)/2)
+	for _, node := range []*yaml.Node{ours, theirs} {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if _, ok := seen[key.Value]; ok {
+				continue
+			}
+			seen[key.Value] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// maxLineDiffCells bounds the LCS table; larger inputs fall back to a single hunk.
+const maxLineDiffCells = 4_000_000
+
+// lineHunk replaces base[start:end) with lines.
+type lineHunk struct {
+	start, end int
+	lines      []string
+}
+
+// mergeTextLines performs a line-based diff3 merge. Conflicting regions are emitted with
+// git-style markers and reported by base line range.
+func mergeTextLines(base, ours, theirs string) (string, []MergeConflict) {
+	switch {
+	case ours == theirs, theirs == base:
+		return ours, nil
+	case ours == base:
+		return theirs, nil
+	}
+
+	baseLines := strings.Split(base, "\n")
+	oursHunks := diffLines(baseLines, strings.Split(ours, "\n"))
+	theirsHunks := diffLines(baseLines, strings.Split(theirs, "\n"))
+
+	type sideHunk struct {
+		lineHunk
+		ours bool
+	}
+	all := make([]sideHunk, 0, len(oursHunks)+len(theirsHunks))
+	for _, h := range oursHunks {
+		all = append(all, sideHunk{h, true})
+	}
+	for _, h := range theirsHunks {
+		all = append(all, sideHunk{h, false})
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].start < all[j].start })
+
+	var out []string
+	var conflicts []MergeConflict
+	pos := 0
+	for i := 0; i < len(all); {
+		start, end := all[i].start, all[i].end
+		var oursPart, theirsPart []lineHunk
+		j := i
+		for ; j < len(all); j++ {
+			h := all[j]
+			if j > i && !(h.start < end || h.start == start || (h.start == end && h.start == h.end)) {
+				break
+			}
+			if h.end > end {
+				end = h.end
+			}
+			if h.ours {
+				oursPart = append(oursPart, h.lineHunk)
+			} else {
+				theirsPart = append(theirsPart, h.lineHunk)
+			}
+		}
+		i = j
+
+		out = append(out, baseLines[pos:start]...)
+		pos = end
+		switch {
+		case len(theirsPart) == 0:
+			out = append(out, applyLineHunks(baseLines, start, end, oursPart)...)
+		case len(oursPart) == 0:
+			out = append(out, applyLineHunks(baseLines, start, end, theirsPart)...)
+		default:
+			oursRegion := applyLineHunks(baseLines, start, end, oursPart)
+			theirsRegion := applyLineHunks(baseLines, start, end, theirsPart)
+			if reflect.DeepEqual(oursRegion, theirsRegion) {
+				out = append(out, oursRegion...)
+				continue
+			}
+			conflicts = append(conflicts, MergeConflict{
+				Field:  fmt.Sprintf("content.lines[%d-%d]", start+1, max(end, start+1)),
+				Base:   strings.Join(baseLines[start:end], "\n"),
+				Ours:   strings.Join(oursRegion, "\n"),
+				Theirs: strings.Join(theirsRegion, "\n"),
+			})
+			out = append(out, "<<<<<<< ours")
+			out = append(out, oursRegion...)
+			out = append(out, "=======")
+			out = append(out, theirsRegion...)
+			out = append(out, ">>>>>>> theirs")
+		}
+	}
+	out = append(out, baseLines[pos:]...)
+	return strings.Join(out, "\n"), conflicts
+}
+
+func applyLineHunks(base []string, start, end int, hunks []lineHunk) []string {
+	out := make([]string, 0, end-start)
+	pos := start
+	for _, h := range hunks {
+		out = append(out, base[pos:h.start]...)
+		out = append(out, h.lines...)
+		pos = h.end
+	}
+	return append(out, base[pos:end]...)
+}
+
+// diffLines returns the hunks that turn base into other, based on a longest common subsequence.
+func diffLines(base, other []string) []lineHunk {
+	// 先去掉公共前后缀，缩小 LCS 表
+	prefix := 0
+	for prefix < len(base) && prefix < len(other) && base[prefix] == other[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(base)-prefix && suffix < len(other)-prefix && base[len(base)-1-suffix] == other[len(other)-1-suffix] {
+		suffix++
+	}
+	b := base[prefix : len(base)-suffix]
+	o := other[prefix : len(other)-suffix]
+	if len(b) == 0 && len(o) == 0 {
+		return nil
+	}
+	if len(b)*len(o) > maxLineDiffCells {
+		return []lineHunk{{start: prefix, end: prefix + len(b), lines: o}}
+	}
+
+	n, m := len(b), len(o)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if b[i] == o[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var hunks []lineHunk
+	open := false
+	hb, ho := 0, 0
+	flush := func(i, j int) {
+		if open {
+			hunks = append(hunks, lineHunk{start: prefix + hb, end: prefix + i, lines: o[ho:j]})
+			open = false
+		}
+	}
+	i, j := 0, 0
+	for i < n || j < m {
+		if i < n && j < m && b[i] == o[j] {
+			flush(i, j)
+			i++
+			j++
+			continue
+		}
+		if !open {
+			open, hb, ho = true, i, j
+		}
+		if j >= m || (i < n && lcs[i+1][j] >= lcs[i][j+1]) {
+			i++
+		} else {
+			j++
+		}
+	}
+	flush(n, m)
+	return hunks
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+// versionedFakeNDR serves historical versions for merge tests.
+type versionedFakeNDR struct {
+	*fakeNDR
+	versions map[int]ndrclient.DocumentVersion
+}
+
+func (f *versionedFakeNDR) GetDocumentVersion(_ context.Context, _ ndrclient.RequestMeta, docID int64, versionNumber int) (ndrclient.DocumentVersion, error) {
+	v, ok := f.versions[versionNumber]
+	if !ok {
+		return ndrclient.DocumentVersion{}, errors.New("version not found")
+	}
+	v.DocumentID = docID
+	v.VersionNumber = versionNumber
+	return v, nil
+}
+
+const mergeBaseYAML = "---\nid: 0\n---\n\ntitle: |-\n  <p>题干</p>\nanalysis: |-\n  <p>解析</p>\ndetails:\n  - no: 1\n    answer: A\n    score: 10\n"
+
+func newMergeFixture(currentData string) (*Service, *versionedFakeNDR) {
+	fake := &versionedFakeNDR{
+		fakeNDR: newFakeNDR(),
+		versions: map[int]ndrclient.DocumentVersion{
+			3: {Title: "Case", Content: map[string]any{"format": "yaml", "data": mergeBaseYAML}, Metadata: map[string]any{"difficulty": float64(2)}},
+		},
+	}
+	version := 4
+	docType := "case_analysis_v1"
+	fake.getDocResp = ndrclient.Document{
+		ID:       9,
+		Title:    "Case",
+		Version:  &version,
+		Type:     &docType,
+		Content:  map[string]any{"format": "yaml", "data": currentData},
+		Metadata: map[string]any{"difficulty": float64(2)},
+	}
+	fake.updateDocResp = ndrclient.Document{ID: 9}
+	return NewService(cache.NewNoop(), fake, nil), fake
+}
+
+func TestUpdateDocumentRejectsStaleVersion(t *testing.T) {
+	svc, fake := newMergeFixture(mergeBaseYAML)
+	stale := 3
+	title := "New"
+
+	_, err := svc.UpdateDocument(context.Background(), RequestMeta{}, 9, DocumentUpdateRequest{Title: &title, ExpectedVersion: &stale})
+	var conflict *DocumentVersionConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, ErrDocumentVersionConflict) {
+		t.Fatalf("expected version conflict, got %v", err)
+	}
+	if conflict.Expected != 3 || *conflict.Current.Version != 4 {
+		t.Fatalf("unexpected conflict details: %+v", conflict)
+	}
+	if len(fake.updatedDocs) != 0 {
+		t.Fatalf("stale update must not reach NDR")
+	}
+
+	fresh := 4
+	if _, err := svc.UpdateDocument(context.Background(), RequestMeta{}, 9, DocumentUpdateRequest{Title: &title, ExpectedVersion: &fresh}); err != nil {
+		t.Fatalf("expected update at current version to succeed, got %v", err)
+	}
+	if len(fake.updatedDocs) != 1 {
+		t.Fatalf("expected one upstream update, got %d", len(fake.updatedDocs))
+	}
+	if len(svc.docLocks) != 0 {
+		t.Fatalf("expected write locks to be released, %d left", len(svc.docLocks))
+	}
+}
+
+func TestMergeDocumentCombinesIndependentYAMLEdits(t *testing.T) {
+	theirs := strings.Replace(mergeBaseYAML, "<p>解析</p>", "<p>新解析</p>", 1)
+	svc, fake := newMergeFixture(theirs)
+	ours := strings.Replace(mergeBaseYAML, "answer: A", "answer: B", 1)
+
+	result, err := svc.MergeDocument(context.Background(), RequestMeta{}, 9, DocumentMergeRequest{
+		BaseVersion: 3,
+		Content:     map[string]any{"format": "yaml", "data": ours},
+		Apply:       true,
+	})
+	if err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	if len(result.Conflicts) != 0 {
+		t.Fatalf("expected clean merge, got %+v", result.Conflicts)
+	}
+	merged := result.Content["data"].(string)
+	for _, want := range []string{"<p>新解析</p>", "answer: B", "---\nid: 0\n---\n\n", "title: |-"} {
+		if !strings.Contains(merged, want) {
+			t.Fatalf("merged content missing %q:\n%s", want, merged)
+		}
+	}
+	if !result.Applied || len(fake.updatedDocs) != 1 {
+		t.Fatalf("expected merge to be applied once")
+	}
+}
+
+func TestMergeDocumentReportsYAMLFieldConflicts(t *testing.T) {
+	svc, fake := newMergeFixture(strings.Replace(mergeBaseYAML, "answer: A", "answer: C", 1))
+	ours := strings.Replace(mergeBaseYAML, "answer: A", "answer: B", 1)
+
+	result, err := svc.MergeDocument(context.Background(), RequestMeta{}, 9, DocumentMergeRequest{
+		BaseVersion: 3,
+		Content:     map[string]any{"format": "yaml", "data": ours},
+		Apply:       true,
+	})
+	if !errors.Is(err, ErrMergeConflict) {
+		t.Fatalf("expected ErrMergeConflict, got %v", err)
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Field != "content.details[0].answer" {
+		t.Fatalf("unexpected conflicts: %+v", result.Conflicts)
+	}
+	if result.Conflicts[0].Ours != "B" || result.Conflicts[0].Theirs != "C" || result.Conflicts[0].Base != "A" {
+		t.Fatalf("unexpected conflict values: %+v", result.Conflicts[0])
+	}
+	if len(fake.updatedDocs) != 0 {
+		t.Fatalf("conflicting merge must not be applied")
+	}
+}
+
+func TestMergeTextLines(t *testing.T) {
+	base := "# 标题\n\n第一段\n\n第二段\n"
+	ours := "# 新标题\n\n第一段\n\n第二段\n"
+	theirs := "# 标题\n\n第一段\n\n第二段（修订）\n"
+
+	merged, conflicts := mergeTextLines(base, ours, theirs)
+	if len(conflicts) != 0 || merged != "# 新标题\n\n第一段\n\n第二段（修订）\n" {
+		t.Fatalf("unexpected clean merge result %q %+v", merged, conflicts)
+	}
+
+	merged, conflicts = mergeTextLines(base, "# 标题\n\n第一段 A\n\n第二段\n", "# 标题\n\n第一段 B\n\n第二段\n")
+	if len(conflicts) != 1 || conflicts[0].Field != "content.lines[3-3]" {
+		t.Fatalf("expected one conflict on line 3, got %+v", conflicts)
+	}
+	if !strings.Contains(merged, "<<<<<<< ours\n第一段 A\n=======\n第一段 B\n>>>>>>> theirs") {
+		t.Fatalf("expected conflict markers, got %q", merged)
+	}
+}
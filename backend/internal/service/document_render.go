@@ -0,0 +1,174 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+// RenderedDocument is the sanitized HTML representation of a single document.
+type RenderedDocument struct {
+	DocumentID int64         `json:"document_id"`
+	Title      string        `json:"title"`
+	Type       string        `json:"type,omitempty"`
+	Format     ContentFormat `json:"format"`
+	Theme      string        `json:"theme,omitempty"`
+	HTML       string        `json:"html"`
+	CSS        string        `json:"css,omitempty"`
+}
+
+// ErrUnknownDocumentTheme is returned when the requested theme is not configured for the type.
+var ErrUnknownDocumentTheme = errors.New("unknown document theme")
+
+// markdownRenderer keeps raw HTML so that the sanitizer, not goldmark, decides what survives.
+var markdownRenderer = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+)
+
+func renderMarkdown(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdownRenderer.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RenderDocument returns sanitized HTML for any document. theme selects one of the
+// stylesheets configured for the type in doc-types/config.yaml; empty means unstyled.
+func (s *Service) RenderDocument(ctx context.Context, meta RequestMeta, docID int64, theme string) (RenderedDocument, error) {
+	doc, err := s.ndr.GetDocument(ctx, toNDRMeta(meta), docID)
+	if err != nil {
+		return RenderedDocument{}, err
+	}
+	return renderDocument(doc, theme)
+}
+
+func renderDocument(doc ndrclient.Document, theme string) (RenderedDocument, error) {
+	format, data := documentContentParts(doc)
+	var docType DocumentType
+	if doc.Type != nil {
+		docType = DocumentType(*doc.Type)
+	}
+	if format == "" {
+		format = string(GetContentFormat(docType))
+	}
+
+	result := RenderedDocument{
+		DocumentID: doc.ID,
+		Title:      doc.Title,
+		Type:       string(docType),
+		Format:     ContentFormat(format),
+	}
+	policy := htmlPolicyFor(docType, result.Format)
+
+	var fragment string
+	switch result.Format {
+	case ContentFormatMarkdown:
+		rendered, err := renderMarkdown(data)
+		if err != nil {
+			return RenderedDocument{}, fmt.Errorf("render markdown: %w", err)
+		}
+		fragment = sanitizeHTML(policy, rendered)
+	case ContentFormatHTML:
+		_, body := splitFrontMatter(data)
+		fragment = sanitizeHTML(policy, body)
+	case ContentFormatYAML:
+		rendered, err := renderYAMLDocument(docType, data)
+		if err != nil {
+			return RenderedDocument{}, err
+		}
+		fragment = rendered
+	default:
+		return RenderedDocument{}, fmt.Errorf("unsupported content format %q", format)
+	}
+
+	if theme == "" {
+		result.HTML = fragment
+		return result, nil
+	}
+	selected, ok := findDocumentTheme(docType, theme)
+	if !ok {
+		return RenderedDocument{}, fmt.Errorf("%w %q for document type %s", ErrUnknownDocumentTheme, theme, docType)
+	}
+	// 与前端预览使用相同的类名结构，主题 CSS 可直接复用
+	result.Theme = selected.ID
+	result.CSS = selected.CSS
+	result.HTML = fmt.Sprintf(`<div class="overview-theme-wrapper overview-theme-%s"><div class="html-preview-content">%s</div></div>`,
+		template.HTMLEscapeString(selected.ID), fragment)
+	return result, nil
+}
+
+// renderYAMLDocument renders question types through the paper templates with answers
+// included; other YAML types are shown as escaped source.
+func renderYAMLDocument(docType DocumentType, data string) (string, error) {
+	if !IsQuestionDocumentType(string(docType)) {
+		_, body := splitFrontMatter(data)
+		return "<pre>" + template.HTMLEscapeString(body) + "</pre>", nil
+	}
+	question, err := buildPaperQuestion(docType, data)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := documentQuestionTemplate.Execute(&buf, question); err != nil {
+		return "", fmt.Errorf("render question: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func findDocumentTheme(docType DocumentType, id string) (DocumentTypeTheme, bool) {
+	def, ok := documentTypeDefinitions[docType]
+	if !ok {
+		return DocumentTypeTheme{}, false
+	}
+	for _, theme := range def.Themes {
+		if theme.ID == id {
+			return theme, true
+		}
+	}
+	return DocumentTypeTheme{}, false
+}
+
+// StandalonePage wraps the rendered fragment in a complete HTML page with the theme stylesheet inlined.
+func (r RenderedDocument) StandalonePage() (string, error) {
+	var buf bytes.Buffer
+	err := documentPageTemplate.Execute(&buf, struct {
+		Title string
+		CSS   template.CSS
+		Body  template.HTML
+	}{
+		Title: r.Title,
+		// 主题 CSS 来自仓库内的 doc-types 配置，正文已经过净化
+		CSS:  template.CSS(r.CSS),
+		Body: template.HTML(r.HTML),
+	})
+	if err != nil {
+		return "", fmt.Errorf("render page: %w", err)
+	}
+	return buf.String(), nil
+}
+
+var documentQuestionTemplate = template.Must(template.Must(paperTemplate.Clone()).New("document").Parse(
+	`<div class="document-question">{{template "question" .}}<div class="document-answer">{{template "answer" .}}</div></div>`))
+
+var documentPageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+{{if .CSS}}<style>{{.CSS}}</style>{{end}}
+</head>
+<body>
+{{.Body}}
+</body>
+</html>
+`))
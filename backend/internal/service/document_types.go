@@ -5,6 +5,8 @@ package service
 import (
 	"fmt"
 	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
 // DocumentType defines the type of document content.
@@ -25,12 +27,21 @@ type DocumentContent struct {
 	Data   string        `json:"data"`
 }
 
+// DocumentTypeTheme is a stylesheet that can be applied when rendering a document type.
+type DocumentTypeTheme struct {
+	ID          string
+	Label       string
+	Description string
+	CSS         string
+}
+
 // DocumentTypeDefinition captures configuration information for a document type.
 type DocumentTypeDefinition struct {
 	ID            DocumentType
 	Label         string
 	ContentFormat ContentFormat
 	TemplatePath  string
+	Themes        []DocumentTypeTheme
 }
 
 var (
@@ -154,9 +165,22 @@ func ValidateDocumentMetadata(metadata map[string]any) error {
 
 	// Validate tags if present
 	if tagsVal, hasTags := metadata["tags"]; hasTags {
-		if _, ok := tagsVal.([]interface{}); !ok {
+		tags, ok := tagsVal.([]interface{})
+		if !ok {
 			return fmt.Errorf("tags must be an array")
 		}
+		for i, tagVal := range tags {
+			tag, ok := tagVal.(string)
+			if !ok {
+				return fmt.Errorf("tags[%d] must be a string", i)
+			}
+			if strings.TrimSpace(tag) == "" {
+				return fmt.Errorf("tags[%d] must not be empty", i)
+			}
+			if utf8.RuneCountInString(tag) > MaxTagNameLength {
+				return fmt.Errorf("tags[%d] exceeds %d characters", i, MaxTagNameLength)
+			}
+		}
 	}
 
 	// Validate references if present
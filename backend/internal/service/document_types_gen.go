@@ -38,6 +38,35 @@ func init() {
 			Label: "知识点概览(v1)",
 			ContentFormat: ContentFormatHTML,
 			TemplatePath: "../../../doc-types/knowledge_overview_v1/template.html",
+			Themes: []DocumentTypeTheme{
+				{
+					ID: "classic",
+					Label: "经典蓝",
+					CSS: ".overview-theme-classic .html-preview-content {\n  background: #ffffff;\n  border-radius: 12px;\n  padding: 24px;\n  box-shadow: 0 10px 30px rgba(24, 144, 255, 0.08);\n}\n.overview-theme-classic .html-preview-content .yjxt-content-card {\n  border: 1px solid rgba(24, 144, 255, 0.12);\n  box-shadow: 0 4px 16px rgba(24, 144, 255, 0.08);\n}\n.overview-theme-classic .html-preview-content .yjxt-card-title {\n  color: #177ddc;\n  border-bottom: 2px solid rgba(23, 125, 220, 0.2);\n}\n.overview-theme-classic .html-preview-content .yjxt-section-title {\n  border-bottom: 2px solid rgba(23, 125, 220, 0.2);\n  color: #0c66c2;\n}\n",
+				},
+				{
+					ID: "warm",
+					Label: "暖色晨曦",
+					CSS: ".overview-theme-warm .html-preview-content {\n  background: linear-gradient(135deg, #fff7f0, #fffefd);\n  border-radius: 16px;\n  padding: 28px;\n  box-shadow: 0 12px 32px rgba(255, 125, 0, 0.08);\n}\n.overview-theme-warm .html-preview-content .yjxt-content-card {\n  background: rgba(255, 255, 255, 0.88);\n  border: 1px solid rgba(255, 140, 0, 0.15);\n  box-shadow: 0 4px 18px rgba(255, 140, 0, 0.12);\n}\n.overview-theme-warm .html-preview-content .yjxt-card-title {\n  color: #d46b08;\n  border-bottom: 2px solid rgba(212, 107, 8, 0.2);\n}\n.overview-theme-warm .html-preview-content .yjxt-section-title {\n  color: #ad4e00;\n  border-bottom: 2px solid rgba(173, 78, 0, 0.2);\n}\n.overview-theme-warm .html-preview-content .yjxt-point-title,\n.overview-theme-warm .html-preview-content h2 {\n  color: #ad4e00;\n}\n",
+				},
+				{
+					ID: "night",
+					Label: "夜间沉浸",
+					CSS: ".overview-theme-night .html-preview-content {\n  background: linear-gradient(135deg, #20293a, #101522);\n  border-radius: 16px;\n  padding: 28px;\n  color: #f5f7fa;\n  box-shadow: 0 16px 36px rgba(15, 23, 42, 0.45);\n}\n.overview-theme-night .html-preview-content .yjxt-content-card {\n  background: rgba(15, 23, 42, 0.9);\n  border: 1px solid rgba(148, 163, 184, 0.2);\n  box-shadow: 0 6px 20px rgba(15, 23, 42, 0.45);\n}\n.overview-theme-night .html-preview-content .yjxt-card-title,\n.overview-theme-night .html-preview-content .yjxt-section-title,\n.overview-theme-night .html-preview-content .yjxt-point-title {\n  color: #60a5fa;\n  border-bottom: 1px solid rgba(96, 165, 250, 0.3);\n}\n.overview-theme-night .html-preview-content .yjxt-summary-list li::before,\n.overview-theme-night .html-preview-content .yjxt-advice-content li::before,\n.overview-theme-night .html-preview-content .yjxt-bullet-list li::before {\n  background: #60a5fa;\n}\n.overview-theme-night .html-preview-content p,\n.overview-theme-night .html-preview-content li {\n  color: #e2e8f0;\n}\n",
+				},
+				{
+					ID: "glass",
+					Label: "玻璃拟态",
+					Description: "半透明蓝紫色，强调高光与模糊",
+					CSS: "/* 玻璃拟态主题：柔和蓝紫色调，配合高斯模糊 */\n.overview-theme-glass {\n  background: linear-gradient(135deg, rgba(59, 130, 246, 0.08), rgba(147, 51, 234, 0.08));\n  padding: 12px;\n  border-radius: 20px;\n  backdrop-filter: blur(18px);\n}\n\n.overview-theme-glass .html-preview-content {\n  background: rgba(255, 255, 255, 0.65);\n  backdrop-filter: blur(24px);\n  border-radius: 18px;\n  padding: 28px;\n  box-shadow: 0 20px 45px rgba(79, 70, 229, 0.18);\n  border: 1px solid rgba(79, 70, 229, 0.15);\n}\n\n.overview-theme-glass .html-preview-content .yjxt-content-card {\n  border-radius: 16px;\n  border: 1px solid rgba(59, 130, 246, 0.18);\n  background: rgba(255, 255, 255, 0.85);\n  box-shadow: 0 12px 28px rgba(59, 130, 246, 0.12);\n}\n\n.overview-theme-glass .html-preview-content .yjxt-card-title {\n  color: #3b82f6;\n  border-bottom: 2px solid rgba(59, 130, 246, 0.3);\n}\n\n.overview-theme-glass .html-preview-content .yjxt-section-title {\n  color: #6d28d9;\n  border-bottom: 2px solid rgba(109, 40, 217, 0.25);\n}\n\n.overview-theme-glass .html-preview-content p,\n.overview-theme-glass .html-preview-content li {\n  color: rgba(31, 41, 55, 0.86);\n}\n",
+				},
+				{
+					ID: "forest",
+					Label: "竹林墨韵",
+					Description: "墨绿色调，适合国风内容",
+					CSS: "/* 森林墨绿主题：偏国风的竹林墨韵 */\n.overview-theme-forest {\n  background: linear-gradient(135deg, rgba(15, 118, 110, 0.12), rgba(22, 163, 74, 0.12));\n  padding: 16px;\n  border-radius: 18px;\n}\n\n.overview-theme-forest .html-preview-content {\n  background: #f8fdf8;\n  border-radius: 14px;\n  padding: 26px;\n  border: 1px solid rgba(22, 163, 74, 0.25);\n  box-shadow: 0 16px 32px rgba(22, 101, 52, 0.12);\n}\n\n.overview-theme-forest .html-preview-content .yjxt-content-card {\n  border-radius: 12px;\n  border: 1px solid rgba(22, 101, 52, 0.18);\n  background: rgba(255, 255, 255, 0.95);\n  box-shadow: 0 8px 20px rgba(15, 118, 110, 0.1);\n}\n\n.overview-theme-forest .html-preview-content .yjxt-card-title {\n  color: #256f43;\n  border-bottom: 2px solid rgba(37, 111, 67, 0.28);\n}\n\n.overview-theme-forest .html-preview-content .yjxt-section-title {\n  color: #14532d;\n  border-bottom: 2px solid rgba(20, 83, 45, 0.22);\n}\n\n.overview-theme-forest .html-preview-content p,\n.overview-theme-forest .html-preview-content li {\n  color: rgba(22, 83, 55, 0.9);\n}\n\n.overview-theme-forest .html-preview-content .yjxt-bullet-list li::before,\n.overview-theme-forest .html-preview-content .yjxt-advice-content li::before {\n  background: #16a34a;\n}\n",
+				},
+			},
 		},
 	}
 	documentTypeOrder = []DocumentType{
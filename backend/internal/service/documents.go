@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/yjxt/ydms/backend/internal/ndrclient"
@@ -22,6 +23,9 @@ type DocumentCreateRequest struct {
 	Content  map[string]any `json:"content,omitempty"`
 	Type     *string        `json:"type,omitempty"`
 	Position *int           `json:"position,omitempty"`
+	// NodeID binds the new document to this node. Tags are then normalized against the
+	// node's course when the document is created, so binding does not write a second version.
+	NodeID *int64 `json:"node_id,omitempty"`
 }
 
 // ListDocuments fetches a paginated list of documents from NDR.
@@ -101,10 +105,28 @@ func (s *Service) CreateDocument(ctx context.Context, meta RequestMeta, payload
 		}
 	}
 
+	// Reject markup the renderer would strip (scripts, event handlers, javascript: URLs)
+	if err := ValidateDocumentHTML(payload.Content, stringValue(payload.Type)); err != nil {
+		return ndrclient.Document{}, fmt.Errorf("invalid content: %w", err)
+	}
+
 	// Validate metadata
 	if err := ValidateDocumentMetadata(payload.Metadata); err != nil {
 		return ndrclient.Document{}, fmt.Errorf("invalid metadata: %w", err)
 	}
+	// Documents created into a node take the tag vocabulary of that node's course; unbound
+	// documents only have their tags cleaned and are mapped once they are bound.
+	var courses []int64
+	if payload.NodeID != nil && s.tags != nil {
+		courseID, err := s.categoryRootID(ctx, meta, *payload.NodeID)
+		if err != nil {
+			return ndrclient.Document{}, fmt.Errorf("resolve course of node %d: %w", *payload.NodeID, err)
+		}
+		courses = []int64{courseID}
+	}
+	if err := s.normalizeTagsForCourses(courses, payload.Metadata); err != nil {
+		return ndrclient.Document{}, fmt.Errorf("load tag registry: %w", err)
+	}
 
 	body := ndrclient.DocumentCreate{
 		Title:    payload.Title,
@@ -115,17 +137,48 @@ func (s *Service) CreateDocument(ctx context.Context, meta RequestMeta, payload
 	}
 
 	// If no position is specified, NDR will assign the next available position automatically
-	return s.ndr.CreateDocument(ctx, toNDRMeta(meta), body)
+	doc, err := s.ndr.CreateDocument(ctx, toNDRMeta(meta), body)
+	if err != nil {
+		return ndrclient.Document{}, err
+	}
+	if payload.NodeID != nil {
+		if err := s.ndr.BindDocument(ctx, toNDRMeta(meta), *payload.NodeID, doc.ID); err != nil {
+			// Do not leave an unbound copy behind when the caller asked for a bound document
+			if delErr := s.ndr.DeleteDocument(ctx, toNDRMeta(meta), doc.ID); delErr != nil {
+				log.Printf("[documents] remove document=%d after failed bind: %v", doc.ID, delErr)
+			}
+			return ndrclient.Document{}, fmt.Errorf("bind document %d to node %d: %w", doc.ID, *payload.NodeID, err)
+		}
+	}
+	// Course subscribers learn about new documents from document.bound.
+	s.publish(meta, EventDocumentCreated, nil, documentEvent{Document: &doc})
+	if payload.NodeID != nil {
+		s.publish(meta, EventDocumentBound, s.nodeCourses(ctx, meta, *payload.NodeID), documentEvent{ID: doc.ID, NodeID: *payload.NodeID})
+	}
+	return doc, nil
 }
 
-// BindDocument associates a document with a specific node.
+// BindDocument associates a document with a specific node. When the binding adds a course
+// whose vocabulary changes the document's tags, the tags are rewritten through UpdateDocument;
+// a rejected rewrite (locked or reviewed document) is returned after the binding is kept.
 func (s *Service) BindDocument(ctx context.Context, meta RequestMeta, nodeID, docID int64) error {
-	return s.ndr.BindDocument(ctx, toNDRMeta(meta), nodeID, docID)
+	if err := s.ndr.BindDocument(ctx, toNDRMeta(meta), nodeID, docID); err != nil {
+		return err
+	}
+	s.publish(meta, EventDocumentBound, s.nodeCourses(ctx, meta, nodeID), documentEvent{ID: docID, NodeID: nodeID})
+	if err := s.retagDocument(ctx, meta, docID); err != nil {
+		return fmt.Errorf("document %d was bound to node %d but its tags were not normalized: %w", docID, nodeID, err)
+	}
+	return nil
 }
 
 // UnbindDocument removes the binding between a node and a document.
 func (s *Service) UnbindDocument(ctx context.Context, meta RequestMeta, nodeID, docID int64) error {
-	return s.ndr.UnbindDocument(ctx, toNDRMeta(meta), nodeID, docID)
+	if err := s.ndr.UnbindDocument(ctx, toNDRMeta(meta), nodeID, docID); err != nil {
+		return err
+	}
+	s.publish(meta, EventDocumentUnbound, s.nodeCourses(ctx, meta, nodeID), documentEvent{ID: docID, NodeID: nodeID})
+	return nil
 }
 
 // GetDocument fetches a single document by ID.
@@ -133,19 +186,58 @@ func (s *Service) GetDocument(ctx context.Context, meta RequestMeta, docID int64
 	return s.ndr.GetDocument(ctx, toNDRMeta(meta), docID)
 }
 
-// DeleteDocument performs a soft delete on the document.
+// DeleteDocument performs a soft delete on the document. Documents locked by another
+// user, or whose review state forbids the caller from editing them, are rejected.
 func (s *Service) DeleteDocument(ctx context.Context, meta RequestMeta, docID int64) error {
-	return s.ndr.DeleteDocument(ctx, toNDRMeta(meta), docID)
+	if err := s.checkDocumentEditable(meta, docID); err != nil {
+		return err
+	}
+	courses := s.documentCourses(ctx, meta, docID)
+	if err := s.ndr.DeleteDocument(ctx, toNDRMeta(meta), docID); err != nil {
+		return err
+	}
+	s.publish(meta, EventDocumentDeleted, courses, documentEvent{ID: docID})
+	return nil
 }
 
-// RestoreDocument restores a previously soft-deleted document.
+// RestoreDocument restores a previously soft-deleted document. It is rejected like
+// DeleteDocument when another user holds the lock or the review state forbids edits.
 func (s *Service) RestoreDocument(ctx context.Context, meta RequestMeta, docID int64) (ndrclient.Document, error) {
+	if err := s.checkDocumentEditable(meta, docID); err != nil {
+		return ndrclient.Document{}, err
+	}
 	return s.ndr.RestoreDocument(ctx, toNDRMeta(meta), docID)
 }
 
-// PurgeDocument permanently removes a document.
+// PurgeDocument permanently removes a document, subject to the same checks as DeleteDocument.
+// Review, lock and comment records of the document are removed along with it.
 func (s *Service) PurgeDocument(ctx context.Context, meta RequestMeta, docID int64) error {
-	return s.ndr.PurgeDocument(ctx, toNDRMeta(meta), docID)
+	if err := s.checkDocumentEditable(meta, docID); err != nil {
+		return err
+	}
+	if err := s.ndr.PurgeDocument(ctx, toNDRMeta(meta), docID); err != nil {
+		return err
+	}
+	s.purgeDocumentRecords(docID)
+	return nil
+}
+
+// purgeDocumentRecords drops the local records of a purged document. NDR has already
+// removed the document, so failures are logged instead of failing the purge.
+func (s *Service) purgeDocumentRecords(docID int64) {
+	var errs []error
+	if s.reviews != nil {
+		errs = append(errs, s.reviews.purge(docID))
+	}
+	if s.editLocks != nil {
+		errs = append(errs, s.editLocks.purge(docID))
+	}
+	if s.comments != nil {
+		errs = append(errs, s.comments.purge(docID))
+	}
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("[documents] purge records of document=%d failed: %v", docID, err)
+	}
 }
 
 // GetDocumentBindingStatus returns the binding status of a document.
@@ -160,6 +252,9 @@ type DocumentUpdateRequest struct {
 	Metadata map[string]any `json:"metadata,omitempty"`
 	Type     *string        `json:"type,omitempty"`
 	Position *int           `json:"position,omitempty"`
+	// ExpectedVersion enables optimistic concurrency: the update is rejected with
+	// DocumentVersionConflictError unless the document is still at this version.
+	ExpectedVersion *int `json:"version_number,omitempty"`
 }
 
 // UpdateDocument updates an existing document upstream.
@@ -178,11 +273,22 @@ func (s *Service) UpdateDocument(ctx context.Context, meta RequestMeta, docID in
 		}
 	}
 
+	if err := ValidateDocumentHTML(payload.Content, stringValue(payload.Type)); err != nil {
+		return ndrclient.Document{}, fmt.Errorf("invalid content: %w", err)
+	}
+
 	// Validate metadata if provided
 	if payload.Metadata != nil {
 		if err := ValidateDocumentMetadata(payload.Metadata); err != nil {
 			return ndrclient.Document{}, fmt.Errorf("invalid metadata: %w", err)
 		}
+		if err := s.normalizeMetadataTags(ctx, meta, docID, payload.Metadata); err != nil {
+			return ndrclient.Document{}, err
+		}
+	}
+
+	if err := s.checkDocumentEditable(meta, docID); err != nil {
+		return ndrclient.Document{}, err
 	}
 
 	body := ndrclient.DocumentUpdate{
@@ -192,7 +298,83 @@ func (s *Service) UpdateDocument(ctx context.Context, meta RequestMeta, docID in
 		Type:     payload.Type,
 		Position: payload.Position,
 	}
-	return s.ndr.UpdateDocument(ctx, toNDRMeta(meta), docID, body)
+	if payload.ExpectedVersion == nil {
+		doc, err := s.ndr.UpdateDocument(ctx, toNDRMeta(meta), docID, body)
+		if err != nil {
+			return ndrclient.Document{}, err
+		}
+		s.publish(meta, EventDocumentUpdated, s.documentCourses(ctx, meta, docID), documentEvent{Document: &doc})
+		return doc, nil
+	}
+
+	// NDR has no conditional update, so the version check and the write are serialized
+	// per document within this process only; concurrent writers on other instances can
+	// still interleave between the check and the write.
+	unlock := s.lockDocumentWrite(docID)
+	defer unlock()
+
+	current, err := s.ndr.GetDocument(ctx, toNDRMeta(meta), docID)
+	if err != nil {
+		return ndrclient.Document{}, err
+	}
+	if current.Version != nil && *current.Version != *payload.ExpectedVersion {
+		return ndrclient.Document{}, &DocumentVersionConflictError{Expected: *payload.ExpectedVersion, Current: current}
+	}
+	doc, err := s.ndr.UpdateDocument(ctx, toNDRMeta(meta), docID, body)
+	if err != nil {
+		return ndrclient.Document{}, err
+	}
+	s.publish(meta, EventDocumentUpdated, s.documentCourses(ctx, meta, docID), documentEvent{Document: &doc})
+	return doc, nil
+}
+
+// documentWriteLock serializes conditional updates of one document. refs counts the
+// holder and the waiters so the entry can be dropped once nobody uses it.
+type documentWriteLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockDocumentWrite locks docID for a conditional update and returns the unlock function.
+func (s *Service) lockDocumentWrite(docID int64) func() {
+	s.docLocksMu.Lock()
+	if s.docLocks == nil {
+		s.docLocks = make(map[int64]*documentWriteLock)
+	}
+	lock := s.docLocks[docID]
+	if lock == nil {
+		lock = &documentWriteLock{}
+		s.docLocks[docID] = lock
+	}
+	lock.refs++
+	s.docLocksMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+		s.docLocksMu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(s.docLocks, docID)
+		}
+		s.docLocksMu.Unlock()
+	}
+}
+
+// checkDocumentEditable rejects writes to documents that are locked by another user or
+// whose review state forbids the caller's role from editing them.
+func (s *Service) checkDocumentEditable(meta RequestMeta, docID int64) error {
+	if err := s.checkReviewState(meta, docID); err != nil {
+		return err
+	}
+	return s.checkDocumentLock(meta, docID)
+}
+
+func stringValue(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
 }
 
 // ErrInvalidDocumentReorder indicates the reorder payload is invalid.
@@ -264,7 +446,13 @@ func (s *Service) ReorderDocuments(ctx context.Context, meta RequestMeta, req Do
 		payload.Type = outboundType
 	}
 
-	return s.ndr.ReorderDocuments(ctx, toNDRMeta(meta), payload)
+	docs, err := s.ndr.ReorderDocuments(ctx, toNDRMeta(meta), payload)
+	if err != nil {
+		return nil, err
+	}
+	// Reordering happens within one node, so the first document's bindings identify the course.
+	s.publish(meta, EventDocumentReordered, s.documentCourses(ctx, meta, req.OrderedIDs[0]), map[string]any{"ordered_ids": req.OrderedIDs})
+	return docs, nil
 }
 
 func extractIDFilter(query url.Values) map[int64]struct{} {
@@ -415,7 +603,15 @@ func (s *Service) GetDocumentVersionDiff(ctx context.Context, meta RequestMeta,
 
 // RestoreDocumentVersion restores a document to a specific version.
 func (s *Service) RestoreDocumentVersion(ctx context.Context, meta RequestMeta, docID int64, versionNumber int) (ndrclient.Document, error) {
-	return s.ndr.RestoreDocumentVersion(ctx, toNDRMeta(meta), docID, versionNumber)
+	if err := s.checkDocumentEditable(meta, docID); err != nil {
+		return ndrclient.Document{}, err
+	}
+	doc, err := s.ndr.RestoreDocumentVersion(ctx, toNDRMeta(meta), docID, versionNumber)
+	if err != nil {
+		return ndrclient.Document{}, err
+	}
+	s.publish(meta, EventDocumentVersionRestored, s.documentCourses(ctx, meta, docID), documentEvent{Document: &doc})
+	return doc, nil
 }
 
 // DocumentReference represents a reference to another document stored in metadata.
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+// 变更事件类型
+const (
+	EventCategoryCreated         = "category.created"
+	EventCategoryUpdated         = "category.updated"
+	EventCategoryMoved           = "category.moved"
+	EventCategoryReordered       = "category.reordered"
+	EventCategoryDeleted         = "category.deleted"
+	EventCategoryRestored        = "category.restored"
+	EventDocumentCreated         = "document.created"
+	EventDocumentUpdated         = "document.updated"
+	EventDocumentDeleted         = "document.deleted"
+	EventDocumentBound           = "document.bound"
+	EventDocumentUnbound         = "document.unbound"
+	EventDocumentReordered       = "document.reordered"
+	EventDocumentVersionRestored = "document.version_restored"
+	EventDocumentCommented       = "document.commented"
+)
+
+// EventTypes 全部事件类型，用于校验订阅条件
+var EventTypes = []string{
+	EventCategoryCreated, EventCategoryUpdated, EventCategoryMoved, EventCategoryReordered,
+	EventCategoryDeleted, EventCategoryRestored,
+	EventDocumentCreated, EventDocumentUpdated, EventDocumentDeleted, EventDocumentBound,
+	EventDocumentUnbound, EventDocumentReordered, EventDocumentVersionRestored, EventDocumentCommented,
+}
+
+// DefaultEventBufferSize 重放缓冲区保留的事件数
+const DefaultEventBufferSize = 1024
+
+// subscriberQueueSize 每个订阅者未发送事件的上限，超出后断开该订阅者，由客户端携带 Last-Event-ID 重连补齐
+const subscriberQueueSize = 256
+
+// Event 一条分类或文档变更事件
+type Event struct {
+	ID        uint64    `json:"id"`
+	Type      string    `json:"type"`
+	Courses   []int64   `json:"courses,omitempty"` // 受影响的课程（根节点），为空时仅超级管理员可见
+	Actor     string    `json:"actor,omitempty"`
+	RequestID string    `json:"request_id,omitempty"` // 触发变更的请求 ID，客户端可据此忽略自己的操作
+	Time      time.Time `json:"time"`
+	Data      any       `json:"data"`
+}
+
+// EventBroker 进程内事件分发，保留最近的事件用于断线重放
+type EventBroker struct {
+	mu          sync.Mutex
+	lastID      uint64
+	buffer      []Event // 环形缓冲区
+	start       int     // buffer 中最早事件的下标
+	size        int
+	subscribers map[*EventSubscription]struct{}
+	hooks       []func(Event)
+	closed      bool
+}
+
+// EventSubscription 一个事件订阅；C 关闭表示订阅者过慢被断开或服务正在关闭
+type EventSubscription struct {
+	C      <-chan Event
+	LastID uint64 // 订阅时最新的事件 ID
+	ch     chan Event
+}
+
+// NewEventBroker 创建事件分发器，bufferSize 为重放缓冲区大小
+func NewEventBroker(bufferSize int) *EventBroker {
+	if bufferSize <= 0 {
+		bufferSize = DefaultEventBufferSize
+	}
+	return &EventBroker{
+		buffer:      make([]Event, bufferSize),
+		subscribers: make(map[*EventSubscription]struct{}),
+	}
+}
+
+// AddHook 注册在每个事件发布后同步调用的函数（在发布者的 goroutine 中、锁外执行），
+// 用于需要可靠接收全部事件的消费者，例如 webhook 投递队列
+func (b *EventBroker) AddHook(hook func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hooks = append(b.hooks, hook)
+}
+
+// Publish 分配事件 ID、写入缓冲区并发送给所有订阅者
+func (b *EventBroker) Publish(event Event) Event {
+	event, hooks := b.dispatch(event)
+	for _, hook := range hooks {
+		hook(event)
+	}
+	return event
+}
+
+func (b *EventBroker) dispatch(event Event) (Event, []func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event.ID = b.lastID
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if b.size < len(b.buffer) {
+		b.buffer[(b.start+b.size)%len(b.buffer)] = event
+		b.size++
+	} else {
+		b.buffer[b.start] = event
+		b.start = (b.start + 1) % len(b.buffer)
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub.ch <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+	return event, b.hooks
+}
+
+// Subscribe 注册订阅者。lastEventID 非 nil 时同时返回其后仍在缓冲区中的事件；
+// complete 为 false 表示中间有事件已被淘汰（或 ID 来自重启前的进程），客户端需要重新加载
+func (b *EventBroker) Subscribe(lastEventID *uint64) (sub *EventSubscription, replay []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberQueueSize)
+	sub = &EventSubscription{C: ch, LastID: b.lastID, ch: ch}
+	if b.closed {
+		close(ch)
+	} else {
+		b.subscribers[sub] = struct{}{}
+	}
+
+	if lastEventID == nil {
+		return sub, nil, true
+	}
+	after := *lastEventID
+	if after > b.lastID {
+		return sub, nil, false
+	}
+	oldest := b.lastID - uint64(b.size) + 1
+	complete = after+1 >= oldest
+	for i := 0; i < b.size; i++ {
+		event := b.buffer[(b.start+i)%len(b.buffer)]
+		if event.ID > after {
+			replay = append(replay, event)
+		}
+	}
+	return sub, replay, complete
+}
+
+// Unsubscribe 注销订阅者
+func (b *EventBroker) Unsubscribe(sub *EventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Close 断开所有订阅者并拒绝新的订阅，在 HTTP 服务关闭时调用，避免长连接阻塞优雅退出
+func (b *EventBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// SetEventBroker 启用变更事件发布
+func (s *Service) SetEventBroker(broker *EventBroker) {
+	s.events = broker
+}
+
+// Events 返回事件分发器，未启用时为 nil
+func (s *Service) Events() *EventBroker {
+	return s.events
+}
+
+// EventFilter 返回判断事件对当前用户是否可见的函数：超级管理员可见全部，
+// 其他角色（含未知或为空的角色）只能看到涉及其授权课程的事件
+func (s *Service) EventFilter(meta RequestMeta) (func(Event) bool, error) {
+	if meta.UserRole == "super_admin" {
+		return func(Event) bool { return true }, nil
+	}
+	if s.userService == nil || meta.UserIDNumeric == 0 {
+		return func(Event) bool { return false }, nil
+	}
+	courses, err := s.userService.GetUserCourses(meta.UserIDNumeric)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[int64]bool, len(courses))
+	for _, id := range courses {
+		allowed[id] = true
+	}
+	return func(event Event) bool {
+		for _, id := range event.Courses {
+			if allowed[id] {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func (s *Service) publish(meta RequestMeta, eventType string, courses []int64, data any) {
+	if s.events == nil {
+		return
+	}
+	s.events.Publish(Event{
+		Type:      eventType,
+		Courses:   courses,
+		Actor:     meta.UserID,
+		RequestID: meta.RequestID,
+		Data:      data,
+	})
+}
+
+// nodeCourses 解析节点所属的课程，未启用事件时不访问 NDR；解析失败的节点被忽略
+func (s *Service) nodeCourses(ctx context.Context, meta RequestMeta, nodeIDs ...int64) []int64 {
+	if s.events == nil {
+		return nil
+	}
+	courses := make([]int64, 0, 1)
+	for _, id := range nodeIDs {
+		rootID, err := s.categoryRootID(ctx, meta, id)
+		if err != nil {
+			log.Printf("[events] resolve course failed node=%d err=%v", id, err)
+			continue
+		}
+		if !containsInt(courses, rootID) {
+			courses = append(courses, rootID)
+		}
+	}
+	return courses
+}
+
+// categoryCourses 新建或移动后的节点所属课程：根节点即课程本身，否则沿父节点解析
+func (s *Service) categoryCourses(ctx context.Context, meta RequestMeta, category *Category) []int64 {
+	if s.events == nil {
+		return nil
+	}
+	if category.ParentID == nil {
+		return []int64{category.ID}
+	}
+	return s.nodeCourses(ctx, meta, *category.ParentID)
+}
+
+// documentCourses 通过文档绑定的节点解析其所属课程
+func (s *Service) documentCourses(ctx context.Context, meta RequestMeta, docIDs ...int64) []int64 {
+	if s.events == nil {
+		return nil
+	}
+	var nodeIDs []int64
+	for _, docID := range docIDs {
+		status, err := s.ndr.GetDocumentBindingStatus(ctx, toNDRMeta(meta), docID)
+		if err != nil {
+			log.Printf("[events] resolve bindings failed document=%d err=%v", docID, err)
+			continue
+		}
+		nodeIDs = append(nodeIDs, status.NodeIDs...)
+	}
+	return s.nodeCourses(ctx, meta, nodeIDs...)
+}
+
+// documentEvent 文档事件携带的数据
+type documentEvent struct {
+	Document *ndrclient.Document `json:"document,omitempty"`
+	ID       int64               `json:"id,omitempty"`
+	NodeID   int64               `json:"node_id,omitempty"`
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+)
+
+func TestEventBrokerReplay(t *testing.T) {
+	broker := NewEventBroker(3)
+	for i := 0; i < 5; i++ {
+		broker.Publish(Event{Type: EventCategoryCreated})
+	}
+
+	// 缓冲区保留 3..5：从 2 之后补发完整，从 1 之后已缺失
+	last := uint64(2)
+	sub, replay, complete := broker.Subscribe(&last)
+	if !complete || len(replay) != 3 || replay[0].ID != 3 || replay[2].ID != 5 {
+		t.Fatalf("unexpected replay complete=%v events=%+v", complete, replay)
+	}
+	broker.Unsubscribe(sub)
+	last = 1
+	if _, _, complete := broker.Subscribe(&last); complete {
+		t.Fatalf("expected evicted events to be reported")
+	}
+	// 重启前的事件 ID 大于当前最新 ID
+	last = 99
+	if sub, _, complete := broker.Subscribe(&last); complete || sub.LastID != 5 {
+		t.Fatalf("expected unknown id to require a reset, got complete=%v last=%d", complete, sub.LastID)
+	}
+
+	live, _, _ := broker.Subscribe(nil)
+	published := broker.Publish(Event{Type: EventDocumentUpdated})
+	if event := <-live.C; event.ID != published.ID || event.ID != 6 {
+		t.Fatalf("expected live event 6, got %+v", event)
+	}
+
+	// 跟不上的订阅者被断开
+	for i := 0; i <= subscriberQueueSize; i++ {
+		broker.Publish(Event{Type: EventDocumentUpdated})
+	}
+	drained := 0
+	for range live.C {
+		drained++
+	}
+	if drained != subscriberQueueSize {
+		t.Fatalf("expected slow subscriber to be dropped after %d events, got %d", subscriberQueueSize, drained)
+	}
+
+	broker.Close()
+	if closed, _, _ := broker.Subscribe(nil); closed != nil {
+		if _, ok := <-closed.C; ok {
+			t.Fatalf("expected subscriptions after Close to be closed")
+		}
+	}
+}
+
+func TestServicePublishesCourseScopedEvents(t *testing.T) {
+	userService := NewUserService(setupUserDB(t))
+	editor, _ := userService.CreateUser("dave", "Secret-pass-9", "course_admin", nil)
+	userService.GrantCoursePermission(editor.ID, 1)
+
+	fake := newCopySourceNDR()
+	now := time.Now().UTC()
+	fake.addNode(sampleNode(5, "Other", "/other", nil, 1, now, now))
+	svc := NewService(cache.NewNoop(), fake, userService)
+	broker := NewEventBroker(16)
+	svc.SetEventBroker(broker)
+	sub, _, _ := broker.Subscribe(nil)
+	meta := RequestMeta{UserID: "alice", RequestID: "req-1"}
+
+	created, err := svc.CreateCategory(context.Background(), meta, CategoryCreateRequest{Name: "Chapter 2", ParentID: ptr(int64(1))})
+	if err != nil {
+		t.Fatalf("CreateCategory: %v", err)
+	}
+	event := <-sub.C
+	if event.Type != EventCategoryCreated || len(event.Courses) != 1 || event.Courses[0] != 1 || event.Actor != "alice" || event.RequestID != "req-1" {
+		t.Fatalf("unexpected created event %+v", event)
+	}
+	if data, ok := event.Data.(*Category); !ok || data.ID != created.ID {
+		t.Fatalf("expected created category as payload, got %#v", event.Data)
+	}
+
+	// 跨课程移动：原课程与目标课程都能收到
+	fake.updateResp = sampleNode(2, "Chapter 1", "/other/chapter-1", ptr(int64(5)), 0, now, now)
+	if _, err := svc.MoveCategory(context.Background(), meta, 2, MoveCategoryRequest{NewParentID: ptr(int64(5)), ParentSpecified: true}); err != nil {
+		t.Fatalf("MoveCategory: %v", err)
+	}
+	event = <-sub.C
+	if event.Type != EventCategoryMoved || len(event.Courses) != 2 || !containsInt(event.Courses, 1) || !containsInt(event.Courses, 5) {
+		t.Fatalf("unexpected moved event %+v", event)
+	}
+
+	if _, err := svc.RestoreDocumentVersion(context.Background(), meta, 10, 1); err != nil {
+		t.Fatalf("RestoreDocumentVersion: %v", err)
+	}
+	event = <-sub.C
+	if event.Type != EventDocumentVersionRestored || len(event.Courses) != 1 || event.Courses[0] != 1 {
+		t.Fatalf("unexpected version restored event %+v", event)
+	}
+
+	visible, err := svc.EventFilter(RequestMeta{UserRole: "course_admin", UserIDNumeric: editor.ID})
+	if err != nil {
+		t.Fatalf("EventFilter: %v", err)
+	}
+	if !visible(Event{Courses: []int64{5, 1}}) || visible(Event{Courses: []int64{5}}) || visible(Event{}) {
+		t.Fatalf("course admin must only see events of granted courses")
+	}
+	all, _ := svc.EventFilter(RequestMeta{UserRole: "super_admin"})
+	if !all(Event{}) {
+		t.Fatalf("super admin must see every event")
+	}
+	for _, role := range []string{"", "auditor"} {
+		filtered, err := svc.EventFilter(RequestMeta{UserRole: role, UserIDNumeric: editor.ID})
+		if err != nil || filtered(Event{Courses: []int64{5}}) || !filtered(Event{Courses: []int64{1}}) {
+			t.Fatalf("role %q must only see events of granted courses", role)
+		}
+	}
+}
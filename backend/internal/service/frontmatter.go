@@ -0,0 +1,48 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const frontMatterDelimiter = "---"
+
+// splitFrontMatter separates a leading `---` delimited YAML block from the document body.
+// Content without front matter is returned unchanged with an empty header.
+func splitFrontMatter(data string) (string, string) {
+	normalized := strings.ReplaceAll(data, "\r\n", "\n")
+	if !strings.HasPrefix(normalized, frontMatterDelimiter+"\n") {
+		return "", normalized
+	}
+	rest := normalized[len(frontMatterDelimiter)+1:]
+	end := strings.Index(rest, "\n"+frontMatterDelimiter)
+	if end == -1 {
+		return "", normalized
+	}
+	header := rest[:end]
+	body := rest[end+len(frontMatterDelimiter)+1:]
+	// 跳过结束分隔符所在行的剩余部分
+	if idx := strings.Index(body, "\n"); idx != -1 {
+		body = body[idx+1:]
+	} else {
+		body = ""
+	}
+	return header, strings.TrimLeft(body, "\n")
+}
+
+// parseYAMLDocument decodes the body of a YAML document (front matter stripped) into out.
+func parseYAMLDocument(data string, out any) (map[string]any, error) {
+	header, body := splitFrontMatter(data)
+	front := map[string]any{}
+	if strings.TrimSpace(header) != "" {
+		if err := yaml.Unmarshal([]byte(header), &front); err != nil {
+			return nil, fmt.Errorf("parse front matter: %w", err)
+		}
+	}
+	if err := yaml.Unmarshal([]byte(body), out); err != nil {
+		return nil, fmt.Errorf("parse yaml body: %w", err)
+	}
+	return front, nil
+}
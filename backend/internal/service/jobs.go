@@ -0,0 +1,555 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+var (
+	// ErrJobNotFound 任务不存在
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobFinished 任务已结束，无法取消
+	ErrJobFinished = errors.New("job has already finished")
+)
+
+// JobRunner 执行某一类后台任务
+// 步骤按顺序执行，每个步骤的结果持久化后才开始下一步；进程重启后从第一个未完成的步骤继续。
+type JobRunner interface {
+	// RunStep 执行单个步骤，返回值序列化后保存在步骤记录中
+	// 步骤失败时应自行撤销本步骤已产生的修改
+	RunStep(ctx context.Context, run *JobRun, step database.JobStep) (any, error)
+	// Finish 在全部步骤成功后执行收尾工作，返回值作为任务结果
+	Finish(ctx context.Context, run *JobRun, steps []database.JobStep) (any, error)
+	// Compensate 在任务失败或取消时撤销已成功步骤的修改（尽力而为）
+	Compensate(ctx context.Context, run *JobRun, steps []database.JobStep)
+}
+
+// JobRun 一次任务执行的上下文
+type JobRun struct {
+	Job  *database.Job
+	Meta RequestMeta // 发起者身份，NDR 凭据由 JobService 补齐
+}
+
+// Decode 解析任务参数
+func (r *JobRun) Decode(v any) error {
+	return json.Unmarshal([]byte(r.Job.Payload), v)
+}
+
+// DecodeStepResult 解析步骤结果
+func DecodeStepResult(step database.JobStep, v any) error {
+	return json.Unmarshal([]byte(step.Result), v)
+}
+
+// persistedMeta 持久化的发起者身份；API Key 等密钥不落库，执行时使用服务端配置
+type persistedMeta struct {
+	UserID        string `json:"user_id"`
+	RequestID     string `json:"request_id"`
+	UserRole      string `json:"user_role"`
+	UserIDNumeric uint   `json:"user_id_numeric"`
+}
+
+// encodeMeta 序列化请求身份（不含密钥）
+func encodeMeta(meta RequestMeta) (string, error) {
+	raw, err := json.Marshal(persistedMeta{
+		UserID:        meta.UserID,
+		RequestID:     meta.RequestID,
+		UserRole:      meta.UserRole,
+		UserIDNumeric: meta.UserIDNumeric,
+	})
+	return string(raw), err
+}
+
+// decodeMeta 还原请求身份，并补上服务端凭据；未记录用户时使用凭据中的默认用户
+func decodeMeta(raw string, credentials RequestMeta) (RequestMeta, error) {
+	meta := RequestMeta{APIKey: credentials.APIKey, AdminKey: credentials.AdminKey}
+	var stored persistedMeta
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+			return meta, err
+		}
+	}
+	meta.UserID = stored.UserID
+	meta.RequestID = stored.RequestID
+	meta.UserRole = stored.UserRole
+	meta.UserIDNumeric = stored.UserIDNumeric
+	if meta.UserID == "" {
+		meta.UserID = credentials.UserID
+	}
+	return meta, nil
+}
+
+// JobOptions worker 池配置
+type JobOptions struct {
+	Workers      int           // 并发执行的任务数
+	PollInterval time.Duration // 没有新任务通知时轮询数据库的间隔
+	Lease        time.Duration // 任务租约时长，worker 崩溃后租约过期即可被其他 worker 接管
+	MaxAttempts  int           // 最多被领取的次数（主动释放的不计），超过后判定失败
+}
+
+// DefaultJobOptions 返回默认的 worker 池配置
+func DefaultJobOptions() JobOptions {
+	return JobOptions{
+		Workers:      2,
+		PollInterval: 5 * time.Second,
+		Lease:        time.Minute,
+		MaxAttempts:  3,
+	}
+}
+
+// JobDetail 任务状态查询结果
+type JobDetail struct {
+	database.Job
+	Progress float64            `json:"progress"` // 0-1
+	Result   json.RawMessage    `json:"result,omitempty"`
+	Steps    []database.JobStep `json:"steps"`
+}
+
+// JobService 持久化的后台任务队列与 worker 池
+type JobService struct {
+	db          *gorm.DB
+	opts        JobOptions
+	workerID    string
+	credentials RequestMeta
+
+	mu      sync.RWMutex
+	runners map[string]JobRunner
+
+	wake      chan struct{}
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	closeOnce sync.Once
+}
+
+// NewJobService 创建任务服务，调用 Start 后开始执行任务
+func NewJobService(db *gorm.DB, opts JobOptions) *JobService {
+	defaults := DefaultJobOptions()
+	if opts.Workers <= 0 {
+		opts.Workers = defaults.Workers
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaults.PollInterval
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = defaults.Lease
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaults.MaxAttempts
+	}
+	hostname, _ := os.Hostname()
+	return &JobService{
+		db:       db,
+		opts:     opts,
+		workerID: fmt.Sprintf("%s/%s", hostname, uuid.NewString()[:8]),
+		runners:  make(map[string]JobRunner),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// SetCredentials 设置执行任务时访问 NDR 使用的凭据（API Key、Admin Key）
+func (s *JobService) SetCredentials(meta RequestMeta) {
+	s.credentials = meta
+}
+
+// Register 注册任务类型的执行器
+func (s *JobService) Register(kind string, runner JobRunner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runners[kind] = runner
+}
+
+func (s *JobService) runner(kind string) (JobRunner, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	runner, ok := s.runners[kind]
+	return runner, ok
+}
+
+// Enqueue 创建任务及其步骤，立即返回
+func (s *JobService) Enqueue(kind string, meta RequestMeta, payload any, stepKeys []string) (*database.Job, error) {
+	if _, ok := s.runner(kind); !ok {
+		return nil, fmt.Errorf("unknown job kind %q", kind)
+	}
+	if len(stepKeys) == 0 {
+		return nil, errors.New("job has no steps")
+	}
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode job payload: %w", err)
+	}
+	metaJSON, err := encodeMeta(meta)
+	if err != nil {
+		return nil, fmt.Errorf("encode job meta: %w", err)
+	}
+
+	job := &database.Job{
+		Kind:        kind,
+		Status:      database.JobQueued,
+		Payload:     string(payloadJSON),
+		Meta:        metaJSON,
+		StepsTotal:  len(stepKeys),
+		CreatedByID: meta.UserIDNumeric,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(job).Error; err != nil {
+			return err
+		}
+		steps := make([]database.JobStep, len(stepKeys))
+		for i, key := range stepKeys {
+			steps[i] = database.JobStep{JobID: job.ID, Seq: i, Key: key, Status: database.JobStepPending}
+		}
+		return tx.CreateInBatches(steps, 200).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create job: %w", err)
+	}
+
+	log.Printf("[jobs] enqueued job=%d kind=%s steps=%d", job.ID, kind, len(stepKeys))
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Get 查询任务状态、进度与步骤
+func (s *JobService) Get(id uint) (*JobDetail, error) {
+	var job database.Job
+	if err := s.db.First(&job, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrJobNotFound
+		}
+		return nil, err
+	}
+	var steps []database.JobStep
+	if err := s.db.Where("job_id = ?", id).Order("seq").Find(&steps).Error; err != nil {
+		return nil, err
+	}
+	detail := &JobDetail{Job: job, Steps: steps}
+	if job.StepsTotal > 0 {
+		detail.Progress = float64(job.StepsDone) / float64(job.StepsTotal)
+	}
+	if job.Result != "" {
+		detail.Result = json.RawMessage(job.Result)
+	}
+	return detail, nil
+}
+
+// Cancel 取消任务：排队中的任务直接取消；执行中的任务在当前步骤完成后停止并补偿已完成的步骤
+func (s *JobService) Cancel(id uint) (*JobDetail, error) {
+	now := time.Now()
+	res := s.db.Model(&database.Job{}).Where("id = ? AND status = ?", id, database.JobQueued).
+		Updates(map[string]interface{}{"status": database.JobCanceled, "cancel_requested": true, "finished_at": now})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		res = s.db.Model(&database.Job{}).Where("id = ? AND status = ?", id, database.JobRunning).
+			Update("cancel_requested", true)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			if _, err := s.Get(id); err != nil {
+				return nil, err
+			}
+			return nil, ErrJobFinished
+		}
+	}
+	return s.Get(id)
+}
+
+// Start 启动 worker 池；租约过期的执行中任务（例如进程崩溃或重启前未完成的任务）会被重新领取
+func (s *JobService) Start() {
+	s.startOnce.Do(func() {
+		for i := 0; i < s.opts.Workers; i++ {
+			s.wg.Add(1)
+			go s.worker()
+		}
+		log.Printf("[jobs] started %d workers id=%s", s.opts.Workers, s.workerID)
+	})
+}
+
+// Close 停止领取新任务，等待执行中的步骤完成；未完成的任务释放租约，下次启动后继续
+func (s *JobService) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *JobService) worker() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		// 连续执行直到没有可领取的任务
+		for {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			ran, err := s.RunNext(context.Background())
+			if err != nil {
+				log.Printf("[jobs] worker error: %v", err)
+				break
+			}
+			if !ran {
+				break
+			}
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunNext 领取并执行一个任务，没有可执行的任务时返回 false
+func (s *JobService) RunNext(ctx context.Context) (bool, error) {
+	job, err := s.claim()
+	if err != nil || job == nil {
+		return false, err
+	}
+	s.execute(ctx, job)
+	return true, nil
+}
+
+// claim 以条件更新的方式领取一个排队中或租约已过期的任务，多实例部署时不会重复执行
+func (s *JobService) claim() (*database.Job, error) {
+	now := time.Now()
+	var candidates []database.Job
+	err := s.db.Select("id", "status", "attempts").
+		Where("status = ? OR (status = ? AND (locked_until IS NULL OR locked_until < ?))", database.JobQueued, database.JobRunning, now).
+		Order("id").Limit(5).Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		query := s.db.Model(&database.Job{}).Where("id = ? AND status = ? AND attempts = ?", candidate.ID, candidate.Status, candidate.Attempts)
+		if candidate.Status == database.JobRunning {
+			query = query.Where("locked_until IS NULL OR locked_until < ?", now)
+		}
+		res := query.Updates(map[string]interface{}{
+			"status":       database.JobRunning,
+			"locked_by":    s.workerID,
+			"locked_until": now.Add(s.opts.Lease),
+			"attempts":     candidate.Attempts + 1,
+		})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue // 已被其他 worker 领取
+		}
+		var job database.Job
+		if err := s.db.First(&job, candidate.ID).Error; err != nil {
+			return nil, err
+		}
+		if job.StartedAt == nil {
+			job.StartedAt = &now
+			s.db.Model(&job).Update("started_at", now)
+		}
+		if job.Attempts > 1 {
+			log.Printf("[jobs] resuming job=%d kind=%s attempt=%d", job.ID, job.Kind, job.Attempts)
+		}
+		return &job, nil
+	}
+	return nil, nil
+}
+
+// execute 执行已领取的任务
+func (s *JobService) execute(ctx context.Context, job *database.Job) {
+	meta, err := decodeMeta(job.Meta, s.credentials)
+	if err != nil {
+		s.finish(job, database.JobFailed, nil, fmt.Errorf("decode job meta: %w", err))
+		return
+	}
+	run := &JobRun{Job: job, Meta: meta}
+
+	runner, ok := s.runner(job.Kind)
+	if !ok {
+		s.finish(job, database.JobFailed, nil, fmt.Errorf("unknown job kind %q", job.Kind))
+		return
+	}
+
+	// 执行期间定期续约
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+	go s.heartbeat(job.ID, heartbeatDone)
+
+	var steps []database.JobStep
+	if err := s.db.Where("job_id = ?", job.ID).Order("seq").Find(&steps).Error; err != nil {
+		s.release(job)
+		log.Printf("[jobs] load steps for job=%d failed: %v", job.ID, err)
+		return
+	}
+
+	if job.Attempts > s.opts.MaxAttempts {
+		s.abort(ctx, run, runner, steps, database.JobFailed, fmt.Errorf("job gave up after %d attempts", s.opts.MaxAttempts))
+		return
+	}
+
+	for i := range steps {
+		step := &steps[i]
+		if step.Status == database.JobStepSucceeded {
+			continue
+		}
+
+		// 每个步骤开始前检查取消请求与停机信号
+		var current database.Job
+		if err := s.db.Select("cancel_requested").First(&current, job.ID).Error; err != nil {
+			s.release(job)
+			log.Printf("[jobs] reload job=%d failed: %v", job.ID, err)
+			return
+		}
+		if current.CancelRequested {
+			s.abort(ctx, run, runner, steps, database.JobCanceled, errors.New("canceled by user"))
+			return
+		}
+		select {
+		case <-s.stop:
+			s.release(job)
+			log.Printf("[jobs] shutting down, job=%d paused at step %d/%d", job.ID, step.Seq+1, len(steps))
+			return
+		default:
+		}
+
+		startedAt := time.Now()
+		step.Status = database.JobStepRunning
+		step.StartedAt = &startedAt
+		s.db.Model(step).Updates(map[string]interface{}{"status": step.Status, "started_at": startedAt})
+
+		result, err := runner.RunStep(ctx, run, *step)
+		finishedAt := time.Now()
+		step.FinishedAt = &finishedAt
+		if err != nil {
+			step.Status = database.JobStepFailed
+			step.Error = err.Error()
+			s.db.Model(step).Updates(map[string]interface{}{"status": step.Status, "error": step.Error, "finished_at": finishedAt})
+			s.abort(ctx, run, runner, steps, database.JobFailed, fmt.Errorf("step %s: %w", step.Key, err))
+			return
+		}
+
+		encoded, err := json.Marshal(result)
+		if err != nil {
+			encoded = []byte("null")
+		}
+		step.Status = database.JobStepSucceeded
+		step.Result = string(encoded)
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(step).Updates(map[string]interface{}{
+				"status": step.Status, "result": step.Result, "error": "", "finished_at": finishedAt,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&database.Job{}).Where("id = ?", job.ID).Update("steps_done", gorm.Expr("steps_done + 1")).Error
+		})
+		if err != nil {
+			// 无法记录步骤结果时停止执行，租约过期后重新执行该步骤
+			log.Printf("[jobs] record step %s of job=%d failed: %v", step.Key, job.ID, err)
+			return
+		}
+	}
+
+	result, err := runner.Finish(ctx, run, steps)
+	if err != nil {
+		s.abort(ctx, run, runner, steps, database.JobFailed, err)
+		return
+	}
+	s.finish(job, database.JobSucceeded, result, nil)
+}
+
+// abort 补偿已成功的步骤并结束任务
+func (s *JobService) abort(ctx context.Context, run *JobRun, runner JobRunner, steps []database.JobStep, status string, cause error) {
+	succeeded := make([]database.JobStep, 0, len(steps))
+	for _, step := range steps {
+		if step.Status == database.JobStepSucceeded {
+			succeeded = append(succeeded, step)
+		}
+	}
+	if len(succeeded) > 0 {
+		runner.Compensate(context.WithoutCancel(ctx), run, succeeded)
+	}
+	s.finish(run.Job, status, nil, cause)
+}
+
+// finish 写入任务的最终状态并释放租约
+func (s *JobService) finish(job *database.Job, status string, result any, cause error) {
+	updates := map[string]interface{}{
+		"status":       status,
+		"finished_at":  time.Now(),
+		"locked_by":    "",
+		"locked_until": nil,
+	}
+	if result != nil {
+		if encoded, err := json.Marshal(result); err == nil {
+			updates["result"] = string(encoded)
+		}
+	}
+	if cause != nil {
+		updates["error"] = cause.Error()
+	}
+	if err := s.db.Model(&database.Job{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		log.Printf("[jobs] failed to record result of job=%d: %v", job.ID, err)
+		return
+	}
+	if cause != nil {
+		log.Printf("[jobs] job=%d kind=%s %s: %v", job.ID, job.Kind, status, cause)
+	} else {
+		log.Printf("[jobs] job=%d kind=%s %s", job.ID, job.Kind, status)
+	}
+}
+
+// release 释放租约但保持执行中状态，使任务可以立即被重新领取
+func (s *JobService) release(job *database.Job) {
+	// 主动释放（如正常停机）不计入领取次数，只有租约过期（进程崩溃）才消耗重试机会
+	err := s.db.Model(&database.Job{}).Where("id = ? AND locked_by = ?", job.ID, s.workerID).
+		Updates(map[string]interface{}{"locked_by": "", "locked_until": nil, "attempts": gorm.Expr("attempts - 1")}).Error
+	if err != nil {
+		log.Printf("[jobs] failed to release job=%d: %v", job.ID, err)
+	}
+}
+
+// heartbeat 在任务执行期间定期延长租约
+func (s *JobService) heartbeat(jobID uint, done <-chan struct{}) {
+	ticker := time.NewTicker(s.opts.Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			err := s.db.Model(&database.Job{}).
+				Where("id = ? AND status = ? AND locked_by = ?", jobID, database.JobRunning, s.workerID).
+				Update("locked_until", time.Now().Add(s.opts.Lease)).Error
+			if err != nil {
+				log.Printf("[jobs] failed to extend lease of job=%d: %v", jobID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+func setupJobDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&database.Job{}, &database.JobStep{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+// recordingRunner 记录执行过的步骤，在 failOn 步骤返回错误
+type recordingRunner struct {
+	ran         []string
+	compensated []string
+	failOn      string
+}
+
+func (r *recordingRunner) RunStep(ctx context.Context, run *JobRun, step database.JobStep) (any, error) {
+	if step.Key == r.failOn {
+		return nil, errors.New("boom")
+	}
+	r.ran = append(r.ran, step.Key)
+	return map[string]string{"done": step.Key}, nil
+}
+
+func (r *recordingRunner) Finish(ctx context.Context, run *JobRun, steps []database.JobStep) (any, error) {
+	return map[string]int{"steps": len(steps)}, nil
+}
+
+func (r *recordingRunner) Compensate(ctx context.Context, run *JobRun, steps []database.JobStep) {
+	for _, step := range steps {
+		r.compensated = append(r.compensated, step.Key)
+	}
+}
+
+func TestJobServiceResumesAfterCrash(t *testing.T) {
+	db := setupJobDB(t)
+	jobs := NewJobService(db, JobOptions{Lease: time.Minute})
+	runner := &recordingRunner{}
+	jobs.Register("test", runner)
+
+	job, err := jobs.Enqueue("test", RequestMeta{UserID: "alice", APIKey: "secret", UserIDNumeric: 7}, map[string]int{"n": 3}, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if stored, _ := jobs.Get(job.ID); stored.Status != database.JobQueued || stored.CreatedByID != 7 || stored.StepsTotal != 3 {
+		t.Fatalf("unexpected queued job: %+v", stored.Job)
+	}
+	var raw database.Job
+	db.First(&raw, job.ID)
+	if raw.Meta == "" || strings.Contains(raw.Meta, "secret") {
+		t.Fatalf("job meta must not persist credentials: %q", raw.Meta)
+	}
+
+	// 模拟进程在第一个步骤完成后崩溃：任务仍为 running，租约已过期
+	expired := time.Now().Add(-time.Second)
+	db.Model(&database.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"status": database.JobRunning, "locked_by": "crashed", "locked_until": expired, "attempts": 1, "steps_done": 1,
+	})
+	db.Model(&database.JobStep{}).Where("job_id = ? AND seq = 0", job.ID).Updates(map[string]interface{}{
+		"status": database.JobStepSucceeded, "result": `{"done":"a"}`,
+	})
+	db.Model(&database.JobStep{}).Where("job_id = ? AND seq = 1", job.ID).Update("status", database.JobStepRunning)
+
+	ran, err := jobs.RunNext(context.Background())
+	if err != nil || !ran {
+		t.Fatalf("expected expired job to be reclaimed: ran=%v err=%v", ran, err)
+	}
+	if len(runner.ran) != 2 || runner.ran[0] != "b" || runner.ran[1] != "c" {
+		t.Fatalf("expected only unfinished steps to run, got %v", runner.ran)
+	}
+
+	detail, err := jobs.Get(job.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if detail.Status != database.JobSucceeded || detail.Progress != 1 || detail.Attempts != 2 || string(detail.Result) != `{"steps":3}` {
+		t.Fatalf("unexpected finished job: %+v result=%s", detail.Job, detail.Result)
+	}
+	if ran, _ := jobs.RunNext(context.Background()); ran {
+		t.Fatalf("finished job must not be claimed again")
+	}
+}
+
+func TestJobServiceGracefulShutdownKeepsAttempts(t *testing.T) {
+	db := setupJobDB(t)
+	producer := NewJobService(db, JobOptions{Lease: time.Minute})
+	producer.Register("test", &recordingRunner{})
+	job, err := producer.Enqueue("test", RequestMeta{}, nil, []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	// 多次滚动发布：每次领取后立即收到停机信号并释放租约
+	for i := 0; i < 5; i++ {
+		jobs := NewJobService(db, JobOptions{Lease: time.Minute, MaxAttempts: 3})
+		jobs.Register("test", &recordingRunner{})
+		if err := jobs.Close(context.Background()); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if ran, err := jobs.RunNext(context.Background()); err != nil || !ran {
+			t.Fatalf("expected job to be claimed on deploy %d: ran=%v err=%v", i, ran, err)
+		}
+		if detail, _ := jobs.Get(job.ID); detail.Status != database.JobRunning || detail.Attempts != 0 {
+			t.Fatalf("released job must not consume an attempt: %+v", detail.Job)
+		}
+	}
+
+	jobs := NewJobService(db, JobOptions{Lease: time.Minute, MaxAttempts: 3})
+	runner := &recordingRunner{}
+	jobs.Register("test", runner)
+	if ran, err := jobs.RunNext(context.Background()); err != nil || !ran {
+		t.Fatalf("expected job to run: ran=%v err=%v", ran, err)
+	}
+	if detail, _ := jobs.Get(job.ID); detail.Status != database.JobSucceeded || len(runner.ran) != 2 {
+		t.Fatalf("expected job to succeed after graceful restarts: %+v ran=%v", detail.Job, runner.ran)
+	}
+}
+
+func TestJobServiceFailureAndCancel(t *testing.T) {
+	db := setupJobDB(t)
+	jobs := NewJobService(db, JobOptions{})
+	runner := &recordingRunner{failOn: "b"}
+	jobs.Register("test", runner)
+
+	if _, err := jobs.Enqueue("unknown", RequestMeta{}, nil, []string{"a"}); err == nil {
+		t.Fatalf("expected unknown kind to be rejected")
+	}
+
+	// 步骤失败：补偿已成功的步骤，后续步骤不再执行
+	job, _ := jobs.Enqueue("test", RequestMeta{}, nil, []string{"a", "b", "c"})
+	if _, err := jobs.RunNext(context.Background()); err != nil {
+		t.Fatalf("RunNext: %v", err)
+	}
+	detail, _ := jobs.Get(job.ID)
+	if detail.Status != database.JobFailed || detail.Steps[1].Status != database.JobStepFailed || detail.Steps[2].Status != database.JobStepPending {
+		t.Fatalf("unexpected failed job: %+v", detail)
+	}
+	if len(runner.compensated) != 1 || runner.compensated[0] != "a" {
+		t.Fatalf("expected step a to be compensated, got %v", runner.compensated)
+	}
+	if _, err := jobs.Cancel(job.ID); !errors.Is(err, ErrJobFinished) {
+		t.Fatalf("expected finished job cancel to fail, got %v", err)
+	}
+
+	// 排队中的任务直接取消，不会被执行
+	job, _ = jobs.Enqueue("test", RequestMeta{}, nil, []string{"x"})
+	if detail, err := jobs.Cancel(job.ID); err != nil || detail.Status != database.JobCanceled {
+		t.Fatalf("expected queued job to be canceled: %v", err)
+	}
+	if ran, _ := jobs.RunNext(context.Background()); ran {
+		t.Fatalf("canceled job must not run")
+	}
+
+	// 执行中的任务在下一个步骤前停止
+	runner.failOn = ""
+	runner.compensated = nil
+	job, _ = jobs.Enqueue("test", RequestMeta{}, nil, []string{"p", "q"})
+	db.Model(&database.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{"status": database.JobRunning, "cancel_requested": true})
+	db.Model(&database.JobStep{}).Where("job_id = ? AND seq = 0", job.ID).Updates(map[string]interface{}{"status": database.JobStepSucceeded, "result": "{}"})
+	if _, err := jobs.RunNext(context.Background()); err != nil {
+		t.Fatalf("RunNext: %v", err)
+	}
+	if detail, _ := jobs.Get(job.ID); detail.Status != database.JobCanceled || len(runner.compensated) != 1 {
+		t.Fatalf("expected running job to be canceled and compensated: %+v %v", detail.Job, runner.compensated)
+	}
+
+	if _, err := jobs.Get(9999); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestCategoryCopyJob(t *testing.T) {
+	newSource := func() *archiveFakeNDR {
+		fake := newCopySourceNDR()
+		now := time.Now().UTC()
+		fake.addNode(sampleNode(5, "Other", "/other", nil, 1, now, now))
+		exercise := sampleDocument(20, "Exercise", "markdown_v1", 0, now, now)
+		exercise.Content = map[string]any{"format": "markdown", "data": "E"}
+		exercise.Metadata = map[string]any{
+			"references": []any{map[string]any{"document_id": float64(10), "title": "Overview", "added_at": "2024-01-01T00:00:00Z"}},
+		}
+		fake.addDocument(5, exercise)
+		return fake
+	}
+
+	// 深拷贝两个源子树，跨子树的引用在收尾时改写
+	fake := newSource()
+	svc := NewService(cache.NewNoop(), fake, nil)
+	jobs := NewJobService(setupJobDB(t), JobOptions{})
+	svc.RegisterCategoryJobs(jobs)
+
+	if _, err := jobs.EnqueueBulkCopyCategories(RequestMeta{}, CategoryBulkCopyRequest{SourceIDs: []int64{1, 5}, Mode: "everything"}); err == nil {
+		t.Fatalf("expected invalid mode to be rejected at enqueue time")
+	}
+	job, err := jobs.EnqueueBulkCopyCategories(RequestMeta{}, CategoryBulkCopyRequest{SourceIDs: []int64{1, 5}, Mode: CategoryCopyDeepCopy})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if _, err := jobs.RunNext(context.Background()); err != nil {
+		t.Fatalf("RunNext: %v", err)
+	}
+	detail, _ := jobs.Get(job.ID)
+	if detail.Status != database.JobSucceeded || detail.StepsDone != 2 {
+		t.Fatalf("unexpected job: %+v", detail.Job)
+	}
+	var overviewCopy, exerciseCopy ndrclient.Document
+	for id, doc := range fake.docs {
+		if id > 1000 && doc.Title == "Overview" {
+			overviewCopy = doc
+		}
+		if id > 1000 && doc.Title == "Exercise" {
+			exerciseCopy = doc
+		}
+	}
+	refs, _ := exerciseCopy.Metadata["references"].([]any)
+	if len(refs) != 1 || refs[0].(map[string]any)["document_id"] != overviewCopy.ID {
+		t.Fatalf("cross-subtree reference should point to the copied overview: %v", exerciseCopy.Metadata)
+	}
+
+	// 第二个源失败时回滚第一个源已复制的节点与文档
+	failing := &copyFailingNDR{archiveFakeNDR: newSource(), failBindNode: "Other"}
+	svc = NewService(cache.NewNoop(), failing, nil)
+	jobs = NewJobService(setupJobDB(t), JobOptions{})
+	svc.RegisterCategoryJobs(jobs)
+	job, _ = jobs.EnqueueBulkCopyCategories(RequestMeta{}, CategoryBulkCopyRequest{SourceIDs: []int64{1, 5}, Mode: CategoryCopyDeepCopy})
+	if _, err := jobs.RunNext(context.Background()); err != nil {
+		t.Fatalf("RunNext: %v", err)
+	}
+	detail, _ = jobs.Get(job.ID)
+	if detail.Status != database.JobFailed {
+		t.Fatalf("expected job to fail, got %+v", detail.Job)
+	}
+	// 第一个源：2 个节点、2 个文档；第二个源：1 个节点、1 个文档
+	if len(failing.deletedNodes) != 3 || len(failing.deletedDocIDs) != 3 {
+		t.Fatalf("expected all copies to be rolled back, nodes=%v docs=%v", failing.deletedNodes, failing.deletedDocIDs)
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockoutPolicy 登录失败锁定策略
+type LockoutPolicy struct {
+	MaxUserFailures int           // 同一用户名在窗口内允许的失败次数（<=0 表示不限制）
+	MaxIPFailures   int           // 同一 IP 在窗口内允许的失败次数（<=0 表示不限制）
+	Window          time.Duration // 失败计数窗口
+	Duration        time.Duration // 锁定时长
+}
+
+// DefaultLockoutPolicy 默认锁定策略
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxUserFailures: 5,
+		MaxIPFailures:   20,
+		Window:          15 * time.Minute,
+		Duration:        15 * time.Minute,
+	}
+}
+
+// LoginLockedError 登录因失败次数过多被临时锁定
+type LoginLockedError struct {
+	Scope string    // user 或 ip
+	Until time.Time // 锁定截止时间
+}
+
+func (e *LoginLockedError) Error() string {
+	if e.Scope == database.LoginThrottleIP {
+		return "too many failed login attempts from this address, try again later"
+	}
+	return "account temporarily locked due to too many failed login attempts"
+}
+
+// RetryAfter 距离解锁还需等待的时间
+func (e *LoginLockedError) RetryAfter(now time.Time) time.Duration {
+	return e.Until.Sub(now)
+}
+
+// Login 带失败计数与锁定的登录认证
+// ip 为空时仅按用户名计数
+func (s *UserService) Login(username, password, ip string) (*database.User, error) {
+	now := s.now()
+	userKey := strings.ToLower(strings.TrimSpace(username))
+
+	// 已锁定时不再校验密码，避免继续猜测
+	if err := s.checkLoginLock(database.LoginThrottleIP, ip, now); err != nil {
+		return nil, err
+	}
+	if err := s.checkLoginLock(database.LoginThrottleUser, userKey, now); err != nil {
+		return nil, err
+	}
+
+	user, err := s.Authenticate(username, password)
+	if err != nil {
+		if !errors.Is(err, ErrInvalidCredentials) {
+			return nil, err
+		}
+		// 不存在的用户名同样计数，避免通过锁定行为枚举用户
+		s.recordLoginFailure(database.LoginThrottleUser, userKey, s.lockoutPolicy.MaxUserFailures, now)
+		s.recordLoginFailure(database.LoginThrottleIP, ip, s.lockoutPolicy.MaxIPFailures, now)
+		return nil, err
+	}
+
+	// 登录成功清除该用户名的失败计数（IP 计数保留，防止用一个有效账号重置）
+	if err := s.db.Where("scope = ? AND key = ?", database.LoginThrottleUser, userKey).
+		Delete(&database.LoginThrottle{}).Error; err != nil {
+		log.Printf("failed to reset login failures for %s: %v", userKey, err)
+	}
+	return user, nil
+}
+
+// checkLoginLock 检查指定维度是否处于锁定状态
+func (s *UserService) checkLoginLock(scope, key string, now time.Time) error {
+	if key == "" {
+		return nil
+	}
+	var throttle database.LoginThrottle
+	err := s.db.Where("scope = ? AND key = ?", scope, key).First(&throttle).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("failed to load login throttle %s:%s: %v", scope, key, err)
+		}
+		return nil
+	}
+	if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+		return &LoginLockedError{Scope: scope, Until: *throttle.LockedUntil}
+	}
+	return nil
+}
+
+// recordLoginFailure 累加失败次数，达到上限时写入锁定截止时间
+func (s *UserService) recordLoginFailure(scope, key string, limit int, now time.Time) {
+	if key == "" || limit <= 0 {
+		return
+	}
+	if err := s.addLoginFailure(scope, key, limit, now); err != nil {
+		log.Printf("failed to record login failure %s:%s: %v", scope, key, err)
+	}
+}
+
+func (s *UserService) addLoginFailure(scope, key string, limit int, now time.Time) error {
+	windowStart := now.Add(-s.lockoutPolicy.Window)
+	table := database.LoginThrottle{}.TableName()
+
+	// 以 upsert 方式原子累加；窗口过期或锁定已结束时重新计数
+	expired := fmt.Sprintf("%[1]s.window_start < ? OR (%[1]s.locked_until IS NOT NULL AND %[1]s.locked_until <= ?)", table)
+	row := database.LoginThrottle{Scope: scope, Key: key, Failures: 1, WindowStart: now, UpdatedAt: now}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "scope"}, {Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":     gorm.Expr("CASE WHEN "+expired+" THEN 1 ELSE "+table+".failures + 1 END", windowStart, now),
+			"window_start": gorm.Expr("CASE WHEN "+expired+" THEN ? ELSE "+table+".window_start END", windowStart, now, now),
+			"locked_until": gorm.Expr("CASE WHEN "+expired+" THEN NULL ELSE "+table+".locked_until END", windowStart, now),
+			"updated_at":   now,
+		}),
+	}).Create(&row).Error
+	if err != nil {
+		return err
+	}
+
+	// 达到上限后锁定（只锁定一次，锁定期间不再延长）
+	lockedUntil := now.Add(s.lockoutPolicy.Duration)
+	result := s.db.Model(&database.LoginThrottle{}).
+		Where("scope = ? AND key = ? AND failures >= ? AND locked_until IS NULL", scope, key, limit).
+		Updates(map[string]interface{}{
+			"locked_until": lockedUntil,
+			"lock_count":   gorm.Expr("lock_count + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("login locked: %s=%s until %s", scope, key, lockedUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// UnlockUser 清除用户的登录失败计数与锁定状态
+func (s *UserService) UnlockUser(userID uint) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	return s.db.Where("scope = ? AND key = ?", database.LoginThrottleUser, strings.ToLower(user.Username)).
+		Delete(&database.LoginThrottle{}).Error
+}
+
+// GetUserLockout 获取用户当前的锁定截止时间（未锁定时返回 nil）
+func (s *UserService) GetUserLockout(username string) (*time.Time, error) {
+	var throttle database.LoginThrottle
+	err := s.db.Where("scope = ? AND key = ?", database.LoginThrottleUser, strings.ToLower(username)).First(&throttle).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if throttle.LockedUntil == nil || !throttle.LockedUntil.After(s.now()) {
+		return nil, nil
+	}
+	return throttle.LockedUntil, nil
+}
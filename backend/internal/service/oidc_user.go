@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"gorm.io/gorm"
+)
+
+// ErrOIDCUserNotProvisioned 外部身份没有对应的 YDMS 账号且未开启自动创建
+var ErrOIDCUserNotProvisioned = errors.New("no YDMS account is linked to this identity")
+
+// ssoPasswordHash 通过单点登录自动创建的用户的占位密码哈希，任何密码都无法匹配
+const ssoPasswordHash = "!sso"
+
+// OIDCProvisioning 外部身份到本地用户的映射规则
+type OIDCProvisioning struct {
+	UsernameClaim string // 作为用户名的声明，默认 preferred_username
+	LinkExisting  bool   // 首次登录时绑定已有账号（要求已验证的邮箱与用户名一致，管理员账号除外）
+	AutoProvision bool   // 没有对应账号时自动创建
+	DefaultRole   string // 自动创建账号的角色，默认 proofreader
+}
+
+// ResolveOIDCUser 根据已验证的外部身份查找或创建本地用户
+// 已绑定的身份按 issuer + subject 匹配，不受用户名变更影响
+func (s *UserService) ResolveOIDCUser(identity *auth.OIDCIdentity, opts OIDCProvisioning) (*database.User, error) {
+	now := s.now()
+
+	// 1. 已绑定的身份
+	var link database.UserIdentity
+	err := s.db.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).First(&link).Error
+	if err == nil {
+		user, err := s.GetUserByID(link.UserID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrOIDCUserNotProvisioned
+			}
+			return nil, err
+		}
+		if user.Disabled {
+			return nil, ErrUserDisabled
+		}
+		s.db.Model(&link).Update("last_login_at", now)
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// 2. 从声明中取得用户名
+	claim := opts.UsernameClaim
+	if claim == "" {
+		claim = "preferred_username"
+	}
+	username := strings.TrimSpace(identity.Claim(claim))
+	if username == "" {
+		return nil, fmt.Errorf("identity has no %s claim", claim)
+	}
+	if claim == "email" && !identity.EmailVerified {
+		return nil, errors.New("identity email is not verified")
+	}
+
+	var user *database.User
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var existing database.User
+		err := tx.Unscoped().Where("username = ?", username).First(&existing).Error
+		switch {
+		case err == nil:
+			// 3. 绑定同名的已有账号
+			if existing.DeletedAt.Valid || existing.IsServiceAccount() || !opts.LinkExisting {
+				return ErrOIDCUserNotProvisioned
+			}
+			if !canLinkOIDCIdentity(&existing, identity) {
+				return ErrOIDCUserNotProvisioned
+			}
+			if existing.Disabled {
+				return ErrUserDisabled
+			}
+			user = &existing
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// 4. 自动创建账号
+			if !opts.AutoProvision {
+				return ErrOIDCUserNotProvisioned
+			}
+			role := opts.DefaultRole
+			if role == "" {
+				role = "proofreader"
+			}
+			if role != "super_admin" && role != "course_admin" && role != "proofreader" {
+				return errors.New("invalid default role for OIDC provisioning")
+			}
+			user = &database.User{
+				Username:     username,
+				PasswordHash: ssoPasswordHash,
+				Role:         role,
+				Kind:         database.UserKindHuman,
+				DisplayName:  identity.Name,
+			}
+			if err := tx.Create(user).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&database.UserIdentity{
+			UserID:      user.ID,
+			Issuer:      identity.Issuer,
+			Subject:     identity.Subject,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// canLinkOIDCIdentity 判断外部身份能否绑定到同名的已有账号。
+// 用户名类声明通常可由用户在 IdP 自行修改，因此只接受已验证且与本地用户名一致的邮箱；
+// 管理员账号不自动绑定，需由管理员手动处理
+func canLinkOIDCIdentity(user *database.User, identity *auth.OIDCIdentity) bool {
+	if user.Role == "super_admin" || user.Role == "course_admin" {
+		return false
+	}
+	return identity.EmailVerified && identity.Email != "" && strings.EqualFold(identity.Email, user.Username)
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+// PaperService 组卷服务：按规则抽题并持久化试卷定义
+type PaperService struct {
+	db  *gorm.DB
+	svc *Service
+}
+
+// NewPaperService 创建组卷服务
+func NewPaperService(db *gorm.DB, svc *Service) *PaperService {
+	return &PaperService{db: db, svc: svc}
+}
+
+// PaperRule 单条抽题规则
+type PaperRule struct {
+	CategoryID    int64    `json:"category_id"`              // 抽题范围（包含子节点）
+	Type          string   `json:"type"`                     // 文档类型，如 comprehensive_choice_v1
+	Count         int      `json:"count"`                    // 抽取数量
+	MinDifficulty *int     `json:"min_difficulty,omitempty"` // metadata.difficulty 下限（含）
+	MaxDifficulty *int     `json:"max_difficulty,omitempty"` // metadata.difficulty 上限（含）
+	Tags          []string `json:"tags,omitempty"`           // 需同时包含的 metadata.tags
+}
+
+// PaperBuildRequest 组卷请求
+type PaperBuildRequest struct {
+	Title             string      `json:"title"`
+	Rules             []PaperRule `json:"rules"`
+	Seed              *int64      `json:"seed,omitempty"`                // 不传则随机生成
+	ExcludeRecentDays int         `json:"exclude_recent_days,omitempty"` // 排除最近 N 天已用过的题目
+	DryRun            bool        `json:"dry_run,omitempty"`             // 仅预览，不保存
+	CreatedByID       uint        `json:"-"`
+}
+
+// PaperDefinition 试卷定义
+type PaperDefinition struct {
+	ID          uint        `json:"id,omitempty"`
+	Title       string      `json:"title"`
+	Seed        int64       `json:"seed"`
+	Rules       []PaperRule `json:"rules"`
+	DocumentIDs []int64     `json:"document_ids"`
+	CreatedByID uint        `json:"created_by_id,omitempty"`
+	CreatedAt   *time.Time  `json:"created_at,omitempty"`
+}
+
+// ErrPaperNotFound 试卷不存在
+var ErrPaperNotFound = errors.New("paper not found")
+
+// BuildPaper 按规则抽题生成试卷；同一个 seed 与相同的题库会得到相同的结果
+func (p *PaperService) BuildPaper(ctx context.Context, meta RequestMeta, req PaperBuildRequest) (*PaperDefinition, error) {
+	if strings.TrimSpace(req.Title) == "" {
+		return nil, errors.New("title is required")
+	}
+	if len(req.Rules) == 0 {
+		return nil, errors.New("rules is required")
+	}
+	for i, rule := range req.Rules {
+		if err := validatePaperRule(rule); err != nil {
+			return nil, fmt.Errorf("rules[%d]: %w", i, err)
+		}
+	}
+
+	seed := time.Now().UnixNano()
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+
+	excluded, err := p.recentlyUsedDocuments(req.ExcludeRecentDays)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[paper] build title=%q rules=%d seed=%d excluded=%d", req.Title, len(req.Rules), seed, len(excluded))
+
+	rng := rand.New(rand.NewPCG(uint64(seed), uint64(seed)>>32))
+	subtreeCache := make(map[int64][]ndrclient.Document)
+	picked := make([]int64, 0)
+
+	for i, rule := range req.Rules {
+		docs, ok := subtreeCache[rule.CategoryID]
+		if !ok {
+			docs, err = p.svc.listSubtreeDocuments(ctx, meta, rule.CategoryID)
+			if err != nil {
+				return nil, fmt.Errorf("rules[%d]: list documents for category %d: %w", i, rule.CategoryID, err)
+			}
+			subtreeCache[rule.CategoryID] = docs
+		}
+
+		candidates := make([]int64, 0, len(docs))
+		for _, doc := range docs {
+			if _, used := excluded[doc.ID]; used {
+				continue
+			}
+			if matchesPaperRule(doc, rule) {
+				candidates = append(candidates, doc.ID)
+			}
+		}
+		// 先排序再洗牌，保证结果只取决于 seed 与候选集合
+		sort.Slice(candidates, func(a, b int) bool { return candidates[a] < candidates[b] })
+		if len(candidates) < rule.Count {
+			return nil, fmt.Errorf("rules[%d]: need %d documents of type %s, only %d available", i, rule.Count, rule.Type, len(candidates))
+		}
+		rng.Shuffle(len(candidates), func(a, b int) {
+			candidates[a], candidates[b] = candidates[b], candidates[a]
+		})
+
+		chosen := candidates[:rule.Count]
+		picked = append(picked, chosen...)
+		for _, id := range chosen {
+			excluded[id] = struct{}{}
+		}
+	}
+
+	definition := &PaperDefinition{
+		Title:       strings.TrimSpace(req.Title),
+		Seed:        seed,
+		Rules:       req.Rules,
+		DocumentIDs: picked,
+		CreatedByID: req.CreatedByID,
+	}
+	if req.DryRun {
+		return definition, nil
+	}
+
+	rulesJSON, err := json.Marshal(req.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize rules: %w", err)
+	}
+	paper := database.Paper{
+		Title:       definition.Title,
+		Seed:        seed,
+		Rules:       string(rulesJSON),
+		CreatedByID: req.CreatedByID,
+	}
+	for i, id := range picked {
+		paper.Questions = append(paper.Questions, database.PaperQuestion{DocumentID: id, Position: i})
+	}
+	if err := p.db.Create(&paper).Error; err != nil {
+		return nil, fmt.Errorf("failed to save paper: %w", err)
+	}
+
+	definition.ID = paper.ID
+	definition.CreatedAt = &paper.CreatedAt
+	log.Printf("[paper] saved id=%d questions=%d", paper.ID, len(picked))
+	return definition, nil
+}
+
+// GetPaper 获取试卷定义
+func (p *PaperService) GetPaper(id uint) (*PaperDefinition, error) {
+	var paper database.Paper
+	err := p.db.Preload("Questions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).First(&paper, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPaperNotFound
+		}
+		return nil, fmt.Errorf("failed to get paper: %w", err)
+	}
+	return toPaperDefinition(paper)
+}
+
+// ListPapers 列出试卷定义（按创建时间倒序）
+func (p *PaperService) ListPapers(createdByID uint) ([]PaperDefinition, error) {
+	var papers []database.Paper
+	query := p.db.Preload("Questions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	})
+	if createdByID > 0 {
+		query = query.Where("created_by_id = ?", createdByID)
+	}
+	if err := query.Order("created_at DESC").Find(&papers).Error; err != nil {
+		return nil, fmt.Errorf("failed to list papers: %w", err)
+	}
+
+	result := make([]PaperDefinition, 0, len(papers))
+	for _, paper := range papers {
+		def, err := toPaperDefinition(paper)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *def)
+	}
+	return result, nil
+}
+
+// DeletePaper 删除试卷定义
+func (p *PaperService) DeletePaper(id uint) error {
+	return p.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&database.Paper{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete paper: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrPaperNotFound
+		}
+		// 已删除的试卷不再参与"近期已用"排除
+		if err := tx.Where("paper_id = ?", id).Delete(&database.PaperQuestion{}).Error; err != nil {
+			return fmt.Errorf("failed to delete paper questions: %w", err)
+		}
+		return nil
+	})
+}
+
+// RenderPaper 渲染已保存的试卷
+func (p *PaperService) RenderPaper(ctx context.Context, meta RequestMeta, id uint, variant PaperVariant) (PaperRenderResult, error) {
+	def, err := p.GetPaper(id)
+	if err != nil {
+		return PaperRenderResult{}, err
+	}
+	return p.svc.RenderPaper(ctx, meta, PaperRenderRequest{
+		Title:       def.Title,
+		DocumentIDs: def.DocumentIDs,
+		Variant:     variant,
+	})
+}
+
+// recentlyUsedDocuments 返回最近 days 天内已被组卷使用的文档 ID
+func (p *PaperService) recentlyUsedDocuments(days int) (map[int64]struct{}, error) {
+	used := make(map[int64]struct{})
+	if days <= 0 {
+		return used, nil
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	var ids []int64
+	if err := p.db.Model(&database.PaperQuestion{}).
+		Where("created_at >= ?", since).
+		Distinct().Pluck("document_id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to query recent papers: %w", err)
+	}
+	for _, id := range ids {
+		used[id] = struct{}{}
+	}
+	return used, nil
+}
+
+func validatePaperRule(rule PaperRule) error {
+	if rule.CategoryID <= 0 {
+		return errors.New("category_id is required")
+	}
+	if !IsQuestionDocumentType(rule.Type) {
+		return fmt.Errorf("type must be one of %v", paperQuestionTypes)
+	}
+	if rule.Count <= 0 {
+		return errors.New("count must be positive")
+	}
+	if rule.MinDifficulty != nil && (*rule.MinDifficulty < 1 || *rule.MinDifficulty > 5) {
+		return errors.New("min_difficulty must be between 1 and 5")
+	}
+	if rule.MaxDifficulty != nil && (*rule.MaxDifficulty < 1 || *rule.MaxDifficulty > 5) {
+		return errors.New("max_difficulty must be between 1 and 5")
+	}
+	if rule.MinDifficulty != nil && rule.MaxDifficulty != nil && *rule.MinDifficulty > *rule.MaxDifficulty {
+		return errors.New("min_difficulty cannot exceed max_difficulty")
+	}
+	return nil
+}
+
+// matchesPaperRule 按类型、难度与标签筛选；字段格式与 ValidateDocumentMetadata 的校验一致
+func matchesPaperRule(doc ndrclient.Document, rule PaperRule) bool {
+	if doc.Type == nil || *doc.Type != rule.Type {
+		return false
+	}
+	if rule.MinDifficulty != nil || rule.MaxDifficulty != nil {
+		difficulty, ok := toInt64(doc.Metadata["difficulty"])
+		if !ok {
+			return false
+		}
+		if rule.MinDifficulty != nil && difficulty < int64(*rule.MinDifficulty) {
+			return false
+		}
+		if rule.MaxDifficulty != nil && difficulty > int64(*rule.MaxDifficulty) {
+			return false
+		}
+	}
+	if len(rule.Tags) > 0 {
+		tags := make(map[string]struct{})
+		if raw, ok := doc.Metadata["tags"].([]any); ok {
+			for _, tag := range raw {
+				if s, ok := tag.(string); ok {
+					tags[s] = struct{}{}
+				}
+			}
+		}
+		for _, want := range rule.Tags {
+			if _, ok := tags[want]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func toPaperDefinition(paper database.Paper) (*PaperDefinition, error) {
+	var rules []PaperRule
+	if paper.Rules != "" {
+		if err := json.Unmarshal([]byte(paper.Rules), &rules); err != nil {
+			return nil, fmt.Errorf("failed to parse rules of paper %d: %w", paper.ID, err)
+		}
+	}
+	ids := make([]int64, 0, len(paper.Questions))
+	for _, q := range paper.Questions {
+		ids = append(ids, q.DocumentID)
+	}
+	createdAt := paper.CreatedAt
+	return &PaperDefinition{
+		ID:          paper.ID,
+		Title:       paper.Title,
+		Seed:        paper.Seed,
+		Rules:       rules,
+		DocumentIDs: ids,
+		CreatedByID: paper.CreatedByID,
+		CreatedAt:   &createdAt,
+	}, nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+func setupPaperService(t *testing.T) *PaperService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&database.Paper{}, &database.PaperQuestion{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	fake := newFakeNDR()
+	now := time.Now().UTC()
+	docs := make([]ndrclient.Document, 0)
+	for i := int64(1); i <= 10; i++ {
+		doc := sampleDocument(i, "Choice", "comprehensive_choice_v1", int(i), now, now)
+		doc.Metadata = map[string]any{"difficulty": float64(i%5 + 1), "tags": []any{"os"}}
+		if i%2 == 0 {
+			doc.Metadata["tags"] = []any{"os", "network"}
+		}
+		docs = append(docs, doc)
+	}
+	essay := sampleDocument(11, "Essay", "essay_v1", 11, now, now)
+	docs = append(docs, essay)
+	fake.nodeDocsResp = docs
+
+	return NewPaperService(db, NewService(cache.NewNoop(), fake, nil))
+}
+
+func TestBuildPaperIsDeterministicForSeed(t *testing.T) {
+	papers := setupPaperService(t)
+	seed := int64(42)
+	req := PaperBuildRequest{
+		Title:  "期中",
+		Rules:  []PaperRule{{CategoryID: 1, Type: "comprehensive_choice_v1", Count: 4}, {CategoryID: 1, Type: "essay_v1", Count: 1}},
+		Seed:   &seed,
+		DryRun: true,
+	}
+
+	first, err := papers.BuildPaper(context.Background(), RequestMeta{}, req)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	second, err := papers.BuildPaper(context.Background(), RequestMeta{}, req)
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if !reflect.DeepEqual(first.DocumentIDs, second.DocumentIDs) {
+		t.Fatalf("expected same selection for same seed, got %v and %v", first.DocumentIDs, second.DocumentIDs)
+	}
+	if len(first.DocumentIDs) != 5 || first.DocumentIDs[4] != 11 {
+		t.Fatalf("unexpected selection %v", first.DocumentIDs)
+	}
+	if first.ID != 0 {
+		t.Fatalf("dry run must not persist the paper")
+	}
+}
+
+func TestBuildPaperFiltersByDifficultyAndTags(t *testing.T) {
+	papers := setupPaperService(t)
+	minDifficulty, maxDifficulty := 3, 4
+	def, err := papers.BuildPaper(context.Background(), RequestMeta{}, PaperBuildRequest{
+		Title: "网络专项",
+		Rules: []PaperRule{{
+			CategoryID:    1,
+			Type:          "comprehensive_choice_v1",
+			Count:         2,
+			MinDifficulty: &minDifficulty,
+			MaxDifficulty: &maxDifficulty,
+			Tags:          []string{"network"},
+		}},
+		DryRun: true,
+	})
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	// difficulty = id%5+1，偶数 ID 带 network 标签：只有 2 和 8 满足
+	got := map[int64]bool{}
+	for _, id := range def.DocumentIDs {
+		got[id] = true
+	}
+	if len(got) != 2 || !got[2] || !got[8] {
+		t.Fatalf("expected documents 2 and 8, got %v", def.DocumentIDs)
+	}
+}
+
+func TestBuildPaperFailsWhenNotEnoughCandidates(t *testing.T) {
+	papers := setupPaperService(t)
+	_, err := papers.BuildPaper(context.Background(), RequestMeta{}, PaperBuildRequest{
+		Title: "不足",
+		Rules: []PaperRule{{CategoryID: 1, Type: "essay_v1", Count: 2}},
+	})
+	if err == nil {
+		t.Fatalf("expected error when not enough documents")
+	}
+}
+
+func TestBuildPaperExcludesRecentlyUsedDocuments(t *testing.T) {
+	papers := setupPaperService(t)
+	rule := PaperRule{CategoryID: 1, Type: "comprehensive_choice_v1", Count: 5}
+
+	first, err := papers.BuildPaper(context.Background(), RequestMeta{}, PaperBuildRequest{Title: "第一套", Rules: []PaperRule{rule}})
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if first.ID == 0 {
+		t.Fatalf("expected paper to be saved")
+	}
+
+	second, err := papers.BuildPaper(context.Background(), RequestMeta{}, PaperBuildRequest{Title: "第二套", Rules: []PaperRule{rule}, ExcludeRecentDays: 7})
+	if err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	used := map[int64]bool{}
+	for _, id := range first.DocumentIDs {
+		used[id] = true
+	}
+	for _, id := range second.DocumentIDs {
+		if used[id] {
+			t.Fatalf("document %d reused within exclusion window", id)
+		}
+	}
+
+	if _, err := papers.BuildPaper(context.Background(), RequestMeta{}, PaperBuildRequest{Title: "第三套", Rules: []PaperRule{rule}, ExcludeRecentDays: 7}); err == nil {
+		t.Fatalf("expected error once all documents were used recently")
+	}
+
+	saved, err := papers.GetPaper(first.ID)
+	if err != nil {
+		t.Fatalf("get paper failed: %v", err)
+	}
+	if !reflect.DeepEqual(saved.DocumentIDs, first.DocumentIDs) || len(saved.Rules) != 1 {
+		t.Fatalf("saved paper mismatch: %+v", saved)
+	}
+	if err := papers.DeletePaper(first.ID); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := papers.GetPaper(first.ID); err != ErrPaperNotFound {
+		t.Fatalf("expected ErrPaperNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,443 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+// PaperVariant selects which audience a rendered paper targets.
+type PaperVariant string
+
+const (
+	// PaperVariantStudent renders questions only.
+	PaperVariantStudent PaperVariant = "student"
+	// PaperVariantTeacher renders questions plus the answer-key appendix.
+	PaperVariantTeacher PaperVariant = "teacher"
+)
+
+// paperQuestionTypes lists the document types that can be rendered into papers, in section order.
+var paperQuestionTypes = []DocumentType{
+	"comprehensive_choice_v1",
+	"case_analysis_v1",
+	"essay_v1",
+	"dictation_v1",
+}
+
+var paperSectionTitles = map[DocumentType]string{
+	"comprehensive_choice_v1": "选择题",
+	"case_analysis_v1":        "案例分析题",
+	"essay_v1":                "论文题",
+	"dictation_v1":            "默写题",
+}
+
+// PaperRenderRequest describes which documents make up a paper.
+type PaperRenderRequest struct {
+	Title       string       `json:"title"`
+	CategoryIDs []int64      `json:"category_ids,omitempty"`
+	DocumentIDs []int64      `json:"document_ids,omitempty"`
+	Variant     PaperVariant `json:"variant"`
+}
+
+// PaperRenderResult contains the composed HTML and summary figures.
+type PaperRenderResult struct {
+	Title         string       `json:"title"`
+	Variant       PaperVariant `json:"variant"`
+	HTML          string       `json:"html"`
+	QuestionCount int          `json:"question_count"`
+	TotalScore    float64      `json:"total_score"`
+	DocumentIDs   []int64      `json:"document_ids"`
+	Skipped       []int64      `json:"skipped,omitempty"`
+}
+
+// IsQuestionDocumentType reports whether the type can be rendered into a paper.
+func IsQuestionDocumentType(docType string) bool {
+	for _, t := range paperQuestionTypes {
+		if string(t) == docType {
+			return true
+		}
+	}
+	return false
+}
+
+type choiceOption struct {
+	Key     string `yaml:"key"`
+	Content string `yaml:"content"`
+}
+
+type choiceSubQuestion struct {
+	Options []choiceOption `yaml:"options"`
+	Answer  string         `yaml:"answer"`
+}
+
+type choiceContent struct {
+	Title        string              `yaml:"title"`
+	Analysis     string              `yaml:"analysis"`
+	Score        float64             `yaml:"score"`
+	SubQuestions []choiceSubQuestion `yaml:"sub_questions"`
+}
+
+type detailItem struct {
+	No       int     `yaml:"no"`
+	Question string  `yaml:"question"`
+	Answer   string  `yaml:"answer"`
+	Score    float64 `yaml:"score"`
+	Type     string  `yaml:"type"`
+	KMPoint  string  `yaml:"km_point"`
+}
+
+type caseAnalysisContent struct {
+	Title    string       `yaml:"title"`
+	Analysis string       `yaml:"analysis"`
+	Details  []detailItem `yaml:"details"`
+}
+
+type essayContent struct {
+	Title    string  `yaml:"title"`
+	Content  string  `yaml:"content"`
+	Analysis string  `yaml:"analysis"`
+	Digest   string  `yaml:"digest"`
+	Sample   string  `yaml:"sample"`
+	Score    float64 `yaml:"score"`
+}
+
+type dictationContent struct {
+	StudyTime string       `yaml:"study_time"`
+	Score     float64      `yaml:"score"`
+	Details   []detailItem `yaml:"details"`
+}
+
+// paperPart is a labelled HTML fragment inside a question or answer.
+type paperPart struct {
+	Label string
+	Body  template.HTML
+}
+
+type paperQuestion struct {
+	Number   int
+	Score    float64
+	Stem     template.HTML
+	Parts    []paperPart
+	Options  [][]choiceOption
+	Answers  []paperPart
+	Analysis template.HTML
+}
+
+type paperSection struct {
+	Title     string
+	Questions []paperQuestion
+	Score     float64
+}
+
+// RenderPaper composes question documents into a printable HTML paper.
+func (s *Service) RenderPaper(ctx context.Context, meta RequestMeta, req PaperRenderRequest) (PaperRenderResult, error) {
+	if len(req.CategoryIDs) == 0 && len(req.DocumentIDs) == 0 {
+		return PaperRenderResult{}, errors.New("category_ids or document_ids is required")
+	}
+	variant := req.Variant
+	if variant == "" {
+		variant = PaperVariantStudent
+	}
+	if variant != PaperVariantStudent && variant != PaperVariantTeacher {
+		return PaperRenderResult{}, fmt.Errorf("invalid variant %q", variant)
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		title = "试卷"
+	}
+
+	log.Printf("[paper] render categories=%v documents=%d variant=%s", req.CategoryIDs, len(req.DocumentIDs), variant)
+
+	docs, err := s.collectPaperDocuments(ctx, meta, req)
+	if err != nil {
+		return PaperRenderResult{}, err
+	}
+	return renderPaperDocuments(title, variant, docs)
+}
+
+// collectPaperDocuments resolves explicit documents first, then category subtrees, without duplicates.
+func (s *Service) collectPaperDocuments(ctx context.Context, meta RequestMeta, req PaperRenderRequest) ([]ndrclient.Document, error) {
+	seen := make(map[int64]struct{})
+	docs := make([]ndrclient.Document, 0, len(req.DocumentIDs))
+
+	for _, id := range req.DocumentIDs {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		doc, err := s.ndr.GetDocument(ctx, toNDRMeta(meta), id)
+		if err != nil {
+			return nil, fmt.Errorf("get document %d: %w", id, err)
+		}
+		seen[id] = struct{}{}
+		docs = append(docs, doc)
+	}
+
+	for _, nodeID := range req.CategoryIDs {
+		subtree, err := s.listSubtreeDocuments(ctx, meta, nodeID)
+		if err != nil {
+			return nil, fmt.Errorf("list documents for category %d: %w", nodeID, err)
+		}
+		for _, doc := range subtree {
+			if _, ok := seen[doc.ID]; ok {
+				continue
+			}
+			seen[doc.ID] = struct{}{}
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// listSubtreeDocuments pages through all documents below a node, including descendants.
+func (s *Service) listSubtreeDocuments(ctx context.Context, meta RequestMeta, nodeID int64) ([]ndrclient.Document, error) {
+	docs := make([]ndrclient.Document, 0)
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set("include_descendants", "true")
+		query.Set("page", strconv.Itoa(page))
+		query.Set("size", strconv.Itoa(archivePageSize))
+
+		result, err := s.ndr.ListNodeDocuments(ctx, toNDRMeta(meta), nodeID, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range result.Items {
+			if doc.DeletedAt == nil {
+				docs = append(docs, doc)
+			}
+		}
+		if len(result.Items) < archivePageSize || (result.Total > 0 && page*archivePageSize >= result.Total) {
+			break
+		}
+	}
+	return docs, nil
+}
+
+func renderPaperDocuments(title string, variant PaperVariant, docs []ndrclient.Document) (PaperRenderResult, error) {
+	sections := make(map[DocumentType]*paperSection)
+	result := PaperRenderResult{Title: title, Variant: variant, DocumentIDs: make([]int64, 0, len(docs))}
+
+	number := 0
+	// 按题型分节，节内保持传入顺序
+	ordered := make([]ndrclient.Document, len(docs))
+	copy(ordered, docs)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return paperTypeRank(ordered[i].Type) < paperTypeRank(ordered[j].Type)
+	})
+
+	for _, doc := range ordered {
+		if doc.Type == nil || !IsQuestionDocumentType(*doc.Type) {
+			result.Skipped = append(result.Skipped, doc.ID)
+			continue
+		}
+		docType := DocumentType(*doc.Type)
+		_, data := documentContentParts(doc)
+
+		question, err := buildPaperQuestion(docType, data)
+		if err != nil {
+			return PaperRenderResult{}, fmt.Errorf("document %d: %w", doc.ID, err)
+		}
+		number++
+		question.Number = number
+
+		section, ok := sections[docType]
+		if !ok {
+			section = &paperSection{Title: paperSectionTitles[docType]}
+			sections[docType] = section
+		}
+		section.Questions = append(section.Questions, question)
+		section.Score += question.Score
+		result.TotalScore += question.Score
+		result.DocumentIDs = append(result.DocumentIDs, doc.ID)
+	}
+	result.QuestionCount = number
+
+	view := struct {
+		Title      string
+		Teacher    bool
+		TotalScore float64
+		Sections   []*paperSection
+	}{
+		Title:      title,
+		Teacher:    variant == PaperVariantTeacher,
+		TotalScore: result.TotalScore,
+	}
+	for _, t := range paperQuestionTypes {
+		if section, ok := sections[t]; ok {
+			view.Sections = append(view.Sections, section)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := paperTemplate.Execute(&buf, view); err != nil {
+		return PaperRenderResult{}, fmt.Errorf("render paper: %w", err)
+	}
+	result.HTML = buf.String()
+	return result, nil
+}
+
+func buildPaperQuestion(docType DocumentType, data string) (paperQuestion, error) {
+	switch docType {
+	case "comprehensive_choice_v1":
+		var c choiceContent
+		if _, err := parseYAMLDocument(data, &c); err != nil {
+			return paperQuestion{}, err
+		}
+		q := paperQuestion{Stem: safeHTML(c.Title), Score: c.Score, Analysis: safeHTML(c.Analysis)}
+		for i, sub := range c.SubQuestions {
+			q.Options = append(q.Options, sub.Options)
+			q.Answers = append(q.Answers, paperPart{Label: fmt.Sprintf("(%d)", i+1), Body: template.HTML(template.HTMLEscapeString(sub.Answer))})
+		}
+		return q, nil
+	case "case_analysis_v1":
+		var c caseAnalysisContent
+		if _, err := parseYAMLDocument(data, &c); err != nil {
+			return paperQuestion{}, err
+		}
+		q := paperQuestion{Stem: safeHTML(c.Title), Analysis: safeHTML(c.Analysis)}
+		for i, d := range c.Details {
+			label := detailLabel("问题", d.No, i)
+			q.Parts = append(q.Parts, paperPart{Label: scoreLabel(label, d.Score), Body: safeHTML(d.Question)})
+			q.Answers = append(q.Answers, paperPart{Label: label, Body: safeHTML(d.Answer)})
+			q.Score += d.Score
+		}
+		return q, nil
+	case "essay_v1":
+		var c essayContent
+		if _, err := parseYAMLDocument(data, &c); err != nil {
+			return paperQuestion{}, err
+		}
+		q := paperQuestion{
+			Stem:     template.HTML("<p><strong>" + template.HTMLEscapeString(c.Title) + "</strong></p>" + sanitizeHTML(richTextPolicy, c.Content)),
+			Score:    c.Score,
+			Analysis: safeHTML(c.Analysis),
+		}
+		if c.Digest != "" {
+			q.Answers = append(q.Answers, paperPart{Label: "要点", Body: safeHTML(c.Digest)})
+		}
+		if c.Sample != "" {
+			q.Answers = append(q.Answers, paperPart{Label: "范文", Body: safeHTML(c.Sample)})
+		}
+		return q, nil
+	case "dictation_v1":
+		var c dictationContent
+		if _, err := parseYAMLDocument(data, &c); err != nil {
+			return paperQuestion{}, err
+		}
+		q := paperQuestion{Score: c.Score}
+		for i, d := range c.Details {
+			label := detailLabel("", d.No, i)
+			question := d.Question
+			if strings.TrimSpace(question) == "" {
+				question = d.KMPoint
+			}
+			q.Parts = append(q.Parts, paperPart{Label: scoreLabel(label, d.Score), Body: safeHTML(question)})
+			q.Answers = append(q.Answers, paperPart{Label: label, Body: safeHTML(d.Answer)})
+			q.Score += d.Score
+		}
+		return q, nil
+	default:
+		return paperQuestion{}, fmt.Errorf("unsupported question type %s", docType)
+	}
+}
+
+func detailLabel(prefix string, no int, index int) string {
+	if no <= 0 {
+		no = index + 1
+	}
+	if prefix == "" {
+		return fmt.Sprintf("(%d)", no)
+	}
+	return fmt.Sprintf("%s%d", prefix, no)
+}
+
+func scoreLabel(label string, score float64) string {
+	if score <= 0 {
+		return label
+	}
+	return fmt.Sprintf("%s（%s分）", label, formatScore(score))
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// safeHTML marks a document field as trusted markup after running it through the rich-text policy.
+func safeHTML(fragment string) template.HTML {
+	return template.HTML(sanitizeHTML(richTextPolicy, fragment))
+}
+
+func paperTypeRank(docType *string) int {
+	if docType == nil {
+		return len(paperQuestionTypes)
+	}
+	for i, t := range paperQuestionTypes {
+		if string(t) == *docType {
+			return i
+		}
+	}
+	return len(paperQuestionTypes)
+}
+
+var paperTemplate = template.Must(template.New("paper").Funcs(template.FuncMap{
+	"score": formatScore,
+	"raw":   safeHTML,
+}).Parse(`{{define "question"}}
+<div class="question-stem">{{if .Number}}<span class="question-number">{{.Number}}.</span>{{end}}{{if .Score}}<span class="question-score">（{{score .Score}}分）</span>{{end}}{{.Stem}}</div>
+{{range $i, $opts := .Options}}<ol class="options">{{range $opts}}<li><span class="option-key">{{.Key}}.</span> {{raw .Content}}</li>{{end}}</ol>{{end}}
+{{range .Parts}}<div class="question-part"><span class="part-label">{{.Label}}</span> {{.Body}}</div>{{end}}
+{{end -}}
+{{define "answer"}}
+{{range .Answers}}<div class="answer-part"><span class="part-label">{{.Label}}</span> {{.Body}}</div>{{end}}
+{{if .Analysis}}<div class="analysis"><strong>解析：</strong>{{.Analysis}}</div>{{end}}
+{{end -}}
+<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: "Songti SC", "SimSun", serif; max-width: 800px; margin: 0 auto; padding: 24px; }
+h1 { text-align: center; }
+.paper-summary { text-align: center; color: #555; }
+.question { margin: 16px 0; page-break-inside: avoid; }
+.question-number { font-weight: bold; margin-right: 4px; }
+.options { list-style: none; padding-left: 24px; }
+.answer-key { page-break-before: always; }
+@media print { body { padding: 0; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .TotalScore}}<p class="paper-summary">满分：{{score .TotalScore}} 分</p>{{end}}
+{{range .Sections}}
+<section class="paper-section">
+<h2>{{.Title}}{{if .Score}}（共 {{score .Score}} 分）{{end}}</h2>
+{{range .Questions}}
+<div class="question">{{template "question" .}}</div>
+{{end}}
+</section>
+{{end}}
+{{if .Teacher}}
+<section class="answer-key">
+<h2>参考答案与解析</h2>
+{{range .Sections}}{{range .Questions}}
+<div class="answer">
+<p><span class="question-number">{{.Number}}.</span></p>
+{{template "answer" .}}
+</div>
+{{end}}{{end}}
+</section>
+{{end}}
+</body>
+</html>
+`))
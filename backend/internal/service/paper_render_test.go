@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+func TestRenderPaperNumbersQuestionsAndSumsScores(t *testing.T) {
+	fake := newFakeNDR()
+	now := time.Now().UTC()
+
+	caseDoc := sampleDocument(2, "Case", "case_analysis_v1", 1, now, now)
+	caseDoc.Content = map[string]any{"format": "yaml", "data": "---\nid: 0\ndoc_type: yaml\n---\n\n" +
+		"title: <p>案例背景</p>\nanalysis: <p>案例解析</p>\ndetails:\n" +
+		"  - no: 1\n    question: <p>问题一</p>\n    answer: <p>答案一</p>\n    score: 10\n" +
+		"  - no: 2\n    question: <p>问题二</p>\n    answer: <p>答案二</p>\n    score: 15\n"}
+	choiceDoc := sampleDocument(1, "Choice", "comprehensive_choice_v1", 0, now, now)
+	choiceDoc.Content = map[string]any{"format": "yaml", "data": "---\nid: 0\n---\n\n" +
+		"title: <p>调度的基本单位是 (1)</p>\nanalysis: <p>进程是资源分配单位</p>\nsub_questions:\n" +
+		"  - options:\n      - key: A\n        content: 进程\n      - key: B\n        content: 线程\n    answer: B\n"}
+	note := sampleDocument(3, "Note", "markdown_v1", 2, now, now)
+	fake.nodeDocsResp = []ndrclient.Document{caseDoc, choiceDoc, note}
+
+	svc := NewService(cache.NewNoop(), fake, nil)
+
+	student, err := svc.RenderPaper(context.Background(), RequestMeta{}, PaperRenderRequest{Title: "期中", CategoryIDs: []int64{10}})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	if student.QuestionCount != 2 {
+		t.Fatalf("expected 2 questions, got %d", student.QuestionCount)
+	}
+	if student.TotalScore != 25 {
+		t.Fatalf("expected total score 25, got %v", student.TotalScore)
+	}
+	if len(student.Skipped) != 1 || student.Skipped[0] != 3 {
+		t.Fatalf("expected markdown document to be skipped, got %v", student.Skipped)
+	}
+	// 选择题排在案例分析题之前
+	if strings.Index(student.HTML, "调度的基本单位") > strings.Index(student.HTML, "案例背景") {
+		t.Fatalf("choice questions should come first")
+	}
+	if strings.Contains(student.HTML, "参考答案") || strings.Contains(student.HTML, "答案一") {
+		t.Fatalf("student paper must not include answers")
+	}
+
+	teacher, err := svc.RenderPaper(context.Background(), RequestMeta{}, PaperRenderRequest{CategoryIDs: []int64{10}, Variant: PaperVariantTeacher})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	for _, want := range []string{"参考答案与解析", "答案一", "案例解析", "进程是资源分配单位"} {
+		if !strings.Contains(teacher.HTML, want) {
+			t.Fatalf("teacher paper missing %q", want)
+		}
+	}
+}
+
+func TestRenderPaperRejectsUnknownVariant(t *testing.T) {
+	svc := NewService(cache.NewNoop(), newFakeNDR(), nil)
+	if _, err := svc.RenderPaper(context.Background(), RequestMeta{}, PaperRenderRequest{DocumentIDs: []int64{1}, Variant: "parent"}); err == nil {
+		t.Fatalf("expected error for unknown variant")
+	}
+}
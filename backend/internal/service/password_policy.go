@@ -0,0 +1,166 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"gorm.io/gorm"
+)
+
+// PasswordPolicy 密码策略
+type PasswordPolicy struct {
+	MinLength   int             // 最小长度
+	MinClasses  int             // 至少包含的字符类别数（小写、大写、数字、符号）
+	HistorySize int             // 禁止重复使用最近 N 个密码（0 表示不限制）
+	DenyList    map[string]bool // 禁用的常见密码（小写）
+}
+
+// DefaultPasswordPolicy 默认密码策略
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:   8,
+		MinClasses:  2,
+		HistorySize: 5,
+		DenyList:    defaultPasswordDenyList(),
+	}
+}
+
+// commonPasswords 内置的常见弱密码列表
+var commonPasswords = []string{
+	"12345678", "123456789", "1234567890", "87654321", "11111111", "00000000",
+	"88888888", "66666666", "12341234", "11223344", "1q2w3e4r", "1qaz2wsx",
+	"qwertyui", "qwerty123", "qwertyuiop", "asdfghjkl", "zxcvbnm123", "abcd1234",
+	"abc12345", "abc123456", "a1234567", "a12345678", "aa123456", "password",
+	"password1", "password123", "passw0rd", "p@ssw0rd", "p@ssword", "iloveyou",
+	"sunshine", "princess", "football", "baseball", "welcome1", "welcome123",
+	"letmein1", "admin123", "admin1234", "admin123456", "administrator", "root1234",
+	"test1234", "test123456", "changeme", "changeme123", "woaini520", "woaini1314",
+	"5201314520", "qq123456", "123qweasd", "123456abc", "123456aa", "a123456789",
+	"ydms1234", "ydms123456",
+}
+
+func defaultPasswordDenyList() map[string]bool {
+	list := make(map[string]bool, len(commonPasswords))
+	for _, password := range commonPasswords {
+		list[password] = true
+	}
+	return list
+}
+
+// LoadPasswordDenyList 从文件追加禁用密码（每行一个，# 开头为注释）
+func (p *PasswordPolicy) LoadPasswordDenyList(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if p.DenyList == nil {
+		p.DenyList = make(map[string]bool)
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.DenyList[strings.ToLower(line)] = true
+	}
+	return scanner.Err()
+}
+
+// Validate 校验密码是否满足长度、字符类别与禁用列表要求
+func (p PasswordPolicy) Validate(username, password string) error {
+	minLength := p.MinLength
+	if minLength < 8 {
+		minLength = 8
+	}
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("password must be at least %d characters", minLength)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+	if classes < p.MinClasses {
+		return fmt.Errorf("password must contain at least %d of: lowercase letters, uppercase letters, digits, symbols", p.MinClasses)
+	}
+
+	normalized := strings.ToLower(password)
+	if p.DenyList[normalized] {
+		return errors.New("password is too common")
+	}
+	if username != "" && strings.Contains(normalized, strings.ToLower(username)) {
+		return errors.New("password must not contain the username")
+	}
+	return nil
+}
+
+// checkPasswordReuse 检查新密码是否与当前密码或最近使用过的密码相同
+func (s *UserService) checkPasswordReuse(userID uint, currentHash, password string) error {
+	if s.passwordPolicy.HistorySize <= 0 {
+		return nil
+	}
+	if currentHash != "" && auth.CheckPassword(password, currentHash) {
+		return errors.New("password was used recently")
+	}
+
+	var history []database.PasswordHistory
+	if err := s.db.Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(s.passwordPolicy.HistorySize).
+		Find(&history).Error; err != nil {
+		return err
+	}
+	for _, entry := range history {
+		if auth.CheckPassword(password, entry.PasswordHash) {
+			return errors.New("password was used recently")
+		}
+	}
+	return nil
+}
+
+// recordPasswordHistory 记录新密码并只保留最近 HistorySize 条
+func (s *UserService) recordPasswordHistory(tx *gorm.DB, userID uint, passwordHash string) error {
+	if s.passwordPolicy.HistorySize <= 0 {
+		return nil
+	}
+	if err := tx.Create(&database.PasswordHistory{UserID: userID, PasswordHash: passwordHash}).Error; err != nil {
+		return err
+	}
+
+	var stale []uint
+	if err := tx.Model(&database.PasswordHistory{}).
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Offset(s.passwordPolicy.HistorySize).
+		Pluck("id", &stale).Error; err != nil {
+		return err
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return tx.Delete(&database.PasswordHistory{}, stale).Error
+}
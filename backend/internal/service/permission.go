@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/yjxt/ydms/backend/internal/database"
 	"github.com/yjxt/ydms/backend/internal/ndrclient"
 	"gorm.io/gorm"
 )
@@ -44,8 +45,8 @@ type NodePermission struct {
 	CanMove   bool
 }
 
-// GetDocumentPermission 获取用户对文档的权限
-func (s *PermissionService) GetDocumentPermission(ctx context.Context, userID uint, role string, nodeID int64) (*DocumentPermission, error) {
+// GetDocumentPermission 获取用户对文档的权限；docID 不为 0 时按该文档的审核状态收紧编辑与恢复版本权限
+func (s *PermissionService) GetDocumentPermission(ctx context.Context, userID uint, role string, nodeID, docID int64) (*DocumentPermission, error) {
 	perm := &DocumentPermission{}
 
 	// 超级管理员：全部权限
@@ -90,9 +91,47 @@ func (s *PermissionService) GetDocumentPermission(ctx context.Context, userID ui
 		perm.CanRestoreVersion = true // ✅ 可以恢复历史版本
 	}
 
+	if docID != 0 {
+		state, err := s.documentReviewState(docID)
+		if err != nil {
+			return perm, err
+		}
+		s.ApplyReviewState(perm, role, state)
+	}
+
 	return perm, nil
 }
 
+// ApplyReviewState 按文档审核状态收紧权限：审核通过或已发布的文档只有课程管理员可以编辑或恢复版本
+func (s *PermissionService) ApplyReviewState(perm *DocumentPermission, role, state string) {
+	if !CanEditInReviewState(role, state) {
+		perm.CanEdit = false
+		perm.CanRestoreVersion = false
+	}
+}
+
+// documentReviewState 返回文档的审核状态，从未提交审核的文档视为草稿
+func (s *PermissionService) documentReviewState(docID int64) (string, error) {
+	review, err := NewReviewWorkflow(s.db).load(docID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load review state: %w", err)
+	}
+	if review == nil {
+		return database.ReviewStateDraft, nil
+	}
+	return review.State, nil
+}
+
+// CanEditInReviewState 判断角色能否编辑处于该审核状态的文档
+func CanEditInReviewState(role, state string) bool {
+	switch state {
+	case database.ReviewStateApproved, database.ReviewStatePublished:
+		return role == "super_admin" || role == "course_admin"
+	default:
+		return true
+	}
+}
+
 // GetNodePermission 获取用户对节点的权限
 func (s *PermissionService) GetNodePermission(ctx context.Context, userID uint, role string, nodeID int64) (*NodePermission, error) {
 	perm := &NodePermission{}
@@ -151,6 +190,15 @@ func (s *PermissionService) CanRestoreDocumentVersion(ctx context.Context, userI
 
 	// 校对员：检查是否有该文档的编辑权限
 	if role == "proofreader" {
+		// 审核通过或已发布的文档不能恢复版本
+		state, err := s.documentReviewState(docID)
+		if err != nil {
+			return false, err
+		}
+		if !CanEditInReviewState(role, state) {
+			return false, nil
+		}
+
 		// 获取文档绑定的节点（暂时简化，假设文档有 node_id）
 		// 实际应该通过 NDR API 查询关系
 		// TODO: 实现完整的文档-节点关系查询
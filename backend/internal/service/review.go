@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+// 审核操作
+const (
+	ReviewActionSubmit  = "submit"  // 校对员或课程管理员提交审核，可同时指定审核人
+	ReviewActionAssign  = "assign"  // 课程管理员指定（或更换）审核人
+	ReviewActionApprove = "approve" // 审核通过
+	ReviewActionReject  = "reject"  // 驳回并退回草稿，必须填写意见
+	ReviewActionPublish = "publish" // 发布审核通过的文档
+	ReviewActionReopen  = "reopen"  // 将审核通过或已发布的文档退回草稿，以便校对员继续修改
+)
+
+var (
+	// ErrReviewWorkflowDisabled 未启用审核流程
+	ErrReviewWorkflowDisabled = errors.New("review workflow is disabled")
+	// ErrInvalidReviewRequest 审核请求参数不合法
+	ErrInvalidReviewRequest = errors.New("invalid review request")
+	// ErrReviewTransition 当前状态不允许该操作，或状态已被其他人修改
+	ErrReviewTransition = errors.New("review transition not allowed")
+	// ErrReviewForbidden 当前角色或课程权限不允许该操作
+	ErrReviewForbidden = errors.New("review action forbidden")
+	// ErrReviewedDocumentReadOnly 审核通过或已发布的文档只能由课程管理员编辑
+	ErrReviewedDocumentReadOnly = errors.New("approved or published documents can only be edited by course admins")
+)
+
+// reviewTransition 审核操作允许的起始状态、目标状态与角色（超级管理员可执行全部操作）
+type reviewTransition struct {
+	from  []string
+	to    string // 为空表示保持原状态
+	roles []string
+}
+
+var reviewTransitions = map[string]reviewTransition{
+	ReviewActionSubmit:  {from: []string{database.ReviewStateDraft}, to: database.ReviewStateInReview, roles: []string{"proofreader", "course_admin"}},
+	ReviewActionAssign:  {from: []string{database.ReviewStateInReview}, roles: []string{"course_admin"}},
+	ReviewActionApprove: {from: []string{database.ReviewStateInReview}, to: database.ReviewStateApproved, roles: []string{"course_admin"}},
+	ReviewActionReject:  {from: []string{database.ReviewStateInReview}, to: database.ReviewStateDraft, roles: []string{"course_admin"}},
+	ReviewActionPublish: {from: []string{database.ReviewStateApproved}, to: database.ReviewStatePublished, roles: []string{"course_admin"}},
+	ReviewActionReopen:  {from: []string{database.ReviewStateApproved, database.ReviewStatePublished}, to: database.ReviewStateDraft, roles: []string{"course_admin"}},
+}
+
+// ReviewActionRequest 审核操作参数
+type ReviewActionRequest struct {
+	Comment    string `json:"comment"`
+	ReviewerID *uint  `json:"reviewer_id"` // submit 与 assign 时指定审核人
+}
+
+// DocumentReviewDetail 文档审核状态及变更记录
+type DocumentReviewDetail struct {
+	database.DocumentReview
+	History []database.DocumentReviewEvent `json:"history"`
+}
+
+// ReviewWorkflow 文档审核状态存储
+type ReviewWorkflow struct {
+	db *gorm.DB
+}
+
+// NewReviewWorkflow 创建审核流程存储
+func NewReviewWorkflow(db *gorm.DB) *ReviewWorkflow {
+	return &ReviewWorkflow{db: db}
+}
+
+// SetReviewWorkflow 启用文档审核流程
+func (s *Service) SetReviewWorkflow(workflow *ReviewWorkflow) {
+	s.reviews = workflow
+}
+
+// GetDocumentReview 返回文档的审核状态与变更记录；从未提交过的文档返回草稿状态
+func (s *Service) GetDocumentReview(ctx context.Context, meta RequestMeta, docID int64) (*DocumentReviewDetail, error) {
+	if s.reviews == nil {
+		return nil, ErrReviewWorkflowDisabled
+	}
+	// 未提交过的文档同样要求课程权限，否则任意用户都能读取其标题
+	courses, err := s.documentBoundCourses(ctx, meta, docID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.hasAnyCoursePermission(meta, courses)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: no permission for document %d", ErrReviewForbidden, docID)
+	}
+	review, err := s.reviews.load(docID)
+	if err != nil {
+		return nil, err
+	}
+	if review == nil {
+		doc, err := s.ndr.GetDocument(ctx, toNDRMeta(meta), docID)
+		if err != nil {
+			return nil, err
+		}
+		return &DocumentReviewDetail{
+			DocumentReview: database.DocumentReview{DocumentID: docID, State: database.ReviewStateDraft, Title: doc.Title},
+			History:        []database.DocumentReviewEvent{},
+		}, nil
+	}
+	detail := &DocumentReviewDetail{DocumentReview: *review}
+	if err := s.reviews.db.Where("document_id = ?", docID).Order("id").Find(&detail.History).Error; err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// TransitionDocumentReview 执行审核操作；状态以条件更新修改，并发操作中只有一个成功
+func (s *Service) TransitionDocumentReview(ctx context.Context, meta RequestMeta, docID int64, action string, req ReviewActionRequest) (*database.DocumentReview, error) {
+	if s.reviews == nil {
+		return nil, ErrReviewWorkflowDisabled
+	}
+	transition, ok := reviewTransitions[action]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidReviewRequest, action)
+	}
+	if meta.UserRole != "super_admin" && !slices.Contains(transition.roles, meta.UserRole) {
+		return nil, fmt.Errorf("%w: role %q cannot %s documents", ErrReviewForbidden, meta.UserRole, action)
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if action == ReviewActionReject && req.Comment == "" {
+		return nil, fmt.Errorf("%w: a comment is required when rejecting", ErrInvalidReviewRequest)
+	}
+	if action == ReviewActionAssign && req.ReviewerID == nil {
+		return nil, fmt.Errorf("%w: reviewer_id is required", ErrInvalidReviewRequest)
+	}
+
+	current, err := s.reviews.load(docID)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.ndr.GetDocument(ctx, toNDRMeta(meta), docID)
+	if err != nil {
+		return nil, err
+	}
+	review := database.DocumentReview{DocumentID: docID, State: database.ReviewStateDraft}
+	if current != nil {
+		review = *current
+	}
+	if review.CourseID == 0 || action == ReviewActionSubmit {
+		// 提交时重新解析课程，文档可能在两次审核之间被移动
+		if review.CourseID, err = s.documentCourse(ctx, meta, docID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.requireReviewCourse(meta, review.CourseID); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(transition.from, review.State) {
+		return nil, fmt.Errorf("%w: cannot %s a document in state %s", ErrReviewTransition, action, review.State)
+	}
+	if req.ReviewerID != nil && action != ReviewActionSubmit && action != ReviewActionAssign {
+		return nil, fmt.Errorf("%w: reviewer_id is only accepted by submit and assign", ErrInvalidReviewRequest)
+	}
+	if req.ReviewerID != nil {
+		if err := s.validateReviewer(*req.ReviewerID, review.CourseID); err != nil {
+			return nil, err
+		}
+	}
+
+	fromState := review.State
+	now := time.Now()
+	review.Title = doc.Title
+	review.Comment = req.Comment
+	if transition.to != "" {
+		review.State = transition.to
+	}
+	switch action {
+	case ReviewActionSubmit:
+		review.SubmittedByID = &meta.UserIDNumeric
+		review.SubmittedAt = &now
+		review.SubmittedVersion = doc.Version
+		review.ReviewerID = req.ReviewerID
+	case ReviewActionAssign:
+		review.ReviewerID = req.ReviewerID
+	}
+
+	event := database.DocumentReviewEvent{
+		DocumentID: docID,
+		Action:     action,
+		FromState:  fromState,
+		ToState:    review.State,
+		ActorID:    meta.UserIDNumeric,
+		ActorName:  meta.Username,
+		ReviewerID: review.ReviewerID,
+		Comment:    req.Comment,
+	}
+	err = s.reviews.db.Transaction(func(tx *gorm.DB) error {
+		if current == nil {
+			if err := tx.Create(&review).Error; err != nil {
+				return fmt.Errorf("%w: document state changed concurrently", ErrReviewTransition)
+			}
+		} else {
+			res := tx.Model(&database.DocumentReview{}).
+				Where("document_id = ? AND state = ?", docID, fromState).
+				Select("course_id", "state", "title", "reviewer_id", "submitted_by_id", "submitted_at", "submitted_version", "comment", "updated_at").
+				Updates(&review)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return fmt.Errorf("%w: document state changed concurrently", ErrReviewTransition)
+			}
+		}
+		return tx.Create(&event).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.reviews.load(docID)
+}
+
+// ListReviewQueue 返回指定给当前用户、等待审核的文档，按提交时间排序
+func (s *Service) ListReviewQueue(meta RequestMeta) ([]database.DocumentReview, error) {
+	if s.reviews == nil {
+		return nil, ErrReviewWorkflowDisabled
+	}
+	reviews := []database.DocumentReview{}
+	err := s.reviews.db.Where("state = ? AND reviewer_id = ?", database.ReviewStateInReview, meta.UserIDNumeric).
+		Order("submitted_at, document_id").Find(&reviews).Error
+	return reviews, err
+}
+
+// ListCourseReviews 返回课程中处于指定审核状态的文档，state 为空时返回等待审核的文档
+func (s *Service) ListCourseReviews(meta RequestMeta, courseID int64, state string) ([]database.DocumentReview, error) {
+	if s.reviews == nil {
+		return nil, ErrReviewWorkflowDisabled
+	}
+	if state == "" {
+		state = database.ReviewStateInReview
+	}
+	switch state {
+	case database.ReviewStateDraft, database.ReviewStateInReview, database.ReviewStateApproved, database.ReviewStatePublished:
+	default:
+		return nil, fmt.Errorf("%w: unknown state %q", ErrInvalidReviewRequest, state)
+	}
+	if err := s.requireReviewCourse(meta, courseID); err != nil {
+		return nil, err
+	}
+	reviews := []database.DocumentReview{}
+	err := s.reviews.db.Where("course_id = ? AND state = ?", courseID, state).
+		Order("submitted_at, document_id").Find(&reviews).Error
+	return reviews, err
+}
+
+// checkReviewState 审核通过或已发布的文档拒绝校对员修改
+func (s *Service) checkReviewState(meta RequestMeta, docID int64) error {
+	if s.reviews == nil || CanEditInReviewState(meta.UserRole, database.ReviewStateApproved) {
+		return nil
+	}
+	review, err := s.reviews.load(docID)
+	if err != nil {
+		return fmt.Errorf("check review state: %w", err)
+	}
+	if review != nil && !CanEditInReviewState(meta.UserRole, review.State) {
+		return ErrReviewedDocumentReadOnly
+	}
+	return nil
+}
+
+// requireReviewCourse 非超级管理员必须拥有文档所属课程的权限
+func (s *Service) requireReviewCourse(meta RequestMeta, courseID int64) error {
+	if meta.UserRole == "super_admin" {
+		return nil
+	}
+	if s.userService == nil || meta.UserIDNumeric == 0 {
+		return ErrReviewForbidden
+	}
+	ok, err := s.userService.HasCoursePermission(meta.UserIDNumeric, courseID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: no permission for course %d", ErrReviewForbidden, courseID)
+	}
+	return nil
+}
+
+// validateReviewer 审核人必须是超级管理员，或拥有该课程权限的课程管理员
+func (s *Service) validateReviewer(reviewerID uint, courseID int64) error {
+	if s.userService == nil {
+		return fmt.Errorf("%w: reviewers cannot be resolved", ErrInvalidReviewRequest)
+	}
+	reviewer, err := s.userService.GetUserByID(reviewerID)
+	if err != nil {
+		return fmt.Errorf("%w: reviewer %d not found", ErrInvalidReviewRequest, reviewerID)
+	}
+	if reviewer.Role == "super_admin" {
+		return nil
+	}
+	if reviewer.Role == "course_admin" {
+		if ok, err := s.userService.HasCoursePermission(reviewer.ID, courseID); err == nil && ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: reviewer %s is not a course admin of course %d", ErrInvalidReviewRequest, reviewer.Username, courseID)
+}
+
+// documentCourse 通过文档绑定的节点解析其所属课程（取第一个绑定节点）
+func (s *Service) documentCourse(ctx context.Context, meta RequestMeta, docID int64) (int64, error) {
+	status, err := s.ndr.GetDocumentBindingStatus(ctx, toNDRMeta(meta), docID)
+	if err != nil {
+		return 0, err
+	}
+	if len(status.NodeIDs) == 0 {
+		return 0, fmt.Errorf("%w: document %d is not bound to any category", ErrInvalidReviewRequest, docID)
+	}
+	return s.categoryRootID(ctx, meta, status.NodeIDs[0])
+}
+
+// purge 删除文档的审核状态与变更记录（文档被彻底删除时调用）
+func (w *ReviewWorkflow) purge(docID int64) error {
+	return w.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", docID).Delete(&database.DocumentReviewEvent{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("document_id = ?", docID).Delete(&database.DocumentReview{}).Error
+	})
+}
+
+func (w *ReviewWorkflow) load(docID int64) (*database.DocumentReview, error) {
+	var review database.DocumentReview
+	err := w.db.Where("document_id = ?", docID).First(&review).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+// courseFixture 是审核、评论与标签测试共用的课程环境：校对员 pat 与课程管理员 rita
+// 拥有课程 1（newCopySourceNDR 的节点 1）的权限，课程管理员 otto 没有任何课程权限。
+type courseFixture struct {
+	db    *gorm.DB
+	users *UserService
+	ndr   *archiveFakeNDR
+	svc   *Service
+
+	proof, admin, outsider             *database.User
+	proofMeta, adminMeta, outsiderMeta RequestMeta
+}
+
+func newCourseFixture(t *testing.T, models ...any) *courseFixture {
+	t.Helper()
+	db := setupUserDB(t)
+	if len(models) > 0 {
+		if err := db.AutoMigrate(models...); err != nil {
+			t.Fatalf("failed to migrate: %v", err)
+		}
+	}
+	users := NewUserService(db)
+	create := func(username, role string) *database.User {
+		user, err := users.CreateUser(username, "Secret-pass-9", role, nil)
+		if err != nil {
+			t.Fatalf("create user %s: %v", username, err)
+		}
+		return user
+	}
+	f := &courseFixture{
+		db:       db,
+		users:    users,
+		ndr:      newCopySourceNDR(),
+		proof:    create("pat", "proofreader"),
+		admin:    create("rita", "course_admin"),
+		outsider: create("otto", "course_admin"),
+	}
+	for _, user := range []*database.User{f.proof, f.admin} {
+		if err := users.GrantCoursePermission(user.ID, 1); err != nil {
+			t.Fatalf("grant course permission: %v", err)
+		}
+	}
+	f.svc = NewService(cache.NewNoop(), f.ndr, users)
+	f.proofMeta = RequestMeta{UserRole: "proofreader", UserIDNumeric: f.proof.ID, Username: "pat"}
+	f.adminMeta = RequestMeta{UserRole: "course_admin", UserIDNumeric: f.admin.ID, Username: "rita"}
+	f.outsiderMeta = RequestMeta{UserRole: "course_admin", UserIDNumeric: f.outsider.ID, Username: "otto"}
+	return f
+}
+
+func TestDocumentReviewWorkflow(t *testing.T) {
+	f := newCourseFixture(t, &database.DocumentReview{}, &database.DocumentReviewEvent{})
+	svc := f.svc
+	svc.SetReviewWorkflow(NewReviewWorkflow(f.db))
+	ctx := context.Background()
+	title := "edited"
+
+	// 各步骤依次推进同一文档的审核状态
+	t.Run("提交", func(t *testing.T) {
+		if _, err := svc.TransitionDocumentReview(ctx, f.proofMeta, 11, ReviewActionSubmit, ReviewActionRequest{ReviewerID: &f.outsider.ID}); !errors.Is(err, ErrInvalidReviewRequest) {
+			t.Fatalf("expected reviewer without course permission to be rejected, got %v", err)
+		}
+		review, err := svc.TransitionDocumentReview(ctx, f.proofMeta, 11, ReviewActionSubmit, ReviewActionRequest{ReviewerID: &f.admin.ID})
+		if err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+		if review.State != database.ReviewStateInReview || review.CourseID != 1 || review.Title != "Question" || review.ReviewerID == nil || *review.ReviewerID != f.admin.ID {
+			t.Fatalf("unexpected submitted review %+v", review)
+		}
+	})
+
+	t.Run("审核权限", func(t *testing.T) {
+		for _, meta := range []RequestMeta{f.proofMeta, f.outsiderMeta} {
+			if _, err := svc.TransitionDocumentReview(ctx, meta, 11, ReviewActionApprove, ReviewActionRequest{}); !errors.Is(err, ErrReviewForbidden) {
+				t.Fatalf("expected approval by %s to be forbidden, got %v", meta.Username, err)
+			}
+		}
+		queue, err := svc.ListReviewQueue(f.adminMeta)
+		if err != nil || len(queue) != 1 || queue[0].DocumentID != 11 {
+			t.Fatalf("unexpected review queue %+v err=%v", queue, err)
+		}
+		if pending, err := svc.ListCourseReviews(f.adminMeta, 1, ""); err != nil || len(pending) != 1 {
+			t.Fatalf("unexpected pending approvals %+v err=%v", pending, err)
+		}
+		if _, err := svc.ListCourseReviews(f.outsiderMeta, 1, ""); !errors.Is(err, ErrReviewForbidden) {
+			t.Fatalf("expected course list without permission to be forbidden, got %v", err)
+		}
+	})
+
+	// 驳回必须填写意见，驳回后退回草稿并可重新提交
+	t.Run("驳回后重新提交", func(t *testing.T) {
+		if _, err := svc.TransitionDocumentReview(ctx, f.adminMeta, 11, ReviewActionReject, ReviewActionRequest{}); !errors.Is(err, ErrInvalidReviewRequest) {
+			t.Fatalf("expected rejection without comment to fail, got %v", err)
+		}
+		review, err := svc.TransitionDocumentReview(ctx, f.adminMeta, 11, ReviewActionReject, ReviewActionRequest{Comment: "fix answer"})
+		if err != nil || review.State != database.ReviewStateDraft || review.Comment != "fix answer" {
+			t.Fatalf("reject: review=%+v err=%v", review, err)
+		}
+		if _, err := svc.TransitionDocumentReview(ctx, f.proofMeta, 11, ReviewActionSubmit, ReviewActionRequest{}); err != nil {
+			t.Fatalf("resubmit: %v", err)
+		}
+		if _, err := svc.TransitionDocumentReview(ctx, f.adminMeta, 11, ReviewActionAssign, ReviewActionRequest{ReviewerID: &f.admin.ID}); err != nil {
+			t.Fatalf("assign: %v", err)
+		}
+		if _, err := svc.TransitionDocumentReview(ctx, f.adminMeta, 11, ReviewActionApprove, ReviewActionRequest{Comment: "ok"}); err != nil {
+			t.Fatalf("approve: %v", err)
+		}
+	})
+
+	// 审核通过后只有课程管理员可以修改
+	t.Run("审核通过后只读", func(t *testing.T) {
+		if _, err := svc.UpdateDocument(ctx, f.proofMeta, 11, DocumentUpdateRequest{Title: &title}); !errors.Is(err, ErrReviewedDocumentReadOnly) {
+			t.Fatalf("expected proofreader edit of approved document to fail, got %v", err)
+		}
+		if err := svc.DeleteDocument(ctx, f.proofMeta, 11); !errors.Is(err, ErrReviewedDocumentReadOnly) {
+			t.Fatalf("expected proofreader delete of approved document to fail, got %v", err)
+		}
+		if _, err := svc.RestoreDocument(ctx, f.proofMeta, 11); !errors.Is(err, ErrReviewedDocumentReadOnly) {
+			t.Fatalf("expected proofreader restore of approved document to fail, got %v", err)
+		}
+		if err := svc.PurgeDocument(ctx, f.proofMeta, 11); !errors.Is(err, ErrReviewedDocumentReadOnly) {
+			t.Fatalf("expected proofreader purge of approved document to fail, got %v", err)
+		}
+		if _, err := svc.UpdateDocument(ctx, f.adminMeta, 11, DocumentUpdateRequest{Title: &title}); err != nil {
+			t.Fatalf("course admin edit: %v", err)
+		}
+	})
+
+	t.Run("发布与重新打开", func(t *testing.T) {
+		if _, err := svc.TransitionDocumentReview(ctx, f.adminMeta, 11, ReviewActionPublish, ReviewActionRequest{}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+		if _, err := svc.TransitionDocumentReview(ctx, f.adminMeta, 11, ReviewActionApprove, ReviewActionRequest{}); !errors.Is(err, ErrReviewTransition) {
+			t.Fatalf("expected approving a published document to fail, got %v", err)
+		}
+		if _, err := svc.TransitionDocumentReview(ctx, f.adminMeta, 11, ReviewActionReopen, ReviewActionRequest{}); err != nil {
+			t.Fatalf("reopen: %v", err)
+		}
+		if _, err := svc.UpdateDocument(ctx, f.proofMeta, 11, DocumentUpdateRequest{Title: &title}); err != nil {
+			t.Fatalf("expected reopened document to be editable: %v", err)
+		}
+	})
+
+	t.Run("审核历史", func(t *testing.T) {
+		detail, err := svc.GetDocumentReview(ctx, f.proofMeta, 11)
+		if err != nil {
+			t.Fatalf("GetDocumentReview: %v", err)
+		}
+		actions := []string{ReviewActionSubmit, ReviewActionReject, ReviewActionSubmit, ReviewActionAssign, ReviewActionApprove, ReviewActionPublish, ReviewActionReopen}
+		if len(detail.History) != len(actions) {
+			t.Fatalf("expected %d history entries, got %+v", len(actions), detail.History)
+		}
+		for i, action := range actions {
+			if detail.History[i].Action != action {
+				t.Fatalf("history[%d]: expected %s, got %+v", i, action, detail.History[i])
+			}
+		}
+		if draft, err := svc.GetDocumentReview(ctx, f.proofMeta, 10); err != nil || draft.State != database.ReviewStateDraft {
+			t.Fatalf("expected unsubmitted document to be a draft, got %+v err=%v", draft, err)
+		}
+		// 没有课程权限时，无论文档是否提交过都不能查看
+		for _, docID := range []int64{10, 11} {
+			if _, err := svc.GetDocumentReview(ctx, f.outsiderMeta, docID); !errors.Is(err, ErrReviewForbidden) {
+				t.Fatalf("expected review of document %d without course permission to be forbidden, got %v", docID, err)
+			}
+		}
+	})
+}
+
+func TestDocumentPermissionFollowsReviewState(t *testing.T) {
+	f := newCourseFixture(t, &database.DocumentReview{})
+	f.db.Create(&database.DocumentReview{DocumentID: 11, CourseID: 1, State: database.ReviewStateApproved})
+	perms := NewPermissionService(f.db, f.users, f.ndr)
+	ctx := context.Background()
+
+	cases := []struct {
+		name     string
+		user     *database.User
+		role     string
+		docID    int64
+		wantEdit bool
+	}{
+		{"校对员可以编辑草稿", f.proof, "proofreader", 10, true},
+		{"校对员不能编辑已通过的文档", f.proof, "proofreader", 11, false},
+		{"课程管理员可以编辑已通过的文档", f.admin, "course_admin", 11, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			perm, err := perms.GetDocumentPermission(ctx, tc.user.ID, tc.role, 2, tc.docID)
+			if err != nil || !perm.CanView || perm.CanEdit != tc.wantEdit || perm.CanRestoreVersion != tc.wantEdit {
+				t.Fatalf("expected edit=%v, got %+v err=%v", tc.wantEdit, perm, err)
+			}
+			ok, err := perms.CanRestoreDocumentVersion(ctx, tc.user.ID, tc.role, tc.docID)
+			if err != nil || ok != tc.wantEdit {
+				t.Fatalf("expected restore=%v, got %v err=%v", tc.wantEdit, ok, err)
+			}
+		})
+	}
+}
+
+func TestPurgeDocumentDropsLocalRecords(t *testing.T) {
+	f := newCourseFixture(t, &database.DocumentReview{}, &database.DocumentReviewEvent{}, &database.DocumentLock{}, &database.DocumentComment{})
+	svc := f.svc
+	svc.SetReviewWorkflow(NewReviewWorkflow(f.db))
+	svc.SetDocumentLocks(NewDocumentLocks(f.db))
+	svc.SetDocumentComments(NewDocumentComments(f.db))
+	ctx := context.Background()
+
+	if _, err := svc.TransitionDocumentReview(ctx, f.proofMeta, 10, ReviewActionSubmit, ReviewActionRequest{}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if _, err := svc.CreateDocumentComment(ctx, f.proofMeta, 10, DocumentCommentInput{Body: "check"}); err != nil {
+		t.Fatalf("comment: %v", err)
+	}
+	if _, err := svc.LockDocument(ctx, f.adminMeta, 10, 0); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	if err := svc.PurgeDocument(ctx, f.adminMeta, 10); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+
+	for _, model := range []any{&database.DocumentReview{}, &database.DocumentReviewEvent{}, &database.DocumentLock{}, &database.DocumentComment{}} {
+		var count int64
+		f.db.Model(model).Where("document_id = ?", 10).Count(&count)
+		if count != 0 {
+			t.Fatalf("expected %T rows of the purged document to be removed, %d left", model, count)
+		}
+	}
+}
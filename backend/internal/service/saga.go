@@ -0,0 +1,548 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+// saga 类型
+const (
+	SagaKindCategoryCopy = "category.bulk_copy"
+	SagaKindCategoryMove = "category.bulk_move"
+)
+
+// saga 步骤动作
+const (
+	sagaCreateNode    = "create_node"    // 创建节点，补偿：软删除
+	sagaCloneDocument = "clone_document" // 复制文档，补偿：删除副本
+	sagaBindDocument  = "bind_document"  // 绑定文档，补偿：解绑
+	sagaMoveNode      = "move_node"      // 移动节点，补偿：移回原父节点
+)
+
+// SagaResolveRollback 与 SagaResolveMarkResolved 为管理员处理卡住的 saga 的方式
+const (
+	SagaResolveRollback     = "rollback"      // 重新执行补偿
+	SagaResolveMarkResolved = "mark_resolved" // 已人工处理，仅更新状态
+)
+
+// DefaultSagaStaleAfter 日志超过该时长未推进的 saga 视为执行进程已崩溃
+const DefaultSagaStaleAfter = 2 * time.Minute
+
+var (
+	// ErrSagaJournalDisabled 未配置数据库，saga 只在内存中记录
+	ErrSagaJournalDisabled = errors.New("saga journal is not enabled")
+	// ErrSagaNotFound saga 不存在
+	ErrSagaNotFound = errors.New("saga not found")
+	// ErrSagaActive saga 仍在执行中，不能人工处理
+	ErrSagaActive = errors.New("saga is still running")
+	// ErrSagaFinished saga 已完成、已回滚或已处理
+	ErrSagaFinished = errors.New("saga already finished")
+)
+
+// SagaJournal 将批量分类操作的每个 NDR 调用在执行前写入数据库，
+// 进程崩溃后由恢复流程根据日志完成或回滚未结束的操作
+type SagaJournal struct {
+	db         *gorm.DB
+	owner      string
+	staleAfter time.Duration
+}
+
+// NewSagaJournal 创建 saga 日志；staleAfter <= 0 时使用 DefaultSagaStaleAfter
+func NewSagaJournal(db *gorm.DB, staleAfter time.Duration) *SagaJournal {
+	if staleAfter <= 0 {
+		staleAfter = DefaultSagaStaleAfter
+	}
+	hostname, _ := os.Hostname()
+	return &SagaJournal{
+		db:         db,
+		owner:      fmt.Sprintf("%s/%s", hostname, uuid.NewString()[:8]),
+		staleAfter: staleAfter,
+	}
+}
+
+// SetSagaJournal 启用 saga 日志；未设置时补偿所需的状态只保存在内存中
+func (s *Service) SetSagaJournal(journal *SagaJournal) {
+	s.sagas = journal
+}
+
+// sagaStepData 步骤参数与结果，按动作使用不同字段
+type sagaStepData struct {
+	NodeID       int64  `json:"node_id,omitempty"`
+	ParentID     *int64 `json:"parent_id,omitempty"` // create_node：父节点（nil 为根）
+	Name         string `json:"name,omitempty"`      // create_node：节点名称，结果未知时按名称查找
+	SourceID     int64  `json:"source_id,omitempty"` // clone_document：源文档
+	DocumentID   int64  `json:"document_id,omitempty"`
+	FromParentID *int64 `json:"from_parent_id,omitempty"` // move_node：原父节点（nil 为根）
+	ToParentID   *int64 `json:"to_parent_id,omitempty"`   // move_node：目标父节点（nil 为根）
+}
+
+type sagaStep struct {
+	id     uint
+	action string
+	data   sagaStepData
+	status string
+	err    string
+}
+
+// saga 一次批量操作的步骤日志；journal 为 nil 时只在内存中记录
+type saga struct {
+	journal *SagaJournal
+	id      uint
+	kind    string
+	steps   []*sagaStep
+}
+
+// beginSaga 开始记录一次批量操作；jobID 非 0 时表示由后台任务的步骤发起
+func (s *Service) beginSaga(kind string, meta RequestMeta, jobID uint) (*saga, error) {
+	g := &saga{journal: s.sagas, kind: kind}
+	if s.sagas == nil {
+		return g, nil
+	}
+	metaJSON, err := encodeMeta(meta)
+	if err != nil {
+		return nil, fmt.Errorf("encode saga meta: %w", err)
+	}
+	row := &database.Saga{
+		Kind:        kind,
+		Status:      database.SagaRunning,
+		Meta:        metaJSON,
+		Owner:       s.sagas.owner,
+		CreatedByID: meta.UserIDNumeric,
+	}
+	if jobID != 0 {
+		row.JobID = &jobID
+	}
+	if err := s.sagas.db.Create(row).Error; err != nil {
+		return nil, fmt.Errorf("create saga: %w", err)
+	}
+	g.id = row.ID
+	return g, nil
+}
+
+// plan 在调用 NDR 之前记录步骤，写入失败时不能继续执行
+func (g *saga) plan(action string, data sagaStepData) (*sagaStep, error) {
+	step := &sagaStep{action: action, data: data, status: database.SagaStepPlanned}
+	if g.journal != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		row := &database.SagaStep{SagaID: g.id, Seq: len(g.steps), Action: action, Data: string(raw), Status: step.status}
+		if err := g.journal.db.Create(row).Error; err != nil {
+			return nil, fmt.Errorf("write saga journal: %w", err)
+		}
+		step.id = row.ID
+		g.touch()
+	}
+	g.steps = append(g.steps, step)
+	return step, nil
+}
+
+// done 记录 NDR 调用成功及其结果（如新建节点 ID）
+func (g *saga) done(step *sagaStep) {
+	step.status = database.SagaStepDone
+	g.save(step)
+}
+
+// fail 记录 NDR 调用失败：服务端明确拒绝时无需补偿，网络错误等结果未知时保持 planned，由补偿流程探测
+func (g *saga) fail(step *sagaStep, cause error) {
+	var ndrErr *ndrclient.Error
+	if errors.As(cause, &ndrErr) && ndrErr.StatusCode < http.StatusInternalServerError {
+		step.status = database.SagaStepAborted
+	}
+	step.err = cause.Error()
+	g.save(step)
+}
+
+func (g *saga) save(step *sagaStep) {
+	if g.journal == nil {
+		return
+	}
+	raw, err := json.Marshal(step.data)
+	if err == nil {
+		err = g.journal.db.Model(&database.SagaStep{}).Where("id = ?", step.id).Updates(map[string]interface{}{
+			"data":   string(raw),
+			"status": step.status,
+			"error":  step.err,
+		}).Error
+	}
+	if err != nil {
+		// 日志未更新时步骤仍为 planned，恢复时会按结果未知处理
+		log.Printf("[saga] id=%d: failed to record step %s: %v", g.id, step.action, err)
+		return
+	}
+	g.touch()
+}
+
+// touch 刷新 updated_at，表示 saga 仍在推进
+func (g *saga) touch() {
+	g.journal.db.Model(&database.Saga{}).Where("id = ?", g.id).UpdateColumn("updated_at", time.Now())
+}
+
+// commit 正向执行全部完成，之后的失败不再回滚
+func (g *saga) commit() {
+	g.finish(database.SagaCommitted, "")
+}
+
+func (g *saga) finish(status, message string) {
+	if g.journal == nil {
+		return
+	}
+	now := time.Now()
+	err := g.journal.db.Model(&database.Saga{}).Where("id = ?", g.id).Updates(map[string]interface{}{
+		"status":      status,
+		"error":       message,
+		"finished_at": &now,
+	}).Error
+	if err != nil {
+		log.Printf("[saga] id=%d: failed to mark %s: %v", g.id, status, err)
+	}
+}
+
+// compensateSaga 按相反顺序补偿已执行（或结果未知）的步骤，返回撤销的节点数与文档数。
+// 全部补偿成功时 saga 标记为 compensated，否则标记为 needs_attention 等待管理员处理。
+func (s *Service) compensateSaga(ctx context.Context, meta RequestMeta, g *saga) (int, int) {
+	nodes, docs, failed := 0, 0, 0
+	for i := len(g.steps) - 1; i >= 0; i-- {
+		step := g.steps[i]
+		switch step.status {
+		case database.SagaStepPlanned, database.SagaStepDone, database.SagaStepCompensationFailed:
+		default:
+			continue
+		}
+		undone, err := s.undoSagaStep(ctx, meta, step)
+		if err != nil {
+			failed++
+			step.status = database.SagaStepCompensationFailed
+			step.err = err.Error()
+			log.Printf("[saga] id=%d: compensate %s %+v failed: %v", g.id, step.action, step.data, err)
+			g.save(step)
+			continue
+		}
+		step.status = database.SagaStepCompensated
+		step.err = ""
+		g.save(step)
+		if !undone {
+			continue
+		}
+		switch step.action {
+		case sagaCreateNode, sagaMoveNode:
+			nodes++
+		case sagaCloneDocument:
+			docs++
+		}
+	}
+	if failed > 0 {
+		g.finish(database.SagaNeedsAttention, fmt.Sprintf("%d steps could not be compensated", failed))
+	} else {
+		g.finish(database.SagaCompensated, "")
+	}
+	return nodes, docs
+}
+
+// undoSagaStep 补偿单个步骤，返回是否实际撤销了资源。
+// planned 步骤的 NDR 调用结果未知，需要先探测是否已生效。
+func (s *Service) undoSagaStep(ctx context.Context, meta RequestMeta, step *sagaStep) (bool, error) {
+	data := step.data
+	switch step.action {
+	case sagaCreateNode:
+		id := data.NodeID
+		if id == 0 {
+			// 名称在创建前已确保在同级中唯一，找到同名节点即为本次创建
+			siblings, err := s.listSiblingNodes(ctx, meta, data.ParentID)
+			if err != nil {
+				return false, fmt.Errorf("look up node %q: %w", data.Name, err)
+			}
+			for _, node := range siblings {
+				if node.Name == data.Name {
+					id = node.ID
+					break
+				}
+			}
+			if id == 0 {
+				return false, nil
+			}
+		}
+		return true, s.DeleteCategory(ctx, meta, id)
+	case sagaCloneDocument:
+		if data.DocumentID == 0 {
+			return false, fmt.Errorf("copy of document %d may have been created, check for an orphan copy", data.SourceID)
+		}
+		return true, s.ndr.DeleteDocument(ctx, toNDRMeta(meta), data.DocumentID)
+	case sagaBindDocument:
+		err := s.ndr.UnbindDocument(ctx, toNDRMeta(meta), data.NodeID, data.DocumentID)
+		if step.status == database.SagaStepPlanned {
+			// 绑定可能未生效，解绑失败可以忽略
+			return false, nil
+		}
+		return err == nil, err
+	case sagaMoveNode:
+		if step.status == database.SagaStepPlanned {
+			node, err := s.ndr.GetNode(ctx, toNDRMeta(meta), data.NodeID, ndrclient.GetNodeOptions{})
+			if err != nil {
+				return false, fmt.Errorf("get node %d: %w", data.NodeID, err)
+			}
+			if !sameParent(node.ParentID, data.ToParentID) || sameParent(data.FromParentID, data.ToParentID) {
+				return false, nil
+			}
+		}
+		_, err := s.MoveCategory(ctx, meta, data.NodeID, MoveCategoryRequest{NewParentID: data.FromParentID, ParentSpecified: true})
+		return err == nil, err
+	default:
+		return false, fmt.Errorf("unknown saga action %q", step.action)
+	}
+}
+
+func sameParent(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// RecoverSagas 处理其他进程遗留的、超过 staleAfter 未推进的 saga：
+// 移动操作的步骤已全部完成时补记为完成，其余一律回滚。
+// 属于仍在执行的后台任务的 saga 由任务重试步骤时处理。
+func (s *Service) RecoverSagas(ctx context.Context, credentials RequestMeta) (int, error) {
+	if s.sagas == nil {
+		return 0, ErrSagaJournalDisabled
+	}
+	activeJobs := s.sagas.db.Model(&database.Job{}).Select("id").
+		Where("status IN ?", []string{database.JobQueued, database.JobRunning})
+	var rows []database.Saga
+	err := s.sagas.db.Where("status = ? AND owner <> ? AND updated_at < ?",
+		database.SagaRunning, s.sagas.owner, time.Now().Add(-s.sagas.staleAfter)).
+		Where("job_id IS NULL OR job_id NOT IN (?)", activeJobs).
+		Order("id").Find(&rows).Error
+	if err != nil {
+		return 0, err
+	}
+	recovered := 0
+	for i := range rows {
+		if err := ctx.Err(); err != nil {
+			return recovered, err
+		}
+		meta, err := decodeMeta(rows[i].Meta, credentials)
+		if err != nil {
+			log.Printf("[saga] recover id=%d: decode meta: %v", rows[i].ID, err)
+			continue
+		}
+		ok, err := s.recoverSaga(ctx, &rows[i], meta, false)
+		if err != nil {
+			log.Printf("[saga] recover id=%d failed: %v", rows[i].ID, err)
+			continue
+		}
+		if ok {
+			recovered++
+		}
+	}
+	return recovered, nil
+}
+
+// RunSagaRecovery 启动时立即执行一次恢复，之后每隔 interval 检查一次，直到 ctx 取消
+func (s *Service) RunSagaRecovery(ctx context.Context, credentials RequestMeta, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := s.RecoverSagas(ctx, credentials); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("[saga] recovery failed: %v", err)
+		} else if n > 0 {
+			log.Printf("[saga] recovered %d sagas", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recoverJobSagas 后台任务重试步骤前，处理该任务上次执行时遗留的 saga
+func (s *Service) recoverJobSagas(ctx context.Context, jobID uint, credentials RequestMeta) error {
+	if s.sagas == nil {
+		return nil
+	}
+	var rows []database.Saga
+	if err := s.sagas.db.Where("job_id = ? AND status = ?", jobID, database.SagaRunning).Order("id").Find(&rows).Error; err != nil {
+		return err
+	}
+	for i := range rows {
+		meta, err := decodeMeta(rows[i].Meta, credentials)
+		if err != nil {
+			return fmt.Errorf("decode saga %d meta: %w", rows[i].ID, err)
+		}
+		if _, err := s.recoverSaga(ctx, &rows[i], meta, false); err != nil {
+			return fmt.Errorf("recover saga %d: %w", rows[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// recoverSaga 接管并结束一个未完成的 saga，返回是否由本进程处理。
+// rollback 为 false 时，步骤已全部完成的移动操作补记为完成而不回滚。
+func (s *Service) recoverSaga(ctx context.Context, row *database.Saga, meta RequestMeta, rollback bool) (bool, error) {
+	// 条件更新 owner 接管 saga，避免多个实例重复处理
+	res := s.sagas.db.Model(&database.Saga{}).
+		Where("id = ? AND status = ? AND owner = ?", row.ID, row.Status, row.Owner).
+		Updates(map[string]interface{}{"owner": s.sagas.owner, "updated_at": time.Now()})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+
+	g, err := s.loadSaga(row)
+	if err != nil {
+		return false, err
+	}
+	if !rollback && row.Kind == SagaKindCategoryMove && row.Status == database.SagaRunning && g.allDone() {
+		// 节点已全部移动，只差收尾排序：补记为完成
+		g.commit()
+		log.Printf("[saga] recovered id=%d kind=%s: all steps done, marked committed", row.ID, row.Kind)
+		return true, nil
+	}
+	nodes, docs := s.compensateSaga(ctx, meta, g)
+	log.Printf("[saga] recovered id=%d kind=%s: rolled back %d nodes and %d documents", row.ID, row.Kind, nodes, docs)
+	return true, nil
+}
+
+// loadSaga 从日志还原 saga
+func (s *Service) loadSaga(row *database.Saga) (*saga, error) {
+	var rows []database.SagaStep
+	if err := s.sagas.db.Where("saga_id = ?", row.ID).Order("seq").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	g := &saga{journal: s.sagas, id: row.ID, kind: row.Kind}
+	for _, r := range rows {
+		step := &sagaStep{id: r.ID, action: r.Action, status: r.Status, err: r.Error}
+		if r.Data != "" {
+			if err := json.Unmarshal([]byte(r.Data), &step.data); err != nil {
+				return nil, fmt.Errorf("decode saga step %d: %w", r.Seq, err)
+			}
+		}
+		g.steps = append(g.steps, step)
+	}
+	return g, nil
+}
+
+func (g *saga) allDone() bool {
+	for _, step := range g.steps {
+		if step.status != database.SagaStepDone {
+			return false
+		}
+	}
+	return len(g.steps) > 0
+}
+
+// SagaStepDetail saga 步骤及其参数
+type SagaStepDetail struct {
+	database.SagaStep
+	Data json.RawMessage `json:"data"`
+}
+
+// SagaDetail saga 及其全部步骤
+type SagaDetail struct {
+	database.Saga
+	Steps []SagaStepDetail `json:"steps"`
+}
+
+// ListSagas 列出 saga；status 为空时列出执行中与需要处理的
+func (s *Service) ListSagas(status string) ([]database.Saga, error) {
+	if s.sagas == nil {
+		return nil, ErrSagaJournalDisabled
+	}
+	statuses := []string{database.SagaRunning, database.SagaNeedsAttention}
+	if status != "" {
+		statuses = []string{status}
+	}
+	var sagas []database.Saga
+	err := s.sagas.db.Where("status IN ?", statuses).Order("id DESC").Limit(200).Find(&sagas).Error
+	return sagas, err
+}
+
+// GetSaga 查询 saga 及其步骤
+func (s *Service) GetSaga(id uint) (*SagaDetail, error) {
+	if s.sagas == nil {
+		return nil, ErrSagaJournalDisabled
+	}
+	var row database.Saga
+	if err := s.sagas.db.First(&row, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSagaNotFound
+		}
+		return nil, err
+	}
+	var steps []database.SagaStep
+	if err := s.sagas.db.Where("saga_id = ?", id).Order("seq").Find(&steps).Error; err != nil {
+		return nil, err
+	}
+	detail := &SagaDetail{Saga: row, Steps: make([]SagaStepDetail, 0, len(steps))}
+	for _, step := range steps {
+		item := SagaStepDetail{SagaStep: step}
+		if step.Data != "" {
+			item.Data = json.RawMessage(step.Data)
+		}
+		detail.Steps = append(detail.Steps, item)
+	}
+	return detail, nil
+}
+
+// ResolveSaga 由管理员处理卡住的 saga：重新执行补偿，或在人工修复后标记为已处理。
+// 只能处理需要关注的 saga，以及超过 staleAfter 未推进的执行中 saga。
+func (s *Service) ResolveSaga(ctx context.Context, meta RequestMeta, id uint, action, actor string) (*SagaDetail, error) {
+	detail, err := s.GetSaga(id)
+	if err != nil {
+		return nil, err
+	}
+	row := detail.Saga
+	switch row.Status {
+	case database.SagaNeedsAttention:
+	case database.SagaRunning:
+		if time.Since(row.UpdatedAt) < s.sagas.staleAfter {
+			return nil, ErrSagaActive
+		}
+	default:
+		return nil, ErrSagaFinished
+	}
+
+	switch action {
+	case SagaResolveRollback:
+		ok, err := s.recoverSaga(ctx, &row, meta, true)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrSagaActive
+		}
+	case SagaResolveMarkResolved:
+		now := time.Now()
+		res := s.sagas.db.Model(&database.Saga{}).Where("id = ? AND status = ?", id, row.Status).Updates(map[string]interface{}{
+			"status":      database.SagaResolved,
+			"resolved_by": actor,
+			"finished_at": &now,
+		})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil, ErrSagaActive
+		}
+	default:
+		return nil, fmt.Errorf("invalid action %q", action)
+	}
+	log.Printf("[saga] id=%d resolved by %s action=%s", id, actor, action)
+	return s.GetSaga(id)
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+func setupSagaDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupJobDB(t)
+	if err := db.AutoMigrate(&database.Saga{}, &database.SagaStep{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+// seedSaga 写入一个其他进程遗留的 saga，age 为距最后一次推进的时长
+func seedSaga(t *testing.T, db *gorm.DB, kind string, age time.Duration, steps ...database.SagaStep) *database.Saga {
+	t.Helper()
+	row := &database.Saga{
+		Kind:      kind,
+		Status:    database.SagaRunning,
+		Meta:      `{"user_id":"alice"}`,
+		Owner:     "crashed-host/1",
+		UpdatedAt: time.Now().Add(-age),
+	}
+	if err := db.Create(row).Error; err != nil {
+		t.Fatalf("seed saga: %v", err)
+	}
+	for i := range steps {
+		steps[i].SagaID = row.ID
+		steps[i].Seq = i
+		if err := db.Create(&steps[i]).Error; err != nil {
+			t.Fatalf("seed saga step: %v", err)
+		}
+	}
+	return row
+}
+
+func sagaStepRow(action, status string, data sagaStepData) database.SagaStep {
+	raw, _ := json.Marshal(data)
+	return database.SagaStep{Action: action, Status: status, Data: string(raw)}
+}
+
+func TestBulkCopyCategoriesWritesSagaJournal(t *testing.T) {
+	db := setupSagaDB(t)
+
+	fake := newCopySourceNDR()
+	svc := NewService(cache.NewNoop(), fake, nil)
+	svc.SetSagaJournal(NewSagaJournal(db, time.Minute))
+	if _, err := svc.BulkCopyCategories(context.Background(), RequestMeta{APIKey: "secret"}, CategoryBulkCopyRequest{SourceIDs: []int64{1}, Mode: CategoryCopyDeepCopy}); err != nil {
+		t.Fatalf("BulkCopyCategories: %v", err)
+	}
+	var committed database.Saga
+	db.First(&committed)
+	detail, _ := svc.GetSaga(committed.ID)
+	// 2 个节点，每个节点 1 个文档：复制 + 绑定
+	if detail.Status != database.SagaCommitted || len(detail.Steps) != 6 || committed.Meta == "" {
+		t.Fatalf("unexpected committed saga: %+v", detail)
+	}
+	for _, step := range detail.Steps {
+		if step.Status != database.SagaStepDone {
+			t.Fatalf("expected all steps done, got %+v", step)
+		}
+	}
+
+	// 绑定失败：日志中的每个步骤都被补偿
+	failing := &copyFailingNDR{archiveFakeNDR: newCopySourceNDR(), failBindNode: "Chapter 1"}
+	svc = NewService(cache.NewNoop(), failing, nil)
+	svc.SetSagaJournal(NewSagaJournal(db, time.Minute))
+	if _, err := svc.BulkCopyCategories(context.Background(), RequestMeta{}, CategoryBulkCopyRequest{SourceIDs: []int64{1}, Mode: CategoryCopyDeepCopy}); err == nil {
+		t.Fatalf("expected copy to fail")
+	}
+	var rolledBack database.Saga
+	db.Last(&rolledBack)
+	detail, _ = svc.GetSaga(rolledBack.ID)
+	if detail.Status != database.SagaCompensated || len(detail.Steps) != 6 {
+		t.Fatalf("unexpected compensated saga: %+v", detail)
+	}
+	for _, step := range detail.Steps {
+		if step.Status != database.SagaStepCompensated {
+			t.Fatalf("expected all steps compensated, got %+v", step)
+		}
+	}
+	if len(failing.deletedNodes) != 2 || len(failing.deletedDocIDs) != 2 {
+		t.Fatalf("unexpected rollback, nodes=%v docs=%v", failing.deletedNodes, failing.deletedDocIDs)
+	}
+}
+
+func TestRecoverSagasRollsBackCrashedCopy(t *testing.T) {
+	db := setupSagaDB(t)
+	fake := &copyFailingNDR{archiveFakeNDR: newCopySourceNDR()}
+	now := time.Now().UTC()
+
+	// 崩溃前：已创建根副本 100 并复制文档 200；子节点 101 已在 NDR 中创建但日志仍为 planned
+	fake.addNode(sampleNode(100, "Course (复制)", "/course-copy", nil, 1, now, now))
+	fake.addNode(sampleNode(101, "Chapter 1", "/course-copy/chapter-1", ptr(int64(100)), 0, now, now))
+	crashed := seedSaga(t, db, SagaKindCategoryCopy, time.Hour,
+		sagaStepRow(sagaCreateNode, database.SagaStepDone, sagaStepData{NodeID: 100, Name: "Course (复制)"}),
+		sagaStepRow(sagaCloneDocument, database.SagaStepDone, sagaStepData{SourceID: 10, DocumentID: 200}),
+		sagaStepRow(sagaBindDocument, database.SagaStepDone, sagaStepData{NodeID: 100, DocumentID: 200}),
+		sagaStepRow(sagaCreateNode, database.SagaStepPlanned, sagaStepData{ParentID: ptr(int64(100)), Name: "Chapter 1"}),
+	)
+	// 仍在推进的 saga 与仍在执行的任务所属的 saga 不处理
+	active := seedSaga(t, db, SagaKindCategoryCopy, 0)
+	job := &database.Job{Kind: JobKindCategoryBulkCopy, Status: database.JobRunning}
+	db.Create(job)
+	owned := seedSaga(t, db, SagaKindCategoryCopy, time.Hour)
+	db.Model(owned).Update("job_id", job.ID)
+
+	svc := NewService(cache.NewNoop(), fake, nil)
+	svc.SetSagaJournal(NewSagaJournal(db, time.Minute))
+	recovered, err := svc.RecoverSagas(context.Background(), RequestMeta{APIKey: "key"})
+	if err != nil || recovered != 1 {
+		t.Fatalf("expected one saga to be recovered: n=%d err=%v", recovered, err)
+	}
+	if len(fake.deletedNodes) != 2 || fake.deletedNodes[0] != 101 || fake.deletedNodes[1] != 100 {
+		t.Fatalf("expected probed child and root to be deleted, got %v", fake.deletedNodes)
+	}
+	if len(fake.deletedDocIDs) != 1 || fake.deletedDocIDs[0] != 200 {
+		t.Fatalf("expected cloned document to be deleted, got %v", fake.deletedDocIDs)
+	}
+	detail, _ := svc.GetSaga(crashed.ID)
+	if detail.Status != database.SagaCompensated || detail.FinishedAt == nil {
+		t.Fatalf("unexpected recovered saga: %+v", detail.Saga)
+	}
+	for _, id := range []uint{active.ID, owned.ID} {
+		if detail, _ := svc.GetSaga(id); detail.Status != database.SagaRunning {
+			t.Fatalf("saga %d must be left alone, got %s", id, detail.Status)
+		}
+	}
+}
+
+func TestRecoverSagasFinishesMovesAndResolve(t *testing.T) {
+	db := setupSagaDB(t)
+	fake := newCopySourceNDR()
+	svc := NewService(cache.NewNoop(), fake, nil)
+	svc.SetSagaJournal(NewSagaJournal(db, time.Minute))
+
+	// 移动已全部完成：补记为完成，不回滚
+	moved := seedSaga(t, db, SagaKindCategoryMove, time.Hour,
+		sagaStepRow(sagaMoveNode, database.SagaStepDone, sagaStepData{NodeID: 2, FromParentID: ptr(int64(1))}),
+	)
+	// 文档复制结果未知：无法自动回滚，等待管理员处理
+	unknown := seedSaga(t, db, SagaKindCategoryCopy, time.Hour,
+		sagaStepRow(sagaCloneDocument, database.SagaStepPlanned, sagaStepData{SourceID: 10}),
+	)
+	active := seedSaga(t, db, SagaKindCategoryCopy, 0)
+
+	if _, err := svc.RecoverSagas(context.Background(), RequestMeta{}); err != nil {
+		t.Fatalf("RecoverSagas: %v", err)
+	}
+	if detail, _ := svc.GetSaga(moved.ID); detail.Status != database.SagaCommitted {
+		t.Fatalf("expected completed move to be committed, got %s", detail.Status)
+	}
+	detail, _ := svc.GetSaga(unknown.ID)
+	if detail.Status != database.SagaNeedsAttention || detail.Steps[0].Status != database.SagaStepCompensationFailed || detail.Steps[0].Error == "" {
+		t.Fatalf("expected saga to need attention: %+v", detail)
+	}
+
+	stuck, err := svc.ListSagas("")
+	if err != nil || len(stuck) != 2 {
+		t.Fatalf("expected needs_attention and running sagas to be listed: %v %v", stuck, err)
+	}
+	if _, err := svc.ResolveSaga(context.Background(), RequestMeta{}, active.ID, SagaResolveMarkResolved, "root"); !errors.Is(err, ErrSagaActive) {
+		t.Fatalf("expected active saga to be rejected, got %v", err)
+	}
+	resolved, err := svc.ResolveSaga(context.Background(), RequestMeta{}, unknown.ID, SagaResolveMarkResolved, "root")
+	if err != nil || resolved.Status != database.SagaResolved || resolved.ResolvedBy != "root" {
+		t.Fatalf("unexpected resolve result: %+v %v", resolved, err)
+	}
+	if _, err := svc.ResolveSaga(context.Background(), RequestMeta{}, unknown.ID, SagaResolveRollback, "root"); !errors.Is(err, ErrSagaFinished) {
+		t.Fatalf("expected resolved saga to be final, got %v", err)
+	}
+	if _, err := svc.GetSaga(9999); !errors.Is(err, ErrSagaNotFound) {
+		t.Fatalf("expected ErrSagaNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnsafeHTML is returned when document content contains markup outside the type's allow-list.
+var ErrUnsafeHTML = errors.New("content contains disallowed html")
+
+// htmlPolicy is an allow-list of elements and attributes, modelled on the DOMPurify
+// configuration used by the frontend previews.
+type htmlPolicy struct {
+	elements   map[string]struct{}
+	attributes map[string]struct{}
+}
+
+func newHTMLPolicy(elements, attributes []string) *htmlPolicy {
+	p := &htmlPolicy{
+		elements:   make(map[string]struct{}, len(elements)),
+		attributes: make(map[string]struct{}, len(attributes)),
+	}
+	for _, e := range elements {
+		p.elements[strings.ToLower(e)] = struct{}{}
+	}
+	for _, a := range attributes {
+		p.attributes[strings.ToLower(a)] = struct{}{}
+	}
+	return p
+}
+
+var richTextElements = []string{
+	"p", "br", "hr", "div", "span",
+	"h1", "h2", "h3", "h4", "h5", "h6",
+	"ul", "ol", "li", "dl", "dt", "dd",
+	"table", "thead", "tbody", "tfoot", "tr", "th", "td", "caption",
+	"strong", "b", "em", "i", "u", "s", "del", "ins", "sub", "sup", "mark",
+	"code", "pre", "blockquote", "a", "img", "input",
+}
+
+var richTextAttributes = []string{
+	"class", "href", "target", "rel", "src", "alt", "title",
+	"width", "height", "colspan", "rowspan", "align", "start",
+	// GFM 任务列表渲染出的 <input type="checkbox" checked disabled>
+	"type", "checked", "disabled",
+}
+
+// richTextPolicy covers HTML fragments inside YAML fields and rendered Markdown.
+var richTextPolicy = newHTMLPolicy(richTextElements, richTextAttributes)
+
+// pageHTMLPolicy covers full HTML documents such as knowledge overviews.
+var pageHTMLPolicy = newHTMLPolicy(
+	append([]string{
+		"section", "article", "header", "footer", "main", "aside", "figure", "figcaption",
+		"svg", "g", "path", "circle", "ellipse", "rect", "line", "polyline", "polygon",
+		"text", "tspan", "defs", "lineargradient", "radialgradient", "stop", "clippath", "mask",
+	}, richTextElements...),
+	append([]string{
+		"id", "style", "viewbox", "preserveaspectratio",
+		"fill", "stroke", "stroke-width", "stroke-linecap", "stroke-linejoin", "stroke-dasharray",
+		"font-size", "font-weight", "font-family", "text-anchor", "dominant-baseline", "alignment-baseline",
+		"d", "cx", "cy", "r", "x", "y", "x1", "y1", "x2", "y2",
+		"points", "transform", "opacity", "stop-color", "stop-opacity",
+		"xmlns", "xmlns:xlink", "xlink:href",
+	}, richTextAttributes...),
+)
+
+// documentHTMLPolicies overrides the per-format default for specific document types.
+var documentHTMLPolicies = map[DocumentType]*htmlPolicy{
+	"knowledge_overview_v1": pageHTMLPolicy,
+}
+
+// htmlPolicyFor picks the allow-list for a document type, falling back to its content format.
+func htmlPolicyFor(docType DocumentType, format ContentFormat) *htmlPolicy {
+	if p, ok := documentHTMLPolicies[docType]; ok {
+		return p
+	}
+	if format == ContentFormatHTML {
+		return pageHTMLPolicy
+	}
+	return richTextPolicy
+}
+
+// droppedContentElements are removed together with everything inside them.
+var droppedContentElements = map[string]struct{}{
+	"script": {}, "style": {}, "iframe": {}, "frame": {}, "frameset": {}, "object": {}, "embed": {},
+	"applet": {}, "noscript": {}, "noembed": {}, "noframes": {}, "template": {}, "textarea": {}, "title": {}, "xmp": {},
+}
+
+var voidElements = map[string]struct{}{
+	"br": {}, "hr": {}, "img": {}, "input": {}, "col": {}, "area": {}, "base": {}, "link": {}, "meta": {}, "source": {}, "wbr": {},
+}
+
+var urlAttributes = map[string]struct{}{
+	"href": {}, "src": {}, "xlink:href": {}, "action": {}, "formaction": {}, "background": {}, "poster": {},
+}
+
+var safeURLSchemes = map[string]struct{}{
+	"http": {}, "https": {}, "mailto": {}, "tel": {},
+}
+
+// sanitize returns the input with disallowed markup removed, plus a description of every
+// dangerous construct that was dropped. Unknown but harmless attributes are stripped silently.
+func (p *htmlPolicy) sanitize(input string) (string, []string) {
+	var out strings.Builder
+	var violations []string
+	seen := make(map[string]struct{})
+	report := func(v string) {
+		if _, ok := seen[v]; ok {
+			return
+		}
+		seen[v] = struct{}{}
+		violations = append(violations, v)
+	}
+
+	z := html.NewTokenizer(strings.NewReader(input))
+	skipDepth := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				report(fmt.Sprintf("malformed html: %v", z.Err()))
+			}
+			break
+		}
+
+		switch tt {
+		case html.TextToken:
+			if skipDepth == 0 {
+				out.WriteString(html.EscapeString(string(z.Text())))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if _, drop := droppedContentElements[tag]; drop {
+				report("<" + tag + ">")
+				if tt == html.StartTagToken {
+					skipDepth++
+				}
+				continue
+			}
+			if skipDepth > 0 {
+				continue
+			}
+			if _, ok := p.elements[tag]; !ok {
+				report("<" + tag + ">")
+				continue
+			}
+
+			out.WriteByte('<')
+			out.WriteString(tag)
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if attr, ok := p.filterAttribute(tag, string(key), string(val), report); ok {
+					out.WriteString(attr)
+				}
+			}
+			if tt == html.SelfClosingTagToken {
+				out.WriteString(" />")
+			} else {
+				out.WriteByte('>')
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if _, drop := droppedContentElements[tag]; drop {
+				if skipDepth > 0 {
+					skipDepth--
+				}
+				continue
+			}
+			if skipDepth > 0 {
+				continue
+			}
+			if _, ok := p.elements[tag]; !ok {
+				continue
+			}
+			if _, void := voidElements[tag]; void {
+				continue
+			}
+			out.WriteString("</" + tag + ">")
+		}
+		// 注释与 DOCTYPE 直接丢弃
+	}
+	return out.String(), violations
+}
+
+// filterAttribute renders a single allowed attribute, reporting event handlers and unsafe URLs.
+func (p *htmlPolicy) filterAttribute(tag, key, val string, report func(string)) (string, bool) {
+	if strings.HasPrefix(key, "on") {
+		report(fmt.Sprintf("<%s %s>", tag, key))
+		return "", false
+	}
+	if _, ok := p.attributes[key]; !ok {
+		return "", false
+	}
+	if _, isURL := urlAttributes[key]; isURL && !isSafeURL(val, tag == "img" && key == "src") {
+		report(fmt.Sprintf("<%s %s=%q>", tag, key, val))
+		return "", false
+	}
+	if key == "style" && !isSafeStyle(val) {
+		report(fmt.Sprintf("<%s style=%q>", tag, val))
+		return "", false
+	}
+	return fmt.Sprintf(` %s="%s"`, key, html.EscapeString(val)), true
+}
+
+func isSafeURL(raw string, allowDataImage bool) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, raw)
+	lower := strings.ToLower(cleaned)
+	colon := strings.IndexByte(lower, ':')
+	if colon == -1 {
+		return true
+	}
+	// 冒号出现在路径、查询或锚点之后时视为相对地址
+	if idx := strings.IndexAny(lower, "/?#"); idx != -1 && idx < colon {
+		return true
+	}
+	scheme := lower[:colon]
+	if _, ok := safeURLSchemes[scheme]; ok {
+		return true
+	}
+	if scheme == "data" && allowDataImage {
+		for _, prefix := range []string{"data:image/png", "data:image/jpeg", "data:image/gif", "data:image/webp"} {
+			if strings.HasPrefix(lower, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isSafeStyle(style string) bool {
+	normalized := strings.ToLower(strings.Join(strings.Fields(style), ""))
+	for _, bad := range []string{"expression(", "javascript:", "vbscript:", "-moz-binding", "behavior:", "@import"} {
+		if strings.Contains(normalized, bad) {
+			return false
+		}
+	}
+	return true
+}
+
+// sanitizeHTML applies the policy and discards the violation report.
+func sanitizeHTML(p *htmlPolicy, input string) string {
+	cleaned, _ := p.sanitize(input)
+	return cleaned
+}
+
+// ValidateDocumentHTML rejects content whose HTML would be stripped by the renderer for
+// security reasons: scripts, embedded frames, event handlers and javascript: URLs.
+// YAML documents are checked field by field since their string values are rendered as HTML.
+func ValidateDocumentHTML(content map[string]any, docType string) error {
+	if content == nil {
+		return nil
+	}
+	format, _ := content["format"].(string)
+	data, _ := content["data"].(string)
+	if strings.TrimSpace(data) == "" {
+		return nil
+	}
+	policy := htmlPolicyFor(DocumentType(docType), ContentFormat(format))
+
+	var violations []string
+	switch ContentFormat(format) {
+	case ContentFormatYAML:
+		_, body := splitFrontMatter(data)
+		var tree any
+		if err := yaml.Unmarshal([]byte(body), &tree); err != nil {
+			// 结构错误由类型校验负责，这里只关心能解析出的字段
+			return nil
+		}
+		walkYAMLStrings(tree, "", func(path, value string) {
+			if !strings.Contains(value, "<") {
+				return
+			}
+			if _, found := policy.sanitize(value); len(found) > 0 {
+				violations = append(violations, fmt.Sprintf("%s: %s", path, strings.Join(found, ", ")))
+			}
+		})
+	case ContentFormatHTML:
+		_, body := splitFrontMatter(data)
+		_, violations = policy.sanitize(body)
+	case ContentFormatMarkdown:
+		rendered, err := renderMarkdown(data)
+		if err != nil {
+			return fmt.Errorf("render markdown: %w", err)
+		}
+		_, violations = policy.sanitize(rendered)
+	default:
+		return nil
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnsafeHTML, strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// walkYAMLStrings visits every string scalar with a dotted path such as details[0].answer.
+func walkYAMLStrings(node any, path string, visit func(path, value string)) {
+	switch v := node.(type) {
+	case string:
+		visit(path, v)
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			walkYAMLStrings(v[k], child, visit)
+		}
+	case []any:
+		for i, item := range v {
+			walkYAMLStrings(item, fmt.Sprintf("%s[%d]", path, i), visit)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+)
+
+func TestSanitizeHTMLStripsDangerousMarkup(t *testing.T) {
+	input := `<p class="lead" onclick="steal()">Hi<script>alert(1)</script></p>` +
+		`<a href="javascript:alert(1)">x</a><a href="/docs?a=b:c">ok</a><iframe src="https://evil"></iframe><font>plain</font>`
+
+	cleaned, violations := richTextPolicy.sanitize(input)
+
+	for _, bad := range []string{"script", "alert", "onclick", "javascript:", "iframe", "<font"} {
+		if strings.Contains(cleaned, bad) {
+			t.Fatalf("sanitized output still contains %q: %s", bad, cleaned)
+		}
+	}
+	for _, want := range []string{`<p class="lead">Hi</p>`, `<a href="/docs?a=b:c">ok</a>`, "plain"} {
+		if !strings.Contains(cleaned, want) {
+			t.Fatalf("sanitized output missing %q: %s", want, cleaned)
+		}
+	}
+	if len(violations) != 5 {
+		t.Fatalf("expected 5 violations, got %v", violations)
+	}
+}
+
+func TestValidateDocumentHTMLRejectsUnsafeYAMLFields(t *testing.T) {
+	safe := map[string]any{"format": "yaml", "data": "---\nid: 0\n---\n\ntitle: <p>题干</p>\nanalysis: <p><strong>解析</strong></p>\n"}
+	if err := ValidateDocumentHTML(safe, "case_analysis_v1"); err != nil {
+		t.Fatalf("expected safe content to pass, got %v", err)
+	}
+
+	unsafe := map[string]any{"format": "yaml", "data": "title: <p>题干</p>\ndetails:\n  - question: <img src=x onerror=alert(1)>\n"}
+	err := ValidateDocumentHTML(unsafe, "case_analysis_v1")
+	if !errors.Is(err, ErrUnsafeHTML) {
+		t.Fatalf("expected ErrUnsafeHTML, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "details[0].question") {
+		t.Fatalf("expected error to name the field, got %v", err)
+	}
+}
+
+func TestValidateDocumentHTMLMarkdownAllowsCodeBlocks(t *testing.T) {
+	code := map[string]any{"format": "markdown", "data": "# 示例\n\n```html\n<script>alert(1)</script>\n```\n"}
+	if err := ValidateDocumentHTML(code, "markdown_v1"); err != nil {
+		t.Fatalf("script inside a code block should be allowed, got %v", err)
+	}
+	raw := map[string]any{"format": "markdown", "data": "# 示例\n\n<script>alert(1)</script>\n"}
+	if err := ValidateDocumentHTML(raw, "markdown_v1"); !errors.Is(err, ErrUnsafeHTML) {
+		t.Fatalf("expected raw script to be rejected, got %v", err)
+	}
+}
+
+func TestCreateDocumentRejectsUnsafeHTML(t *testing.T) {
+	svc := NewService(cache.NewNoop(), newFakeNDR(), nil)
+	docType := "knowledge_overview_v1"
+	_, err := svc.CreateDocument(context.Background(), RequestMeta{}, DocumentCreateRequest{
+		Title:   "Overview",
+		Type:    &docType,
+		Content: map[string]any{"format": "html", "data": `<div onmouseover="x()">hi</div>`},
+	})
+	if !errors.Is(err, ErrUnsafeHTML) {
+		t.Fatalf("expected ErrUnsafeHTML, got %v", err)
+	}
+}
+
+func TestRenderDocumentAppliesTheme(t *testing.T) {
+	now := time.Now().UTC()
+	doc := sampleDocument(7, "Overview", "knowledge_overview_v1", 0, now, now)
+	doc.Content = map[string]any{"format": "html", "data": "---\nid: 0\n---\n\n<div class=\"yjxt-content-card\" style=\"color: red\">内容<script>x()</script></div>"}
+
+	rendered, err := renderDocument(doc, "classic")
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	if !strings.Contains(rendered.HTML, "overview-theme-classic") || !strings.Contains(rendered.HTML, `style="color: red"`) {
+		t.Fatalf("unexpected html: %s", rendered.HTML)
+	}
+	if strings.Contains(rendered.HTML, "script") {
+		t.Fatalf("script should be stripped: %s", rendered.HTML)
+	}
+	if !strings.Contains(rendered.CSS, ".overview-theme-classic") {
+		t.Fatalf("expected theme css, got %q", rendered.CSS)
+	}
+
+	if _, err := renderDocument(doc, "missing"); !errors.Is(err, ErrUnknownDocumentTheme) {
+		t.Fatalf("expected ErrUnknownDocumentTheme, got %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"hash/crc32"
 	"regexp"
 	"strings"
+	"sync"
 	"unicode"
 
 	"github.com/yjxt/ydms/backend/internal/cache"
@@ -17,6 +18,15 @@ type Service struct {
 	cache       cache.Provider
 	ndr         ndrclient.Client
 	userService *UserService // 用于查询用户权限
+	docLocksMu  sync.Mutex
+	docLocks    map[int64]*documentWriteLock // 串行化带版本校验的文档更新，无人等待时移除
+	sagas       *SagaJournal                 // 批量分类操作的补偿日志，nil 时只在内存中记录
+	tree        *categoryTreeCache
+	events      *EventBroker      // 变更事件分发，nil 时不发布
+	editLocks   *DocumentLocks    // 文档编辑锁（软锁），nil 时不启用
+	reviews     *ReviewWorkflow   // 文档审核流程，nil 时不启用
+	comments    *DocumentComments // 文档评论，nil 时不启用
+	tags        *TagRegistry      // 课程标签词表，nil 时标签只做去空白与去重
 }
 
 // RequestMeta propagates authentication info to downstream services.
@@ -27,6 +37,7 @@ type RequestMeta struct {
 	AdminKey      string
 	UserRole      string // 用户角色
 	UserIDNumeric uint   // 用户 ID (数字)
+	Username      string // 认证用户的用户名
 }
 
 func toNDRMeta(meta RequestMeta) ndrclient.RequestMeta {
@@ -44,6 +55,7 @@ func NewService(cache cache.Provider, ndr ndrclient.Client, userService *UserSer
 		cache:       cache,
 		ndr:         ndr,
 		userService: userService,
+		tree:        newCategoryTreeCache(DefaultCategoryTreeTTL),
 	}
 }
 
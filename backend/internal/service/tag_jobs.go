@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+// JobKindTagSync 标签改名、替换同义词或合并后，将词表变化同步到课程中的文档
+const JobKindTagSync = "tag.sync_documents"
+
+// tagSyncRequest 标签同步任务的参数
+type tagSyncRequest struct {
+	TagID uint `json:"tag_id"`
+}
+
+// RegisterTagJobs 注册标签同步任务的执行器
+func (s *Service) RegisterTagJobs(jobs *JobService) {
+	jobs.Register(JobKindTagSync, &tagSyncRunner{svc: s})
+}
+
+// EnqueueTagSync 将标签同步写入任务队列；同步可以整体重新执行，因此只有一个步骤
+func (s *JobService) EnqueueTagSync(meta RequestMeta, tagID uint) (*database.Job, error) {
+	return s.Enqueue(JobKindTagSync, meta, tagSyncRequest{TagID: tagID}, []string{strconv.FormatUint(uint64(tagID), 10)})
+}
+
+type tagSyncRunner struct {
+	svc *Service
+}
+
+func (r *tagSyncRunner) RunStep(ctx context.Context, run *JobRun, step database.JobStep) (any, error) {
+	var req tagSyncRequest
+	if err := run.Decode(&req); err != nil {
+		return nil, err
+	}
+	return r.svc.SyncTagDocuments(ctx, run.Meta, req.TagID)
+}
+
+func (r *tagSyncRunner) Finish(ctx context.Context, run *JobRun, steps []database.JobStep) (any, error) {
+	var result TagChangeResult
+	if err := DecodeStepResult(steps[0], &result); err != nil {
+		return nil, fmt.Errorf("decode step %s: %w", steps[0].Key, err)
+	}
+	return result, nil
+}
+
+// Compensate 不撤销：已同步的文档与修改后的词表一致，保留即可
+func (r *tagSyncRunner) Compensate(ctx context.Context, run *JobRun, steps []database.JobStep) {
+	log.Printf("[tags] sync job=%d stopped, documents already updated are kept", run.Job.ID)
+}
@@ -0,0 +1,840 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+const (
+	// MaxTagNameLength 标签名称的最大字符数
+	MaxTagNameLength = 64
+	// maxBulkTagDocuments 单次批量打标签允许的文档数
+	maxBulkTagDocuments = 500
+)
+
+var (
+	// ErrTagRegistryDisabled 未启用标签词表
+	ErrTagRegistryDisabled = errors.New("tag registry is disabled")
+	// ErrTagNotFound 标签不存在
+	ErrTagNotFound = errors.New("tag not found")
+	// ErrInvalidTag 标签参数不合法
+	ErrInvalidTag = errors.New("invalid tag")
+	// ErrTagConflict 名称或同义词已被同一课程的其他标签使用
+	ErrTagConflict = errors.New("tag name conflicts with an existing tag or synonym")
+	// ErrTagForbidden 没有课程权限，或不是课程管理员
+	ErrTagForbidden = errors.New("tag action forbidden")
+)
+
+// TagInput 创建标签的参数
+type TagInput struct {
+	CourseID int64    `json:"course_id"`
+	Name     string   `json:"name"`
+	ParentID *uint    `json:"parent_id"`
+	Synonyms []string `json:"synonyms"`
+}
+
+// TagUpdate 修改标签的参数，未提供的字段保持不变
+type TagUpdate struct {
+	Name     *string   `json:"name"`      // 改名后旧名称保留为同义词，使用旧名称的文档改为新名称
+	ParentID *uint     `json:"parent_id"` // 0 表示移到顶级
+	Synonyms *[]string `json:"synonyms"`  // 替换全部同义词
+}
+
+// TagDocumentFailure 同步标签时未能更新的文档
+type TagDocumentFailure struct {
+	DocumentID int64  `json:"document_id"`
+	Error      string `json:"error"`
+}
+
+// TagChangeResult 标签修改或合并的结果，以及同步到文档的情况
+type TagChangeResult struct {
+	Tag              *database.Tag        `json:"tag"`
+	UpdatedDocuments []int64              `json:"updated_documents"`
+	Failed           []TagDocumentFailure `json:"failed,omitempty"`
+}
+
+// BulkTagRequest 批量打标签或移除标签
+type BulkTagRequest struct {
+	DocumentIDs []int64  `json:"document_ids"`
+	Tags        []string `json:"tags"`
+}
+
+// BulkTagResult 单个文档的批量打标签结果
+type BulkTagResult struct {
+	DocumentID int64    `json:"document_id"`
+	Tags       []string `json:"tags"` // 处理后的标签
+	Changed    bool     `json:"changed"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// TagCloud 分类子树中的标签统计
+type TagCloud struct {
+	CategoryID int64          `json:"category_id"`
+	CourseID   int64          `json:"course_id"`
+	Documents  int            `json:"documents"`
+	Tags       []TagCloudItem `json:"tags"`
+}
+
+// TagCloudItem 标签在子树中的使用次数；未登记到词表的标签 tag_id 为空
+type TagCloudItem struct {
+	Name     string `json:"name"`
+	TagID    *uint  `json:"tag_id,omitempty"`
+	ParentID *uint  `json:"parent_id,omitempty"`
+	Count    int    `json:"count"` // 直接使用该标签的文档数
+	Total    int    `json:"total"` // 使用该标签或其任一下级标签的文档数
+}
+
+// TagRegistry 按课程维护的标签词表
+type TagRegistry struct {
+	db *gorm.DB
+}
+
+// NewTagRegistry 创建标签词表存储
+func NewTagRegistry(db *gorm.DB) *TagRegistry {
+	return &TagRegistry{db: db}
+}
+
+// SetTagRegistry 启用标签词表；未设置时文档标签只做去空白与去重
+func (s *Service) SetTagRegistry(registry *TagRegistry) {
+	s.tags = registry
+}
+
+// ListTags 返回课程的标签词表（含同义词），按名称排序
+func (s *Service) ListTags(meta RequestMeta, courseID int64) ([]database.Tag, error) {
+	if s.tags == nil {
+		return nil, ErrTagRegistryDisabled
+	}
+	if err := s.requireTagCourse(meta, courseID, false); err != nil {
+		return nil, err
+	}
+	return s.tags.list(courseID)
+}
+
+// CreateTag 在课程词表中新建标签，仅课程管理员与超级管理员可操作
+func (s *Service) CreateTag(meta RequestMeta, input TagInput) (*database.Tag, error) {
+	if s.tags == nil {
+		return nil, ErrTagRegistryDisabled
+	}
+	if input.CourseID <= 0 {
+		return nil, fmt.Errorf("%w: course_id is required", ErrInvalidTag)
+	}
+	if err := s.requireTagCourse(meta, input.CourseID, true); err != nil {
+		return nil, err
+	}
+	name, err := cleanTagName(input.Name)
+	if err != nil {
+		return nil, err
+	}
+	tag := database.Tag{CourseID: input.CourseID, Name: name, Key: tagKey(name)}
+	synonyms, err := tagSynonyms(input.Synonyms, tag.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tags.db.Transaction(func(tx *gorm.DB) error {
+		if input.ParentID != nil && *input.ParentID != 0 {
+			if _, err := loadCourseTag(tx, input.CourseID, *input.ParentID); err != nil {
+				return err
+			}
+			tag.ParentID = input.ParentID
+		}
+		for _, key := range append([]string{tag.Key}, synonymKeys(synonyms)...) {
+			if err := checkTagKey(tx, input.CourseID, key, 0); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&tag).Error; err != nil {
+			return err
+		}
+		return replaceTagSynonyms(tx, &tag, synonyms)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.tags.get(tag.ID)
+}
+
+// UpdateTag 修改标签的名称、上级或同义词；名称与同义词的变化由 SyncTagDocuments 同步到文档
+func (s *Service) UpdateTag(meta RequestMeta, tagID uint, update TagUpdate) (*database.Tag, error) {
+	if s.tags == nil {
+		return nil, ErrTagRegistryDisabled
+	}
+	tag, err := s.tags.get(tagID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireTagCourse(meta, tag.CourseID, true); err != nil {
+		return nil, err
+	}
+
+	synonyms := tagSynonymNames(tag.Synonyms)
+	if update.Synonyms != nil {
+		synonyms = *update.Synonyms
+	}
+	if update.Name != nil {
+		name, err := cleanTagName(*update.Name)
+		if err != nil {
+			return nil, err
+		}
+		if key := tagKey(name); key != tag.Key {
+			// 旧名称保留为同义词，尚未同步的文档与习惯旧名称的用户仍能匹配到该标签
+			synonyms = append(synonyms, tag.Name)
+			tag.Key = key
+		}
+		tag.Name = name
+	}
+	cleaned, err := tagSynonyms(synonyms, tag.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tags.db.Transaction(func(tx *gorm.DB) error {
+		if update.ParentID != nil {
+			tag.ParentID = nil
+			if *update.ParentID != 0 {
+				if err := checkTagParent(tx, tag, *update.ParentID); err != nil {
+					return err
+				}
+				tag.ParentID = update.ParentID
+			}
+		}
+		for _, key := range append([]string{tag.Key}, synonymKeys(cleaned)...) {
+			if err := checkTagKey(tx, tag.CourseID, key, tag.ID); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(tag).Select("name", "key", "parent_id", "updated_at").Updates(tag).Error; err != nil {
+			return err
+		}
+		return replaceTagSynonyms(tx, tag, cleaned)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.tags.get(tag.ID)
+}
+
+// MergeTag 将 source 合并到 target：source 的名称与同义词成为 target 的同义词，
+// 下级标签移到 target 之下；文档中的 source 标签由 SyncTagDocuments 替换为 target
+func (s *Service) MergeTag(meta RequestMeta, sourceID, targetID uint) (*database.Tag, error) {
+	if s.tags == nil {
+		return nil, ErrTagRegistryDisabled
+	}
+	if sourceID == targetID {
+		return nil, fmt.Errorf("%w: cannot merge a tag into itself", ErrInvalidTag)
+	}
+	source, err := s.tags.get(sourceID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.tags.get(targetID)
+	if err != nil {
+		return nil, err
+	}
+	if source.CourseID != target.CourseID {
+		return nil, fmt.Errorf("%w: tags belong to different courses", ErrInvalidTag)
+	}
+	if err := s.requireTagCourse(meta, target.CourseID, true); err != nil {
+		return nil, err
+	}
+
+	synonyms := append(tagSynonymNames(target.Synonyms), source.Name)
+	synonyms = append(synonyms, tagSynonymNames(source.Synonyms)...)
+	cleaned, err := tagSynonyms(synonyms, target.Key)
+	if err != nil {
+		return nil, err
+	}
+	err = s.tags.db.Transaction(func(tx *gorm.DB) error {
+		// target 在 source 之下时先移到 source 的上级，避免下级标签移动后形成环
+		if descendant, err := isTagDescendant(tx, target, source.ID); err != nil {
+			return err
+		} else if descendant {
+			target.ParentID = source.ParentID
+			if err := tx.Model(target).Select("parent_id").Updates(target).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&database.Tag{}).Where("parent_id = ? AND id <> ?", source.ID, target.ID).
+			Update("parent_id", target.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id = ?", source.ID).Delete(&database.TagSynonym{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&database.Tag{}, source.ID).Error; err != nil {
+			return err
+		}
+		return replaceTagSynonyms(tx, target, cleaned)
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[tags] course=%d merged tag %q (id=%d) into %q (id=%d) by %s", target.CourseID, source.Name, source.ID, target.Name, target.ID, meta.Username)
+	return s.tags.get(target.ID)
+}
+
+// DeleteTag 从词表中删除标签及其同义词，下级标签移到其上级；文档中的标签保持不变
+func (s *Service) DeleteTag(meta RequestMeta, tagID uint) error {
+	if s.tags == nil {
+		return ErrTagRegistryDisabled
+	}
+	tag, err := s.tags.get(tagID)
+	if err != nil {
+		return err
+	}
+	if err := s.requireTagCourse(meta, tag.CourseID, true); err != nil {
+		return err
+	}
+	return s.tags.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.Tag{}).Where("parent_id = ?", tag.ID).Update("parent_id", tag.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&database.TagSynonym{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&database.Tag{}, tag.ID).Error
+	})
+}
+
+// BulkTagDocuments 为一组文档添加（remove 为 false）或移除标签。标签先按文档所属课程的词表归一化，
+// 单个文档失败（无权限、被锁定、审核状态不允许修改等）不影响其他文档
+func (s *Service) BulkTagDocuments(ctx context.Context, meta RequestMeta, req BulkTagRequest, remove bool) ([]BulkTagResult, error) {
+	if len(req.DocumentIDs) == 0 {
+		return nil, fmt.Errorf("%w: document_ids is required", ErrInvalidTag)
+	}
+	if len(req.DocumentIDs) > maxBulkTagDocuments {
+		return nil, fmt.Errorf("%w: at most %d documents per request", ErrInvalidTag, maxBulkTagDocuments)
+	}
+	if len(req.Tags) == 0 {
+		return nil, fmt.Errorf("%w: tags is required", ErrInvalidTag)
+	}
+	for _, name := range req.Tags {
+		if _, err := cleanTagName(name); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]BulkTagResult, 0, len(req.DocumentIDs))
+	for _, docID := range req.DocumentIDs {
+		result := BulkTagResult{DocumentID: docID}
+		if err := s.bulkTagDocument(ctx, meta, docID, req.Tags, remove, &result); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (s *Service) bulkTagDocument(ctx context.Context, meta RequestMeta, docID int64, names []string, remove bool, result *BulkTagResult) error {
+	courses, err := s.documentBoundCourses(ctx, meta, docID)
+	if err != nil {
+		return err
+	}
+	if ok, err := s.hasAnyCoursePermission(meta, courses); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("%w: no permission for document %d", ErrTagForbidden, docID)
+	}
+	doc, err := s.ndr.GetDocument(ctx, toNDRMeta(meta), docID)
+	if err != nil {
+		return err
+	}
+	vocab, err := s.tagVocabulary(courses)
+	if err != nil {
+		return err
+	}
+
+	current := vocab.canonicalize(documentTags(doc.Metadata))
+	var next []string
+	if remove {
+		drop := make(map[string]struct{})
+		for _, name := range vocab.canonicalize(names) {
+			drop[tagKey(name)] = struct{}{}
+		}
+		for _, name := range current {
+			if _, ok := drop[tagKey(name)]; !ok {
+				next = append(next, name)
+			}
+		}
+	} else {
+		next = vocab.canonicalize(append(current, names...))
+	}
+	result.Tags = next
+	if slices.Equal(next, documentTags(doc.Metadata)) {
+		return nil
+	}
+
+	metadata := make(map[string]any, len(doc.Metadata)+1)
+	for k, v := range doc.Metadata {
+		metadata[k] = v
+	}
+	metadata["tags"] = tagsToAny(next)
+	if _, err := s.UpdateDocument(ctx, meta, docID, DocumentUpdateRequest{Metadata: metadata}); err != nil {
+		return err
+	}
+	result.Changed = true
+	return nil
+}
+
+// TagCloud 统计分类子树（含子孙节点）中文档使用的标签，标签按课程词表归一化后计数
+func (s *Service) TagCloud(ctx context.Context, meta RequestMeta, categoryID int64) (*TagCloud, error) {
+	courseID, err := s.categoryRootID(ctx, meta, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireTagCourse(meta, courseID, false); err != nil {
+		return nil, err
+	}
+	docs, err := s.listSubtreeDocuments(ctx, meta, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	vocab, err := s.tagVocabulary([]int64{courseID})
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]*database.Tag, len(vocab.tags))
+	byID := make(map[uint]*database.Tag, len(vocab.tags))
+	for i := range vocab.tags {
+		byKey[vocab.tags[i].Key] = &vocab.tags[i]
+		byID[vocab.tags[i].ID] = &vocab.tags[i]
+	}
+	items := make(map[string]*TagCloudItem)
+	item := func(name string) *TagCloudItem {
+		key := tagKey(name)
+		if existing, ok := items[key]; ok {
+			return existing
+		}
+		entry := &TagCloudItem{Name: name}
+		if tag, ok := byKey[key]; ok {
+			entry.Name, entry.TagID, entry.ParentID = tag.Name, &tag.ID, tag.ParentID
+		}
+		items[key] = entry
+		return entry
+	}
+
+	for _, doc := range docs {
+		counted := make(map[string]struct{})
+		for _, name := range vocab.canonicalize(documentTags(doc.Metadata)) {
+			entry := item(name)
+			entry.Count++
+			// 标签及其全部上级各计一次，同一文档不重复计数
+			for key := tagKey(name); ; {
+				if _, ok := counted[key]; ok {
+					break
+				}
+				counted[key] = struct{}{}
+				items[key].Total++
+				tag, ok := byKey[key]
+				if !ok || tag.ParentID == nil || byID[*tag.ParentID] == nil {
+					break
+				}
+				parent := byID[*tag.ParentID]
+				item(parent.Name)
+				key = parent.Key
+			}
+		}
+	}
+
+	cloud := &TagCloud{CategoryID: categoryID, CourseID: courseID, Documents: len(docs), Tags: make([]TagCloudItem, 0, len(items))}
+	for _, entry := range items {
+		cloud.Tags = append(cloud.Tags, *entry)
+	}
+	sort.Slice(cloud.Tags, func(i, j int) bool {
+		if cloud.Tags[i].Total != cloud.Tags[j].Total {
+			return cloud.Tags[i].Total > cloud.Tags[j].Total
+		}
+		return cloud.Tags[i].Name < cloud.Tags[j].Name
+	})
+	return cloud, nil
+}
+
+// normalizeMetadataTags 将 metadata.tags 去空白、去重，并按文档所属课程的词表替换为规范名称；
+// docID 为 0（新建文档尚未绑定）时只做清理
+func (s *Service) normalizeMetadataTags(ctx context.Context, meta RequestMeta, docID int64, metadata map[string]any) error {
+	if _, ok := metadata["tags"].([]any); !ok {
+		return nil
+	}
+	var courses []int64
+	if s.tags != nil && docID != 0 {
+		var err error
+		if courses, err = s.documentBoundCourses(ctx, meta, docID); err != nil {
+			return fmt.Errorf("resolve document courses: %w", err)
+		}
+	}
+	return s.normalizeTagsForCourses(courses, metadata)
+}
+
+// normalizeTagsForCourses 按给定课程的词表归一化 metadata.tags；courses 为空时只做清理
+func (s *Service) normalizeTagsForCourses(courses []int64, metadata map[string]any) error {
+	raw, ok := metadata["tags"].([]any)
+	if !ok {
+		return nil
+	}
+	vocab, err := s.tagVocabulary(courses)
+	if err != nil {
+		return fmt.Errorf("load tag registry: %w", err)
+	}
+	names := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if name, ok := v.(string); ok {
+			names = append(names, name)
+		}
+	}
+	metadata["tags"] = tagsToAny(vocab.canonicalize(names))
+	return nil
+}
+
+// retagDocument 文档绑定到新课程后按该课程的词表归一化标签，标签不变时不写入新版本
+func (s *Service) retagDocument(ctx context.Context, meta RequestMeta, docID int64) error {
+	if s.tags == nil {
+		return nil
+	}
+	doc, err := s.ndr.GetDocument(ctx, toNDRMeta(meta), docID)
+	if err != nil {
+		return err
+	}
+	tags := documentTags(doc.Metadata)
+	if len(tags) == 0 {
+		return nil
+	}
+	metadata := make(map[string]any, len(doc.Metadata))
+	for k, v := range doc.Metadata {
+		metadata[k] = v
+	}
+	if err := s.normalizeMetadataTags(ctx, meta, docID, metadata); err != nil {
+		return err
+	}
+	if slices.Equal(documentTags(metadata), tags) {
+		return nil
+	}
+	_, err = s.UpdateDocument(ctx, meta, docID, DocumentUpdateRequest{Metadata: metadata})
+	return err
+}
+
+// SyncTagDocuments 将标签（含同义词）同步到课程中的文档：使用其任一名称的文档统一改为规范名称。
+// 已是规范名称的文档不会再次更新，因此中断后可以整体重新执行
+func (s *Service) SyncTagDocuments(ctx context.Context, meta RequestMeta, tagID uint) (*TagChangeResult, error) {
+	if s.tags == nil {
+		return nil, ErrTagRegistryDisabled
+	}
+	tag, err := s.tags.get(tagID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireTagCourse(meta, tag.CourseID, true); err != nil {
+		return nil, err
+	}
+	result := &TagChangeResult{Tag: tag, UpdatedDocuments: []int64{}}
+	keys := map[string]struct{}{tag.Key: {}}
+	for _, synonym := range tag.Synonyms {
+		keys[synonym.Key] = struct{}{}
+	}
+
+	docs, err := s.listSubtreeDocuments(ctx, meta, tag.CourseID)
+	if err != nil {
+		return nil, fmt.Errorf("list course documents: %w", err)
+	}
+	for _, doc := range docs {
+		// 停机时中止，由任务重新执行
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		tags := documentTags(doc.Metadata)
+		affected := false
+		for _, name := range tags {
+			if _, ok := keys[tagKey(name)]; ok {
+				affected = true
+				break
+			}
+		}
+		if !affected {
+			continue
+		}
+		metadata := make(map[string]any, len(doc.Metadata))
+		for k, v := range doc.Metadata {
+			metadata[k] = v
+		}
+		if err := s.normalizeMetadataTags(ctx, meta, doc.ID, metadata); err != nil {
+			result.Failed = append(result.Failed, TagDocumentFailure{DocumentID: doc.ID, Error: err.Error()})
+			continue
+		}
+		if slices.Equal(documentTags(metadata), tags) {
+			continue
+		}
+		if _, err := s.UpdateDocument(ctx, meta, doc.ID, DocumentUpdateRequest{Metadata: metadata}); err != nil {
+			result.Failed = append(result.Failed, TagDocumentFailure{DocumentID: doc.ID, Error: err.Error()})
+			continue
+		}
+		result.UpdatedDocuments = append(result.UpdatedDocuments, doc.ID)
+	}
+	if len(result.Failed) > 0 {
+		log.Printf("[tags] tag=%d synced %d documents, %d failed", tag.ID, len(result.UpdatedDocuments), len(result.Failed))
+	}
+	return result, nil
+}
+
+// requireTagCourse 读取词表需要课程权限；管理词表还需要课程管理员角色
+func (s *Service) requireTagCourse(meta RequestMeta, courseID int64, manage bool) error {
+	if manage && meta.UserRole != "super_admin" && meta.UserRole != "course_admin" {
+		return fmt.Errorf("%w: only course admins can manage tags", ErrTagForbidden)
+	}
+	ok, err := s.hasAnyCoursePermission(meta, []int64{courseID})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: no permission for course %d", ErrTagForbidden, courseID)
+	}
+	return nil
+}
+
+// tagVocabulary 按课程顺序合并词表，同一名称在多个课程中登记时以靠前的课程为准
+func (s *Service) tagVocabulary(courses []int64) (*tagVocabulary, error) {
+	vocab := &tagVocabulary{names: make(map[string]string)}
+	if s.tags == nil {
+		return vocab, nil
+	}
+	for _, courseID := range courses {
+		tags, err := s.tags.list(courseID)
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			if _, ok := vocab.names[tag.Key]; !ok {
+				vocab.names[tag.Key] = tag.Name
+			}
+			for _, synonym := range tag.Synonyms {
+				if _, ok := vocab.names[synonym.Key]; !ok {
+					vocab.names[synonym.Key] = tag.Name
+				}
+			}
+		}
+		vocab.tags = append(vocab.tags, tags...)
+	}
+	return vocab, nil
+}
+
+// tagVocabulary 匹配键到规范名称的映射
+type tagVocabulary struct {
+	names map[string]string
+	tags  []database.Tag
+}
+
+// canonicalize 清理空白、替换为规范名称并按匹配键去重，保持原有顺序；未登记的标签保留原样
+func (v *tagVocabulary) canonicalize(names []string) []string {
+	result := make([]string, 0, len(names))
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" {
+			continue
+		}
+		if canonical, ok := v.names[tagKey(name)]; ok {
+			name = canonical
+		}
+		key := tagKey(name)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		result = append(result, name)
+	}
+	return result
+}
+
+// tagKey 标签的匹配键：合并空白、全角字符转半角并转为小写，使 "OS"、"os"、"ＯＳ" 视为同一标签
+func tagKey(name string) string {
+	var b strings.Builder
+	for _, r := range strings.Join(strings.Fields(name), " ") {
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r -= 0xFEE0
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+func cleanTagName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", fmt.Errorf("%w: name is required", ErrInvalidTag)
+	}
+	if utf8.RuneCountInString(name) > MaxTagNameLength {
+		return "", fmt.Errorf("%w: %q exceeds %d characters", ErrInvalidTag, name, MaxTagNameLength)
+	}
+	return name, nil
+}
+
+// tagSynonyms 清理同义词，去掉与规范名称或彼此重复的项
+func tagSynonyms(names []string, tagKeyValue string) ([]database.TagSynonym, error) {
+	synonyms := make([]database.TagSynonym, 0, len(names))
+	seen := map[string]struct{}{tagKeyValue: {}}
+	for _, raw := range names {
+		name, err := cleanTagName(raw)
+		if err != nil {
+			return nil, err
+		}
+		key := tagKey(name)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		synonyms = append(synonyms, database.TagSynonym{Name: name, Key: key})
+	}
+	return synonyms, nil
+}
+
+func tagSynonymNames(synonyms []database.TagSynonym) []string {
+	names := make([]string, 0, len(synonyms))
+	for _, synonym := range synonyms {
+		names = append(names, synonym.Name)
+	}
+	return names
+}
+
+func synonymKeys(synonyms []database.TagSynonym) []string {
+	keys := make([]string, 0, len(synonyms))
+	for _, synonym := range synonyms {
+		keys = append(keys, synonym.Key)
+	}
+	return keys
+}
+
+// checkTagKey 匹配键不能被同一课程的其他标签用作名称或同义词
+func checkTagKey(tx *gorm.DB, courseID int64, key string, exceptTagID uint) error {
+	var count int64
+	if err := tx.Model(&database.Tag{}).Where("course_id = ? AND key = ? AND id <> ?", courseID, key, exceptTagID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		if err := tx.Model(&database.TagSynonym{}).Where("course_id = ? AND key = ? AND tag_id <> ?", courseID, key, exceptTagID).Count(&count).Error; err != nil {
+			return err
+		}
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %q is already used in course %d", ErrTagConflict, key, courseID)
+	}
+	return nil
+}
+
+// checkTagParent 上级标签须属于同一课程，且不能是标签自身或其下级
+func checkTagParent(tx *gorm.DB, tag *database.Tag, parentID uint) error {
+	parent, err := loadCourseTag(tx, tag.CourseID, parentID)
+	if err != nil {
+		return err
+	}
+	if parent.ID == tag.ID {
+		return fmt.Errorf("%w: a tag cannot be its own parent", ErrInvalidTag)
+	}
+	descendant, err := isTagDescendant(tx, parent, tag.ID)
+	if err != nil {
+		return err
+	}
+	if descendant {
+		return fmt.Errorf("%w: parent %q is below %q", ErrInvalidTag, parent.Name, tag.Name)
+	}
+	return nil
+}
+
+// isTagDescendant 沿上级链判断 tag 是否位于 ancestorID 之下
+func isTagDescendant(tx *gorm.DB, tag *database.Tag, ancestorID uint) (bool, error) {
+	visited := map[uint]struct{}{tag.ID: {}}
+	parentID := tag.ParentID
+	for parentID != nil {
+		if *parentID == ancestorID {
+			return true, nil
+		}
+		if _, ok := visited[*parentID]; ok {
+			return false, nil
+		}
+		visited[*parentID] = struct{}{}
+		var parent database.Tag
+		if err := tx.Select("id", "parent_id").First(&parent, *parentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+		parentID = parent.ParentID
+	}
+	return false, nil
+}
+
+func loadCourseTag(tx *gorm.DB, courseID int64, tagID uint) (*database.Tag, error) {
+	var tag database.Tag
+	err := tx.Where("course_id = ?", courseID).First(&tag, tagID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: parent tag %d not found in course %d", ErrInvalidTag, tagID, courseID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+func replaceTagSynonyms(tx *gorm.DB, tag *database.Tag, synonyms []database.TagSynonym) error {
+	if err := tx.Where("tag_id = ?", tag.ID).Delete(&database.TagSynonym{}).Error; err != nil {
+		return err
+	}
+	for i := range synonyms {
+		synonyms[i].ID = 0
+		synonyms[i].TagID = tag.ID
+		synonyms[i].CourseID = tag.CourseID
+	}
+	if len(synonyms) == 0 {
+		return nil
+	}
+	return tx.Create(&synonyms).Error
+}
+
+// documentTags 读取 metadata.tags 中的字符串标签
+func documentTags(metadata map[string]any) []string {
+	raw, _ := metadata["tags"].([]any)
+	tags := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if name, ok := v.(string); ok {
+			tags = append(tags, name)
+		}
+	}
+	return tags
+}
+
+func tagsToAny(tags []string) []any {
+	result := make([]any, len(tags))
+	for i, tag := range tags {
+		result[i] = tag
+	}
+	return result
+}
+
+func (r *TagRegistry) list(courseID int64) ([]database.Tag, error) {
+	tags := []database.Tag{}
+	err := r.db.Preload("Synonyms", func(db *gorm.DB) *gorm.DB { return db.Order("name") }).
+		Where("course_id = ?", courseID).Order("name").Find(&tags).Error
+	return tags, err
+}
+
+func (r *TagRegistry) get(tagID uint) (*database.Tag, error) {
+	var tag database.Tag
+	err := r.db.Preload("Synonyms", func(db *gorm.DB) *gorm.DB { return db.Order("name") }).First(&tag, tagID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTagNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
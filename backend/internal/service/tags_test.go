@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"github.com/yjxt/ydms/backend/internal/ndrclient"
+)
+
+func TestTagRegistryNormalizesAndPropagates(t *testing.T) {
+	f := newCourseFixture(t, &database.Tag{}, &database.TagSynonym{}, &database.Job{}, &database.JobStep{})
+	now := time.Now().UTC()
+	extra := sampleDocument(12, "Extra", "markdown_v1", 4, now, now)
+	extra.Metadata = map[string]any{"tags": []any{"OS", "network"}}
+	f.ndr.addDocument(1, extra)
+
+	svc := f.svc
+	svc.SetTagRegistry(NewTagRegistry(f.db))
+	jobs := NewJobService(f.db, JobOptions{Lease: time.Minute})
+	svc.RegisterTagJobs(jobs)
+	ctx := context.Background()
+
+	// syncTag 以后台任务同步文档并返回任务结果
+	syncTag := func(t *testing.T, tagID uint) TagChangeResult {
+		t.Helper()
+		job, err := jobs.EnqueueTagSync(f.adminMeta, tagID)
+		if err != nil {
+			t.Fatalf("enqueue tag sync: %v", err)
+		}
+		if ran, err := jobs.RunNext(ctx); err != nil || !ran {
+			t.Fatalf("expected tag sync job to run: %v", err)
+		}
+		detail, err := jobs.Get(job.ID)
+		if err != nil || detail.Status != database.JobSucceeded {
+			t.Fatalf("unexpected tag sync job %+v err=%v", detail, err)
+		}
+		var result TagChangeResult
+		if err := json.Unmarshal(detail.Result, &result); err != nil {
+			t.Fatalf("decode job result: %v", err)
+		}
+		return result
+	}
+
+	// 以下步骤依次修改同一课程的词表
+	var osTag, process *database.Tag
+	t.Run("管理词表", func(t *testing.T) {
+		if _, err := svc.CreateTag(f.proofMeta, TagInput{CourseID: 1, Name: "操作系统"}); !errors.Is(err, ErrTagForbidden) {
+			t.Fatalf("expected proofreader to be unable to manage tags, got %v", err)
+		}
+		var err error
+		osTag, err = svc.CreateTag(f.adminMeta, TagInput{CourseID: 1, Name: " 操作系统 ", Synonyms: []string{"OS", "os", "操作系统"}})
+		if err != nil {
+			t.Fatalf("create tag: %v", err)
+		}
+		if osTag.Name != "操作系统" || len(osTag.Synonyms) != 1 || osTag.Synonyms[0].Name != "OS" {
+			t.Fatalf("unexpected tag %+v", osTag)
+		}
+		if process, err = svc.CreateTag(f.adminMeta, TagInput{CourseID: 1, Name: "进程", ParentID: &osTag.ID}); err != nil {
+			t.Fatalf("create child tag: %v", err)
+		}
+		if _, err := svc.CreateTag(f.adminMeta, TagInput{CourseID: 1, Name: "Linux", Synonyms: []string{"ｏｓ"}}); !errors.Is(err, ErrTagConflict) {
+			t.Fatalf("expected synonym conflict, got %v", err)
+		}
+		if _, err := svc.UpdateTag(f.adminMeta, osTag.ID, TagUpdate{ParentID: &process.ID}); !errors.Is(err, ErrInvalidTag) {
+			t.Fatalf("expected parent cycle to be rejected, got %v", err)
+		}
+	})
+	if osTag == nil || process == nil {
+		t.FailNow()
+	}
+
+	// 保存文档时同义词替换为规范名称并去重
+	t.Run("保存时归一化", func(t *testing.T) {
+		if _, err := svc.UpdateDocument(ctx, f.adminMeta, 10, DocumentUpdateRequest{Metadata: map[string]any{"tags": []any{"ｏｓ", " 进程 ", "OS"}}}); err != nil {
+			t.Fatalf("update document: %v", err)
+		}
+		if tags := documentTags(f.ndr.docs[10].Metadata); !slices.Equal(tags, []string{"操作系统", "进程"}) {
+			t.Fatalf("expected normalized tags, got %v", tags)
+		}
+	})
+
+	t.Run("标签云", func(t *testing.T) {
+		cloud, err := svc.TagCloud(ctx, f.proofMeta, 1)
+		if err != nil {
+			t.Fatalf("tag cloud: %v", err)
+		}
+		counts := make(map[string][2]int)
+		for _, item := range cloud.Tags {
+			counts[item.Name] = [2]int{item.Count, item.Total}
+		}
+		if cloud.Documents != 2 || counts["操作系统"] != [2]int{2, 2} || counts["进程"] != [2]int{1, 1} || counts["network"] != [2]int{1, 1} {
+			t.Fatalf("unexpected tag cloud %+v", cloud)
+		}
+		if _, err := svc.TagCloud(ctx, f.outsiderMeta, 1); !errors.Is(err, ErrTagForbidden) {
+			t.Fatalf("expected tag cloud without course permission to be forbidden, got %v", err)
+		}
+	})
+
+	t.Run("批量打标签", func(t *testing.T) {
+		results, err := svc.BulkTagDocuments(ctx, f.proofMeta, BulkTagRequest{DocumentIDs: []int64{10, 12}, Tags: []string{"Network"}}, false)
+		if err != nil || len(results) != 2 || !results[0].Changed || results[0].Error != "" {
+			t.Fatalf("unexpected bulk tag results %+v err=%v", results, err)
+		}
+		if tags := documentTags(f.ndr.docs[12].Metadata); !slices.Equal(tags, []string{"操作系统", "network"}) {
+			t.Fatalf("expected existing tag to be kept once, got %v", tags)
+		}
+		if _, err := svc.BulkTagDocuments(ctx, f.proofMeta, BulkTagRequest{DocumentIDs: []int64{12}, Tags: []string{"os"}}, true); err != nil {
+			t.Fatalf("bulk untag: %v", err)
+		}
+		if tags := documentTags(f.ndr.docs[12].Metadata); !slices.Equal(tags, []string{"network"}) {
+			t.Fatalf("expected synonym to remove the canonical tag, got %v", tags)
+		}
+	})
+
+	// 改名与合并只修改词表，文档由后台任务同步
+	t.Run("改名", func(t *testing.T) {
+		name := "Process"
+		if _, err := svc.UpdateTag(f.adminMeta, process.ID, TagUpdate{Name: &name}); err != nil {
+			t.Fatalf("rename: %v", err)
+		}
+		if tags := documentTags(f.ndr.docs[10].Metadata); !slices.Equal(tags, []string{"操作系统", "进程", "Network"}) {
+			t.Fatalf("expected documents to be updated by the job only, got %v", tags)
+		}
+		if result := syncTag(t, process.ID); !slices.Equal(result.UpdatedDocuments, []int64{10}) {
+			t.Fatalf("unexpected rename sync result %+v", result)
+		}
+		if tags := documentTags(f.ndr.docs[10].Metadata); !slices.Equal(tags, []string{"操作系统", "Process", "Network"}) {
+			t.Fatalf("expected renamed tag in document, got %v", tags)
+		}
+	})
+
+	t.Run("合并", func(t *testing.T) {
+		merged, err := svc.MergeTag(f.adminMeta, process.ID, osTag.ID)
+		if err != nil || len(merged.Synonyms) != 3 {
+			t.Fatalf("unexpected merged tag %+v err=%v", merged, err)
+		}
+		if result := syncTag(t, osTag.ID); !slices.Equal(result.UpdatedDocuments, []int64{10}) {
+			t.Fatalf("unexpected merge sync result %+v", result)
+		}
+		if tags := documentTags(f.ndr.docs[10].Metadata); !slices.Equal(tags, []string{"操作系统", "Network"}) {
+			t.Fatalf("expected merged tag in document, got %v", tags)
+		}
+		if tags, err := svc.ListTags(f.proofMeta, 1); err != nil || len(tags) != 1 {
+			t.Fatalf("expected merged source to be removed, got %+v err=%v", tags, err)
+		}
+	})
+
+	// 删除标签时下级标签移到其上级，文档中的标签保持不变
+	t.Run("删除", func(t *testing.T) {
+		kernel, err := svc.CreateTag(f.adminMeta, TagInput{CourseID: 1, Name: "Kernel", ParentID: &osTag.ID})
+		if err != nil {
+			t.Fatalf("create child tag: %v", err)
+		}
+		if err := svc.DeleteTag(f.adminMeta, osTag.ID); err != nil {
+			t.Fatalf("delete tag: %v", err)
+		}
+		if tags, _ := svc.ListTags(f.adminMeta, 1); len(tags) != 1 || tags[0].ID != kernel.ID || tags[0].ParentID != nil {
+			t.Fatalf("expected child to move to top level, got %+v", tags)
+		}
+		if tags := documentTags(f.ndr.docs[10].Metadata); !slices.Equal(tags, []string{"操作系统", "Network"}) {
+			t.Fatalf("expected document tags to be kept, got %v", tags)
+		}
+	})
+}
+
+// updateCountingNDR 记录文档更新次数，用于确认绑定不会写入第二个版本
+type updateCountingNDR struct {
+	*archiveFakeNDR
+	updates int
+}
+
+func (f *updateCountingNDR) UpdateDocument(ctx context.Context, meta ndrclient.RequestMeta, id int64, body ndrclient.DocumentUpdate) (ndrclient.Document, error) {
+	f.updates++
+	return f.archiveFakeNDR.UpdateDocument(ctx, meta, id, body)
+}
+
+func TestCreateDocumentNormalizesTagsForTargetCourse(t *testing.T) {
+	f := newCourseFixture(t, &database.Tag{}, &database.TagSynonym{}, &database.DocumentLock{})
+	fake := &updateCountingNDR{archiveFakeNDR: f.ndr}
+	svc := NewService(cache.NewNoop(), fake, f.users)
+	svc.SetTagRegistry(NewTagRegistry(f.db))
+	svc.SetDocumentLocks(NewDocumentLocks(f.db))
+	ctx := context.Background()
+	if _, err := svc.CreateTag(f.adminMeta, TagInput{CourseID: 1, Name: "操作系统", Synonyms: []string{"OS"}}); err != nil {
+		t.Fatalf("create tag: %v", err)
+	}
+
+	t.Run("创建到节点时一次写入规范标签", func(t *testing.T) {
+		doc, err := svc.CreateDocument(ctx, f.adminMeta, DocumentCreateRequest{
+			Title:    "New",
+			Metadata: map[string]any{"tags": []any{"ｏｓ", "OS", "kernel"}},
+			NodeID:   ptr(int64(2)),
+		})
+		if err != nil {
+			t.Fatalf("create document: %v", err)
+		}
+		if tags := documentTags(fake.docs[doc.ID].Metadata); !slices.Equal(tags, []string{"操作系统", "kernel"}) {
+			t.Fatalf("expected canonical tags on creation, got %v", tags)
+		}
+		if _, ok := fake.docBindings[doc.ID][2]; !ok {
+			t.Fatalf("expected document to be bound to node 2, bindings %v", fake.docBindings[doc.ID])
+		}
+		// 再绑定到同一课程的其他节点时标签不变，不写入新版本
+		if err := svc.BindDocument(ctx, f.adminMeta, 1, doc.ID); err != nil {
+			t.Fatalf("bind document: %v", err)
+		}
+		if fake.updates != 0 {
+			t.Fatalf("expected no extra document versions, got %d updates", fake.updates)
+		}
+	})
+
+	t.Run("绑定后无法归一化时返回错误", func(t *testing.T) {
+		doc, err := svc.CreateDocument(ctx, f.adminMeta, DocumentCreateRequest{Title: "Loose", Metadata: map[string]any{"tags": []any{"os"}}})
+		if err != nil {
+			t.Fatalf("create document: %v", err)
+		}
+		if tags := documentTags(fake.docs[doc.ID].Metadata); !slices.Equal(tags, []string{"os"}) {
+			t.Fatalf("expected unbound document to keep its tags, got %v", tags)
+		}
+		if _, err := svc.LockDocument(ctx, RequestMeta{UserRole: "super_admin", UserIDNumeric: 99, Username: "admin"}, doc.ID, 0); err != nil {
+			t.Fatalf("lock document: %v", err)
+		}
+		var locked *DocumentLockedError
+		if err := svc.BindDocument(ctx, f.adminMeta, 2, doc.ID); !errors.As(err, &locked) {
+			t.Fatalf("expected the rejected tag rewrite to be returned, got %v", err)
+		}
+		if _, ok := fake.docBindings[doc.ID][2]; !ok {
+			t.Fatalf("expected binding to be kept, bindings %v", fake.docBindings[doc.ID])
+		}
+	})
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"gorm.io/gorm"
+)
+
+// recoveryCodeCount 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+var (
+	// ErrInvalidSecondFactor 验证码或恢复码错误
+	ErrInvalidSecondFactor = errors.New("invalid verification code")
+	// ErrTOTPNotEnabled 用户未启用两步验证
+	ErrTOTPNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrTOTPAlreadyEnabled 用户已启用两步验证
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTOTPRequired 当前角色必须启用两步验证
+	ErrTOTPRequired = errors.New("two-factor authentication is required for this role")
+)
+
+// TwoFactorPolicy 两步验证策略
+type TwoFactorPolicy struct {
+	Issuer        string   // otpauth URI 中显示的发行方
+	RequiredRoles []string // 必须启用两步验证的角色
+}
+
+// TOTPEnrollment 绑定认证器 App 所需的信息
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// TwoFactorStatus 用户的两步验证状态
+type TwoFactorStatus struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// SetTwoFactorPolicy 设置两步验证策略
+func (s *UserService) SetTwoFactorPolicy(policy TwoFactorPolicy) {
+	if policy.Issuer == "" {
+		policy.Issuer = "YDMS"
+	}
+	s.twoFactorPolicy = policy
+}
+
+// TwoFactorRequired 用户所属角色是否必须启用两步验证（服务账号不适用）
+func (s *UserService) TwoFactorRequired(user *database.User) bool {
+	if user.IsServiceAccount() {
+		return false
+	}
+	for _, role := range s.twoFactorPolicy.RequiredRoles {
+		if user.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTwoFactorStatus 获取用户的两步验证状态
+func (s *UserService) GetTwoFactorStatus(userID uint) (*TwoFactorStatus, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	status := &TwoFactorStatus{Enabled: user.TOTPEnabled, Required: s.TwoFactorRequired(user)}
+	if user.TOTPEnabled {
+		if err := s.db.Model(&database.RecoveryCode{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Count(&status.RecoveryCodesRemaining).Error; err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// BeginTOTPEnrollment 生成新的 TOTP 密钥，需调用 ConfirmTOTPEnrollment 校验后才生效
+func (s *UserService) BeginTOTPEnrollment(userID uint) (*TOTPEnrollment, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsServiceAccount() {
+		return nil, errors.New("service accounts cannot enable two-factor authentication")
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&database.User{}).Where("id = ?", userID).Update("totp_secret", secret).Error; err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{
+		Secret: secret,
+		URI:    auth.TOTPURI(s.twoFactorPolicy.Issuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment 校验认证器 App 生成的验证码并启用两步验证，返回一次性恢复码
+func (s *UserService) ConfirmTOTPEnrollment(userID uint, code, ip string) ([]string, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, errors.New("two-factor enrollment has not been started")
+	}
+	if err := s.checkLoginLock(database.LoginThrottleUser, strings.ToLower(user.Username), s.now()); err != nil {
+		return nil, err
+	}
+
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, s.now())
+	if !ok {
+		s.recordSecondFactorFailure(user, ip)
+		return nil, ErrInvalidSecondFactor
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP 使用验证码或恢复码关闭两步验证（角色要求启用时不允许关闭）
+func (s *UserService) DisableTOTP(userID uint, code, ip string) error {
+	user, err := s.VerifySecondFactor(userID, code, ip)
+	if err != nil {
+		return err
+	}
+	if s.TwoFactorRequired(user) {
+		return ErrTOTPRequired
+	}
+	return s.clearTOTP(userID)
+}
+
+// ResetTOTP 管理员为丢失认证器的用户清除两步验证，用户下次登录时重新绑定
+func (s *UserService) ResetTOTP(userID uint) error {
+	if _, err := s.GetUserByID(userID); err != nil {
+		return err
+	}
+	return s.clearTOTP(userID)
+}
+
+func (s *UserService) clearTOTP(userID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&database.RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧的恢复码全部失效
+func (s *UserService) RegenerateRecoveryCodes(userID uint, code, ip string) ([]string, error) {
+	if _, err := s.VerifySecondFactor(userID, code, ip); err != nil {
+		return nil, err
+	}
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor 校验 TOTP 验证码或一次性恢复码
+// 失败次数与密码登录共用锁定计数
+func (s *UserService) VerifySecondFactor(userID uint, code, ip string) (*database.User, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTOTPNotEnabled
+	}
+
+	now := s.now()
+	userKey := strings.ToLower(user.Username)
+	if err := s.checkLoginLock(database.LoginThrottleIP, ip, now); err != nil {
+		return nil, err
+	}
+	if err := s.checkLoginLock(database.LoginThrottleUser, userKey, now); err != nil {
+		return nil, err
+	}
+
+	ok, err := s.consumeSecondFactor(user, code, now)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		s.recordSecondFactorFailure(user, ip)
+		return nil, ErrInvalidSecondFactor
+	}
+
+	if err := s.db.Where("scope = ? AND key = ?", database.LoginThrottleUser, userKey).
+		Delete(&database.LoginThrottle{}).Error; err != nil {
+		log.Printf("failed to reset login failures for %s: %v", userKey, err)
+	}
+	return user, nil
+}
+
+// consumeSecondFactor 校验并消费验证码：TOTP 时间步只能使用一次，恢复码使用后失效
+func (s *UserService) consumeSecondFactor(user *database.User, code string, now time.Time) (bool, error) {
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, now); ok {
+		result := s.db.Model(&database.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected > 0, nil
+	}
+
+	normalized := auth.NormalizeRecoveryCode(code)
+	if len(normalized) != 11 {
+		return false, nil
+	}
+	var codes []database.RecoveryCode
+	if err := s.db.Where("user_id = ? AND used_at IS NULL", user.ID).Find(&codes).Error; err != nil {
+		return false, err
+	}
+	for _, candidate := range codes {
+		if !auth.CheckPassword(normalized, candidate.CodeHash) {
+			continue
+		}
+		result := s.db.Model(&database.RecoveryCode{}).
+			Where("id = ? AND used_at IS NULL", candidate.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		return result.RowsAffected > 0, nil
+	}
+	return false, nil
+}
+
+// recordSecondFactorFailure 记录一次验证码错误
+func (s *UserService) recordSecondFactorFailure(user *database.User, ip string) {
+	now := s.now()
+	s.recordLoginFailure(database.LoginThrottleUser, strings.ToLower(user.Username), s.lockoutPolicy.MaxUserFailures, now)
+	s.recordLoginFailure(database.LoginThrottleIP, ip, s.lockoutPolicy.MaxIPFailures, now)
+}
+
+// replaceRecoveryCodes 删除旧恢复码并生成新的一组，返回明文（仅此一次）
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&database.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	rows := make([]database.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := auth.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		hash, err := auth.HashPassword(code)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		rows = append(rows, database.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
@@ -9,14 +9,44 @@ import (
 	"gorm.io/gorm"
 )
 
+// ErrInvalidCredentials 用户名或密码错误
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ErrServiceAccountPassword 服务账号不支持设置密码
+var ErrServiceAccountPassword = errors.New("service accounts cannot have a password")
+
+// ErrUserDisabled 账号已停用
+var ErrUserDisabled = errors.New("account is disabled")
+
+// ErrLastSuperAdmin 不能停用或降级最后一个可用的超级管理员
+var ErrLastSuperAdmin = errors.New("at least one active super administrator is required")
+
+// serviceAccountPasswordHash 服务账号的占位密码哈希，不是合法的 bcrypt 哈希，任何密码都无法匹配
+const serviceAccountPasswordHash = "!service-account"
+
 // UserService 用户服务
 type UserService struct {
-	db *gorm.DB
+	db              *gorm.DB
+	passwordPolicy  PasswordPolicy
+	lockoutPolicy   LockoutPolicy
+	twoFactorPolicy TwoFactorPolicy
+	now             func() time.Time
 }
 
-// NewUserService 创建用户服务
+// NewUserService 创建用户服务（使用默认密码策略与锁定策略）
 func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+	return NewUserServiceWithPolicies(db, DefaultPasswordPolicy(), DefaultLockoutPolicy())
+}
+
+// NewUserServiceWithPolicies 使用指定的密码策略与锁定策略创建用户服务
+func NewUserServiceWithPolicies(db *gorm.DB, passwordPolicy PasswordPolicy, lockoutPolicy LockoutPolicy) *UserService {
+	return &UserService{
+		db:              db,
+		passwordPolicy:  passwordPolicy,
+		lockoutPolicy:   lockoutPolicy,
+		twoFactorPolicy: TwoFactorPolicy{Issuer: "YDMS"},
+		now:             time.Now,
+	}
 }
 
 // Authenticate 用户认证（登录）
@@ -25,14 +55,24 @@ func (s *UserService) Authenticate(username, password string) (*database.User, e
 	err := s.db.Where("username = ? AND deleted_at IS NULL", username).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("invalid username or password")
+			return nil, ErrInvalidCredentials
 		}
 		return nil, err
 	}
 
+	// 服务账号不能使用密码登录
+	if user.IsServiceAccount() {
+		return nil, ErrInvalidCredentials
+	}
+
 	// 验证密码
 	if !auth.CheckPassword(password, user.PasswordHash) {
-		return nil, errors.New("invalid username or password")
+		return nil, ErrInvalidCredentials
+	}
+
+	// 停用状态在密码正确后才提示，避免被用于探测账号
+	if user.Disabled {
+		return nil, ErrUserDisabled
 	}
 
 	return &user, nil
@@ -66,8 +106,8 @@ func (s *UserService) CreateUser(username, password, role string, createdByID *u
 	}
 
 	// 验证密码强度
-	if len(password) < 8 {
-		return nil, errors.New("password must be at least 8 characters")
+	if err := s.passwordPolicy.Validate(username, password); err != nil {
+		return nil, err
 	}
 
 	// 检查用户名是否已存在（排除软删除用户）
@@ -91,7 +131,13 @@ func (s *UserService) CreateUser(username, password, role string, createdByID *u
 			softDeleted.Role = role
 			softDeleted.DeletedAt = gorm.DeletedAt{}
 			softDeleted.CreatedByID = createdByID
-			if err := s.db.Unscoped().Save(&softDeleted).Error; err != nil {
+			err := s.db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Unscoped().Save(&softDeleted).Error; err != nil {
+					return err
+				}
+				return s.recordPasswordHistory(tx, softDeleted.ID, passwordHash)
+			})
+			if err != nil {
 				return nil, err
 			}
 			return &softDeleted, nil
@@ -106,7 +152,12 @@ func (s *UserService) CreateUser(username, password, role string, createdByID *u
 		CreatedByID:  createdByID,
 	}
 
-	err = s.db.Create(user).Error
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return s.recordPasswordHistory(tx, user.ID, passwordHash)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -116,9 +167,22 @@ func (s *UserService) CreateUser(username, password, role string, createdByID *u
 
 // UpdatePassword 修改密码
 func (s *UserService) UpdatePassword(userID uint, newPassword string) error {
-	// 验证密码强度
-	if len(newPassword) < 8 {
-		return errors.New("password must be at least 8 characters")
+	var user database.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	// 服务账号没有密码
+	if user.IsServiceAccount() {
+		return ErrServiceAccountPassword
+	}
+
+	// 验证密码强度与历史密码
+	if err := s.passwordPolicy.Validate(user.Username, newPassword); err != nil {
+		return err
+	}
+	if err := s.checkPasswordReuse(user.ID, user.PasswordHash, newPassword); err != nil {
+		return err
 	}
 
 	// 加密密码
@@ -127,9 +191,16 @@ func (s *UserService) UpdatePassword(userID uint, newPassword string) error {
 		return err
 	}
 
-	// 更新密码
-	err = s.db.Model(&database.User{}).Where("id = ?", userID).Update("password_hash", passwordHash).Error
-	return err
+	// 更新密码并记录历史，同时清除强制改密标记
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&database.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"password_hash":        passwordHash,
+			"must_change_password": false,
+		}).Error; err != nil {
+			return err
+		}
+		return s.recordPasswordHistory(tx, userID, passwordHash)
+	})
 }
 
 // DeleteUser 删除用户（软删除）
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"gorm.io/gorm"
+)
+
+// UpdateUserRequest 管理员修改用户的请求，字段为 nil 表示不修改
+type UpdateUserRequest struct {
+	Role        *string `json:"role"`
+	DisplayName *string `json:"display_name"`
+	Disabled    *bool   `json:"disabled"`
+}
+
+// UpdateUser 修改用户的角色、显示名称或停用状态
+func (s *UserService) UpdateUser(userID uint, req UpdateUserRequest) (*database.User, error) {
+	updates := map[string]interface{}{}
+	if req.Role != nil {
+		if *req.Role != "super_admin" && *req.Role != "course_admin" && *req.Role != "proofreader" {
+			return nil, errors.New("invalid role")
+		}
+		updates["role"] = *req.Role
+	}
+	if req.DisplayName != nil {
+		displayName := strings.TrimSpace(*req.DisplayName)
+		if len(displayName) > 100 {
+			return nil, errors.New("display name is too long")
+		}
+		updates["display_name"] = displayName
+	}
+	if req.Disabled != nil {
+		updates["disabled"] = *req.Disabled
+	}
+
+	var user database.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deleted_at IS NULL").First(&user, userID).Error; err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+
+		// 降级或停用超级管理员时，必须保留至少一个可用的超级管理员
+		demoted := req.Role != nil && *req.Role != "super_admin"
+		disabled := req.Disabled != nil && *req.Disabled
+		if user.Role == "super_admin" && !user.Disabled && (demoted || disabled) {
+			var others int64
+			if err := tx.Model(&database.User{}).
+				Where("role = ? AND disabled = ? AND kind = ? AND id <> ?", "super_admin", false, database.UserKindHuman, user.ID).
+				Count(&others).Error; err != nil {
+				return err
+			}
+			if others == 0 {
+				return ErrLastSuperAdmin
+			}
+		}
+
+		return tx.Model(&user).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUserByID(userID)
+}
+
+// UpdateProfile 用户修改自己的资料（目前仅显示名称）
+func (s *UserService) UpdateProfile(userID uint, displayName string) (*database.User, error) {
+	return s.UpdateUser(userID, UpdateUserRequest{DisplayName: &displayName})
+}
+
+// ResetPassword 管理员重置用户密码
+// 返回一次性临时密码，用户使用它登录后必须先设置新密码；同时解除该用户的登录锁定
+func (s *UserService) ResetPassword(userID uint) (string, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return "", err
+	}
+	if user.IsServiceAccount() {
+		return "", ErrServiceAccountPassword
+	}
+
+	password, err := s.temporaryPassword(user.Username)
+	if err != nil {
+		return "", err
+	}
+	passwordHash, err := auth.HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+
+	// 临时密码不计入密码历史
+	err = s.db.Model(&database.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"password_hash":        passwordHash,
+		"must_change_password": true,
+	}).Error
+	if err != nil {
+		return "", err
+	}
+	if err := s.UnlockUser(user.ID); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// temporaryPassword 生成满足当前密码策略的随机临时密码
+func (s *UserService) temporaryPassword(username string) (string, error) {
+	length := 16
+	if s.passwordPolicy.MinLength > length {
+		length = s.passwordPolicy.MinLength
+	}
+	for attempt := 0; attempt < 20; attempt++ {
+		buf := make([]byte, length)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		password := base64.RawURLEncoding.EncodeToString(buf)[:length]
+		if s.passwordPolicy.Validate(username, password) == nil {
+			return password, nil
+		}
+	}
+	return "", errors.New("failed to generate a temporary password")
+}
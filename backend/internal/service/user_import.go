@@ -0,0 +1,326 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+	"gorm.io/gorm"
+)
+
+// MaxUserImportRows 单次导入的最大行数（每行需要一次 bcrypt 哈希）
+const MaxUserImportRows = 500
+
+// ErrUserImportInvalid 导入文件存在错误行，未创建任何用户
+var ErrUserImportInvalid = errors.New("user import contains invalid rows, nothing was created")
+
+// userCSVHeader 导出文件的列，导入时按列名识别并忽略其他列
+var userCSVHeader = []string{"id", "username", "display_name", "role", "kind", "disabled", "courses", "created_at"}
+
+// CourseResolver 将课程引用（根节点 ID 或 slug）解析为根节点 ID
+type CourseResolver func(ref string) (int64, error)
+
+// UserImportRow 导入文件中的一行
+type UserImportRow struct {
+	Line        int      `json:"line"`
+	Username    string   `json:"username"`
+	DisplayName string   `json:"display_name,omitempty"`
+	Role        string   `json:"role"`
+	Courses     []string `json:"-"`
+	CourseIDs   []int64  `json:"course_ids"`
+	UserID      uint     `json:"user_id,omitempty"`
+	Password    string   `json:"initial_password,omitempty"` // 仅在实际创建时返回一次
+}
+
+// UserImportError 行级校验错误
+type UserImportError struct {
+	Line     int    `json:"line"`
+	Username string `json:"username,omitempty"`
+	Error    string `json:"error"`
+}
+
+// UserImportOptions 导入选项
+type UserImportOptions struct {
+	DryRun        bool
+	CreatedByID   uint
+	ResolveCourse CourseResolver // 为 nil 时课程只能填写根节点 ID
+}
+
+// UserImportResult 导入结果
+type UserImportResult struct {
+	DryRun  bool              `json:"dry_run"`
+	Created int               `json:"created"`
+	Users   []UserImportRow   `json:"users"`
+	Errors  []UserImportError `json:"errors,omitempty"`
+}
+
+// ParseUserImportCSV 解析导入文件
+// 首行为表头，必须包含 username；可选列 display_name、role（默认 proofreader）、
+// courses（课程根节点 ID 或 slug，多个用分号分隔）。导出文件可以直接作为模板使用。
+func ParseUserImportCSV(r io.Reader) ([]UserImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("csv file is empty")
+		}
+		return nil, fmt.Errorf("invalid csv: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, errors.New("csv header must contain a username column")
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []UserImportRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		// 跳过空行
+		empty := true
+		for _, value := range record {
+			if strings.TrimSpace(value) != "" {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			continue
+		}
+
+		row := UserImportRow{
+			Line:        line,
+			Username:    field(record, "username"),
+			DisplayName: field(record, "display_name"),
+			Role:        field(record, "role"),
+		}
+		for _, ref := range strings.Split(field(record, "courses"), ";") {
+			if ref = strings.TrimSpace(ref); ref != "" {
+				row.Courses = append(row.Courses, ref)
+			}
+		}
+		rows = append(rows, row)
+		if len(rows) > MaxUserImportRows {
+			return nil, fmt.Errorf("csv file has more than %d rows", MaxUserImportRows)
+		}
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("csv file has no users")
+	}
+	return rows, nil
+}
+
+// ImportUsers 校验所有行后在一个事务中创建用户并授予课程权限
+// 任意一行有错误时不创建任何用户，返回的结果中列出全部错误与 ErrUserImportInvalid。
+// 新用户使用随机初始密码，首次登录必须修改。
+func (s *UserService) ImportUsers(rows []UserImportRow, opts UserImportOptions) (*UserImportResult, error) {
+	result := &UserImportResult{DryRun: opts.DryRun, Users: rows}
+	fail := func(row *UserImportRow, format string, args ...interface{}) {
+		result.Errors = append(result.Errors, UserImportError{Line: row.Line, Username: row.Username, Error: fmt.Sprintf(format, args...)})
+	}
+
+	// 1. 逐行校验
+	seen := make(map[string]int, len(rows))
+	usernames := make([]string, 0, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		if row.Role == "" {
+			row.Role = "proofreader"
+		}
+		switch {
+		case row.Username == "":
+			fail(row, "username is required")
+		case strings.IndexFunc(row.Username, unicode.IsSpace) >= 0:
+			fail(row, "username must not contain spaces")
+		case len(row.Username) > 64:
+			fail(row, "username is too long")
+		default:
+			key := strings.ToLower(row.Username)
+			if first, dup := seen[key]; dup {
+				fail(row, "duplicate username (first seen on line %d)", first)
+			} else {
+				seen[key] = row.Line
+				usernames = append(usernames, row.Username)
+			}
+		}
+		if row.Role != "super_admin" && row.Role != "course_admin" && row.Role != "proofreader" {
+			fail(row, "invalid role %q", row.Role)
+		}
+		if len(row.DisplayName) > 100 {
+			fail(row, "display name is too long")
+		}
+
+		row.CourseIDs = make([]int64, 0, len(row.Courses))
+		granted := make(map[int64]bool, len(row.Courses))
+		for _, ref := range row.Courses {
+			id, err := resolveCourseRef(ref, opts.ResolveCourse)
+			if err != nil {
+				fail(row, "course %q: %v", ref, err)
+				continue
+			}
+			if !granted[id] {
+				granted[id] = true
+				row.CourseIDs = append(row.CourseIDs, id)
+			}
+		}
+	}
+
+	// 2. 用户名不能与已有账号（包括已删除账号）重复
+	if len(usernames) > 0 {
+		var existing []string
+		if err := s.db.Unscoped().Model(&database.User{}).Where("username IN ?", usernames).
+			Pluck("username", &existing).Error; err != nil {
+			return nil, err
+		}
+		taken := make(map[string]bool, len(existing))
+		for _, username := range existing {
+			taken[username] = true
+		}
+		for i := range rows {
+			if taken[rows[i].Username] {
+				fail(&rows[i], "username already exists")
+			}
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Line < result.Errors[j].Line })
+		return result, ErrUserImportInvalid
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// 3. 生成初始密码（事务外完成 bcrypt，缩短事务时间）
+	hashes := make([]string, len(rows))
+	for i := range rows {
+		password, err := s.temporaryPassword(rows[i].Username)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		rows[i].Password = password
+		hashes[i] = hash
+	}
+
+	// 4. 在一个事务中创建用户与课程权限
+	var createdBy *uint
+	if opts.CreatedByID > 0 {
+		createdBy = &opts.CreatedByID
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for i := range rows {
+			row := &rows[i]
+			user := &database.User{
+				Username:           row.Username,
+				PasswordHash:       hashes[i],
+				Role:               row.Role,
+				Kind:               database.UserKindHuman,
+				DisplayName:        row.DisplayName,
+				CreatedByID:        createdBy,
+				MustChangePassword: true,
+			}
+			if err := tx.Create(user).Error; err != nil {
+				return fmt.Errorf("line %d: failed to create user: %w", row.Line, err)
+			}
+			for _, rootNodeID := range row.CourseIDs {
+				if err := tx.Create(&database.CoursePermission{UserID: user.ID, RootNodeID: rootNodeID}).Error; err != nil {
+					return fmt.Errorf("line %d: failed to grant course %d: %w", row.Line, rootNodeID, err)
+				}
+			}
+			row.UserID = user.ID
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range rows {
+			rows[i].Password = ""
+			rows[i].UserID = 0
+		}
+		return nil, err
+	}
+
+	result.Created = len(rows)
+	return result, nil
+}
+
+// resolveCourseRef 解析课程引用：没有解析器时只接受数字 ID
+func resolveCourseRef(ref string, resolve CourseResolver) (int64, error) {
+	if resolve != nil {
+		return resolve(ref)
+	}
+	id, err := strconv.ParseInt(ref, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("must be a course id")
+	}
+	return id, nil
+}
+
+// ExportUsersCSV 导出用户及其课程权限（不含服务账号与已删除用户）
+func (s *UserService) ExportUsersCSV(w io.Writer) error {
+	var users []database.User
+	if err := s.db.Where("deleted_at IS NULL AND kind = ?", database.UserKindHuman).
+		Order("id").Find(&users).Error; err != nil {
+		return err
+	}
+	var permissions []database.CoursePermission
+	if err := s.db.Order("root_node_id").Find(&permissions).Error; err != nil {
+		return err
+	}
+	courses := make(map[uint][]string)
+	for _, p := range permissions {
+		courses[p.UserID] = append(courses[p.UserID], strconv.FormatInt(p.RootNodeID, 10))
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(userCSVHeader); err != nil {
+		return err
+	}
+	for _, user := range users {
+		record := []string{
+			strconv.FormatUint(uint64(user.ID), 10),
+			user.Username,
+			user.DisplayName,
+			user.Role,
+			user.Kind,
+			strconv.FormatBool(user.Disabled),
+			strings.Join(courses[user.ID], ";"),
+			user.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
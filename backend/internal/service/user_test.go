@@ -0,0 +1,426 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/auth"
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+func setupUserDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&database.User{}, &database.PasswordHistory{}, &database.LoginThrottle{}, &database.RecoveryCode{}, &database.CoursePermission{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	cases := []struct {
+		password string
+		ok       bool
+	}{
+		{"short1", false},
+		{"onlyletters", false},
+		{"Password123", false},  // 常见密码（不区分大小写）
+		{"alice-2024-x", false}, // 包含用户名
+		{"correct horse 9", true},
+		{"Tr0ubadour", true},
+	}
+	for _, tc := range cases {
+		err := policy.Validate("alice", tc.password)
+		if (err == nil) != tc.ok {
+			t.Errorf("Validate(%q) error = %v, want ok=%v", tc.password, err, tc.ok)
+		}
+	}
+}
+
+func TestUpdatePasswordRejectsRecentPasswords(t *testing.T) {
+	db := setupUserDB(t)
+	policy := DefaultPasswordPolicy()
+	policy.HistorySize = 2
+	svc := NewUserServiceWithPolicies(db, policy, DefaultLockoutPolicy())
+
+	user, err := svc.CreateUser("bob", "first-pass-1", "proofreader", nil)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if err := svc.UpdatePassword(user.ID, "first-pass-1"); err == nil {
+		t.Fatalf("expected current password to be rejected")
+	}
+	for _, password := range []string{"second-pass-2", "third-pass-3"} {
+		if err := svc.UpdatePassword(user.ID, password); err != nil {
+			t.Fatalf("update to %q failed: %v", password, err)
+		}
+	}
+	if err := svc.UpdatePassword(user.ID, "second-pass-2"); err == nil {
+		t.Fatalf("expected a recent password to be rejected")
+	}
+	// 只保留最近 2 条，最早的密码可以再次使用
+	if err := svc.UpdatePassword(user.ID, "first-pass-1"); err != nil {
+		t.Fatalf("password outside the history window should be allowed: %v", err)
+	}
+
+	var count int64
+	db.Model(&database.PasswordHistory{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 2 {
+		t.Fatalf("expected history to be trimmed to 2 entries, got %d", count)
+	}
+}
+
+func TestLoginLockoutPersistsAndUnlocks(t *testing.T) {
+	db := setupUserDB(t)
+	lockout := LockoutPolicy{MaxUserFailures: 3, MaxIPFailures: 5, Window: time.Minute, Duration: 10 * time.Minute}
+	now := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	newService := func() *UserService {
+		svc := NewUserServiceWithPolicies(db, DefaultPasswordPolicy(), lockout)
+		svc.now = func() time.Time { return now }
+		return svc
+	}
+
+	svc := newService()
+	user, err := svc.CreateUser("carol", "Secret-pass-9", "course_admin", nil)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Login("Carol", "wrong-password", "10.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("attempt %d: expected invalid credentials, got %v", i, err)
+		}
+	}
+
+	// 重建服务模拟重启：锁定状态来自数据库，正确的密码也被拒绝
+	svc = newService()
+	var locked *LoginLockedError
+	if _, err := svc.Login("carol", "Secret-pass-9", "10.0.0.2"); !errors.As(err, &locked) || locked.Scope != database.LoginThrottleUser {
+		t.Fatalf("expected user lockout, got %v", err)
+	}
+	if until, _ := svc.GetUserLockout("carol"); until == nil || !until.Equal(now.Add(10*time.Minute)) {
+		t.Fatalf("unexpected lockout: %v", until)
+	}
+
+	if err := svc.UnlockUser(user.ID); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if _, err := svc.Login("carol", "Secret-pass-9", "10.0.0.2"); err != nil {
+		t.Fatalf("login after unlock failed: %v", err)
+	}
+
+	// 同一 IP 针对不同用户名的失败也会累计
+	for _, name := range []string{"x1", "x2"} {
+		svc.Login(name, "nope", "10.0.0.1")
+	}
+	if _, err := svc.Login("carol", "Secret-pass-9", "10.0.0.1"); !errors.As(err, &locked) || locked.Scope != database.LoginThrottleIP {
+		t.Fatalf("expected IP lockout, got %v", err)
+	}
+
+	// 锁定到期后重新计数
+	now = now.Add(11 * time.Minute)
+	if _, err := svc.Login("carol", "Secret-pass-9", "10.0.0.1"); err != nil {
+		t.Fatalf("login after lockout expiry failed: %v", err)
+	}
+	svc.Login("x3", "nope", "10.0.0.1")
+	var throttle database.LoginThrottle
+	db.Where("scope = ? AND key = ?", database.LoginThrottleIP, "10.0.0.1").First(&throttle)
+	if throttle.Failures != 1 || throttle.LockedUntil != nil || throttle.LockCount != 1 {
+		t.Fatalf("expected counter to restart after expiry, got %+v", throttle)
+	}
+}
+
+func TestTOTPEnrollmentAndSecondFactor(t *testing.T) {
+	db := setupUserDB(t)
+	svc := NewUserService(db)
+	svc.SetTwoFactorPolicy(TwoFactorPolicy{RequiredRoles: []string{"super_admin"}})
+	now := time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	user, err := svc.CreateUser("dave", "Secret-pass-9", "super_admin", nil)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if !svc.TwoFactorRequired(user) {
+		t.Fatalf("super_admin should require 2FA")
+	}
+
+	enrollment, err := svc.BeginTOTPEnrollment(user.ID)
+	if err != nil {
+		t.Fatalf("begin enrollment failed: %v", err)
+	}
+	if _, err := svc.ConfirmTOTPEnrollment(user.ID, "000000", ""); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Fatalf("expected wrong code to be rejected, got %v", err)
+	}
+	code, _ := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(now))
+	recovery, err := svc.ConfirmTOTPEnrollment(user.ID, code, "")
+	if err != nil || len(recovery) != recoveryCodeCount {
+		t.Fatalf("confirm failed: %v (%d codes)", err, len(recovery))
+	}
+
+	// 绑定时使用的验证码不能再次用于登录
+	if _, err := svc.VerifySecondFactor(user.ID, code, ""); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Fatalf("expected replayed code to be rejected, got %v", err)
+	}
+	now = now.Add(30 * time.Second)
+	next, _ := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(now))
+	if _, err := svc.VerifySecondFactor(user.ID, next, ""); err != nil {
+		t.Fatalf("expected next code to be accepted: %v", err)
+	}
+
+	// 恢复码只能使用一次
+	if _, err := svc.VerifySecondFactor(user.ID, strings.ToLower(recovery[0]), ""); err != nil {
+		t.Fatalf("expected recovery code to be accepted: %v", err)
+	}
+	if _, err := svc.VerifySecondFactor(user.ID, recovery[0], ""); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Fatalf("expected used recovery code to be rejected, got %v", err)
+	}
+	status, _ := svc.GetTwoFactorStatus(user.ID)
+	if !status.Enabled || !status.Required || status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	// 角色要求两步验证时不能自行关闭，管理员可以重置
+	if err := svc.DisableTOTP(user.ID, recovery[1], ""); !errors.Is(err, ErrTOTPRequired) {
+		t.Fatalf("expected disable to be refused, got %v", err)
+	}
+	if err := svc.ResetTOTP(user.ID); err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if status, _ := svc.GetTwoFactorStatus(user.ID); status.Enabled || status.RecoveryCodesRemaining != 0 {
+		t.Fatalf("expected 2FA to be cleared, got %+v", status)
+	}
+}
+
+func TestUpdateUserDisableAndResetPassword(t *testing.T) {
+	db := setupUserDB(t)
+	svc := NewUserService(db)
+
+	admin, err := svc.CreateUser("root", "Secret-pass-9", "super_admin", nil)
+	if err != nil {
+		t.Fatalf("create admin failed: %v", err)
+	}
+	user, err := svc.CreateUser("erin", "Secret-pass-9", "proofreader", &admin.ID)
+	if err != nil {
+		t.Fatalf("create user failed: %v", err)
+	}
+
+	// 修改角色与显示名称
+	role, name := "course_admin", "  Erin  "
+	updated, err := svc.UpdateUser(user.ID, UpdateUserRequest{Role: &role, DisplayName: &name})
+	if err != nil || updated.Role != "course_admin" || updated.DisplayName != "Erin" {
+		t.Fatalf("unexpected update result: %+v, %v", updated, err)
+	}
+	invalid := "owner"
+	if _, err := svc.UpdateUser(user.ID, UpdateUserRequest{Role: &invalid}); err == nil {
+		t.Fatalf("expected invalid role to be rejected")
+	}
+
+	// 唯一的超级管理员不能被降级或停用
+	demote, disable := "proofreader", true
+	if _, err := svc.UpdateUser(admin.ID, UpdateUserRequest{Role: &demote}); !errors.Is(err, ErrLastSuperAdmin) {
+		t.Fatalf("expected last super admin to be kept, got %v", err)
+	}
+	if _, err := svc.UpdateUser(admin.ID, UpdateUserRequest{Disabled: &disable}); !errors.Is(err, ErrLastSuperAdmin) {
+		t.Fatalf("expected last super admin to be kept, got %v", err)
+	}
+
+	// 停用后即使密码正确也不能登录，且不计入失败次数
+	if _, err := svc.UpdateUser(user.ID, UpdateUserRequest{Disabled: &disable}); err != nil {
+		t.Fatalf("disable failed: %v", err)
+	}
+	if _, err := svc.Login("erin", "Secret-pass-9", "10.0.0.1"); !errors.Is(err, ErrUserDisabled) {
+		t.Fatalf("expected disabled user to be rejected, got %v", err)
+	}
+	if _, err := svc.Login("erin", "wrong-Pass-1", "10.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected wrong password to report invalid credentials, got %v", err)
+	}
+	enable := false
+	if _, err := svc.UpdateUser(user.ID, UpdateUserRequest{Disabled: &enable}); err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+
+	// 重置密码：临时密码可以登录，但必须先修改
+	temporary, err := svc.ResetPassword(user.ID)
+	if err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	if _, err := svc.Login("erin", "Secret-pass-9", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("expected old password to stop working, got %v", err)
+	}
+	loggedIn, err := svc.Login("erin", temporary, "")
+	if err != nil || !loggedIn.MustChangePassword {
+		t.Fatalf("expected temporary password to require a change: %+v, %v", loggedIn, err)
+	}
+	if err := svc.UpdatePassword(user.ID, temporary); err == nil {
+		t.Fatalf("expected temporary password to be rejected as the new password")
+	}
+	if err := svc.UpdatePassword(user.ID, "Fresh-pass-42"); err != nil {
+		t.Fatalf("update password failed: %v", err)
+	}
+	if loggedIn, err = svc.Login("erin", "Fresh-pass-42", ""); err != nil || loggedIn.MustChangePassword {
+		t.Fatalf("expected forced change to be cleared: %+v, %v", loggedIn, err)
+	}
+}
+
+func TestImportUsersFromCSV(t *testing.T) {
+	db := setupUserDB(t)
+	svc := NewUserService(db)
+	if _, err := svc.CreateUser("frank", "Secret-pass-9", "proofreader", nil); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	resolve := func(ref string) (int64, error) {
+		switch ref {
+		case "10", "math":
+			return 10, nil
+		case "20", "physics":
+			return 20, nil
+		}
+		return 0, errors.New("course not found")
+	}
+
+	// 有错误的行时整个文件都不导入，并列出全部错误
+	invalid := "username,display_name,role,courses\n" +
+		"grace,Grace,proofreader,math\n" +
+		"frank,Frank,,\n" +
+		"grace,Dup,proofreader,\n" +
+		"heidi,Heidi,owner,chemistry\n"
+	rows, err := ParseUserImportCSV(strings.NewReader(invalid))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	result, err := svc.ImportUsers(rows, UserImportOptions{ResolveCourse: resolve})
+	if !errors.Is(err, ErrUserImportInvalid) || len(result.Errors) != 4 {
+		t.Fatalf("expected 4 row errors, got %v: %+v", err, result)
+	}
+	if result.Errors[0].Line != 3 || result.Errors[0].Username != "frank" {
+		t.Fatalf("unexpected first error: %+v", result.Errors[0])
+	}
+	var count int64
+	db.Model(&database.User{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected nothing to be created, have %d users", count)
+	}
+
+	// 试运行只校验不写入
+	valid := "\ufeffusername,display_name,role,courses\n" +
+		"grace,Grace,,math;20;physics\n" +
+		"\n" +
+		"heidi,\"Heidi, H.\",course_admin,\n"
+	rows, _ = ParseUserImportCSV(strings.NewReader(valid))
+	result, err = svc.ImportUsers(rows, UserImportOptions{DryRun: true, ResolveCourse: resolve})
+	if err != nil || result.Created != 0 || len(result.Users) != 2 || result.Users[0].Password != "" {
+		t.Fatalf("unexpected dry run result: %+v, %v", result, err)
+	}
+	if got := result.Users[0].CourseIDs; len(got) != 2 || got[0] != 10 || got[1] != 20 {
+		t.Fatalf("expected courses to be resolved and deduplicated, got %v", got)
+	}
+	db.Model(&database.User{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("dry run must not create users, have %d", count)
+	}
+
+	// 实际导入：返回初始密码，首次登录必须修改
+	rows, _ = ParseUserImportCSV(strings.NewReader(valid))
+	result, err = svc.ImportUsers(rows, UserImportOptions{ResolveCourse: resolve})
+	if err != nil || result.Created != 2 {
+		t.Fatalf("import failed: %+v, %v", result, err)
+	}
+	grace := result.Users[0]
+	if grace.Password == "" || grace.Role != "proofreader" {
+		t.Fatalf("unexpected imported row: %+v", grace)
+	}
+	user, err := svc.Login("grace", grace.Password, "")
+	if err != nil || !user.MustChangePassword {
+		t.Fatalf("expected initial password to require a change: %+v, %v", user, err)
+	}
+	if courses, _ := svc.GetUserCourses(grace.UserID); len(courses) != 2 {
+		t.Fatalf("expected 2 course grants, got %v", courses)
+	}
+
+	// 导出包含课程权限，可以作为导入模板
+	var out strings.Builder
+	if err := svc.ExportUsersCSV(&out); err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	exported := out.String()
+	if !strings.HasPrefix(exported, "id,username,display_name,role,kind,disabled,courses,created_at\n") ||
+		!strings.Contains(exported, ",grace,Grace,proofreader,human,false,10;20,") ||
+		!strings.Contains(exported, `"Heidi, H."`) {
+		t.Fatalf("unexpected export:\n%s", exported)
+	}
+	rows, err = ParseUserImportCSV(strings.NewReader(exported))
+	if err != nil || len(rows) != 3 || rows[1].Username != "grace" || len(rows[1].Courses) != 2 {
+		t.Fatalf("expected export to parse as import file: %+v, %v", rows, err)
+	}
+}
+
+func TestResolveOIDCUserLinksOnlyVerifiedNonAdminAccounts(t *testing.T) {
+	db := setupUserDB(t)
+	if err := db.AutoMigrate(&database.UserIdentity{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	svc := NewUserService(db)
+	for _, u := range []struct{ name, role string }{
+		{"root@example.com", "super_admin"},
+		{"rita@example.com", "course_admin"},
+		{"pat@example.com", "proofreader"},
+	} {
+		if _, err := svc.CreateUser(u.name, "Secret-pass-9", u.role, nil); err != nil {
+			t.Fatalf("create user %s: %v", u.name, err)
+		}
+	}
+	identity := func(sub, email string, verified bool) *auth.OIDCIdentity {
+		return &auth.OIDCIdentity{
+			Issuer:        "https://idp.example.com",
+			Subject:       sub,
+			Email:         email,
+			EmailVerified: verified,
+			Claims:        map[string]interface{}{"sub": sub, "preferred_username": email, "email": email},
+		}
+	}
+	link := OIDCProvisioning{LinkExisting: true}
+
+	cases := []struct {
+		name     string
+		identity *auth.OIDCIdentity
+		opts     OIDCProvisioning
+		wantUser string
+	}{
+		{"默认不绑定已有账号", identity("s-1", "pat@example.com", true), OIDCProvisioning{}, ""},
+		{"超级管理员不自动绑定", identity("s-2", "root@example.com", true), link, ""},
+		{"课程管理员不自动绑定", identity("s-3", "rita@example.com", true), link, ""},
+		{"邮箱未验证时不绑定", identity("s-4", "pat@example.com", false), link, ""},
+		{"用户名与邮箱不一致时不绑定", &auth.OIDCIdentity{Issuer: "https://idp.example.com", Subject: "s-5", Email: "other@example.com", EmailVerified: true,
+			Claims: map[string]interface{}{"preferred_username": "pat@example.com"}}, link, ""},
+		{"已验证邮箱绑定普通账号", identity("s-6", "pat@example.com", true), link, "pat@example.com"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			user, err := svc.ResolveOIDCUser(tc.identity, tc.opts)
+			if tc.wantUser == "" {
+				if !errors.Is(err, ErrOIDCUserNotProvisioned) {
+					t.Fatalf("expected identity not to be linked, got user=%v err=%v", user, err)
+				}
+				return
+			}
+			if err != nil || user.Username != tc.wantUser {
+				t.Fatalf("expected link to %s, got user=%v err=%v", tc.wantUser, user, err)
+			}
+		})
+	}
+
+	var links int64
+	db.Model(&database.UserIdentity{}).Count(&links)
+	if links != 1 {
+		t.Fatalf("expected only the verified proofreader identity to be linked, got %d links", links)
+	}
+}
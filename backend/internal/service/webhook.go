@@ -0,0 +1,735 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+var (
+	// ErrWebhookNotFound webhook 订阅不存在
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrWebhookDeliveryNotFound 投递记录不存在
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	// ErrInvalidWebhook 订阅参数不合法
+	ErrInvalidWebhook = errors.New("invalid webhook")
+)
+
+// 投递请求头
+const (
+	WebhookHeaderEvent     = "X-YDMS-Event"
+	WebhookHeaderDelivery  = "X-YDMS-Delivery"
+	WebhookHeaderTimestamp = "X-YDMS-Timestamp"
+	WebhookHeaderSignature = "X-YDMS-Signature"
+)
+
+// WebhookOptions webhook 投递配置
+type WebhookOptions struct {
+	Workers      int           // 并发投递数
+	PollInterval time.Duration // 没有新投递通知时轮询数据库的间隔
+	Timeout      time.Duration // 单次 HTTP 请求超时
+	MaxAttempts  int           // 最多投递次数，用尽后进入死信列表
+	BaseBackoff  time.Duration // 首次重试等待时间，之后每次翻倍
+	MaxBackoff   time.Duration // 重试等待时间上限
+	Retention    time.Duration // 投递成功的记录保留时长，死信不自动清理
+	// AllowPrivateTargets 允许投递到回环、链路本地与内网地址，仅用于订阅方部署在内网的场景
+	AllowPrivateTargets bool
+}
+
+// DefaultWebhookOptions 返回默认的投递配置：8 次投递，重试间隔 30s 起翻倍，最长 1 小时
+func DefaultWebhookOptions() WebhookOptions {
+	return WebhookOptions{
+		Workers:      2,
+		PollInterval: 5 * time.Second,
+		Timeout:      10 * time.Second,
+		MaxAttempts:  8,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   time.Hour,
+		Retention:    7 * 24 * time.Hour,
+	}
+}
+
+// WebhookInput 创建 webhook 订阅的参数
+type WebhookInput struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`      // 为空时自动生成
+	EventTypes []string `json:"event_types"` // 为空表示全部；支持 "document.*" 形式的前缀
+	CourseIDs  []int64  `json:"course_ids"`  // 为空表示全部课程
+	Active     *bool    `json:"active"`
+}
+
+// WebhookUpdate 更新 webhook 订阅的参数，nil 字段保持不变
+type WebhookUpdate struct {
+	Name         *string   `json:"name"`
+	URL          *string   `json:"url"`
+	EventTypes   *[]string `json:"event_types"`
+	CourseIDs    *[]int64  `json:"course_ids"`
+	Active       *bool     `json:"active"`
+	RotateSecret bool      `json:"rotate_secret"` // 生成新的签名密钥并在响应中返回一次
+}
+
+// WebhookView webhook 订阅详情
+type WebhookView struct {
+	database.WebhookSubscription
+	EventTypes []string `json:"event_types"`
+	CourseIDs  []int64  `json:"course_ids"`
+	Secret     string   `json:"secret,omitempty"` // 仅在创建与轮换密钥时返回
+}
+
+// WebhookDeliveryView 投递记录详情
+type WebhookDeliveryView struct {
+	database.WebhookDelivery
+	Payload json.RawMessage `json:"payload"`
+}
+
+// WebhookService 管理 webhook 订阅，并把变更事件可靠地投递给订阅方
+type WebhookService struct {
+	db       *gorm.DB
+	opts     WebhookOptions
+	client   *http.Client
+	workerID string
+
+	wake      chan struct{}
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	closeOnce sync.Once
+}
+
+// NewWebhookService 创建 webhook 服务，调用 Start 后开始投递
+func NewWebhookService(db *gorm.DB, opts WebhookOptions) *WebhookService {
+	defaults := DefaultWebhookOptions()
+	if opts.Workers <= 0 {
+		opts.Workers = defaults.Workers
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaults.PollInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaults.Timeout
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaults.MaxAttempts
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = defaults.BaseBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaults.MaxBackoff
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = defaults.Retention
+	}
+	hostname, _ := os.Hostname()
+	return &WebhookService{
+		db:       db,
+		opts:     opts,
+		client:   newWebhookClient(opts),
+		workerID: fmt.Sprintf("%s/%s", hostname, uuid.NewString()[:8]),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+// CreateWebhook 创建订阅；未提供密钥时生成随机密钥，密钥只在本次响应中返回
+func (s *WebhookService) CreateWebhook(input WebhookInput, createdByID uint) (*WebhookView, error) {
+	if err := s.validateWebhookURL(input.URL); err != nil {
+		return nil, err
+	}
+	eventTypes, err := encodeWebhookEventTypes(input.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+	courseIDs, err := encodeWebhookCourses(input.CourseIDs)
+	if err != nil {
+		return nil, err
+	}
+	secret := strings.TrimSpace(input.Secret)
+	if secret == "" {
+		if secret, err = generateWebhookSecret(); err != nil {
+			return nil, err
+		}
+	} else if len(secret) < 16 || len(secret) > 128 {
+		return nil, fmt.Errorf("%w: secret must be 16-128 characters", ErrInvalidWebhook)
+	}
+
+	sub := &database.WebhookSubscription{
+		Name:        strings.TrimSpace(input.Name),
+		URL:         strings.TrimSpace(input.URL),
+		Secret:      secret,
+		EventTypes:  eventTypes,
+		CourseIDs:   courseIDs,
+		Active:      input.Active == nil || *input.Active,
+		CreatedByID: createdByID,
+	}
+	if err := s.db.Create(sub).Error; err != nil {
+		return nil, fmt.Errorf("create webhook: %w", err)
+	}
+	log.Printf("[webhooks] created subscription=%d url=%s", sub.ID, sub.URL)
+	view := webhookView(*sub)
+	view.Secret = secret
+	return &view, nil
+}
+
+// ListWebhooks 列出全部订阅
+func (s *WebhookService) ListWebhooks() ([]WebhookView, error) {
+	var subs []database.WebhookSubscription
+	if err := s.db.Order("id").Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	views := make([]WebhookView, len(subs))
+	for i, sub := range subs {
+		views[i] = webhookView(sub)
+	}
+	return views, nil
+}
+
+// GetWebhook 查询订阅
+func (s *WebhookService) GetWebhook(id uint) (*WebhookView, error) {
+	sub, err := s.loadWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	view := webhookView(*sub)
+	return &view, nil
+}
+
+// UpdateWebhook 更新订阅
+func (s *WebhookService) UpdateWebhook(id uint, update WebhookUpdate) (*WebhookView, error) {
+	sub, err := s.loadWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	if update.Name != nil {
+		sub.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.URL != nil {
+		if err := s.validateWebhookURL(*update.URL); err != nil {
+			return nil, err
+		}
+		sub.URL = strings.TrimSpace(*update.URL)
+	}
+	if update.EventTypes != nil {
+		if sub.EventTypes, err = encodeWebhookEventTypes(*update.EventTypes); err != nil {
+			return nil, err
+		}
+	}
+	if update.CourseIDs != nil {
+		if sub.CourseIDs, err = encodeWebhookCourses(*update.CourseIDs); err != nil {
+			return nil, err
+		}
+	}
+	if update.Active != nil {
+		sub.Active = *update.Active
+	}
+	if update.RotateSecret {
+		if sub.Secret, err = generateWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.db.Save(sub).Error; err != nil {
+		return nil, fmt.Errorf("update webhook: %w", err)
+	}
+	view := webhookView(*sub)
+	if update.RotateSecret {
+		view.Secret = sub.Secret
+	}
+	return &view, nil
+}
+
+// DeleteWebhook 删除订阅及其投递记录
+func (s *WebhookService) DeleteWebhook(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&database.WebhookSubscription{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrWebhookNotFound
+		}
+		return tx.Where("subscription_id = ?", id).Delete(&database.WebhookDelivery{}).Error
+	})
+}
+
+// ListDeliveries 查询投递历史，subscriptionID 为 0 时不限订阅；status 为空时不限状态
+func (s *WebhookService) ListDeliveries(subscriptionID uint, status string, limit int) ([]WebhookDeliveryView, error) {
+	if subscriptionID != 0 {
+		if _, err := s.loadWebhook(subscriptionID); err != nil {
+			return nil, err
+		}
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	query := s.db.Order("id DESC").Limit(limit)
+	if subscriptionID != 0 {
+		query = query.Where("subscription_id = ?", subscriptionID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var deliveries []database.WebhookDelivery
+	if err := query.Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	views := make([]WebhookDeliveryView, len(deliveries))
+	for i, delivery := range deliveries {
+		views[i] = WebhookDeliveryView{WebhookDelivery: delivery, Payload: json.RawMessage(delivery.Payload)}
+	}
+	return views, nil
+}
+
+// Redeliver 重新投递一条记录（通常来自死信列表），重置投递次数
+func (s *WebhookService) Redeliver(id uint) (*WebhookDeliveryView, error) {
+	now := time.Now()
+	res := s.db.Model(&database.WebhookDelivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          database.WebhookDeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": now,
+		"last_error":      "",
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	s.notify()
+	var delivery database.WebhookDelivery
+	if err := s.db.First(&delivery, id).Error; err != nil {
+		return nil, err
+	}
+	return &WebhookDeliveryView{WebhookDelivery: delivery, Payload: json.RawMessage(delivery.Payload)}, nil
+}
+
+// HandleEvent 为匹配的订阅写入待投递记录；作为 EventBroker 的 hook 在变更请求中同步执行，
+// 事件在请求返回前已持久化，进程重启后仍会投递
+func (s *WebhookService) HandleEvent(event Event) {
+	var subs []database.WebhookSubscription
+	if err := s.db.Where("active = ?", true).Find(&subs).Error; err != nil {
+		log.Printf("[webhooks] load subscriptions failed: %v", err)
+		return
+	}
+	var payload []byte
+	now := time.Now()
+	deliveries := make([]database.WebhookDelivery, 0, len(subs))
+	for _, sub := range subs {
+		if !webhookMatches(sub, event) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(event); err != nil {
+				log.Printf("[webhooks] encode event %s failed: %v", event.Type, err)
+				return
+			}
+		}
+		deliveries = append(deliveries, database.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventType:      event.Type,
+			Payload:        string(payload),
+			Status:         database.WebhookDeliveryPending,
+			NextAttemptAt:  &now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	if err := s.db.Create(&deliveries).Error; err != nil {
+		log.Printf("[webhooks] enqueue %s failed: %v", event.Type, err)
+		return
+	}
+	s.notify()
+}
+
+// Start 启动投递 worker；重启前未完成的投递在租约到期后继续
+func (s *WebhookService) Start() {
+	s.startOnce.Do(func() {
+		for i := 0; i < s.opts.Workers; i++ {
+			s.wg.Add(1)
+			go s.worker()
+		}
+		s.wg.Add(1)
+		go s.pruneLoop()
+		log.Printf("[webhooks] started %d workers id=%s", s.opts.Workers, s.workerID)
+	})
+}
+
+// Close 停止领取新的投递并等待进行中的请求完成
+func (s *WebhookService) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *WebhookService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *WebhookService) worker() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			sent, err := s.DeliverNext(context.Background())
+			if err != nil {
+				log.Printf("[webhooks] worker error: %v", err)
+				break
+			}
+			if !sent {
+				break
+			}
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *WebhookService) pruneLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			res := s.db.Where("status = ? AND delivered_at < ?", database.WebhookDeliveryDelivered, time.Now().Add(-s.opts.Retention)).
+				Delete(&database.WebhookDelivery{})
+			if res.Error != nil {
+				log.Printf("[webhooks] prune deliveries failed: %v", res.Error)
+			} else if res.RowsAffected > 0 {
+				log.Printf("[webhooks] pruned %d delivered records", res.RowsAffected)
+			}
+		}
+	}
+}
+
+// DeliverNext 领取并投递一条到期的记录，没有到期记录时返回 false
+func (s *WebhookService) DeliverNext(ctx context.Context) (bool, error) {
+	delivery, err := s.claim()
+	if err != nil || delivery == nil {
+		return false, err
+	}
+	s.deliver(ctx, delivery)
+	return true, nil
+}
+
+// claim 以条件更新领取一条到期的投递，并把下次投递时间推后作为租约，多实例部署时不会重复投递
+func (s *WebhookService) claim() (*database.WebhookDelivery, error) {
+	now := time.Now()
+	var candidates []database.WebhookDelivery
+	err := s.db.Select("id", "attempts").
+		Where("status = ? AND next_attempt_at <= ?", database.WebhookDeliveryPending, now).
+		Order("next_attempt_at, id").Limit(5).Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		res := s.db.Model(&database.WebhookDelivery{}).
+			Where("id = ? AND status = ? AND attempts = ?", candidate.ID, database.WebhookDeliveryPending, candidate.Attempts).
+			Updates(map[string]interface{}{
+				"attempts":        candidate.Attempts + 1,
+				"next_attempt_at": now.Add(2 * s.opts.Timeout),
+			})
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			continue // 已被其他 worker 领取
+		}
+		var delivery database.WebhookDelivery
+		if err := s.db.First(&delivery, candidate.ID).Error; err != nil {
+			return nil, err
+		}
+		return &delivery, nil
+	}
+	return nil, nil
+}
+
+func (s *WebhookService) deliver(ctx context.Context, delivery *database.WebhookDelivery) {
+	var sub database.WebhookSubscription
+	if err := s.db.First(&sub, delivery.SubscriptionID).Error; err != nil || !sub.Active {
+		s.finishDelivery(delivery, 0, errors.New("subscription deleted or disabled"), true)
+		return
+	}
+
+	status, err := s.post(ctx, sub, delivery)
+	s.finishDelivery(delivery, status, err, false)
+}
+
+// post 发送签名后的请求；签名为 HMAC-SHA256(secret, timestamp + "." + body) 的十六进制
+func (s *WebhookService) post(ctx context.Context, sub database.WebhookSubscription, delivery *database.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "YDMS-Webhook/1")
+	req.Header.Set(WebhookHeaderEvent, delivery.EventType)
+	req.Header.Set(WebhookHeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(WebhookHeaderTimestamp, timestamp)
+	req.Header.Set(WebhookHeaderSignature, "sha256="+SignWebhookPayload(sub.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver returned %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	return resp.StatusCode, nil
+}
+
+func (s *WebhookService) finishDelivery(delivery *database.WebhookDelivery, status int, cause error, final bool) {
+	now := time.Now()
+	updates := map[string]interface{}{"response_status": status}
+	switch {
+	case cause == nil:
+		updates["status"] = database.WebhookDeliveryDelivered
+		updates["delivered_at"] = now
+		updates["next_attempt_at"] = nil
+		updates["last_error"] = ""
+	case final || delivery.Attempts >= s.opts.MaxAttempts:
+		updates["status"] = database.WebhookDeliveryDead
+		updates["next_attempt_at"] = nil
+		updates["last_error"] = cause.Error()
+		log.Printf("[webhooks] delivery=%d subscription=%d dead after %d attempts: %v", delivery.ID, delivery.SubscriptionID, delivery.Attempts, cause)
+	default:
+		updates["next_attempt_at"] = now.Add(s.backoff(delivery.Attempts))
+		updates["last_error"] = cause.Error()
+	}
+	if err := s.db.Model(&database.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		log.Printf("[webhooks] update delivery=%d failed: %v", delivery.ID, err)
+	}
+}
+
+// backoff 第 attempts 次投递失败后的等待时间
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	wait := s.opts.BaseBackoff
+	for i := 1; i < attempts && wait < s.opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > s.opts.MaxBackoff {
+		wait = s.opts.MaxBackoff
+	}
+	return wait
+}
+
+// SignWebhookPayload 计算投递签名，接收方用同样的方式校验 X-YDMS-Signature
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *WebhookService) loadWebhook(id uint) (*database.WebhookSubscription, error) {
+	var sub database.WebhookSubscription
+	if err := s.db.First(&sub, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func webhookView(sub database.WebhookSubscription) WebhookView {
+	view := WebhookView{WebhookSubscription: sub, EventTypes: []string{}, CourseIDs: []int64{}}
+	if sub.EventTypes != "" {
+		_ = json.Unmarshal([]byte(sub.EventTypes), &view.EventTypes)
+	}
+	if sub.CourseIDs != "" {
+		_ = json.Unmarshal([]byte(sub.CourseIDs), &view.CourseIDs)
+	}
+	return view
+}
+
+// webhookMatches 判断事件是否符合订阅的事件类型与课程条件
+func webhookMatches(sub database.WebhookSubscription, event Event) bool {
+	view := webhookView(sub)
+	if len(view.EventTypes) > 0 {
+		matched := false
+		for _, pattern := range view.EventTypes {
+			if pattern == event.Type || (strings.HasSuffix(pattern, ".*") && strings.HasPrefix(event.Type, strings.TrimSuffix(pattern, "*"))) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(view.CourseIDs) > 0 {
+		for _, course := range event.Courses {
+			if containsInt(view.CourseIDs, course) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// validateWebhookURL 校验订阅地址；地址为 IP 时在此拒绝内网地址，域名在投递连接时按解析结果校验
+func (s *WebhookService) validateWebhookURL(raw string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidWebhook)
+	}
+	if s.opts.AllowPrivateTargets {
+		return nil
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("%w: %s", ErrInvalidWebhook, errWebhookTargetBlocked)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && webhookAddrBlocked(addr) {
+		return fmt.Errorf("%w: %s", ErrInvalidWebhook, errWebhookTargetBlocked)
+	}
+	return nil
+}
+
+// errWebhookTargetBlocked 订阅地址指向回环、链路本地或内网地址
+var errWebhookTargetBlocked = errors.New("webhook target resolves to a loopback, link-local or private address")
+
+// cgnatPrefix 运营商级 NAT 地址段，netip 不将其视为私有地址
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// webhookAddrBlocked 判断投递目标地址是否属于禁止访问的地址段
+func webhookAddrBlocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() || cgnatPrefix.Contains(addr)
+}
+
+// newWebhookClient 创建投递用的 HTTP 客户端：不跟随重定向，不使用代理；
+// 在建立连接时校验实际连接的地址，DNS 解析到内网地址（包括 DNS rebinding）时拒绝连接
+func newWebhookClient(opts WebhookOptions) *http.Client {
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+	if !opts.AllowPrivateTargets {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || webhookAddrBlocked(addr) {
+				return errWebhookTargetBlocked
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: opts.Timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		// 重定向可能把投递引向内网地址，3xx 按投递失败处理
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func encodeWebhookEventTypes(types []string) (string, error) {
+	cleaned := make([]string, 0, len(types))
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		known := false
+		for _, eventType := range EventTypes {
+			if t == eventType || (strings.HasSuffix(t, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(t, "*"))) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return "", fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, t)
+		}
+		cleaned = append(cleaned, t)
+	}
+	if len(cleaned) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(cleaned)
+	return string(data), err
+}
+
+func encodeWebhookCourses(courses []int64) (string, error) {
+	if len(courses) == 0 {
+		return "", nil
+	}
+	for _, id := range courses {
+		if id <= 0 {
+			return "", fmt.Errorf("%w: invalid course id %d", ErrInvalidWebhook, id)
+		}
+	}
+	data, err := json.Marshal(courses)
+	return string(data), err
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
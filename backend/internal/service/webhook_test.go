@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/yjxt/ydms/backend/internal/cache"
+	"github.com/yjxt/ydms/backend/internal/database"
+)
+
+func setupWebhookDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&database.WebhookSubscription{}, &database.WebhookDelivery{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+// webhookReceiver 记录收到的请求，按 statuses 依次返回状态码（用完后返回 200）
+type webhookReceiver struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	statuses []int
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	if len(r.statuses) > 0 {
+		status := r.statuses[0]
+		r.statuses = r.statuses[1:]
+		http.Error(w, "receiver unavailable", status)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestWebhookDeliversSignedCourseEvents(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhooks := NewWebhookService(setupWebhookDB(t), WebhookOptions{AllowPrivateTargets: true})
+	svc := NewService(cache.NewNoop(), newCopySourceNDR(), nil)
+	broker := NewEventBroker(16)
+	broker.AddHook(webhooks.HandleEvent)
+	svc.SetEventBroker(broker)
+
+	if _, err := webhooks.CreateWebhook(WebhookInput{URL: "ftp://example.com"}, 1); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("expected invalid url to be rejected, got %v", err)
+	}
+	if _, err := webhooks.CreateWebhook(WebhookInput{URL: server.URL, EventTypes: []string{"course.created"}}, 1); !errors.Is(err, ErrInvalidWebhook) {
+		t.Fatalf("expected unknown event type to be rejected, got %v", err)
+	}
+	sub, err := webhooks.CreateWebhook(WebhookInput{
+		Name:       "course 1 categories",
+		URL:        server.URL,
+		EventTypes: []string{"category.*"},
+		CourseIDs:  []int64{1},
+	}, 1)
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	if len(sub.Secret) != 64 || !sub.Active {
+		t.Fatalf("expected generated secret and active subscription, got %+v", sub)
+	}
+	if listed, _ := webhooks.GetWebhook(sub.ID); listed.Secret != "" {
+		t.Fatalf("secret must only be returned on create")
+	}
+
+	meta := RequestMeta{UserID: "alice", RequestID: "req-1"}
+	created, err := svc.CreateCategory(context.Background(), meta, CategoryCreateRequest{Name: "Chapter 2", ParentID: ptr(int64(1))})
+	if err != nil {
+		t.Fatalf("CreateCategory: %v", err)
+	}
+	// 其他课程与文档事件不匹配订阅条件
+	broker.Publish(Event{Type: EventCategoryCreated, Courses: []int64{5}})
+	broker.Publish(Event{Type: EventDocumentUpdated, Courses: []int64{1}})
+
+	pending, _ := webhooks.ListDeliveries(sub.ID, database.WebhookDeliveryPending, 0)
+	if len(pending) != 1 || pending[0].EventType != EventCategoryCreated {
+		t.Fatalf("expected one pending delivery, got %+v", pending)
+	}
+	if sent, err := webhooks.DeliverNext(context.Background()); !sent || err != nil {
+		t.Fatalf("DeliverNext: sent=%v err=%v", sent, err)
+	}
+	if sent, _ := webhooks.DeliverNext(context.Background()); sent {
+		t.Fatalf("expected no further deliveries")
+	}
+
+	req, body := receiver.requests[0], receiver.bodies[0]
+	signature := "sha256=" + SignWebhookPayload(sub.Secret, req.Header.Get(WebhookHeaderTimestamp), body)
+	if req.Header.Get(WebhookHeaderSignature) != signature || req.Header.Get(WebhookHeaderEvent) != EventCategoryCreated {
+		t.Fatalf("unexpected webhook headers %v", req.Header)
+	}
+	var event struct {
+		Type      string   `json:"type"`
+		Courses   []int64  `json:"courses"`
+		RequestID string   `json:"request_id"`
+		Data      Category `json:"data"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if event.Data.ID != created.ID || event.RequestID != "req-1" || len(event.Courses) != 1 || event.Courses[0] != 1 {
+		t.Fatalf("unexpected payload %s", body)
+	}
+	delivered, _ := webhooks.ListDeliveries(sub.ID, database.WebhookDeliveryDelivered, 0)
+	if len(delivered) != 1 || delivered[0].Attempts != 1 || delivered[0].DeliveredAt == nil || delivered[0].ResponseStatus != http.StatusNoContent {
+		t.Fatalf("unexpected delivery history %+v", delivered)
+	}
+}
+
+func TestWebhookRetriesThenDeadLetters(t *testing.T) {
+	receiver := &webhookReceiver{statuses: []int{http.StatusBadGateway, http.StatusInternalServerError}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhooks := NewWebhookService(setupWebhookDB(t), WebhookOptions{MaxAttempts: 2, BaseBackoff: time.Nanosecond, AllowPrivateTargets: true})
+	sub, err := webhooks.CreateWebhook(WebhookInput{URL: server.URL}, 1)
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	webhooks.HandleEvent(Event{ID: 1, Type: EventDocumentDeleted})
+
+	for i := 0; i < 2; i++ {
+		if sent, err := webhooks.DeliverNext(context.Background()); !sent || err != nil {
+			t.Fatalf("attempt %d: sent=%v err=%v", i+1, sent, err)
+		}
+	}
+	if sent, _ := webhooks.DeliverNext(context.Background()); sent {
+		t.Fatalf("expected delivery to stop after max attempts")
+	}
+	dead, _ := webhooks.ListDeliveries(0, database.WebhookDeliveryDead, 0)
+	if len(dead) != 1 || dead[0].Attempts != 2 || dead[0].ResponseStatus != http.StatusInternalServerError || dead[0].LastError == "" {
+		t.Fatalf("unexpected dead letters %+v", dead)
+	}
+
+	// 重新投递后接收方恢复
+	if _, err := webhooks.Redeliver(dead[0].ID); err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	if sent, err := webhooks.DeliverNext(context.Background()); !sent || err != nil {
+		t.Fatalf("redeliver: sent=%v err=%v", sent, err)
+	}
+	if delivered, _ := webhooks.ListDeliveries(sub.ID, database.WebhookDeliveryDelivered, 0); len(delivered) != 1 {
+		t.Fatalf("expected redelivered record to succeed, got %+v", delivered)
+	}
+	if len(receiver.requests) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(receiver.requests))
+	}
+
+	// 停用的订阅不再产生投递
+	if _, err := webhooks.UpdateWebhook(sub.ID, WebhookUpdate{Active: ptr(false)}); err != nil {
+		t.Fatalf("UpdateWebhook: %v", err)
+	}
+	webhooks.HandleEvent(Event{ID: 2, Type: EventDocumentDeleted})
+	if pending, _ := webhooks.ListDeliveries(sub.ID, database.WebhookDeliveryPending, 0); len(pending) != 0 {
+		t.Fatalf("expected no deliveries for inactive subscription, got %+v", pending)
+	}
+	if webhooks.backoff(1) != time.Nanosecond || webhooks.backoff(3) != 4*time.Nanosecond {
+		t.Fatalf("unexpected backoff")
+	}
+}
+
+func TestWebhookRejectsPrivateTargetsAndRedirects(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	redirector := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+	defer redirector.Close()
+
+	webhooks := NewWebhookService(setupWebhookDB(t), WebhookOptions{})
+	for _, target := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.1.2.3/hook",
+		"http://[::1]/hook",
+		"http://[::ffff:192.168.0.1]/hook",
+		"http://localhost:9000/hook",
+	} {
+		if _, err := webhooks.CreateWebhook(WebhookInput{URL: target}, 1); !errors.Is(err, ErrInvalidWebhook) {
+			t.Fatalf("expected %s to be rejected, got %v", target, err)
+		}
+	}
+	// 域名在连接时按解析结果校验
+	if _, err := webhooks.client.Get(server.URL); !errors.Is(err, errWebhookTargetBlocked) {
+		t.Fatalf("expected connection to a loopback address to be refused, got %v", err)
+	}
+
+	// 允许内网地址时仍不跟随重定向
+	internal := NewWebhookService(setupWebhookDB(t), WebhookOptions{MaxAttempts: 1, AllowPrivateTargets: true})
+	if _, err := internal.CreateWebhook(WebhookInput{URL: redirector.URL}, 1); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	internal.HandleEvent(Event{ID: 1, Type: EventDocumentDeleted})
+	if sent, err := internal.DeliverNext(context.Background()); !sent || err != nil {
+		t.Fatalf("DeliverNext: sent=%v err=%v", sent, err)
+	}
+	dead, _ := internal.ListDeliveries(0, database.WebhookDeliveryDead, 0)
+	if len(dead) != 1 || dead[0].ResponseStatus != http.StatusFound || len(receiver.requests) != 0 {
+		t.Fatalf("expected redirect to fail the delivery, got %+v requests=%d", dead, len(receiver.requests))
+	}
+}
@@ -57,6 +57,7 @@ export interface DocumentCreatePayload {
   title: string;
   type?: string;
   position?: number;
+  node_id?: number;
   metadata?: Record<string, unknown>;
   content?: Record<string, unknown>;
 }
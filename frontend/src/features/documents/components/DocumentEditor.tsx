@@ -35,7 +35,6 @@ import { YAMLPreview } from "./YAMLPreview";
 import { resolveYamlPreview } from "../previewRegistry";
 import { useDocumentTagCache } from "../hooks/useDocumentTagCache";
 import {
-  bindDocument,
   createDocument,
   getDocumentDetail,
   updateDocument,
@@ -466,6 +465,7 @@ export const DocumentEditor: FC<DocumentEditorProps> = ({ mode, docId: docIdProp
         title: title.trim(),
         type: documentType,
         position,
+        node_id: effectiveNodeId,
         content: template
           ? {
               format: template.format,
@@ -478,9 +478,8 @@ export const DocumentEditor: FC<DocumentEditorProps> = ({ mode, docId: docIdProp
         payload.metadata = metadataPayload;
       }
 
-      const doc = await createDocument(payload);
-      await bindDocument(effectiveNodeId, doc.id);
-      return doc;
+      // 创建时直接绑定节点，标签按该课程的词表归一化，不会产生第二个版本
+      return createDocument(payload);
     },
     onSuccess: async (_doc) => {
       message.success("文档创建成功");